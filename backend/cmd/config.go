@@ -1,35 +1,478 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/apikeys"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
 	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/collections"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/compliance"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/events"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/fraud"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geocode"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/handlers"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/impact"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/invoices"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
 	"github.com/Doreen-Onyango/zingiratech/backend/internal/middlewares"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/notifications"
+	notifysandbox "github.com/Doreen-Onyango/zingiratech/backend/internal/notifications/sandbox"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/opendata"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments/sandbox"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/photos"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/referrals"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/reminders"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
 	"github.com/Doreen-Onyango/zingiratech/backend/internal/routes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/routing"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/serviceareas"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
 	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/webhooks"
 )
 
-// Config initializes the application configuration and returns a configured http.Handler.
-func Config(authService *auth.AuthService) (http.Handler, error) {
+// jobWorkers is how many background jobs run at once.
+const jobWorkers = 4
+
+// Config initializes the application configuration and returns a configured
+// http.Handler, along with a function that stops background work and waits
+// for running jobs to finish when the server shuts down.
+func Config(authService *auth.AuthService) (http.Handler, func(context.Context) error, error) {
 	// Load templates
 	if err := utils.LoadTemplates(); err != nil {
-		return nil, fmt.Errorf("error loading templates: %w", err)
+		return nil, nil, fmt.Errorf("error loading templates: %w", err)
 	}
 	log.Println("Templates loaded successfully.")
 
+	// Open the data store
+	db, err := openStore()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening data store: %w", err)
+	}
+	log.Println("Data store opened successfully.")
+
+	// Features register their job handlers on the queue as they are set up.
+	jobQueue := jobs.NewQueue(db, jobWorkers)
+
+	// Domain events are recorded with the changes they describe and then
+	// delivered to subscribers. Partners receive them through the signed
+	// webhooks set up below.
+	eventBus := events.NewBus(db, jobQueue)
+
 	// Initialize routes
 	mux := http.NewServeMux()
 	if err := routes.InitRoutes(mux); err != nil {
-		return nil, fmt.Errorf("error initializing routes: %w", err)
+		return nil, nil, fmt.Errorf("error initializing routes: %w", err)
+	}
+
+	ledger := rewards.NewLedger(db)
+	ledger.Subscribe(eventBus.OnPosting)
+	earning := rewards.NewEngine(db, ledger)
+	catalogue := rewards.NewCatalogue(db, ledger)
+	if err := catalogue.Seed(); err != nil {
+		return nil, nil, fmt.Errorf("error seeding rewards catalogue: %w", err)
+	}
+	detector := fraud.NewDetector(db, ledger, catalogue, fraud.DefaultThresholds)
+	catalogue.SetScreen(detector.ScreenRedemption)
+
+	boundaries, err := loadBoundaries()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading county boundaries: %w", err)
+	}
+	areaService := serviceareas.NewService(db, boundaries, serviceareas.DefaultAreas)
+	// Only official boundaries are precise enough to turn pickups away.
+	areaService.SetStrict(os.Getenv("ZINGIRA_BOUNDARIES_FILE") != "")
+	gazetteer, err := loadGazetteer()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading gazetteer: %w", err)
+	}
+
+	itemCatalogue := items.NewService(db)
+	if err := itemCatalogue.Seed(); err != nil {
+		return nil, nil, fmt.Errorf("error seeding item catalogue: %w", err)
+	}
+
+	// The fraud detector must follow the earning engine so it can hold fresh awards.
+	pickupService := pickups.NewService(db)
+	pickupService.AddScreen(areaService.ScreenPickup)
+	pickupService.AddScreen(itemCatalogue.ScreenPickup)
+	pickupService.Subscribe(earning.OnPickupTransition)
+	pickupService.Subscribe(detector.OnPickupTransition)
+
+	impactEngine := impact.NewEngine(db)
+	pickupService.Subscribe(impactEngine.OnPickupTransition)
+	if n, err := impactEngine.Backfill(); err != nil {
+		return nil, nil, fmt.Errorf("error backfilling pickup impact: %w", err)
+	} else if n > 0 {
+		log.Printf("Recorded the impact of %d earlier pickups.", n)
 	}
+
+	// Referral bonuses wait for any fraud review of the referee's first pickup.
+	referralService := referrals.NewService(db, ledger, referrals.DefaultBonuses)
+	pickupService.Subscribe(referralService.OnPickupTransition)
+	detector.Subscribe(referralService.OnCaseResolved)
+	pickupService.Subscribe(eventBus.OnPickupTransition)
+
+	// Residents hear about their pickups once each change commits; failed
+	// deliveries are retried by the job queue.
+	notificationService, err := newNotificationService(db, jobQueue, authService)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring notifications: %w", err)
+	}
+	pickupService.Subscribe(notificationService.OnPickupTransition)
+	if n, err := notificationService.Backfill(); err != nil {
+		return nil, nil, fmt.Errorf("error queueing notifications: %w", err)
+	} else if n > 0 {
+		log.Printf("Queued the deliveries of %d earlier notifications.", n)
+	}
+
+	// Reminders and follow-ups are planned as pickups change and run once due.
+	scheduler := reminders.NewScheduler(db, jobQueue, notificationService, publicURL())
+	pickupService.Subscribe(scheduler.OnPickupTransition)
+	if n, err := scheduler.Backfill(); err != nil {
+		return nil, nil, fmt.Errorf("error planning pickup reminders: %w", err)
+	} else if n > 0 {
+		log.Printf("Planned %d reminders for earlier pickups.", n)
+	}
+
+	paymentService, err := newPaymentService(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring payments: %w", err)
+	}
+
+	quoteSecret, err := secretFromEnv("QUOTES_SIGNING_SECRET")
+	if err != nil {
+		return nil, nil, err
+	}
+	quoteService := quotes.NewService(db, pickupService, quotes.DefaultPriceList, quotes.DefaultHubs, quoteSecret)
+
+	seller, err := sellerFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	invoiceService := invoices.NewService(db, seller, invoices.DefaultVATRate)
+	paymentService.Subscribe(invoiceService.OnPaymentSettled)
+	pickupService.Subscribe(invoiceService.OnPickupTransition)
+
+	photoService, err := newPhotoService(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring photo storage: %w", err)
+	}
+
+	routeService := routing.NewService(db, quotes.DefaultHubs)
+	routeService.SetUnitWeight(itemCatalogue.UnitWeightKg)
+	collectionService := collections.NewService(db, pickupService, photoService)
+
+	// Reports for the last complete month, quarter and year are generated
+	// as soon as the period ends.
+	operator, err := operatorFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	complianceService := compliance.NewService(db, operator)
+	complianceService.Subscribe(eventBus.OnHandover)
+	if err := complianceService.Schedule(jobQueue); err != nil {
+		return nil, nil, fmt.Errorf("error scheduling compliance reports: %w", err)
+	}
+
+	// Partners receive the events they register webhooks for. Endpoints on
+	// this machine are only allowed with WEBHOOKS_ALLOW_LOCAL=1, for
+	// development.
+	webhookService := webhooks.NewService(db, jobQueue, nil)
+	webhookService.SetAllowLocal(devFlag("WEBHOOKS_ALLOW_LOCAL"))
+	webhookService.Subscribe(eventBus)
+	// Partner keys stop working once the partner's certification lapses.
+	apiKeyService := apikeys.NewService(db)
+	apiKeyService.SetPartnerCheck(complianceService.CertifiedTx)
+
+	auditLog := audit.NewLog(db)
+
+	routes.InitAPIRoutes(mux, &routes.API{
+		Rewards:       handlers.NewRewardsHandler(ledger, catalogue),
+		EarningRules:  handlers.NewEarningRulesHandler(earning),
+		Pickups:       handlers.NewPickupsHandler(pickupService),
+		Fraud:         handlers.NewFraudHandler(detector),
+		Referrals:     handlers.NewReferralsHandler(referralService),
+		Payments:      handlers.NewPaymentsHandler(paymentService),
+		Quotes:        handlers.NewQuotesHandler(quoteService),
+		Invoices:      handlers.NewInvoicesHandler(invoiceService),
+		ServiceAreas:  handlers.NewServiceAreasHandler(areaService),
+		Geocode:       handlers.NewGeocodeHandler(gazetteer),
+		Routes:        handlers.NewRoutesHandler(routeService),
+		Collector:     handlers.NewCollectorHandler(routeService, collectionService),
+		Photos:        handlers.NewPhotosHandler(photoService),
+		Items:         handlers.NewItemsHandler(itemCatalogue),
+		Impact:        handlers.NewImpactHandler(impactEngine),
+		Compliance:    handlers.NewComplianceHandler(complianceService),
+		OpenData:      handlers.NewOpenDataHandler(opendata.NewService(impactEngine, opendata.DefaultThresholds)),
+		Notifications: handlers.NewNotificationsHandler(notificationService),
+		Reminders:     handlers.NewRemindersHandler(scheduler),
+		Audit:         handlers.NewAuditHandler(auditLog),
+		Jobs:          handlers.NewJobsHandler(jobQueue),
+		Events:        handlers.NewEventsHandler(eventBus),
+		Webhooks:      handlers.NewWebhooksHandler(webhookService),
+		APIKeys:       handlers.NewAPIKeysHandler(apiKeyService),
+		PartnerKeys:   middlewares.NewPartnerKeys(apiKeyService, authService),
+		Sessions:      authService,
+	})
+
+	csrfSecret, err := secretFromEnv("ADMIN_CSRF_SECRET")
+	if err != nil {
+		return nil, nil, err
+	}
+	console := handlers.NewAdminConsole(authService, pickupService, complianceService, detector, itemCatalogue, catalogue, auditLog, csrfSecret)
+	routes.InitAdminRoutes(mux, console, authService)
 	log.Println("Routes initialized successfully.")
 
 	// Wrap the routes with middleware
-	wrappedMux := middlewares.RouteChecker(mux)
+	wrappedMux := middlewares.RequestID(middlewares.RouteChecker(mux))
 	log.Println("Middleware applied successfully.")
 
+	// Background work starts once everything is configured, job handlers
+	// included, and stops when the returned shutdown function is called.
+	ctx, cancel := context.WithCancel(context.Background())
+	go eventBus.Run(ctx, 10*time.Second)
+	go jobQueue.Run(ctx, 5*time.Second)
+
+	shutdown := func(ctx context.Context) error {
+		cancel()
+		return jobQueue.Drain(ctx)
+	}
+
 	log.Println("HTTP server configured successfully.")
-	return wrappedMux, nil
+	return wrappedMux, shutdown, nil
+}
+
+// openStore opens the data store at ZINGIRA_DATA_FILE, defaulting to backend/data/zingira.json.
+func openStore() (*store.Store, error) {
+	path := os.Getenv("ZINGIRA_DATA_FILE")
+	if path == "" {
+		var err error
+		path, err = utils.GetProjectRootPath("backend", "data", "zingira.json")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return store.Open(path)
+}
+
+// loadBoundaries reads county boundaries from ZINGIRA_BOUNDARIES_FILE, falling
+// back to the simplified boundaries bundled with the application.
+func loadBoundaries() (*geo.Boundaries, error) {
+	if path := os.Getenv("ZINGIRA_BOUNDARIES_FILE"); path != "" {
+		return geo.LoadBoundaries(path)
+	}
+	return geo.DefaultBoundaries()
+}
+
+// loadGazetteer reads address suggestions from ZINGIRA_GAZETTEER_FILE, falling
+// back to the places bundled with the application.
+func loadGazetteer() (*geocode.Gazetteer, error) {
+	if path := os.Getenv("ZINGIRA_GAZETTEER_FILE"); path != "" {
+		return geocode.LoadGazetteer(path)
+	}
+	return geocode.DefaultGazetteer()
+}
+
+// newPhotoService keeps photos under ZINGIRA_PHOTOS_DIR, defaulting to
+// backend/data/photos, and signs their links with PHOTOS_SIGNING_SECRET.
+func newPhotoService(db *store.Store) (*photos.Service, error) {
+	dir := os.Getenv("ZINGIRA_PHOTOS_DIR")
+	if dir == "" {
+		var err error
+		dir, err = utils.GetProjectRootPath("backend", "data", "photos")
+		if err != nil {
+			return nil, err
+		}
+	}
+	storage, err := photos.NewDiskStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := secretFromEnv("PHOTOS_SIGNING_SECRET")
+	if err != nil {
+		return nil, err
+	}
+	return photos.NewService(db, storage, secret), nil
+}
+
+// sellerFromEnv reads the issuer printed on invoices from INVOICE_SELLER_NAME,
+// INVOICE_SELLER_PIN, INVOICE_SELLER_ADDRESS and INVOICE_SELLER_EMAIL. The
+// server refuses to start without a valid seller rather than issue tax
+// invoices under someone else's PIN.
+func sellerFromEnv() (invoices.Party, error) {
+	seller := invoices.Party{
+		Name:    os.Getenv("INVOICE_SELLER_NAME"),
+		TaxPIN:  os.Getenv("INVOICE_SELLER_PIN"),
+		Address: os.Getenv("INVOICE_SELLER_ADDRESS"),
+		Email:   os.Getenv("INVOICE_SELLER_EMAIL"),
+	}
+	if err := invoices.ValidateSeller(seller); err != nil {
+		return invoices.Party{}, fmt.Errorf("INVOICE_SELLER_NAME, INVOICE_SELLER_PIN and INVOICE_SELLER_ADDRESS must be set: %w", err)
+	}
+	return seller, nil
+}
+
+// operatorFromEnv reads the licensed operator printed on compliance returns
+// from COMPLIANCE_OPERATOR_NAME, COMPLIANCE_OPERATOR_LICENCE and
+// COMPLIANCE_OPERATOR_ADDRESS. The server refuses to start without one
+// rather than file returns under a made-up licence.
+func operatorFromEnv() (compliance.Operator, error) {
+	operator := compliance.Operator{
+		Name:    os.Getenv("COMPLIANCE_OPERATOR_NAME"),
+		Licence: os.Getenv("COMPLIANCE_OPERATOR_LICENCE"),
+		Address: os.Getenv("COMPLIANCE_OPERATOR_ADDRESS"),
+	}
+	if err := compliance.ValidateOperator(operator); err != nil {
+		return compliance.Operator{}, fmt.Errorf("COMPLIANCE_OPERATOR_NAME, COMPLIANCE_OPERATOR_LICENCE and COMPLIANCE_OPERATOR_ADDRESS must be set: %w", err)
+	}
+	return operator, nil
+}
+
+// newPaymentService connects payments to Daraja when MPESA_CONSUMER_KEY is set
+// and to a local sandbox when PAYMENTS_SANDBOX=1; with neither it refuses to
+// start, rather than take payments that are never charged.
+// ZINGIRA_PUBLIC_URL is the address the provider calls back on and
+// PAYMENTS_CALLBACK_SECRET signs the callback URLs.
+func newPaymentService(db *store.Store) (*payments.Service, error) {
+	secret := []byte(os.Getenv("PAYMENTS_CALLBACK_SECRET"))
+
+	config := payments.DarajaConfig{
+		BaseURL:        os.Getenv("MPESA_BASE_URL"),
+		ConsumerKey:    os.Getenv("MPESA_CONSUMER_KEY"),
+		ConsumerSecret: os.Getenv("MPESA_CONSUMER_SECRET"),
+		ShortCode:      os.Getenv("MPESA_SHORTCODE"),
+		Passkey:        os.Getenv("MPESA_PASSKEY"),
+	}
+	if config.ConsumerKey != "" {
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("PAYMENTS_CALLBACK_SECRET must be set when MPESA_CONSUMER_KEY is")
+		}
+		if config.BaseURL == "" {
+			config.BaseURL = "https://sandbox.safaricom.co.ke"
+		}
+	} else {
+		if !devFlag("PAYMENTS_SANDBOX") {
+			return nil, fmt.Errorf("MPESA_CONSUMER_KEY must be set, or PAYMENTS_SANDBOX=1 for the local payments sandbox")
+		}
+		server := sandbox.NewServer()
+		server.AutoComplete = 5 * time.Second
+		baseURL, err := server.Start()
+		if err != nil {
+			return nil, err
+		}
+		if secret, err = secretFromEnv("PAYMENTS_CALLBACK_SECRET"); err != nil {
+			return nil, err
+		}
+		config = payments.DarajaConfig{BaseURL: baseURL, ConsumerKey: "sandbox", ConsumerSecret: "sandbox", ShortCode: "174379", Passkey: "sandbox"}
+		log.Printf("PAYMENTS_SANDBOX set; payments complete by themselves in the local sandbox at %s and no money is taken", baseURL)
+	}
+	provider := payments.NewDarajaProvider(config)
+	return payments.NewService(db, provider, publicURL()+"/api/payments/callback", secret), nil
+}
+
+// devFlag reports whether the environment variable name is set to 1. Such
+// flags turn on local stand-ins for external services, which must never be
+// used in production.
+func devFlag(name string) bool {
+	return os.Getenv(name) == "1"
+}
+
+// publicURL is the address the application is reached at from outside, set
+// by ZINGIRA_PUBLIC_URL.
+func publicURL() string {
+	if url := os.Getenv("ZINGIRA_PUBLIC_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080"
+}
+
+// newNotificationService sends email through the SMTP relay at SMTP_ADDR and
+// SMS through Africa's Talking when AT_API_KEY is set. Either falls back to a
+// local sandbox, which keeps messages in memory and logs only who they were
+// for, when NOTIFICATIONS_SANDBOX=1; otherwise the server refuses to start
+// rather than drop every notification.
+func newNotificationService(db *store.Store, queue *jobs.Queue, directory notifications.Directory) (*notifications.Service, error) {
+	smtpConfig := notifications.SMTPConfig{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if smtpConfig.From == "" {
+		smtpConfig.From = "ZingiraTech <no-reply@zingiratech.co.ke>"
+	}
+	sandboxed := devFlag("NOTIFICATIONS_SANDBOX")
+	if smtpConfig.Addr == "" {
+		if !sandboxed {
+			return nil, fmt.Errorf("SMTP_ADDR must be set, or NOTIFICATIONS_SANDBOX=1 for the local mail sink")
+		}
+		sink := notifysandbox.NewSMTPSink()
+		sink.Echo = true
+		addr, err := sink.Start()
+		if err != nil {
+			return nil, err
+		}
+		smtpConfig = notifications.SMTPConfig{Addr: addr, From: smtpConfig.From}
+		log.Printf("SMTP_ADDR not set; using the local SMTP sink at %s", addr)
+	}
+
+	atConfig := notifications.AfricasTalkingConfig{
+		BaseURL:  os.Getenv("AT_BASE_URL"),
+		Username: os.Getenv("AT_USERNAME"),
+		APIKey:   os.Getenv("AT_API_KEY"),
+		SenderID: os.Getenv("AT_SENDER_ID"),
+	}
+	if atConfig.APIKey != "" {
+		if atConfig.Username == "" {
+			return nil, fmt.Errorf("AT_USERNAME must be set when AT_API_KEY is")
+		}
+		if atConfig.BaseURL == "" {
+			atConfig.BaseURL = "https://api.africastalking.com"
+		}
+	} else {
+		if !sandboxed {
+			return nil, fmt.Errorf("AT_API_KEY must be set, or NOTIFICATIONS_SANDBOX=1 for the local SMS sandbox")
+		}
+		server := notifysandbox.NewSMSServer()
+		server.Echo = true
+		baseURL, err := server.Start()
+		if err != nil {
+			return nil, err
+		}
+		atConfig = notifications.AfricasTalkingConfig{BaseURL: baseURL, Username: "sandbox", APIKey: notifysandbox.APIKey}
+		log.Printf("AT_API_KEY not set; using the local SMS sandbox at %s", baseURL)
+	}
+
+	return notifications.NewService(db, queue, directory,
+		notifications.NewSMTPProvider(smtpConfig),
+		notifications.NewAfricasTalkingProvider(atConfig),
+	)
+}
+
+// secretFromEnv returns the signing secret in the environment variable name.
+// When it is unset a random secret is generated, so anything signed with it
+// stops verifying after a restart.
+func secretFromEnv(name string) ([]byte, error) {
+	if value := os.Getenv(name); value != "" {
+		return []byte(value), nil
+	}
+	log.Printf("%s not set; using a random secret for this run", name)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error generating %s: %w", name, err)
+	}
+	return secret, nil
 }
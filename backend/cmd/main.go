@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
 )
 
+// shutdownTimeout is how long in-flight requests and background jobs get to
+// finish once the server is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Initialize Firebase Auth Service
 	authService, err := auth.NewAuthService()
@@ -15,7 +25,7 @@ func main() {
 		log.Fatalf("Failed to initialize Firebase: %v", err)
 	}
 
-	wrapper, err := Config(authService)
+	wrapper, shutdown, err := Config(authService)
 	if err != nil {
 		log.Fatalf("Configuration failed: %v", err)
 	}
@@ -26,7 +36,26 @@ func main() {
 	}
 
 	fmt.Println("Server running on http://localhost:8080")
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server encountered an error: %v", err)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server encountered an error: %v", err)
+		}
+	}()
+
+	// Stop taking requests on SIGINT or SIGTERM, then let the ones in flight
+	// and any running background jobs finish.
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	log.Println("Shutting down...")
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down the HTTP server: %v", err)
+	}
+	if err := shutdown(ctx); err != nil {
+		log.Printf("Background jobs did not finish in time: %v", err)
 	}
+	log.Println("Server stopped.")
 }
@@ -0,0 +1,440 @@
+// Package apikeys lets recycling partners' systems call the API without a
+// user session. A partner's staff issue keys from the partner portal; each
+// key acts for the partner with the scopes it was given, expires, is held
+// to its own rate limit and can be rotated or revoked. Only a hash of each
+// key is stored, so a key cannot be recovered once it has been shown.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets. Hashes map the SHA-256 of each key to its ID, so a key is
+// found without storing it.
+const (
+	keysBucket   = "api_keys"
+	hashesBucket = "api_key_hashes"
+)
+
+// Prefix starts every key, so keys can be told apart from user tokens and
+// found by secret scanners.
+const Prefix = "zk_"
+
+// Scopes a key can be given.
+const (
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+)
+
+// Scopes lists the scopes a key can be given.
+var Scopes = []string{ScopeWebhooksRead, ScopeWebhooksWrite}
+
+// Key states.
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+	StatusRevoked = "revoked"
+)
+
+// Limits on keys. Rate limits are in requests per minute.
+const (
+	DefaultRateLimit    = 120
+	MaxRateLimit        = 1200
+	DefaultLifetimeDays = 90
+	MaxLifetimeDays     = 365
+	maxKeysPerPartner   = 10
+)
+
+// RotationOverlap is how long a rotated key keeps working, so partners can
+// roll the new one out without downtime.
+const RotationOverlap = 24 * time.Hour
+
+// usedInterval is how often the last use of a key is recorded, so that
+// busy keys do not write on every request.
+const usedInterval = time.Minute
+
+var (
+	// ErrNotFound is returned when a key does not exist or belongs to
+	// another partner.
+	ErrNotFound = errors.New("API key not found")
+	// ErrInvalidRequest is returned when a key request fails validation.
+	ErrInvalidRequest = errors.New("invalid API key request")
+	// ErrInvalidKey is returned when a presented key is unknown or revoked.
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrKeyExpired is returned when a presented key has expired.
+	ErrKeyExpired = errors.New("API key has expired")
+	// ErrPartnerInactive is returned when a presented key belongs to a
+	// partner that is no longer registered or certified.
+	ErrPartnerInactive = errors.New("API key's partner is no longer certified")
+)
+
+// Key is an API key, without the key itself. Hint is the start of the key,
+// enough for partners to tell their keys apart.
+type Key struct {
+	ID         string    `json:"id"`
+	PartnerID  string    `json:"partner_id"`
+	Name       string    `json:"name"`
+	Hint       string    `json:"hint"`
+	Scopes     []string  `json:"scopes"`
+	RateLimit  int       `json:"rate_limit"`
+	Status     string    `json:"status"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// status returns the state of the key at now.
+func (k *Key) status(now time.Time) string {
+	switch {
+	case !k.RevokedAt.IsZero():
+		return StatusRevoked
+	case !now.Before(k.ExpiresAt):
+		return StatusExpired
+	default:
+		return StatusActive
+	}
+}
+
+// KeyRequest holds the fields a partner sets on a new key. Zero values get
+// the defaults.
+type KeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	RateLimit     int      `json:"rate_limit"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// PartnerCheck reports whether the partner with the given ID may still use
+// its keys.
+type PartnerCheck func(tx *store.Tx, partnerID string) (bool, error)
+
+// Service issues and checks API keys.
+type Service struct {
+	store   *store.Store
+	now     func() time.Time
+	partner PartnerCheck
+}
+
+// NewService creates an API key service backed by s.
+func NewService(s *store.Store) *Service {
+	return &Service{store: s, now: time.Now}
+}
+
+// SetPartnerCheck makes Authenticate refuse the keys of partners that check
+// reports as no longer active.
+func (s *Service) SetPartnerCheck(check PartnerCheck) {
+	s.partner = check
+}
+
+// validate checks req and returns it with the defaults filled in.
+func validate(req KeyRequest) (KeyRequest, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 80 {
+		return req, fmt.Errorf("%w: name must be 1 to 80 characters", ErrInvalidRequest)
+	}
+	if len(req.Scopes) == 0 {
+		return req, fmt.Errorf("%w: choose at least one scope", ErrInvalidRequest)
+	}
+	seen := map[string]bool{}
+	var scopes []string
+	for _, s := range req.Scopes {
+		known := false
+		for _, k := range Scopes {
+			known = known || k == s
+		}
+		if !known {
+			return req, fmt.Errorf("%w: unknown scope %q", ErrInvalidRequest, s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	req.Scopes = scopes
+	if req.RateLimit == 0 {
+		req.RateLimit = DefaultRateLimit
+	}
+	if req.RateLimit < 1 || req.RateLimit > MaxRateLimit {
+		return req, fmt.Errorf("%w: rate_limit must be between 1 and %d requests a minute", ErrInvalidRequest, MaxRateLimit)
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = DefaultLifetimeDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > MaxLifetimeDays {
+		return req, fmt.Errorf("%w: expires_in_days must be between 1 and %d", ErrInvalidRequest, MaxLifetimeDays)
+	}
+	return req, nil
+}
+
+// newKey returns a random key and the hash it is stored under.
+func newKey() (string, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("error generating API key: %w", err)
+	}
+	key := Prefix + hex.EncodeToString(b)
+	return key, hash(key), nil
+}
+
+// hash returns the SHA-256 of key in hex. Keys are long and random, so a
+// fast hash is enough to make stored hashes useless to an attacker.
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// hint returns the part of key shown in listings.
+func hint(key string) string {
+	return key[:len(Prefix)+6] + "..."
+}
+
+func getKeyTx(tx *store.Tx, partnerID, id string) (*Key, error) {
+	var k Key
+	err := tx.Get(keysBucket, id, &k)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && partnerID != "" && k.PartnerID != partnerID) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func listKeysTx(tx *store.Tx, partnerID string) ([]Key, error) {
+	list := []Key{}
+	err := tx.ForEach(keysBucket, func(id string, raw json.RawMessage) error {
+		var k Key
+		if err := json.Unmarshal(raw, &k); err != nil {
+			return fmt.Errorf("error decoding API key %s: %w", id, err)
+		}
+		if partnerID == "" || k.PartnerID == partnerID {
+			list = append(list, k)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// insertTx stores a new key for partnerID built from req and returns it.
+func (s *Service) insertTx(tx *store.Tx, partnerID, actor string, req KeyRequest, hashed, shown string) (*Key, error) {
+	seq, err := tx.NextSequence(keysBucket)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	k := &Key{
+		ID:        fmt.Sprintf("key_%d", seq),
+		PartnerID: partnerID,
+		Name:      req.Name,
+		Hint:      shown,
+		Scopes:    req.Scopes,
+		RateLimit: req.RateLimit,
+		Status:    StatusActive,
+		ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays),
+		CreatedBy: actor,
+		CreatedAt: now,
+	}
+	if err := tx.Insert(keysBucket, k.ID, k); err != nil {
+		return nil, err
+	}
+	if err := tx.Insert(hashesBucket, hashed, k.ID); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Create issues a key for partnerID and returns it with the key itself,
+// which is only shown here.
+func (s *Service) Create(partnerID, actor string, req KeyRequest) (*Key, string, error) {
+	req, err := validate(req)
+	if err != nil {
+		return nil, "", err
+	}
+	raw, hashed, err := newKey()
+	if err != nil {
+		return nil, "", err
+	}
+	var k *Key
+	err = s.store.Update(func(tx *store.Tx) error {
+		existing, err := listKeysTx(tx, partnerID)
+		if err != nil {
+			return err
+		}
+		active, now := 0, s.now()
+		for i := range existing {
+			if existing[i].status(now) == StatusActive {
+				active++
+			}
+		}
+		if active >= maxKeysPerPartner {
+			return fmt.Errorf("%w: a partner can have at most %d active keys", ErrInvalidRequest, maxKeysPerPartner)
+		}
+		k, err = s.insertTx(tx, partnerID, actor, req, hashed, hint(raw))
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return k, raw, nil
+}
+
+// Rotate issues a replacement for a key with the same name, scopes, rate
+// limit and lifetime, which does not count against the partner's limit. The
+// old key keeps working for RotationOverlap, or until it would have expired
+// if that is sooner. A key can only be rotated once; rotate its replacement
+// instead.
+func (s *Service) Rotate(partnerID, actor, id string) (*Key, string, error) {
+	raw, hashed, err := newKey()
+	if err != nil {
+		return nil, "", err
+	}
+	var k *Key
+	err = s.store.Update(func(tx *store.Tx) error {
+		old, err := getKeyTx(tx, partnerID, id)
+		if err != nil {
+			return err
+		}
+		now := s.now().UTC()
+		if old.status(now) != StatusActive {
+			return fmt.Errorf("%w: only active keys can be rotated", ErrInvalidRequest)
+		}
+		if old.ReplacedBy != "" {
+			return fmt.Errorf("%w: key has already been rotated to %s", ErrInvalidRequest, old.ReplacedBy)
+		}
+		days := int(old.ExpiresAt.Sub(old.CreatedAt).Hours()/24 + 0.5)
+		if days < 1 {
+			days = 1
+		}
+		req := KeyRequest{Name: old.Name, Scopes: old.Scopes, RateLimit: old.RateLimit, ExpiresInDays: days}
+		if overlap := now.Add(RotationOverlap); overlap.Before(old.ExpiresAt) {
+			old.ExpiresAt = overlap
+		}
+		if k, err = s.insertTx(tx, old.PartnerID, actor, req, hashed, hint(raw)); err != nil {
+			return err
+		}
+		old.ReplacedBy = k.ID
+		return tx.Put(keysBucket, old.ID, old)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return k, raw, nil
+}
+
+// Revoke stops a key working at once. An empty partnerID matches any
+// partner, for admins.
+func (s *Service) Revoke(partnerID, id string) (*Key, error) {
+	var k *Key
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		if k, err = getKeyTx(tx, partnerID, id); err != nil {
+			return err
+		}
+		if k.RevokedAt.IsZero() {
+			k.RevokedAt = s.now().UTC()
+		}
+		return tx.Put(keysBucket, k.ID, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	k.Status = k.status(s.now())
+	return k, nil
+}
+
+// Keys returns the keys of partnerID, or of every partner when it is empty,
+// newest first.
+func (s *Service) Keys(partnerID string) ([]Key, error) {
+	var list []Key
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		list, err = listKeysTx(tx, partnerID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	for i := range list {
+		list[i].Status = list[i].status(now)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Authenticate returns the key raw belongs to if it may be used now,
+// ErrKeyExpired if it has expired, ErrPartnerInactive if its partner may no
+// longer use it or ErrInvalidKey otherwise.
+func (s *Service) Authenticate(raw string) (*Key, error) {
+	if !strings.HasPrefix(raw, Prefix) {
+		return nil, ErrInvalidKey
+	}
+	var k *Key
+	active := true
+	err := s.store.View(func(tx *store.Tx) error {
+		var id string
+		if err := tx.Get(hashesBucket, hash(raw), &id); err != nil {
+			return err
+		}
+		var err error
+		if k, err = getKeyTx(tx, "", id); err != nil {
+			return err
+		}
+		if s.partner != nil {
+			active, err = s.partner(tx, k.PartnerID)
+		}
+		return err
+	})
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	switch k.status(now) {
+	case StatusRevoked:
+		return nil, ErrInvalidKey
+	case StatusExpired:
+		return nil, ErrKeyExpired
+	}
+	if !active {
+		return nil, ErrPartnerInactive
+	}
+	k.Status = StatusActive
+	if now.Sub(k.LastUsedAt) >= usedInterval {
+		s.touch(k.ID, now)
+		k.LastUsedAt = now
+	}
+	return k, nil
+}
+
+// touch records that a key was used at now. Failing to is logged rather
+// than failing the request.
+func (s *Service) touch(id string, now time.Time) {
+	err := s.store.Update(func(tx *store.Tx) error {
+		k, err := getKeyTx(tx, "", id)
+		if err != nil {
+			return err
+		}
+		k.LastUsedAt = now
+		return tx.Put(keysBucket, id, k)
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to record use of API key %s: %v", id, err)
+	}
+}
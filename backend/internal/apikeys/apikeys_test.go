@@ -0,0 +1,149 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func newService(t *testing.T) (*Service, *time.Time) {
+	t.Helper()
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	s := NewService(store.NewMemory())
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestCreateValidatesAndStoresOnlyAHash(t *testing.T) {
+	s, _ := newService(t)
+	for _, req := range []KeyRequest{
+		{Scopes: []string{ScopeWebhooksRead}},
+		{Name: "inventory"},
+		{Name: "inventory", Scopes: []string{"pickups:write"}},
+		{Name: "inventory", Scopes: Scopes, RateLimit: MaxRateLimit + 1},
+		{Name: "inventory", Scopes: Scopes, ExpiresInDays: MaxLifetimeDays + 1},
+	} {
+		if _, _, err := s.Create("weee", "u1", req); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Create(%+v) error = %v, want ErrInvalidRequest", req, err)
+		}
+	}
+
+	key, raw, err := s.Create("weee", "u1", KeyRequest{Name: " inventory ", Scopes: []string{ScopeWebhooksRead, ScopeWebhooksRead}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(raw, Prefix) || len(raw) < 40 || !strings.HasPrefix(raw, strings.TrimSuffix(key.Hint, "...")) {
+		t.Errorf("Create() key = %q, hint %q", raw, key.Hint)
+	}
+	if key.Name != "inventory" || len(key.Scopes) != 1 || key.RateLimit != DefaultRateLimit || key.ExpiresAt != key.CreatedAt.AddDate(0, 0, DefaultLifetimeDays) {
+		t.Errorf("Create() = %+v", key)
+	}
+
+	// Nothing stored contains the key.
+	s.store.View(func(tx *store.Tx) error {
+		for _, bucket := range []string{keysBucket, hashesBucket} {
+			tx.ForEach(bucket, func(k string, v json.RawMessage) error {
+				if strings.Contains(k, raw) || strings.Contains(string(v), raw) {
+					t.Errorf("%s stores the key in %s: %s", bucket, k, v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, now := newService(t)
+	key, raw, _ := s.Create("weee", "u1", KeyRequest{Name: "inventory", Scopes: Scopes, ExpiresInDays: 30})
+
+	got, err := s.Authenticate(raw)
+	if err != nil || got.ID != key.ID || got.PartnerID != "weee" || !got.LastUsedAt.Equal(*now) {
+		t.Fatalf("Authenticate() = %+v, %v", got, err)
+	}
+	for _, bad := range []string{"", "zk_", raw + "0", "Bearer " + raw, strings.ToUpper(raw)} {
+		if _, err := s.Authenticate(bad); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrInvalidKey", bad, err)
+		}
+	}
+
+	*now = now.AddDate(0, 0, 30)
+	if _, err := s.Authenticate(raw); !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("Authenticate() after expiry error = %v, want ErrKeyExpired", err)
+	}
+	list, _ := s.Keys("weee")
+	if len(list) != 1 || list[0].Status != StatusExpired {
+		t.Errorf("Keys() = %+v", list)
+	}
+}
+
+func TestAuthenticateChecksPartner(t *testing.T) {
+	s, _ := newService(t)
+	certified := map[string]bool{"weee": true}
+	s.SetPartnerCheck(func(tx *store.Tx, partnerID string) (bool, error) {
+		return certified[partnerID], nil
+	})
+	_, raw, _ := s.Create("weee", "u1", KeyRequest{Name: "inventory", Scopes: Scopes})
+
+	if _, err := s.Authenticate(raw); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	certified["weee"] = false
+	if _, err := s.Authenticate(raw); !errors.Is(err, ErrPartnerInactive) {
+		t.Errorf("Authenticate() for a lapsed partner error = %v, want ErrPartnerInactive", err)
+	}
+}
+
+func TestRotateOverlapsAndRevokeIsImmediate(t *testing.T) {
+	s, now := newService(t)
+	old, oldRaw, _ := s.Create("weee", "u1", KeyRequest{Name: "inventory", Scopes: []string{ScopeWebhooksRead}, RateLimit: 30, ExpiresInDays: 60})
+
+	if _, _, err := s.Rotate("recyclers_ke", "u2", old.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rotate() by another partner error = %v, want ErrNotFound", err)
+	}
+	*now = now.Add(time.Hour)
+	rotated, newRaw, err := s.Rotate("weee", "u1", old.ID)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if newRaw == oldRaw || rotated.Name != "inventory" || rotated.RateLimit != 30 || len(rotated.Scopes) != 1 || rotated.ExpiresAt != now.AddDate(0, 0, 60) {
+		t.Errorf("Rotate() = %+v", rotated)
+	}
+
+	if _, _, err := s.Rotate("weee", "u1", old.ID); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("second Rotate() of the same key error = %v, want ErrInvalidRequest", err)
+	}
+
+	// Both keys work during the overlap; only the new one after it.
+	for _, raw := range []string{oldRaw, newRaw} {
+		if _, err := s.Authenticate(raw); err != nil {
+			t.Errorf("Authenticate() during overlap error = %v", err)
+		}
+	}
+	*now = now.Add(RotationOverlap)
+	if _, err := s.Authenticate(oldRaw); !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("Authenticate(old) after overlap error = %v, want ErrKeyExpired", err)
+	}
+	if _, err := s.Authenticate(newRaw); err != nil {
+		t.Errorf("Authenticate(new) error = %v", err)
+	}
+
+	revoked, err := s.Revoke("weee", rotated.ID)
+	if err != nil || revoked.Status != StatusRevoked {
+		t.Fatalf("Revoke() = %+v, %v", revoked, err)
+	}
+	if _, err := s.Authenticate(newRaw); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Authenticate() after revoking error = %v, want ErrInvalidKey", err)
+	}
+	if _, _, err := s.Rotate("weee", "u1", rotated.ID); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Rotate() of a revoked key error = %v, want ErrInvalidRequest", err)
+	}
+	list, _ := s.Keys("weee")
+	if len(list) != 2 || list[0].ID != rotated.ID || list[1].ReplacedBy != rotated.ID {
+		t.Errorf("Keys() = %+v", list)
+	}
+}
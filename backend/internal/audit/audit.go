@@ -0,0 +1,281 @@
+// Package audit records who changed what. Entries are append-only: each one
+// carries the hash of the one before it, so editing, removing or reordering
+// recorded entries breaks the chain and is caught by Verify.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Buckets used by the audit log. Entries are keyed by store.SequenceKey so
+// the store's key order is the order they were recorded in; the head is the
+// sequence and hash of the latest entry.
+const (
+	entriesBucket = "audit_entries"
+	chainBucket   = "audit_chain"
+	headKey       = "head"
+)
+
+var (
+	// ErrTampered is returned by Verify when recorded entries no longer
+	// match their hashes.
+	ErrTampered = errors.New("audit log has been tampered with")
+	// ErrUnknownFormat is returned for export formats other than JSONL and CSV.
+	ErrUnknownFormat = errors.New("unknown export format")
+)
+
+// Origin identifies who made a change and where the request came from.
+type Origin struct {
+	Actor     string `json:"actor"`
+	Role      string `json:"role,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	IP        string `json:"ip,omitempty"`
+}
+
+// Change is one field that differs between the before and after state of
+// the target. Before is empty for created fields and After for removed ones.
+type Change struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Entry is one audited change. Action names what was done, e.g.
+// "pickup.reassign", and Target what it was done to.
+type Entry struct {
+	ID  string    `json:"id"`
+	Seq uint64    `json:"seq"`
+	At  time.Time `json:"at"`
+	Origin
+	Action   string            `json:"action"`
+	Target   string            `json:"target,omitempty"`
+	Changes  []Change          `json:"changes,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	PrevHash string            `json:"prev_hash"`
+	Hash     string            `json:"hash"`
+}
+
+// hash returns the hash of everything in e but its own hash.
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("error encoding audit entry %s: %w", e.ID, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// head points at the latest entry.
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Filter selects entries. Empty fields match everything; From is inclusive
+// and To exclusive.
+type Filter struct {
+	Actor     string
+	Action    string
+	Target    string
+	RequestID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+func (f Filter) match(e *Entry) bool {
+	return (f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Target == "" || e.Target == f.Target) &&
+		(f.RequestID == "" || e.RequestID == f.RequestID) &&
+		(f.From.IsZero() || !e.At.Before(f.From)) &&
+		(f.To.IsZero() || e.At.Before(f.To))
+}
+
+// Diff lists the top-level fields whose JSON encoding differs between before
+// and after. Either may be nil, for a target that was created or removed.
+func Diff(before, after interface{}) ([]Change, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for name := range b {
+		names[name] = true
+	}
+	for name := range a {
+		names[name] = true
+	}
+	changes := []Change{}
+	for name := range names {
+		if string(b[name]) != string(a[name]) {
+			changes = append(changes, Change{Field: name, Before: b[name], After: a[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// fields splits the JSON encoding of v into its top-level fields. Values
+// that are not objects are treated as a single field named "value".
+func fields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding audited state: %w", err)
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return map[string]json.RawMessage{"value": data}, nil
+	}
+	return m, nil
+}
+
+// Log stores audit entries. It only ever appends: nothing in this package
+// updates or deletes an entry, and the bucket is marked append-only in the
+// store so nothing else can either.
+type Log struct {
+	store *store.Store
+	now   func() time.Time
+}
+
+// NewLog creates an audit log backed by s.
+func NewLog(s *store.Store) *Log {
+	s.AppendOnly(entriesBucket)
+	return &Log{store: s, now: time.Now}
+}
+
+// Record appends e in its own transaction. Its ID, sequence, time and
+// hashes are filled in.
+func (l *Log) Record(e Entry) (*Entry, error) {
+	var recorded *Entry
+	err := l.store.Update(func(tx *store.Tx) error {
+		var err error
+		recorded, err = l.RecordTx(tx, e)
+		return err
+	})
+	return recorded, err
+}
+
+// RecordTx appends e inside tx, so it commits or rolls back with the change
+// it describes.
+func (l *Log) RecordTx(tx *store.Tx, e Entry) (*Entry, error) {
+	var last head
+	if err := tx.Get(chainBucket, headKey, &last); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	seq, err := tx.NextSequence(entriesBucket)
+	if err != nil {
+		return nil, err
+	}
+	e.ID = "aud_" + strconv.FormatUint(seq, 10)
+	e.Seq = seq
+	e.At = l.now().UTC()
+	e.PrevHash = last.Hash
+	if e.Hash, err = e.hash(); err != nil {
+		return nil, err
+	}
+	if err := tx.Insert(entriesBucket, store.SequenceKey(seq), e); err != nil {
+		return nil, err
+	}
+	if err := tx.Put(chainBucket, headKey, head{Seq: seq, Hash: e.Hash}); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the entries matching filter, newest first, up to filter.Limit
+// entries when it is set.
+func (l *Log) List(filter Filter) ([]Entry, error) {
+	all, err := l.scan(filter)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+	if filter.Limit > 0 && len(all) > filter.Limit {
+		all = all[:filter.Limit]
+	}
+	return all, nil
+}
+
+// scan returns the entries matching filter, oldest first.
+func (l *Log) scan(filter Filter) ([]Entry, error) {
+	all := []Entry{}
+	err := l.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(entriesBucket, func(key string, raw json.RawMessage) error {
+			var e Entry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return fmt.Errorf("error decoding audit entry %s: %w", key, err)
+			}
+			if filter.match(&e) {
+				all = append(all, e)
+			}
+			return nil
+		})
+	})
+	return all, err
+}
+
+// Verify walks the whole log and checks every entry's hash and link to the
+// one before it, and that the latest entry is the recorded head. It returns
+// the number of entries checked.
+func (l *Log) Verify() (int, error) {
+	n := 0
+	err := l.store.View(func(tx *store.Tx) error {
+		var last head
+		if err := tx.Get(chainBucket, headKey, &last); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		prev := head{}
+		err := tx.ForEach(entriesBucket, func(key string, raw json.RawMessage) error {
+			var e Entry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return fmt.Errorf("%w: entry %s cannot be decoded", ErrTampered, key)
+			}
+			sum, err := e.hash()
+			if err != nil {
+				return err
+			}
+			switch {
+			case key != store.SequenceKey(e.Seq) || e.Seq != prev.Seq+1:
+				return fmt.Errorf("%w: entry %s is out of sequence", ErrTampered, key)
+			case e.PrevHash != prev.Hash:
+				return fmt.Errorf("%w: entry %s does not follow %s", ErrTampered, e.ID, "aud_"+strconv.FormatUint(prev.Seq, 10))
+			case sum != e.Hash:
+				return fmt.Errorf("%w: entry %s has been altered", ErrTampered, e.ID)
+			}
+			prev = head{Seq: e.Seq, Hash: e.Hash}
+			n++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if prev != last {
+			return fmt.Errorf("%w: the log ends at entry %d but %d were recorded", ErrTampered, prev.Seq, last.Seq)
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	firebase "firebase.google.com/go/v4/auth"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func newTestLog(t *testing.T) (*Log, *store.Store) {
+	t.Helper()
+	s := store.NewMemory()
+	log := NewLog(s)
+	at := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	log.now = func() time.Time {
+		at = at.Add(time.Hour)
+		return at
+	}
+	for _, e := range []Entry{
+		{Origin: Origin{Actor: "admin1", Role: auth.RoleAdmin, RequestID: "req-1", IP: "10.0.0.1"}, Action: "user.role", Target: "u1"},
+		{Origin: Origin{Actor: "admin2", Role: auth.RoleAdmin, RequestID: "req-2"}, Action: "pickup.cancel", Target: "pk_1"},
+		{Origin: Origin{Actor: "admin1", Role: auth.RoleAdmin, RequestID: "req-3"}, Action: "user.disable", Target: "u1", Details: map[string]string{"k": "v"}},
+	} {
+		if _, err := log.Record(e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	return log, s
+}
+
+func TestRecordAndList(t *testing.T) {
+	log, _ := newTestLog(t)
+	all, err := log.List(Filter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(all) != 3 || all[0].ID != "aud_3" || all[2].ID != "aud_1" || all[0].Details["k"] != "v" || all[2].IP != "10.0.0.1" {
+		t.Fatalf("List() = %+v, want three entries newest first", all)
+	}
+	if all[2].PrevHash != "" || all[1].PrevHash != all[2].Hash || all[0].PrevHash != all[1].Hash {
+		t.Errorf("entries are not chained: %+v", all)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "By actor", filter: Filter{Actor: "admin1"}, want: []string{"aud_3", "aud_1"}},
+		{name: "By target and action", filter: Filter{Target: "u1", Action: "user.role"}, want: []string{"aud_1"}},
+		{name: "By request", filter: Filter{RequestID: "req-2"}, want: []string{"aud_2"}},
+		{name: "By time", filter: Filter{From: time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC), To: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}, want: []string{"aud_2"}},
+		{name: "Limited", filter: Filter{Limit: 1}, want: []string{"aud_3"}},
+		{name: "No match", filter: Filter{Actor: "nobody"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List() = %+v, want %v", got, tt.want)
+			}
+			for i, id := range tt.want {
+				if got[i].ID != id {
+					t.Errorf("List()[%d] = %s, want %s", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordTxRollsBackWithTheChange(t *testing.T) {
+	s := store.NewMemory()
+	log := NewLog(s)
+	_ = s.Update(func(tx *store.Tx) error {
+		if _, err := log.RecordTx(tx, Entry{Origin: Origin{Actor: "admin1"}, Action: "user.role"}); err != nil {
+			t.Fatalf("RecordTx() error = %v", err)
+		}
+		return store.ErrNotFound
+	})
+	if all, _ := log.List(Filter{}); len(all) != 0 {
+		t.Errorf("List() = %+v, want none after rollback", all)
+	}
+	if n, err := log.Verify(); n != 0 || err != nil {
+		t.Errorf("Verify() = %d, %v", n, err)
+	}
+}
+
+func TestEntriesCannotBeChanged(t *testing.T) {
+	log, s := newTestLog(t)
+	if n, err := log.Verify(); n != 3 || err != nil {
+		t.Fatalf("Verify() = %d, %v, want 3 intact entries", n, err)
+	}
+	err := s.Update(func(tx *store.Tx) error {
+		return tx.Delete(entriesBucket, store.SequenceKey(2))
+	})
+	if !errors.Is(err, store.ErrAppendOnly) {
+		t.Errorf("deleting an entry: error = %v, want ErrAppendOnly", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(entries map[string]json.RawMessage)
+	}{
+		{name: "Altered", tamper: func(entries map[string]json.RawMessage) {
+			entries[store.SequenceKey(2)] = json.RawMessage(strings.Replace(string(entries[store.SequenceKey(2)]), "admin2", "admin1", 1))
+		}},
+		{name: "Removed", tamper: func(entries map[string]json.RawMessage) {
+			delete(entries, store.SequenceKey(2))
+		}},
+		{name: "Truncated", tamper: func(entries map[string]json.RawMessage) {
+			delete(entries, store.SequenceKey(3))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, s := newTestLog(t)
+			// Tamper with the store file as someone with disk access would.
+			entries := map[string]json.RawMessage{}
+			_ = s.View(func(tx *store.Tx) error {
+				return tx.ForEach(entriesBucket, func(key string, raw json.RawMessage) error {
+					entries[key] = raw
+					return nil
+				})
+			})
+			tt.tamper(entries)
+			tampered := store.NewMemory()
+			_ = tampered.Update(func(tx *store.Tx) error {
+				for key, raw := range entries {
+					if err := tx.Put(entriesBucket, key, raw); err != nil {
+						return err
+					}
+				}
+				var h head
+				_ = s.View(func(stx *store.Tx) error { return stx.Get(chainBucket, headKey, &h) })
+				return tx.Put(chainBucket, headKey, h)
+			})
+			log.store = tampered
+			if _, err := log.Verify(); !errors.Is(err, ErrTampered) {
+				t.Errorf("Verify() error = %v, want ErrTampered", err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	type reward struct {
+		ID     string `json:"id"`
+		Cost   int    `json:"cost"`
+		Active bool   `json:"active"`
+	}
+	changes, err := Diff(&reward{ID: "r1", Cost: 200, Active: true}, reward{ID: "r1", Cost: 250, Active: false})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(changes) != 2 || changes[0].Field != "active" || string(changes[1].Before) != "200" || string(changes[1].After) != "250" {
+		t.Errorf("Diff() = %+v", changes)
+	}
+	var missing *reward
+	created, _ := Diff(missing, reward{ID: "r2"})
+	if len(created) != 3 || created[0].Before != nil {
+		t.Errorf("Diff(nil, r2) = %+v, want every field created", created)
+	}
+}
+
+func TestDescribeAndOrigin(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/admin/items/categories", nil)
+	req.RemoteAddr = "192.0.2.7:5123"
+	ctx := auth.WithToken(WithRequestID(req.Context(), "req-9"), &firebase.Token{UID: "admin1", Claims: map[string]interface{}{"role": auth.RoleAdmin}})
+	if o := OriginOf(req.WithContext(ctx)); o != (Origin{Actor: "admin1", Role: auth.RoleAdmin, RequestID: "req-9", IP: "192.0.2.7"}) {
+		t.Errorf("OriginOf() = %+v", o)
+	}
+
+	Describe(context.Background(), "ignored", nil, map[string]int{"a": 1})
+	ctx, described := WithCapture(ctx)
+	Describe(ctx, "phones", map[string]bool{"active": true}, map[string]bool{"active": false})
+	if target, changes := described(); target != "phones" || len(changes) != 1 || string(changes[0].After) != "false" {
+		t.Errorf("described() = %s, %+v", target, changes)
+	}
+}
+
+func TestExport(t *testing.T) {
+	log, _ := newTestLog(t)
+	data, err := log.Export(Filter{Actor: "admin1"}, FormatJSONL)
+	if err != nil {
+		t.Fatalf("Export(jsonl) error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var first Entry
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &first) != nil || first.ID != "aud_1" || first.Hash == "" {
+		t.Errorf("Export(jsonl) = %s", data)
+	}
+
+	data, err = log.Export(Filter{}, FormatCSV)
+	if err != nil {
+		t.Fatalf("Export(csv) error = %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(records) != 4 || records[3][0] != "aud_3" || records[3][7] != `k="v"` {
+		t.Errorf("Export(csv) = %v, %v", records, err)
+	}
+
+	if _, err := log.Export(Filter{}, "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Export(xml) error = %v, want ErrUnknownFormat", err)
+	}
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	describedKey
+)
+
+// WithRequestID returns a copy of ctx carrying the ID of the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID in ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// OriginOf returns the signed-in user, request ID and client address of r.
+func OriginOf(r *http.Request) Origin {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return Origin{
+		Actor:     auth.UIDFromContext(r.Context()),
+		Role:      auth.RoleFromContext(r.Context()),
+		RequestID: RequestIDFromContext(r.Context()),
+		IP:        ip,
+	}
+}
+
+// described is what a handler reported changing while serving a request.
+type described struct {
+	mu      sync.Mutex
+	target  string
+	changes []Change
+}
+
+// WithCapture returns a copy of ctx in which handlers can Describe what they
+// change, and a function returning what they described.
+func WithCapture(ctx context.Context) (context.Context, func() (string, []Change)) {
+	d := &described{}
+	return context.WithValue(ctx, describedKey, d), func() (string, []Change) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.target, d.changes
+	}
+}
+
+// Describe reports that the request in ctx changed target from before to
+// after, so its audit entry carries the difference. Either state may be nil.
+// It does nothing for requests that are not being audited.
+func Describe(ctx context.Context, target string, before, after interface{}) {
+	d, ok := ctx.Value(describedKey).(*described)
+	if !ok {
+		return
+	}
+	changes, err := Diff(before, after)
+	if err != nil {
+		log.Printf("Failed to describe the change to %s: %v", target, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.target, d.changes = target, changes
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats.
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// ContentTypes maps each export format to its media type.
+var ContentTypes = map[string]string{
+	FormatJSONL: "application/x-ndjson",
+	FormatCSV:   "text/csv; charset=utf-8",
+}
+
+// Export returns the entries matching filter, oldest first, for an
+// investigation. JSONL keeps every field, including the hashes, so the
+// export can be checked against the chain; CSV is for spreadsheets.
+func (l *Log) Export(filter Filter, format string) ([]byte, error) {
+	if _, ok := ContentTypes[format]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	entries, err := l.scan(filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+
+	var buf bytes.Buffer
+	if format == FormatJSONL {
+		enc := json.NewEncoder(&buf)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "at", "actor", "role", "action", "target", "changes", "details", "request_id", "ip", "hash"})
+	for _, e := range entries {
+		_ = w.Write([]string{
+			e.ID, e.At.Format(time.RFC3339), e.Actor, e.Role, e.Action, e.Target,
+			formatChanges(e.Changes), formatDetails(e.Details), e.RequestID, e.IP, e.Hash,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Filename names an export of the log taken at t.
+func Filename(format string, t time.Time) string {
+	return "audit-" + t.UTC().Format("20060102-150405") + "." + format
+}
+
+// formatChanges writes changes as "field: before -> after" lines.
+func formatChanges(changes []Change) string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = c.Field + ": " + orNone(c.Before) + " -> " + orNone(c.After)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func orNone(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "(none)"
+	}
+	return string(raw)
+}
+
+// formatDetails writes details as sorted "key=value" pairs.
+func formatDetails(details map[string]string) string {
+	pairs := make([]string, 0, len(details))
+	for k, v := range details {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// UserContextKey is the request context key under which AuthMiddleware stores the verified token.
+const UserContextKey = "user"
+
+// ClientContextKey is the request context key under which a partner system
+// that signed in with an API key is stored.
+const ClientContextKey = "client"
+
+// Client is a partner system calling the API with an API key rather than a
+// user token. It acts for its partner with the scopes of its key.
+type Client struct {
+	KeyID     string
+	PartnerID string
+	Scopes    []string
+}
+
+// ClientFromContext returns the partner system stored on the request context.
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(ClientContextKey).(*Client)
+	return client, ok && client != nil
+}
+
+// WithClient returns a copy of ctx carrying client.
+func WithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, ClientContextKey, client)
+}
+
+// TokenFromContext returns the verified Firebase token stored on the request context.
+func TokenFromContext(ctx context.Context) (*auth.Token, bool) {
+	token, ok := ctx.Value(UserContextKey).(*auth.Token)
+	return token, ok && token != nil
+}
+
+// KeyActorPrefix starts the actor of a partner system, so that what is done
+// with an API key is never attributed to a user with the same ID.
+const KeyActorPrefix = "key:"
+
+// UIDFromContext returns the UID of the authenticated user, the key ID of a
+// partner system prefixed with KeyActorPrefix, or an empty string.
+func UIDFromContext(ctx context.Context) string {
+	if client, ok := ClientFromContext(ctx); ok {
+		return KeyActorPrefix + client.KeyID
+	}
+	if token, ok := TokenFromContext(ctx); ok {
+		return token.UID
+	}
+	return ""
+}
+
+// RoleFromContext returns the "role" custom claim of the authenticated user.
+// Users without the claim are treated as residents; partner systems are
+// partners.
+func RoleFromContext(ctx context.Context) string {
+	if _, ok := ClientFromContext(ctx); ok {
+		return RolePartner
+	}
+	token, ok := TokenFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if role, ok := token.Claims["role"].(string); ok && role != "" {
+		return role
+	}
+	return RoleResident
+}
+
+// PartnerIDFromContext returns the "partner_id" custom claim of the
+// authenticated user, or the partner of a partner system: the recycling
+// partner the caller acts for.
+func PartnerIDFromContext(ctx context.Context) string {
+	if client, ok := ClientFromContext(ctx); ok {
+		return client.PartnerID
+	}
+	token, ok := TokenFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	partnerID, _ := token.Claims["partner_id"].(string)
+	return partnerID
+}
+
+// WithToken returns a copy of ctx carrying token. Used by tests and internal callers.
+func WithToken(ctx context.Context, token *auth.Token) context.Context {
+	return context.WithValue(ctx, UserContextKey, token)
+}
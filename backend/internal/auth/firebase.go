@@ -92,6 +92,17 @@ func (as *AuthService) VerifyIDToken(ctx context.Context, idToken string) (*auth
 	return token, nil
 }
 
+// VerifyIDTokenAndCheckRevoked verifies the Firebase ID token and also asks
+// Firebase whether the user has been disabled or their sessions revoked
+// since it was issued. It costs a call to Firebase per request.
+func (as *AuthService) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error) {
+	token, err := as.client.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying ID token: %v", err)
+	}
+	return token, nil
+}
+
 // ExtractClaims extracts custom claims from a verified token
 func (as *AuthService) ExtractClaims(token *auth.Token) map[string]interface{} {
 	return token.Claims
@@ -0,0 +1,9 @@
+package auth
+
+// Roles carried in the "role" custom claim of Firebase tokens.
+const (
+	RoleResident  = "resident"
+	RoleCollector = "collector"
+	RolePartner   = "partner"
+	RoleAdmin     = "admin"
+)
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	fbauth "firebase.google.com/go/v4/auth"
+	"google.golang.org/api/iterator"
+)
+
+// Roles lists every role, in the order the admin console offers them.
+var Roles = []string{RoleResident, RoleCollector, RolePartner, RoleAdmin}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// User is an account as shown to administrators.
+type User struct {
+	UID          string    `json:"uid"`
+	Email        string    `json:"email"`
+	Phone        string    `json:"phone,omitempty"`
+	DisplayName  string    `json:"display_name"`
+	Role         string    `json:"role"`
+	PartnerID    string    `json:"partner_id,omitempty"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastSignInAt time.Time `json:"last_sign_in_at"`
+}
+
+// Directory lists accounts and changes their role or access. Role changes
+// reach a user's token the next time it is refreshed, within the hour.
+type Directory interface {
+	User(ctx context.Context, uid string) (*User, error)
+	Users(ctx context.Context, pageToken string, pageSize int) ([]User, string, error)
+	SetRole(ctx context.Context, uid, role string) error
+	SetPartner(ctx context.Context, uid, partnerID string) error
+	SetDisabled(ctx context.Context, uid string, disabled bool) error
+}
+
+// Users returns a page of Firebase accounts and the token of the next page,
+// which is empty after the last.
+func (as *AuthService) Users(ctx context.Context, pageToken string, pageSize int) ([]User, string, error) {
+	it := as.client.Users(ctx, pageToken)
+	users := []User{}
+	for len(users) < pageSize {
+		record, err := it.Next()
+		if err == iterator.Done {
+			return users, "", nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error listing users: %v", err)
+		}
+		users = append(users, userFromRecord(record.UserRecord))
+	}
+	return users, it.PageInfo().Token, nil
+}
+
+// User returns the account uid.
+func (as *AuthService) User(ctx context.Context, uid string) (*User, error) {
+	record, err := as.client.GetUser(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user %s: %v", uid, err)
+	}
+	u := userFromRecord(record)
+	return &u, nil
+}
+
+func userFromRecord(record *fbauth.UserRecord) User {
+	role, _ := record.CustomClaims["role"].(string)
+	if role == "" {
+		role = RoleResident
+	}
+	partnerID, _ := record.CustomClaims["partner_id"].(string)
+	return User{
+		UID:          record.UID,
+		Email:        record.Email,
+		Phone:        record.PhoneNumber,
+		DisplayName:  record.DisplayName,
+		Role:         role,
+		PartnerID:    partnerID,
+		Disabled:     record.Disabled,
+		CreatedAt:    time.UnixMilli(record.UserMetadata.CreationTimestamp),
+		LastSignInAt: time.UnixMilli(record.UserMetadata.LastLogInTimestamp),
+	}
+}
+
+// SetRole sets the "role" custom claim of uid, keeping its other claims.
+// The user's refresh tokens are revoked so the change takes effect at once
+// wherever revocation is checked, rather than when their token expires.
+func (as *AuthService) SetRole(ctx context.Context, uid, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	record, err := as.client.GetUser(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("error loading user %s: %v", uid, err)
+	}
+	claims := map[string]interface{}{}
+	for k, v := range record.CustomClaims {
+		claims[k] = v
+	}
+	claims["role"] = role
+	if err := as.client.SetCustomUserClaims(ctx, uid, claims); err != nil {
+		return fmt.Errorf("error setting role of %s: %v", uid, err)
+	}
+	return as.revoke(ctx, uid)
+}
+
+// SetPartner links uid to the recycling partner partnerID, giving it the
+// partner role, or unlinks it when partnerID is empty. Other claims are kept
+// and, as with SetRole, existing sessions are revoked.
+func (as *AuthService) SetPartner(ctx context.Context, uid, partnerID string) error {
+	record, err := as.client.GetUser(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("error loading user %s: %v", uid, err)
+	}
+	claims := map[string]interface{}{}
+	for k, v := range record.CustomClaims {
+		claims[k] = v
+	}
+	if partnerID == "" {
+		delete(claims, "partner_id")
+	} else {
+		claims["role"] = RolePartner
+		claims["partner_id"] = partnerID
+	}
+	if err := as.client.SetCustomUserClaims(ctx, uid, claims); err != nil {
+		return fmt.Errorf("error setting partner of %s: %v", uid, err)
+	}
+	return as.revoke(ctx, uid)
+}
+
+// SetDisabled blocks or restores sign-in for uid. Disabling also revokes the
+// user's refresh tokens, so existing sessions end on the paths that check
+// revocation with VerifyIDTokenAndCheckRevoked and, elsewhere, within the
+// hour their ID token lasts.
+func (as *AuthService) SetDisabled(ctx context.Context, uid string, disabled bool) error {
+	params := (&fbauth.UserToUpdate{}).Disabled(disabled)
+	if _, err := as.client.UpdateUser(ctx, uid, params); err != nil {
+		return fmt.Errorf("error updating user %s: %v", uid, err)
+	}
+	if disabled {
+		return as.revoke(ctx, uid)
+	}
+	return nil
+}
+
+// revoke ends the existing sessions of uid.
+func (as *AuthService) revoke(ctx context.Context, uid string) error {
+	if err := as.client.RevokeRefreshTokens(ctx, uid); err != nil {
+		return fmt.Errorf("error revoking sessions of %s: %v", uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+// Package collections records what collectors capture in the field and
+// applies the updates their devices queue while offline.
+package collections
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/photos"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+const (
+	// collectionsBucket holds one Collection per pickup, keyed by pickup ID.
+	collectionsBucket = "collections"
+	// operationsBucket remembers the result of every operation, keyed by
+	// collector and client operation ID, so replays are not applied twice.
+	operationsBucket = "sync_operations"
+)
+
+// Operation types a device may queue.
+const (
+	OpScan      = "scan"
+	OpWeight    = "weight"
+	OpPhoto     = "photo"
+	OpSignature = "signature"
+	OpStatus    = "status"
+)
+
+// Outcomes of applying an operation.
+const (
+	// OutcomeApplied means the operation changed, or already matched, the server state.
+	OutcomeApplied = "applied"
+	// OutcomeSuperseded means a later recording of the same value won.
+	OutcomeSuperseded = "superseded"
+	// OutcomeConflict means the pickup changed on the server in a way the
+	// operation cannot be applied on top of.
+	OutcomeConflict = "conflict"
+	// OutcomeRejected means the operation is invalid and will never apply.
+	OutcomeRejected = "rejected"
+	// OutcomeFailed means the server could not process the operation; the
+	// device should send it again.
+	OutcomeFailed = "failed"
+)
+
+// Limits on what a device may send.
+const (
+	MaxBatchSize     = 100
+	MaxSignatureSize = 256 << 10
+	MaxClockSkew     = 5 * time.Minute
+	maxOperationID   = 64
+)
+
+// collectorStatuses are the status changes collectors make in the field.
+var collectorStatuses = map[string]bool{pickups.StatusCollected: true, pickups.StatusCancelled: true}
+
+// ErrBatchTooLarge is returned when a sync batch holds too many operations.
+var ErrBatchTooLarge = fmt.Errorf("a sync batch holds at most %d operations", MaxBatchSize)
+
+// Operation is one update queued on a collector's device. ID is generated by
+// the device and RecordedAt is the device clock when the update was made.
+type Operation struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	PickupID   string    `json:"pickup_id"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Item       *int      `json:"item,omitempty"`
+	Serial     string    `json:"serial,omitempty"`
+	Category   string    `json:"category,omitempty"`
+	WeightKg   float64   `json:"weight_kg,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	SignedBy   string    `json:"signed_by,omitempty"`
+	Caption    string    `json:"caption,omitempty"`
+	Data       string    `json:"data,omitempty"`
+}
+
+// Result reports what happened to one operation.
+type Result struct {
+	ID           string `json:"id"`
+	Outcome      string `json:"outcome"`
+	Error        string `json:"error,omitempty"`
+	PickupStatus string `json:"pickup_status,omitempty"`
+	// Duplicate is set when the operation was already synced; the result is
+	// the one recorded the first time.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// Stamp identifies the operation that recorded a value. Later stamps win;
+// equal times are ordered by operation ID so every server agrees.
+type Stamp struct {
+	OpID       string    `json:"op_id"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Before reports whether s was recorded before o.
+func (s Stamp) Before(o Stamp) bool {
+	if !s.RecordedAt.Equal(o.RecordedAt) {
+		return s.RecordedAt.Before(o.RecordedAt)
+	}
+	return s.OpID < o.OpID
+}
+
+// Scan is a device identified at the door by barcode or serial number.
+type Scan struct {
+	Stamp
+	Serial   string `json:"serial"`
+	Category string `json:"category,omitempty"`
+	Item     *int   `json:"item,omitempty"`
+}
+
+// Weight is the measured weight of one of the pickup's items.
+type Weight struct {
+	Stamp
+	Item     int     `json:"item"`
+	WeightKg float64 `json:"weight_kg"`
+}
+
+// Photo refers to a proof-of-collection photo kept by the photos service.
+type Photo struct {
+	Stamp
+	ID          string `json:"id"`
+	ContentType string `json:"content_type"`
+	Caption     string `json:"caption,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// Signature is the resident's sign-off on handing the items over.
+type Signature struct {
+	Stamp
+	SignedBy string `json:"signed_by"`
+	Data     string `json:"data"`
+}
+
+// Collection is everything captured at one pickup.
+type Collection struct {
+	PickupID    string     `json:"pickup_id"`
+	CollectorID string     `json:"collector_id"`
+	Scans       []Scan     `json:"scans"`
+	Weights     []Weight   `json:"weights"`
+	Photos      []Photo    `json:"photos"`
+	Signature   *Signature `json:"signature,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Service applies field updates to pickups and their collection records.
+type Service struct {
+	store   *store.Store
+	pickups *pickups.Service
+	photos  *photos.Service
+	now     func() time.Time
+}
+
+// NewService creates a collections service that keeps photos with photoService.
+func NewService(s *store.Store, pickupService *pickups.Service, photoService *photos.Service) *Service {
+	return &Service{store: s, pickups: pickupService, photos: photoService, now: time.Now}
+}
+
+// Get returns the collection record of a pickup, empty if nothing has been
+// captured. When collectorID is set, pickups assigned to anyone else are
+// reported as not found.
+func (s *Service) Get(pickupID, collectorID string) (*Collection, error) {
+	var c *Collection
+	err := s.store.View(func(tx *store.Tx) error {
+		pickup, err := pickups.GetTx(tx, pickupID)
+		if err != nil {
+			return err
+		}
+		if collectorID != "" && pickup.CollectorID != collectorID {
+			return pickups.ErrNotFound
+		}
+		c, err = GetTx(tx, pickupID)
+		return err
+	})
+	return c, err
+}
+
+// GetTx returns the collection record of a pickup inside tx, empty if
+// nothing has been captured.
+func GetTx(tx *store.Tx, pickupID string) (*Collection, error) {
+	c := &Collection{PickupID: pickupID, Scans: []Scan{}, Weights: []Weight{}, Photos: []Photo{}}
+	if err := tx.Get(collectionsBucket, pickupID, c); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Sync applies a batch of operations queued by collectorID's device and
+// returns one result per operation, in the order they were sent.
+//
+// Operations are applied oldest first by RecordedAt, then by ID, so the
+// outcome does not depend on the order devices upload in. Each operation is
+// applied in its own transaction: one failing does not hold back the rest.
+func (s *Service) Sync(collectorID string, ops []Operation) ([]Result, error) {
+	if len(ops) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+	order := make([]int, len(ops))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		x, y := ops[order[a]], ops[order[b]]
+		return Stamp{x.ID, x.RecordedAt}.Before(Stamp{y.ID, y.RecordedAt})
+	})
+
+	results := make([]Result, len(ops))
+	for _, i := range order {
+		results[i] = s.apply(collectorID, ops[i])
+	}
+	return results, nil
+}
+
+// upload is the photo of an OpPhoto operation, processed before the
+// operation's transaction so that resizing does not hold the store's write
+// lock. err is reported when the operation is applied.
+type upload struct {
+	image *photos.Image
+	err   error
+}
+
+// apply records op and its result in one transaction.
+func (s *Service) apply(collectorID string, op Operation) Result {
+	var photo upload
+	if op.Type == OpPhoto {
+		var data []byte
+		data, photo.err = decodeBase64(op.Data, photos.MaxUploadBytes)
+		if photo.err == nil {
+			photo.image, photo.err = photos.Process(data)
+		}
+	}
+
+	var result Result
+	err := s.store.Update(func(tx *store.Tx) error {
+		key := collectorID + ":" + op.ID
+		if op.ID != "" && tx.Exists(operationsBucket, key) {
+			if err := tx.Get(operationsBucket, key, &result); err != nil {
+				return err
+			}
+			result.Duplicate = true
+			return nil
+		}
+
+		var err error
+		result, err = s.applyTx(tx, collectorID, op, photo)
+		if err != nil {
+			return err
+		}
+		if op.ID == "" {
+			return nil
+		}
+		return tx.Put(operationsBucket, key, &result)
+	})
+	if err != nil {
+		return Result{ID: op.ID, Outcome: OutcomeFailed, Error: err.Error()}
+	}
+	return result
+}
+
+// applyTx applies op. Errors are reserved for storage failures; everything
+// the device can act on is reported in the result.
+func (s *Service) applyTx(tx *store.Tx, collectorID string, op Operation, photo upload) (Result, error) {
+	result := Result{ID: op.ID}
+	reject := func(format string, args ...interface{}) (Result, error) {
+		result.Outcome, result.Error = OutcomeRejected, fmt.Sprintf(format, args...)
+		return result, nil
+	}
+
+	if op.ID == "" || len(op.ID) > maxOperationID {
+		return reject("id must be 1 to %d characters", maxOperationID)
+	}
+	if op.RecordedAt.IsZero() || op.RecordedAt.After(s.now().Add(MaxClockSkew)) {
+		return reject("recorded_at must be set and not in the future")
+	}
+	pickup, err := pickups.GetTx(tx, op.PickupID)
+	if errors.Is(err, pickups.ErrNotFound) {
+		return reject("pickup %q not found", op.PickupID)
+	}
+	if err != nil {
+		return result, err
+	}
+	if pickup.CollectorID != collectorID {
+		return reject("pickup %s is not assigned to you", pickup.ID)
+	}
+	result.PickupStatus = pickup.Status
+
+	if op.Type == OpStatus {
+		return s.applyStatus(tx, collectorID, op, pickup, result)
+	}
+	if pickup.Status == pickups.StatusCancelled {
+		result.Outcome, result.Error = OutcomeConflict, "pickup was cancelled"
+		return result, nil
+	}
+
+	c, err := GetTx(tx, pickup.ID)
+	if err != nil {
+		return result, err
+	}
+	c.CollectorID = collectorID
+	stamp := Stamp{OpID: op.ID, RecordedAt: op.RecordedAt.UTC()}
+	result.Outcome = OutcomeApplied
+
+	switch op.Type {
+	case OpScan:
+		serial := strings.TrimSpace(op.Serial)
+		if serial == "" {
+			return reject("serial is required")
+		}
+		if op.Item != nil && (*op.Item < 0 || *op.Item >= len(pickup.Items)) {
+			return reject("item %d does not exist", *op.Item)
+		}
+		// Scans are a set: scanning a serial again keeps the first scan.
+		for _, scan := range c.Scans {
+			if strings.EqualFold(scan.Serial, serial) {
+				return result, nil
+			}
+		}
+		c.Scans = append(c.Scans, Scan{Stamp: stamp, Serial: serial, Category: op.Category, Item: op.Item})
+
+	case OpWeight:
+		if op.Item == nil || *op.Item < 0 || *op.Item >= len(pickup.Items) {
+			return reject("item must name one of the pickup's items")
+		}
+		if op.WeightKg <= 0 {
+			return reject("weight_kg must be positive")
+		}
+		weight := Weight{Stamp: stamp, Item: *op.Item, WeightKg: op.WeightKg}
+		replaced := false
+		for i, existing := range c.Weights {
+			if existing.Item != weight.Item {
+				continue
+			}
+			if stamp.Before(existing.Stamp) {
+				result.Outcome = OutcomeSuperseded
+				return result, nil
+			}
+			c.Weights[i], replaced = weight, true
+		}
+		if !replaced {
+			c.Weights = append(c.Weights, weight)
+		}
+		pickup.Items[weight.Item].MeasuredWeightKg = weight.WeightKg
+		if err := pickups.SaveTx(tx, pickup); err != nil {
+			return result, err
+		}
+
+	case OpPhoto:
+		if photo.err != nil {
+			return reject("photo: %v", photo.err)
+		}
+		stored, err := s.photos.AddTx(tx, pickup.ID, collectorID, photos.KindProof, op.Caption, photo.image)
+		if err != nil {
+			return result, err
+		}
+		c.Photos = append(c.Photos, Photo{
+			Stamp: stamp, ID: stored.ID, ContentType: stored.ContentType, Caption: stored.Caption, Size: stored.Size,
+		})
+
+	case OpSignature:
+		if strings.TrimSpace(op.SignedBy) == "" {
+			return reject("signed_by is required")
+		}
+		data, err := decodeBase64(op.Data, MaxSignatureSize)
+		if err == nil && http.DetectContentType(data) != "image/png" {
+			err = errors.New("must be a PNG image")
+		}
+		if err != nil {
+			return reject("signature: %v", err)
+		}
+		if c.Signature != nil && stamp.Before(c.Signature.Stamp) {
+			result.Outcome = OutcomeSuperseded
+			return result, nil
+		}
+		c.Signature = &Signature{Stamp: stamp, SignedBy: strings.TrimSpace(op.SignedBy), Data: op.Data}
+
+	default:
+		return reject("unknown operation type %q", op.Type)
+	}
+
+	c.UpdatedAt = s.now().UTC()
+	return result, tx.Put(collectionsBucket, pickup.ID, c)
+}
+
+// applyStatus moves the pickup along its lifecycle. A status change made on
+// the server after the device recorded the operation wins over the device.
+func (s *Service) applyStatus(tx *store.Tx, collectorID string, op Operation, pickup *pickups.Pickup, result Result) (Result, error) {
+	if !collectorStatuses[op.Status] {
+		result.Outcome, result.Error = OutcomeRejected, fmt.Sprintf("collectors cannot set status %q", op.Status)
+		return result, nil
+	}
+	if pickup.Status == op.Status {
+		result.Outcome = OutcomeApplied
+		return result, nil
+	}
+	last := pickup.History[len(pickup.History)-1]
+	if last.Actor != collectorID && last.At.After(op.RecordedAt) {
+		result.Outcome = OutcomeConflict
+		result.Error = fmt.Sprintf("pickup became %s after this update was recorded", pickup.Status)
+		return result, nil
+	}
+	if !pickups.CanTransition(pickup.Status, op.Status) {
+		result.Outcome = OutcomeConflict
+		result.Error = fmt.Sprintf("pickup cannot go from %s to %s", pickup.Status, op.Status)
+		return result, nil
+	}
+
+	updated, err := s.pickups.TransitionTx(tx, pickup.ID, op.Status, collectorID)
+	if err != nil {
+		return result, err
+	}
+	result.Outcome, result.PickupStatus = OutcomeApplied, updated.Status
+	return result, nil
+}
+
+// decodeBase64 decodes data of at most limit bytes.
+func decodeBase64(encoded string, limit int) ([]byte, error) {
+	if encoded == "" {
+		return nil, errors.New("data is required")
+	}
+	if base64.StdEncoding.DecodedLen(len(encoded)) > limit+3 {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("data must be base64")
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,192 @@
+package collections
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/photos"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var (
+	day = time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)
+	// pngData is the smallest data that sniffs as a PNG.
+	pngData = base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n0000"))
+)
+
+func jpegData(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func intPtr(i int) *int { return &i }
+
+func newTestService(t *testing.T) (*Service, *pickups.Service, *pickups.Pickup) {
+	t.Helper()
+	storage, err := photos.NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+	db := store.NewMemory()
+	pickupService := pickups.NewService(db)
+	svc := NewService(db, pickupService, photos.NewService(db, storage, []byte("secret")))
+	svc.now = func() time.Time { return day.Add(time.Hour) }
+
+	p, err := pickupService.Create("resident", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "computers", Quantity: 1, WeightKg: 8}, {Category: "phones", Quantity: 3}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if p, err = pickupService.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	return svc, pickupService, p
+}
+
+func TestSyncAppliesBatch(t *testing.T) {
+	svc, pickupService, p := newTestService(t)
+	ops := []Operation{
+		{ID: "op-4", Type: OpStatus, PickupID: p.ID, RecordedAt: day.Add(4 * time.Minute), Status: pickups.StatusCollected},
+		{ID: "op-1", Type: OpScan, PickupID: p.ID, RecordedAt: day.Add(time.Minute), Serial: "SN123", Item: intPtr(0)},
+		{ID: "op-2", Type: OpWeight, PickupID: p.ID, RecordedAt: day.Add(2 * time.Minute), Item: intPtr(0), WeightKg: 7.5},
+		{ID: "op-3", Type: OpSignature, PickupID: p.ID, RecordedAt: day.Add(3 * time.Minute), SignedBy: "Jane", Data: pngData},
+		{ID: "op-5", Type: OpPhoto, PickupID: p.ID, RecordedAt: day.Add(5 * time.Minute), Data: jpegData(t), Caption: "Load"},
+	}
+	results, err := svc.Sync("col1", ops)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	for i, r := range results {
+		if r.ID != ops[i].ID || r.Outcome != OutcomeApplied {
+			t.Errorf("result %d = %+v, want applied %s", i, r, ops[i].ID)
+		}
+	}
+	if results[0].PickupStatus != pickups.StatusCollected {
+		t.Errorf("status result = %+v", results[0])
+	}
+
+	c, err := svc.Get(p.ID, "col1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(c.Scans) != 1 || len(c.Weights) != 1 || len(c.Photos) != 1 || c.Signature == nil || c.Signature.SignedBy != "Jane" {
+		t.Errorf("unexpected collection %+v", c)
+	}
+	if _, err := svc.Get(p.ID, "col2"); !errors.Is(err, pickups.ErrNotFound) {
+		t.Errorf("Get(other collector) error = %v, want ErrNotFound", err)
+	}
+	photo, err := svc.photos.Get(c.Photos[0].ID)
+	if err != nil || photo.Kind != photos.KindProof || photo.UploadedBy != "col1" || photo.Caption != "Load" {
+		t.Errorf("stored photo = %+v, %v", photo, err)
+	}
+
+	updated, _ := pickupService.Get(p.ID)
+	if updated.Status != pickups.StatusCollected || updated.Items[0].MeasuredWeightKg != 7.5 || updated.Items[0].WeightKg != 8 {
+		t.Errorf("pickup not updated: %+v", updated)
+	}
+}
+
+func TestSyncIsIdempotent(t *testing.T) {
+	svc, _, p := newTestService(t)
+	op := Operation{ID: "op-1", Type: OpScan, PickupID: p.ID, RecordedAt: day, Serial: "SN1"}
+
+	first, _ := svc.Sync("col1", []Operation{op})
+	again, _ := svc.Sync("col1", []Operation{op, {ID: "op-2", Type: OpScan, PickupID: p.ID, RecordedAt: day, Serial: "sn1"}})
+	if first[0].Outcome != OutcomeApplied || first[0].Duplicate {
+		t.Errorf("first sync = %+v", first[0])
+	}
+	if again[0].Outcome != OutcomeApplied || !again[0].Duplicate {
+		t.Errorf("replayed sync = %+v", again[0])
+	}
+	if c, _ := svc.Get(p.ID, "col1"); len(c.Scans) != 1 {
+		t.Errorf("scans duplicated: %+v", c.Scans)
+	}
+}
+
+func TestSyncLastWriterWins(t *testing.T) {
+	svc, pickupService, p := newTestService(t)
+	// The later measurement arrives first, from another device.
+	newer := Operation{ID: "b", Type: OpWeight, PickupID: p.ID, RecordedAt: day.Add(time.Minute), Item: intPtr(1), WeightKg: 0.6}
+	older := Operation{ID: "a", Type: OpWeight, PickupID: p.ID, RecordedAt: day, Item: intPtr(1), WeightKg: 0.9}
+	tie := Operation{ID: "c", Type: OpWeight, PickupID: p.ID, RecordedAt: day.Add(time.Minute), Item: intPtr(1), WeightKg: 0.7}
+
+	svc.Sync("col1", []Operation{newer})
+	results, _ := svc.Sync("col1", []Operation{older, tie})
+	if results[0].Outcome != OutcomeSuperseded || results[1].Outcome != OutcomeApplied {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if updated, _ := pickupService.Get(p.ID); updated.Items[1].MeasuredWeightKg != 0.7 {
+		t.Errorf("weight = %v, want 0.7 from the tie-breaking op", updated.Items[1].MeasuredWeightKg)
+	}
+}
+
+func TestSyncStatusConflicts(t *testing.T) {
+	svc, pickupService, p := newTestService(t)
+	// An admin cancels after the collector recorded the collection offline.
+	svc.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := pickupService.Transition(p.ID, pickups.StatusCancelled, "admin"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	offline := time.Now().Add(-time.Minute)
+	results, _ := svc.Sync("col1", []Operation{
+		{ID: "op-1", Type: OpStatus, PickupID: p.ID, RecordedAt: offline, Status: pickups.StatusCollected},
+		{ID: "op-2", Type: OpScan, PickupID: p.ID, RecordedAt: offline, Serial: "SN1"},
+	})
+	for _, r := range results {
+		if r.Outcome != OutcomeConflict || r.PickupStatus != pickups.StatusCancelled {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestSyncRejects(t *testing.T) {
+	svc, _, p := newTestService(t)
+	tests := []struct {
+		name string
+		op   Operation
+	}{
+		{"Missing ID", Operation{Type: OpScan, PickupID: p.ID, RecordedAt: day, Serial: "SN1"}},
+		{"Future timestamp", Operation{ID: "x", Type: OpScan, PickupID: p.ID, RecordedAt: day.Add(2 * time.Hour), Serial: "SN1"}},
+		{"Unknown pickup", Operation{ID: "x", Type: OpScan, PickupID: "pk_404", RecordedAt: day, Serial: "SN1"}},
+		{"Unknown type", Operation{ID: "x", Type: "dance", PickupID: p.ID, RecordedAt: day}},
+		{"Item out of range", Operation{ID: "x", Type: OpWeight, PickupID: p.ID, RecordedAt: day, Item: intPtr(5), WeightKg: 1}},
+		{"Status not for collectors", Operation{ID: "x", Type: OpStatus, PickupID: p.ID, RecordedAt: day, Status: pickups.StatusProcessed}},
+		{"Photo not an image", Operation{ID: "x", Type: OpPhoto, PickupID: p.ID, RecordedAt: day, Data: base64.StdEncoding.EncodeToString([]byte("hello"))}},
+		{"Signature not base64", Operation{ID: "x", Type: OpSignature, PickupID: p.ID, RecordedAt: day, SignedBy: "Jane", Data: "!!"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.op.ID != "" {
+				// Rejections are remembered too, so each case needs its own ID.
+				tt.op.ID = tt.name
+			}
+			results, err := svc.Sync("col1", []Operation{tt.op})
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if results[0].Outcome != OutcomeRejected || results[0].Error == "" {
+				t.Errorf("result = %+v, want rejected", results[0])
+			}
+		})
+	}
+
+	results, _ := svc.Sync("col2", []Operation{{ID: "x", Type: OpScan, PickupID: p.ID, RecordedAt: day, Serial: "SN1"}})
+	if results[0].Outcome != OutcomeRejected {
+		t.Errorf("other collector's sync = %+v, want rejected", results[0])
+	}
+	if _, err := svc.Sync("col1", make([]Operation, MaxBatchSize+1)); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("Sync(oversized) error = %v, want ErrBatchTooLarge", err)
+	}
+}
@@ -0,0 +1,588 @@
+// Package compliance produces the periodic e-waste returns submitted to
+// environmental regulators: tonnage collected by category, county and
+// certified partner, and how completely each pickup's chain of custody is
+// documented.
+package compliance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/collections"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the compliance service.
+const (
+	partnersBucket  = "compliance_partners"
+	handoversBucket = "compliance_handovers"
+	reportsBucket   = "compliance_reports"
+)
+
+// GenerateKind is the job kind that generates the reports falling due. One
+// runs at the start of every month, when a month, and sometimes a quarter
+// and a year, has just ended.
+const GenerateKind = "compliance.generate"
+
+// GenerateOptions is the retry schedule of report generation.
+var GenerateOptions = jobs.Options{
+	MaxAttempts: 5,
+	Backoff:     10 * time.Minute,
+	MaxBackoff:  6 * time.Hour,
+	Timeout:     10 * time.Minute,
+}
+
+// Reporting periods.
+const (
+	PeriodMonthly   = "monthly"
+	PeriodQuarterly = "quarterly"
+	PeriodAnnual    = "annual"
+)
+
+// Custody checks. A pickup's custody is complete when none are missing.
+const (
+	CheckCollector = "collector"
+	CheckWeighed   = "weighed"
+	CheckSignature = "signature"
+	CheckHandover  = "handover"
+	CheckCertified = "certified_partner"
+	CheckProcessed = "processed"
+)
+
+// Checks lists the custody checks in the order they happen.
+var Checks = []string{CheckCollector, CheckWeighed, CheckSignature, CheckHandover, CheckCertified, CheckProcessed}
+
+// checkLabels describe the custody checks in rendered reports.
+var checkLabels = map[string]string{
+	CheckCollector: "No collector assigned",
+	CheckWeighed:   "Items not weighed",
+	CheckSignature: "No resident signature",
+	CheckHandover:  "Not handed to a partner",
+	CheckCertified: "Partner not certified on handover",
+	CheckProcessed: "Not yet processed",
+}
+
+var (
+	// ErrNotFound is returned when a report has not been generated.
+	ErrNotFound = errors.New("compliance report not found")
+	// ErrInvalidPeriod is returned for a malformed or unfinished reporting period.
+	ErrInvalidPeriod = errors.New("invalid reporting period")
+	// ErrInvalidPartner is returned when a partner fails validation.
+	ErrInvalidPartner = errors.New("invalid partner")
+	// ErrPartnerNotFound is returned for an unknown partner.
+	ErrPartnerNotFound = errors.New("partner not found")
+	// ErrInvalidHandover is returned when a handover fails validation.
+	ErrInvalidHandover = errors.New("invalid handover")
+	// ErrHandoverExists is returned when a pickup has already been handed over.
+	ErrHandoverExists = errors.New("pickup has already been handed over")
+	// ErrHandoverNotFound is returned when a pickup has not been handed over.
+	ErrHandoverNotFound = errors.New("no handover recorded for this pickup")
+	// ErrNoOperator is returned when the operator filing the returns is
+	// missing or incomplete; no report is generated without it.
+	ErrNoOperator = errors.New("compliance operator is not configured")
+)
+
+// Operator identifies the licensed collector filing the return.
+type Operator struct {
+	Name    string `json:"name"`
+	Licence string `json:"licence"`
+	Address string `json:"address"`
+}
+
+// ValidateOperator checks that the operator printed at the head of every
+// report has a name, a licence number and an address.
+func ValidateOperator(o Operator) error {
+	switch {
+	case strings.TrimSpace(o.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrNoOperator)
+	case strings.TrimSpace(o.Licence) == "":
+		return fmt.Errorf("%w: licence is required", ErrNoOperator)
+	case strings.TrimSpace(o.Address) == "":
+		return fmt.Errorf("%w: address is required", ErrNoOperator)
+	}
+	return nil
+}
+
+// Period is a reporting period running from From up to but excluding To.
+// IDs are "2026-10" for a month, "2026-Q3" for a quarter and "2026" for a year.
+type Period struct {
+	ID   string    `json:"id"`
+	Kind string    `json:"kind"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// ParsePeriod reads a period ID.
+func ParsePeriod(id string) (Period, error) {
+	p := Period{ID: id}
+	year, rest, _ := strings.Cut(id, "-")
+	y, err := strconv.Atoi(year)
+	if err != nil || len(year) != 4 {
+		return p, fmt.Errorf("%w: %q is not YYYY, YYYY-MM or YYYY-Qn", ErrInvalidPeriod, id)
+	}
+	switch {
+	case rest == "":
+		p.Kind = PeriodAnnual
+		p.From = time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+		p.To = p.From.AddDate(1, 0, 0)
+	case len(rest) == 2 && rest[0] == 'Q' && rest[1] >= '1' && rest[1] <= '4':
+		p.Kind = PeriodQuarterly
+		p.From = time.Date(y, time.Month(3*int(rest[1]-'1')+1), 1, 0, 0, 0, 0, time.UTC)
+		p.To = p.From.AddDate(0, 3, 0)
+	default:
+		m, err := strconv.Atoi(rest)
+		if err != nil || len(rest) != 2 || m < 1 || m > 12 {
+			return p, fmt.Errorf("%w: %q is not YYYY, YYYY-MM or YYYY-Qn", ErrInvalidPeriod, id)
+		}
+		p.Kind = PeriodMonthly
+		p.From = time.Date(y, time.Month(m), 1, 0, 0, 0, 0, time.UTC)
+		p.To = p.From.AddDate(0, 1, 0)
+	}
+	return p, nil
+}
+
+// Label names the period for people, e.g. "October 2026" or "Q3 2026".
+func (p Period) Label() string {
+	switch p.Kind {
+	case PeriodMonthly:
+		return p.From.Format("January 2006")
+	case PeriodQuarterly:
+		return fmt.Sprintf("Q%d %d", (int(p.From.Month())-1)/3+1, p.From.Year())
+	default:
+		return strconv.Itoa(p.From.Year())
+	}
+}
+
+// lastComplete returns the IDs of the most recent month, quarter and year
+// that ended before now.
+func lastComplete(now time.Time) []string {
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	quarter := time.Date(now.Year(), time.Month((int(now.Month())-1)/3*3+1), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -3, 0)
+	return []string{
+		month.Format("2006-01"),
+		fmt.Sprintf("%d-Q%d", quarter.Year(), (int(quarter.Month())-1)/3+1),
+		strconv.Itoa(now.Year() - 1),
+	}
+}
+
+// Row is the tonnage attributed to one category, county or partner.
+// EstimatedKg is the part of WeightKg taken from catalogue weights because
+// the items were not weighed.
+type Row struct {
+	Key         string  `json:"key"`
+	Label       string  `json:"label"`
+	Pickups     int     `json:"pickups"`
+	Units       int     `json:"units"`
+	WeightKg    float64 `json:"weight_kg"`
+	EstimatedKg float64 `json:"estimated_kg"`
+}
+
+// Tonnes returns the row's weight in tonnes.
+func (r *Row) Tonnes() float64 {
+	return r.WeightKg / 1000
+}
+
+// Gap is a pickup whose custody record is incomplete.
+type Gap struct {
+	PickupID    string    `json:"pickup_id"`
+	County      string    `json:"county,omitempty"`
+	CollectedAt time.Time `json:"collected_at"`
+	Missing     []string  `json:"missing"`
+}
+
+// Custody summarises how completely the period's pickups are documented
+// from the resident's door to a certified partner.
+type Custody struct {
+	Pickups  int            `json:"pickups"`
+	Complete int            `json:"complete"`
+	Percent  float64        `json:"percent"`
+	Missing  map[string]int `json:"missing"`
+	Gaps     []Gap          `json:"gaps"`
+}
+
+// Report is a compliance return for one period. It is a snapshot: later
+// changes to pickups only show up if the report is generated again.
+type Report struct {
+	Period
+	Label       string    `json:"label"`
+	Operator    Operator  `json:"operator"`
+	GeneratedAt time.Time `json:"generated_at"`
+	GeneratedBy string    `json:"generated_by"`
+	Totals      Row       `json:"totals"`
+	ByCategory  []Row     `json:"by_category"`
+	ByCounty    []Row     `json:"by_county"`
+	ByPartner   []Row     `json:"by_partner"`
+	Custody     Custody   `json:"custody"`
+}
+
+// Summary is the listing entry of a generated report.
+type Summary struct {
+	ID             string    `json:"id"`
+	Kind           string    `json:"kind"`
+	Label          string    `json:"label"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	GeneratedAt    time.Time `json:"generated_at"`
+	GeneratedBy    string    `json:"generated_by"`
+	Tonnes         float64   `json:"tonnes"`
+	CustodyPercent float64   `json:"custody_percent"`
+}
+
+// Service keeps partners and handovers and generates compliance reports.
+type Service struct {
+	store     *store.Store
+	queue     *jobs.Queue
+	operator  Operator
+	now       func() time.Time
+	listeners []HandoverListener
+}
+
+// NewService creates a compliance service backed by s that files reports
+// on behalf of operator. Reports are only generated if operator passes
+// ValidateOperator.
+func NewService(s *store.Store, operator Operator) *Service {
+	return &Service{store: s, operator: operator, now: time.Now}
+}
+
+// HandoverListener is notified of every handover, inside the transaction
+// that records it.
+type HandoverListener func(tx *store.Tx, h *Handover) error
+
+// Subscribe registers l to be called whenever a handover is recorded.
+func (s *Service) Subscribe(l HandoverListener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// Generate computes the report for a finished period and stores it,
+// replacing any earlier version.
+func (s *Service) Generate(periodID, actor string) (*Report, error) {
+	if err := ValidateOperator(s.operator); err != nil {
+		return nil, err
+	}
+	period, err := ParsePeriod(periodID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	if period.To.After(now) {
+		return nil, fmt.Errorf("%w: %s has not ended yet", ErrInvalidPeriod, period.Label())
+	}
+
+	var report *Report
+	err = s.store.Update(func(tx *store.Tx) error {
+		report, err = s.build(tx, period)
+		if err != nil {
+			return err
+		}
+		report.GeneratedAt, report.GeneratedBy = now, actor
+		return tx.Put(reportsBucket, period.ID, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// tally accumulates the rows of one grouping. A pickup counts once towards
+// each row however many of its items fall in it.
+type tally struct {
+	rows map[string]*Row
+	seen map[string]bool
+}
+
+func newTally() *tally {
+	return &tally{rows: map[string]*Row{}, seen: map[string]bool{}}
+}
+
+func (t *tally) add(key, label, pickupID string, units int, weight, estimated float64) {
+	row := t.rows[key]
+	if row == nil {
+		row = &Row{Key: key, Label: label}
+		t.rows[key] = row
+	}
+	if !t.seen[key+"/"+pickupID] {
+		t.seen[key+"/"+pickupID] = true
+		row.Pickups++
+	}
+	row.Units += units
+	row.WeightKg += weight
+	row.EstimatedKg += estimated
+}
+
+// sorted returns the rows heaviest first.
+func (t *tally) sorted() []Row {
+	rows := []Row{}
+	for _, row := range t.rows {
+		row.WeightKg, row.EstimatedKg = round(row.WeightKg), round(row.EstimatedKg)
+		rows = append(rows, *row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].WeightKg != rows[j].WeightKg {
+			return rows[i].WeightKg > rows[j].WeightKg
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
+
+// round keeps gram precision.
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// build covers every pickup collected in the period that was not cancelled.
+func (s *Service) build(tx *store.Tx, period Period) (*Report, error) {
+	list, err := pickups.ListTx(tx, func(p *pickups.Pickup) bool {
+		at := p.ChangedAt(pickups.StatusCollected)
+		return p.Status != pickups.StatusCancelled && !at.IsZero() && !at.Before(period.From) && at.Before(period.To)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Period:   period,
+		Label:    period.Label(),
+		Operator: s.operator,
+		Totals:   Row{Key: "total", Label: "Total"},
+		Custody:  Custody{Missing: map[string]int{}, Gaps: []Gap{}},
+	}
+	byCategory, byCounty, byPartner := newTally(), newTally(), newTally()
+	partners := map[string]*Partner{}
+
+	for _, p := range list {
+		handover, partner, err := custodyOf(tx, p.ID, partners)
+		if err != nil {
+			return nil, err
+		}
+		county, countyLabel := p.County, p.County
+		if county == "" {
+			county, countyLabel = "unknown", "County not recorded"
+		}
+		partnerKey, partnerLabel := "", "Awaiting handover"
+		if partner != nil {
+			partnerKey, partnerLabel = partner.ID, partner.Name+" ("+partner.Licence+")"
+		}
+
+		for _, item := range p.Items {
+			weight, estimated, err := itemWeight(tx, item)
+			if err != nil {
+				return nil, err
+			}
+			label := item.Category
+			if spec, err := items.LookupTx(tx, item.Category, ""); err == nil {
+				label = spec.Name
+			}
+			byCategory.add(item.Category, label, p.ID, item.Quantity, weight, estimated)
+			byCounty.add(county, countyLabel, p.ID, item.Quantity, weight, estimated)
+			byPartner.add(partnerKey, partnerLabel, p.ID, item.Quantity, weight, estimated)
+			report.Totals.Units += item.Quantity
+			report.Totals.WeightKg += weight
+			report.Totals.EstimatedKg += estimated
+		}
+		report.Totals.Pickups++
+
+		missing, err := missingChecks(tx, p, handover, partner)
+		if err != nil {
+			return nil, err
+		}
+		report.Custody.Pickups++
+		if len(missing) == 0 {
+			report.Custody.Complete++
+			continue
+		}
+		for _, check := range missing {
+			report.Custody.Missing[check]++
+		}
+		report.Custody.Gaps = append(report.Custody.Gaps, Gap{
+			PickupID: p.ID, County: p.County, CollectedAt: p.ChangedAt(pickups.StatusCollected), Missing: missing,
+		})
+	}
+
+	report.Totals.WeightKg, report.Totals.EstimatedKg = round(report.Totals.WeightKg), round(report.Totals.EstimatedKg)
+	report.ByCategory, report.ByCounty, report.ByPartner = byCategory.sorted(), byCounty.sorted(), byPartner.sorted()
+	if report.Custody.Pickups > 0 {
+		report.Custody.Percent = math.Round(1000*float64(report.Custody.Complete)/float64(report.Custody.Pickups)) / 10
+	}
+	return report, nil
+}
+
+// custodyOf returns the handover of a pickup and the partner it went to,
+// both nil if it has not been handed over. Partners are cached in known.
+func custodyOf(tx *store.Tx, pickupID string, known map[string]*Partner) (*Handover, *Partner, error) {
+	var h Handover
+	if err := tx.Get(handoversBucket, pickupID, &h); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	if p, ok := known[h.PartnerID]; ok {
+		return &h, p, nil
+	}
+	var p Partner
+	if err := tx.Get(partnersBucket, h.PartnerID, &p); err != nil {
+		return nil, nil, fmt.Errorf("error loading partner %s: %w", h.PartnerID, err)
+	}
+	known[p.ID] = &p
+	return &h, &p, nil
+}
+
+// itemWeight returns the weight of an item and how much of it is estimated.
+func itemWeight(tx *store.Tx, item pickups.Item) (weight, estimated float64, err error) {
+	if weight := item.EarningWeightKg(); weight > 0 {
+		return weight, 0, nil
+	}
+	perUnit, err := items.UnitWeightKgTx(tx, item)
+	if err != nil {
+		return 0, 0, err
+	}
+	weight = perUnit * float64(item.Quantity)
+	return weight, weight, nil
+}
+
+// missingChecks returns the custody checks p fails, in Checks order.
+func missingChecks(tx *store.Tx, p *pickups.Pickup, h *Handover, partner *Partner) ([]string, error) {
+	collection, err := collections.GetTx(tx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	weighed := len(p.Items) > 0
+	for _, item := range p.Items {
+		if item.MeasuredWeightKg <= 0 {
+			weighed = false
+		}
+	}
+
+	var missing []string
+	for _, check := range Checks {
+		var ok bool
+		switch check {
+		case CheckCollector:
+			ok = p.CollectorID != ""
+		case CheckWeighed:
+			ok = weighed
+		case CheckSignature:
+			ok = collection.Signature != nil
+		case CheckHandover:
+			ok = h != nil
+		case CheckCertified:
+			ok = h != nil && partner.CertifiedOn(h.HandedOverAt)
+		case CheckProcessed:
+			ok = p.Status == pickups.StatusProcessed
+		}
+		if !ok {
+			missing = append(missing, check)
+		}
+	}
+	return missing, nil
+}
+
+// Get returns a generated report.
+func (s *Service) Get(id string) (*Report, error) {
+	var r Report
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.Get(reportsBucket, id, &r)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// List returns the generated reports, latest period first.
+func (s *Service) List() ([]Summary, error) {
+	list := []Summary{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(reportsBucket, func(key string, raw json.RawMessage) error {
+			var r Report
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return fmt.Errorf("error decoding compliance report %s: %w", key, err)
+			}
+			list = append(list, Summary{
+				ID: r.ID, Kind: r.Kind, Label: r.Label, From: r.From, To: r.To,
+				GeneratedAt: r.GeneratedAt, GeneratedBy: r.GeneratedBy,
+				Tonnes: r.Totals.Tonnes(), CustodyPercent: r.Custody.Percent,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].To.Equal(list[j].To) {
+			return list[i].To.After(list[j].To)
+		}
+		return list[i].From.After(list[j].From)
+	})
+	return list, nil
+}
+
+// GenerateDue generates the reports for the last complete month, quarter
+// and year that have not been generated yet, and returns their IDs.
+func (s *Service) GenerateDue() ([]string, error) {
+	var generated []string
+	for _, id := range lastComplete(s.now()) {
+		var exists bool
+		if err := s.store.View(func(tx *store.Tx) error {
+			exists = tx.Exists(reportsBucket, id)
+			return nil
+		}); err != nil {
+			return generated, err
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.Generate(id, "scheduler"); err != nil {
+			return generated, fmt.Errorf("error generating compliance report %s: %w", id, err)
+		}
+		generated = append(generated, id)
+	}
+	return generated, nil
+}
+
+// Schedule has queue generate the reports that are due now and then at the
+// start of every month.
+func (s *Service) Schedule(queue *jobs.Queue) error {
+	s.queue = queue
+	queue.Register(GenerateKind, s.generate, GenerateOptions)
+	return s.scheduleAt(s.now())
+}
+
+// scheduleAt queues a GenerateKind job for t unless one is already queued
+// for that month.
+func (s *Service) scheduleAt(t time.Time) error {
+	t = t.UTC()
+	_, err := s.queue.Enqueue(GenerateKind, nil, jobs.EnqueueOptions{UniqueKey: t.Format("2006-01"), RunAt: t})
+	return err
+}
+
+// generate runs a GenerateKind job. The next month's job is queued first,
+// so a month whose reports keep failing does not stop later ones.
+func (s *Service) generate(ctx context.Context, job *jobs.Job) error {
+	now := s.now().UTC()
+	if err := s.scheduleAt(time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		return err
+	}
+	generated, err := s.GenerateDue()
+	for _, id := range generated {
+		log.Printf("Generated compliance report %s.", id)
+	}
+	return err
+}
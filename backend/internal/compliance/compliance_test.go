@@ -0,0 +1,357 @@
+package compliance
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/collections"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/photos"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var testOperator = Operator{Name: "ZingiraTech Ltd", Licence: "EW/C/TEST", Address: "Nairobi, Kenya"}
+
+type fixture struct {
+	svc         *Service
+	pickups     *pickups.Service
+	collections *collections.Service
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	db := store.NewMemory()
+	if err := items.NewService(db).Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	storage, err := photos.NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+	pickupService := pickups.NewService(db)
+	f := &fixture{
+		svc:         NewService(db, testOperator),
+		pickups:     pickupService,
+		collections: collections.NewService(db, pickupService, photos.NewService(db, storage, []byte("secret"))),
+	}
+	// Every period containing the pickups below has ended.
+	f.svc.now = func() time.Time { return time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	for _, p := range []Partner{
+		{ID: "greencycle", Name: "GreenCycle", Licence: "EW/R/001", CertifiedFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), CertifiedUntil: time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{ID: "oldco", Name: "OldCo", Licence: "EW/R/002", CertifiedFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), CertifiedUntil: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		if _, err := f.svc.SavePartner(p, "admin"); err != nil {
+			t.Fatalf("SavePartner() error = %v", err)
+		}
+	}
+	return f
+}
+
+// collect books a pickup of list and takes it through to collected.
+func (f *fixture) collect(t *testing.T, list ...pickups.Item) *pickups.Pickup {
+	t.Helper()
+	p, err := f.pickups.Create("resident", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning", Items: list,
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := f.pickups.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if p, err = f.pickups.Transition(p.ID, pickups.StatusCollected, "col1"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	return p
+}
+
+func (f *fixture) sign(t *testing.T, p *pickups.Pickup) {
+	t.Helper()
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n0000"))
+	results, err := f.collections.Sync("col1", []collections.Operation{
+		{ID: "sig-" + p.ID, Type: collections.OpSignature, PickupID: p.ID, RecordedAt: time.Now(), SignedBy: "Jane", Data: png},
+	})
+	if err != nil || results[0].Outcome != collections.OutcomeApplied {
+		t.Fatalf("Sync() = %+v, %v", results, err)
+	}
+}
+
+// weigh records the collector weighing item i of p.
+func (f *fixture) weigh(t *testing.T, p *pickups.Pickup, i int, kg float64) {
+	t.Helper()
+	results, err := f.collections.Sync("col1", []collections.Operation{
+		{ID: "weight-" + p.ID, Type: collections.OpWeight, PickupID: p.ID, RecordedAt: time.Now(), Item: &i, WeightKg: kg},
+	})
+	if err != nil || results[0].Outcome != collections.OutcomeApplied {
+		t.Fatalf("Sync() = %+v, %v", results, err)
+	}
+}
+
+func (f *fixture) handOver(t *testing.T, p *pickups.Pickup, partnerID string) {
+	t.Helper()
+	h := Handover{PickupID: p.ID, PartnerID: partnerID, Reference: "CN-" + p.ID, HandedOverAt: time.Now()}
+	if _, err := f.svc.RecordHandover(h, "admin"); err != nil {
+		t.Fatalf("RecordHandover() error = %v", err)
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func TestGenerate(t *testing.T) {
+	f := newFixture(t)
+	complete := f.collect(t, pickups.Item{Category: "computers", Subcategory: "laptops", Quantity: 1, WeightKg: 3})
+	f.weigh(t, complete, 0, 3)
+	f.sign(t, complete)
+	f.handOver(t, complete, "greencycle")
+	if _, err := f.pickups.Transition(complete.ID, pickups.StatusProcessed, "admin"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	partial := f.collect(t, pickups.Item{Category: "phones", Quantity: 2})
+	f.handOver(t, partial, "oldco")
+	cancelled := f.collect(t, pickups.Item{Category: "phones", Quantity: 1})
+	if _, err := f.pickups.Transition(cancelled.ID, pickups.StatusCancelled, "admin"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+
+	period := complete.ChangedAt(pickups.StatusCollected).Format("2006-01")
+	r, err := f.svc.Generate(period, "admin")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if r.Totals.Pickups != 2 || r.Totals.Units != 3 || !near(r.Totals.WeightKg, 3.4) || !near(r.Totals.EstimatedKg, 0.4) {
+		t.Errorf("unexpected totals %+v", r.Totals)
+	}
+	if len(r.ByCategory) != 2 || r.ByCategory[0].Key != "computers" || r.ByCategory[1].Label != "Phones and tablets" {
+		t.Errorf("unexpected categories %+v", r.ByCategory)
+	}
+	if len(r.ByCounty) != 1 || r.ByCounty[0].Key != "unknown" || r.ByCounty[0].Pickups != 2 {
+		t.Errorf("unexpected counties %+v", r.ByCounty)
+	}
+	if len(r.ByPartner) != 2 || r.ByPartner[0].Key != "greencycle" || r.ByPartner[1].Label != "OldCo (EW/R/002)" {
+		t.Errorf("unexpected partners %+v", r.ByPartner)
+	}
+
+	if r.Custody.Pickups != 2 || r.Custody.Complete != 1 || r.Custody.Percent != 50 || len(r.Custody.Gaps) != 1 {
+		t.Fatalf("unexpected custody %+v", r.Custody)
+	}
+	want := []string{CheckWeighed, CheckSignature, CheckCertified, CheckProcessed}
+	if gap := r.Custody.Gaps[0]; gap.PickupID != partial.ID || !reflect.DeepEqual(gap.Missing, want) {
+		t.Errorf("gap = %+v, want %s missing %v", gap, partial.ID, want)
+	}
+
+	stored, err := f.svc.Get(period)
+	if err != nil || stored.GeneratedBy != "admin" || stored.Custody.Complete != 1 {
+		t.Errorf("Get() = %+v, %v", stored, err)
+	}
+}
+
+func TestGenerateRefusesUnfinishedPeriod(t *testing.T) {
+	f := newFixture(t)
+	f.svc.now = func() time.Time { return time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC) }
+	for _, id := range []string{"2026-10", "2026-Q4", "2026", "2026-13", "26-Q1", "2026-Q5"} {
+		if _, err := f.svc.Generate(id, "admin"); !errors.Is(err, ErrInvalidPeriod) {
+			t.Errorf("Generate(%q) error = %v, want ErrInvalidPeriod", id, err)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		id    string
+		kind  string
+		from  time.Time
+		to    time.Time
+		label string
+	}{
+		{"2026-09", PeriodMonthly, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), "September 2026"},
+		{"2026-Q4", PeriodQuarterly, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), "Q4 2026"},
+		{"2025", PeriodAnnual, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), "2025"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			p, err := ParsePeriod(tt.id)
+			if err != nil {
+				t.Fatalf("ParsePeriod() error = %v", err)
+			}
+			if p.Kind != tt.kind || !p.From.Equal(tt.from) || !p.To.Equal(tt.to) || p.Label() != tt.label {
+				t.Errorf("ParsePeriod() = %+v (%s)", p, p.Label())
+			}
+		})
+	}
+}
+
+func TestGenerateDue(t *testing.T) {
+	f := newFixture(t)
+	f.svc.now = func() time.Time { return time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC) }
+	generated, err := f.svc.GenerateDue()
+	if err != nil || !reflect.DeepEqual(generated, []string{"2026-09", "2026-Q3", "2025"}) {
+		t.Fatalf("GenerateDue() = %v, %v", generated, err)
+	}
+	if generated, _ := f.svc.GenerateDue(); len(generated) != 0 {
+		t.Errorf("second GenerateDue() = %v, want nothing", generated)
+	}
+	list, _ := f.svc.List()
+	if len(list) != 3 || list[0].ID != "2026-09" || list[1].ID != "2026-Q3" || list[2].GeneratedBy != "scheduler" {
+		t.Errorf("List() = %+v", list)
+	}
+}
+
+func TestScheduleGeneratesDueReportsMonthly(t *testing.T) {
+	f := newFixture(t)
+	// The queue runs on the real clock.
+	f.svc.now = time.Now
+	queue := jobs.NewQueue(f.svc.store, 1)
+	if err := f.svc.Schedule(queue); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx, 5*time.Millisecond)
+	defer queue.Drain(context.Background())
+
+	due := lastComplete(time.Now())
+	deadline := time.Now().Add(2 * time.Second)
+	for list, _ := f.svc.List(); len(list) < len(due); list, _ = f.svc.List() {
+		if time.Now().After(deadline) {
+			t.Fatalf("reports = %+v, want %v", list, due)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	queued, _ := queue.List(jobs.Filter{Kind: GenerateKind, Status: jobs.StatusQueued})
+	if len(queued) != 1 || !queued[0].RunAt.Equal(next) {
+		t.Errorf("queued = %+v, want one run at %s", queued, next)
+	}
+}
+
+func TestRecordHandover(t *testing.T) {
+	f := newFixture(t)
+	booked, err := f.pickups.Create("resident", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning", Items: []pickups.Item{{Category: "phones", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	collected := f.collect(t, pickups.Item{Category: "phones", Quantity: 1})
+
+	tests := []struct {
+		name string
+		h    Handover
+		err  error
+	}{
+		{"Not collected", Handover{PickupID: booked.ID, PartnerID: "greencycle", Reference: "CN-1"}, ErrInvalidHandover},
+		{"No reference", Handover{PickupID: collected.ID, PartnerID: "greencycle"}, ErrInvalidHandover},
+		{"Unknown partner", Handover{PickupID: collected.ID, PartnerID: "nobody", Reference: "CN-1"}, ErrPartnerNotFound},
+		{"Unknown pickup", Handover{PickupID: "pk_404", PartnerID: "greencycle", Reference: "CN-1"}, pickups.ErrNotFound},
+		{"Before collection", Handover{PickupID: collected.ID, PartnerID: "greencycle", Reference: "CN-1",
+			HandedOverAt: collected.ChangedAt(pickups.StatusCollected).Add(-time.Minute)}, ErrInvalidHandover},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := f.svc.RecordHandover(tt.h, "admin"); !errors.Is(err, tt.err) {
+				t.Errorf("RecordHandover() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	f.handOver(t, collected, "greencycle")
+	again := Handover{PickupID: collected.ID, PartnerID: "oldco", Reference: "CN-2"}
+	if _, err := f.svc.RecordHandover(again, "admin"); !errors.Is(err, ErrHandoverExists) {
+		t.Errorf("second RecordHandover() error = %v, want ErrHandoverExists", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	f := newFixture(t)
+	p := f.collect(t, pickups.Item{Category: "batteries", Subcategory: "lead_acid", Quantity: 2})
+	r, err := f.svc.Generate(p.ChangedAt(pickups.StatusCollected).Format("2006-Q")+quarterOf(p), "admin")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	data, err := CSV(r)
+	if err != nil {
+		t.Fatalf("CSV() error = %v", err)
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || records[0][0] != "E-waste collection return" || records[9][0] != "total" || records[9][4] != "24" {
+		t.Errorf("CSV() = %q, %v", records, err)
+	}
+
+	data, err = XLSX(r)
+	if err != nil {
+		t.Fatalf("XLSX() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("XLSX() is not a zip archive: %v", err)
+	}
+	names := map[string]bool{}
+	for _, file := range zr.File {
+		names[file.Name] = true
+	}
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet5.xml"} {
+		if !names[name] {
+			t.Errorf("XLSX() is missing %s", name)
+		}
+	}
+
+	if data := PDF(r); !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Errorf("PDF() does not start with a PDF header")
+	}
+}
+
+func TestGenerateRequiresOperator(t *testing.T) {
+	f := newFixture(t)
+	f.svc.operator = Operator{Name: "ZingiraTech Ltd", Address: "Nairobi, Kenya"}
+	if _, err := f.svc.Generate("2026-09", "admin"); !errors.Is(err, ErrNoOperator) {
+		t.Errorf("Generate() without a licence error = %v, want ErrNoOperator", err)
+	}
+}
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	r := &Report{Operator: Operator{Name: "=HYPERLINK(\"http://evil\")", Licence: "@SUM(A1)", Address: "-2+3"}}
+	data, err := CSV(r)
+	if err != nil {
+		t.Fatalf("CSV() error = %v", err)
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("CSV() is not valid CSV: %v", err)
+	}
+	want := []string{"'=HYPERLINK(\"http://evil\")", "'@SUM(A1)", "'-2+3"}
+	for i, cell := range want {
+		if got := records[i+1][1]; got != cell {
+			t.Errorf("row %d = %q, want %q", i+1, got, cell)
+		}
+	}
+}
+
+func quarterOf(p *pickups.Pickup) string {
+	return string(rune('1' + (int(p.ChangedAt(pickups.StatusCollected).Month())-1)/3))
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
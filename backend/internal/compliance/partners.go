@@ -0,0 +1,194 @@
+package compliance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// validPartnerID matches partner IDs, which appear in report rows and file names.
+var validPartnerID = regexp.MustCompile(`^[a-z0-9_]{1,40}$`)
+
+// Partner is a licensed recycler or refurbisher that takes custody of
+// collected e-waste. A handover only counts towards custody completeness if
+// the partner's licence was valid on the day.
+type Partner struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Licence        string    `json:"licence"`
+	County         string    `json:"county,omitempty"`
+	CertifiedFrom  time.Time `json:"certified_from"`
+	CertifiedUntil time.Time `json:"certified_until"`
+	UpdatedBy      string    `json:"updated_by"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CertifiedOn reports whether the partner's licence covers t. Both ends of
+// the licence period are whole days.
+func (p *Partner) CertifiedOn(t time.Time) bool {
+	day := t.UTC().Truncate(24 * time.Hour)
+	return !day.Before(p.CertifiedFrom.UTC().Truncate(24*time.Hour)) &&
+		!day.After(p.CertifiedUntil.UTC().Truncate(24*time.Hour))
+}
+
+func (p *Partner) validate() error {
+	switch {
+	case !validPartnerID.MatchString(p.ID):
+		return fmt.Errorf("%w: id must be 1-40 lowercase letters, digits or underscores", ErrInvalidPartner)
+	case strings.TrimSpace(p.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidPartner)
+	case strings.TrimSpace(p.Licence) == "":
+		return fmt.Errorf("%w: licence number is required", ErrInvalidPartner)
+	case p.CertifiedFrom.IsZero() || p.CertifiedUntil.IsZero():
+		return fmt.Errorf("%w: certification dates are required", ErrInvalidPartner)
+	case p.CertifiedUntil.Before(p.CertifiedFrom):
+		return fmt.Errorf("%w: certification must end after it starts", ErrInvalidPartner)
+	}
+	return nil
+}
+
+// Handover records a pickup's e-waste passing into a partner's custody.
+// Reference is the consignment or waste tracking note number.
+type Handover struct {
+	PickupID     string    `json:"pickup_id"`
+	PartnerID    string    `json:"partner_id"`
+	Reference    string    `json:"reference"`
+	HandedOverAt time.Time `json:"handed_over_at"`
+	RecordedBy   string    `json:"recorded_by"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// Partners returns every partner, sorted by name.
+func (s *Service) Partners() ([]Partner, error) {
+	list := []Partner{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(partnersBucket, func(key string, raw json.RawMessage) error {
+			var p Partner
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return fmt.Errorf("error decoding partner %s: %w", key, err)
+			}
+			list = append(list, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Partner returns the partner with the given ID.
+func (s *Service) Partner(id string) (*Partner, error) {
+	var p Partner
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.Get(partnersBucket, id, &p)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrPartnerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CertifiedTx reports whether the partner with the given ID is registered and
+// certified today. It is an apikeys.PartnerCheck.
+func (s *Service) CertifiedTx(tx *store.Tx, partnerID string) (bool, error) {
+	var p Partner
+	if err := tx.Get(partnersBucket, partnerID, &p); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return p.CertifiedOn(s.now()), nil
+}
+
+// SavePartner creates or replaces a partner.
+func (s *Service) SavePartner(p Partner, actor string) (*Partner, error) {
+	p.Name, p.Licence = strings.TrimSpace(p.Name), strings.TrimSpace(p.Licence)
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	p.UpdatedBy = actor
+	p.UpdatedAt = s.now().UTC()
+	if err := s.store.Update(func(tx *store.Tx) error {
+		return tx.Put(partnersBucket, p.ID, p)
+	}); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// RecordHandover records that the items of a collected pickup were handed to
+// a partner. Handovers are evidence and cannot be changed once recorded.
+func (s *Service) RecordHandover(h Handover, actor string) (*Handover, error) {
+	h.Reference = strings.TrimSpace(h.Reference)
+	if h.Reference == "" {
+		return nil, fmt.Errorf("%w: a consignment note reference is required", ErrInvalidHandover)
+	}
+	now := s.now().UTC()
+	if h.HandedOverAt.IsZero() {
+		h.HandedOverAt = now
+	}
+	if h.HandedOverAt.After(now) {
+		return nil, fmt.Errorf("%w: the handover cannot be in the future", ErrInvalidHandover)
+	}
+	h.RecordedBy, h.RecordedAt = actor, now
+
+	err := s.store.Update(func(tx *store.Tx) error {
+		pickup, err := pickups.GetTx(tx, h.PickupID)
+		if err != nil {
+			return err
+		}
+		if pickup.Status != pickups.StatusCollected && pickup.Status != pickups.StatusProcessed {
+			return fmt.Errorf("%w: pickup %s has not been collected", ErrInvalidHandover, pickup.ID)
+		}
+		if collected := pickup.ChangedAt(pickups.StatusCollected); h.HandedOverAt.Before(collected) {
+			return fmt.Errorf("%w: pickup %s was not collected until %s", ErrInvalidHandover, pickup.ID, collected.Format(time.RFC3339))
+		}
+		if !tx.Exists(partnersBucket, h.PartnerID) {
+			return ErrPartnerNotFound
+		}
+		if tx.Exists(handoversBucket, h.PickupID) {
+			return ErrHandoverExists
+		}
+		if err := tx.Insert(handoversBucket, h.PickupID, h); err != nil {
+			return err
+		}
+		for _, listener := range s.listeners {
+			if err := listener(tx, &h); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Handover returns the handover recorded for a pickup.
+func (s *Service) Handover(pickupID string) (*Handover, error) {
+	var h Handover
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.Get(handoversBucket, pickupID, &h)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrHandoverNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
@@ -0,0 +1,272 @@
+package compliance
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pdf"
+)
+
+// Download formats.
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatPDF  = "pdf"
+)
+
+// ContentTypes maps each download format to its media type.
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatPDF:  "application/pdf",
+}
+
+// Filename is the suggested name of a report download.
+func (r *Report) Filename(format string) string {
+	return fmt.Sprintf("ewaste-return-%s.%s", r.ID, format)
+}
+
+// Render writes r in one of the download formats.
+func Render(r *Report, format string) ([]byte, error) {
+	switch format {
+	case FormatCSV:
+		return CSV(r)
+	case FormatXLSX:
+		return XLSX(r)
+	case FormatPDF:
+		return PDF(r), nil
+	}
+	return nil, fmt.Errorf("unknown report format %q", format)
+}
+
+// sheet is one table of a report. Cells hold strings, ints or float64s so
+// that spreadsheets keep numbers as numbers.
+type sheet struct {
+	name string
+	rows [][]interface{}
+}
+
+var rowHeader = []interface{}{"Key", "Description", "Pickups", "Units", "Weight (kg)", "Estimated (kg)", "Tonnes"}
+
+func rowCells(r Row) []interface{} {
+	return []interface{}{r.Key, r.Label, r.Pickups, r.Units, r.WeightKg, r.EstimatedKg, r.Tonnes()}
+}
+
+// sheets lays r out as the tables shared by the CSV and XLSX formats.
+func sheets(r *Report) []sheet {
+	summary := sheet{name: "Summary", rows: [][]interface{}{
+		{"E-waste collection return"},
+		{"Operator", r.Operator.Name},
+		{"Licence", r.Operator.Licence},
+		{"Address", r.Operator.Address},
+		{"Period", r.Label},
+		{"From", r.From.Format("2006-01-02")},
+		{"To", r.To.AddDate(0, 0, -1).Format("2006-01-02")},
+		{"Generated", r.GeneratedAt.Format("2006-01-02 15:04 MST")},
+		{},
+		rowHeader,
+		rowCells(r.Totals),
+		{},
+		{"Custody", "Pickups", "Complete", "Percent"},
+		{"", r.Custody.Pickups, r.Custody.Complete, r.Custody.Percent},
+		{},
+		{"Check", "Pickups missing it"},
+	}}
+	for _, check := range Checks {
+		summary.rows = append(summary.rows, []interface{}{checkLabels[check], r.Custody.Missing[check]})
+	}
+
+	result := []sheet{summary}
+	for _, group := range []struct {
+		name string
+		rows []Row
+	}{{"By category", r.ByCategory}, {"By county", r.ByCounty}, {"By partner", r.ByPartner}} {
+		s := sheet{name: group.name, rows: [][]interface{}{rowHeader}}
+		for _, row := range group.rows {
+			s.rows = append(s.rows, rowCells(row))
+		}
+		result = append(result, s)
+	}
+
+	gaps := sheet{name: "Custody gaps", rows: [][]interface{}{{"Pickup", "County", "Collected", "Missing"}}}
+	for _, g := range r.Custody.Gaps {
+		gaps.rows = append(gaps.rows, []interface{}{g.PickupID, g.County, g.CollectedAt.Format("2006-01-02"), strings.Join(g.Missing, "; ")})
+	}
+	return append(result, gaps)
+}
+
+// csvText is cellText for CSV files. Text starting with a character a
+// spreadsheet would read as a formula is prefixed with a quote, so that a
+// partner name or reference cannot run a formula when the file is opened.
+func csvText(v interface{}) string {
+	text := cellText(v)
+	if _, ok := v.(string); ok && text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func cellText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// CSV renders r as one file with a titled section per table.
+func CSV(r *Report) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for i, s := range sheets(r) {
+		if i > 0 {
+			w.Write(nil)
+			w.Write([]string{s.name})
+		}
+		for _, row := range s.rows {
+			record := make([]string, len(row))
+			for j, v := range row {
+				record[j] = csvText(v)
+			}
+			w.Write(record)
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Column positions of the PDF tables, in points from the left edge.
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	colPickups   = 330.0
+	colUnits     = 390.0
+	colTonnes    = 460.0
+	colEstimated = marginRight
+	pageBottom   = pdf.PageHeight - 80
+)
+
+// PDF renders r as a printable return.
+func PDF(r *Report) []byte {
+	doc := pdf.New("E-waste collection return " + r.Label)
+	y := 60.0
+	newPage := func() {
+		doc.AddPage()
+		y = 60
+	}
+
+	doc.Text(marginLeft, y, 18, true, "E-waste collection return")
+	doc.TextRight(marginRight, y, 12, true, r.Label)
+	y += 24
+	for _, line := range []string{
+		r.Operator.Name,
+		"Licence: " + r.Operator.Licence,
+		r.Operator.Address,
+		fmt.Sprintf("Period: %s to %s", r.From.Format("02 Jan 2006"), r.To.AddDate(0, 0, -1).Format("02 Jan 2006")),
+		"Generated: " + r.GeneratedAt.Format("02 Jan 2006 15:04 MST"),
+	} {
+		doc.Text(marginLeft, y, 9, false, line)
+		y += 12
+	}
+
+	y += 12
+	doc.Text(marginLeft, y, 11, true, fmt.Sprintf("Total collected: %.3f t from %d pickups (%d units)", r.Totals.Tonnes(), r.Totals.Pickups, r.Totals.Units))
+	y += 14
+	if r.Totals.WeightKg > 0 {
+		doc.Text(marginLeft, y, 9, false, fmt.Sprintf("%.1f%% of the weight is estimated from catalogue weights.", 100*r.Totals.EstimatedKg/r.Totals.WeightKg))
+		y += 12
+	}
+
+	for _, group := range []struct {
+		title string
+		rows  []Row
+	}{{"Tonnage by category", r.ByCategory}, {"Tonnage by county", r.ByCounty}, {"Tonnage by certified partner", r.ByPartner}} {
+		if y > pageBottom-60 {
+			newPage()
+		}
+		y += 20
+		doc.Text(marginLeft, y, 11, true, group.title)
+		y += 16
+		header := func() {
+			doc.TextRight(colPickups, y, 9, true, "Pickups")
+			doc.TextRight(colUnits, y, 9, true, "Units")
+			doc.TextRight(colTonnes, y, 9, true, "Tonnes")
+			doc.TextRight(colEstimated, y, 9, true, "Estimated (t)")
+			doc.Line(marginLeft, y+5, marginRight, y+5)
+			y += 18
+		}
+		header()
+		for _, row := range group.rows {
+			if y > pageBottom {
+				newPage()
+				header()
+			}
+			doc.Text(marginLeft, y, 9, false, truncate(row.Label, 44))
+			doc.TextRight(colPickups, y, 9, false, strconv.Itoa(row.Pickups))
+			doc.TextRight(colUnits, y, 9, false, strconv.Itoa(row.Units))
+			doc.TextRight(colTonnes, y, 9, false, fmt.Sprintf("%.3f", row.Tonnes()))
+			doc.TextRight(colEstimated, y, 9, false, fmt.Sprintf("%.3f", row.EstimatedKg/1000))
+			y += 14
+		}
+	}
+
+	if y > pageBottom-120 {
+		newPage()
+	}
+	y += 20
+	doc.Text(marginLeft, y, 11, true, "Chain of custody")
+	y += 16
+	doc.Text(marginLeft, y, 9, false, fmt.Sprintf("%d of %d pickups (%.1f%%) are documented from collection to a certified partner.",
+		r.Custody.Complete, r.Custody.Pickups, r.Custody.Percent))
+	y += 16
+	for _, check := range Checks {
+		doc.Text(marginLeft+10, y, 9, false, checkLabels[check])
+		doc.TextRight(colPickups, y, 9, false, strconv.Itoa(r.Custody.Missing[check]))
+		y += 13
+	}
+
+	if len(r.Custody.Gaps) > 0 {
+		y += 14
+		header := func() {
+			doc.Text(marginLeft, y, 9, true, "Pickup")
+			doc.Text(140, y, 9, true, "Collected")
+			doc.Text(210, y, 9, true, "Missing")
+			doc.Line(marginLeft, y+5, marginRight, y+5)
+			y += 18
+		}
+		header()
+		for _, g := range r.Custody.Gaps {
+			if y > pageBottom {
+				newPage()
+				header()
+			}
+			missing := make([]string, len(g.Missing))
+			for i, check := range g.Missing {
+				missing[i] = checkLabels[check]
+			}
+			doc.Text(marginLeft, y, 8, false, g.PickupID)
+			doc.Text(140, y, 8, false, g.CollectedAt.Format("02 Jan 2006"))
+			doc.Text(210, y, 8, false, truncate(strings.Join(missing, ", "), 80))
+			y += 13
+		}
+	}
+
+	doc.Text(marginLeft, pdf.PageHeight-50, 8, false,
+		"Weights are measured at collection unless marked as estimated. Prepared for submission to the environmental regulator.")
+	return doc.Bytes()
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/compliance"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Event types. Pickup events carry a PickupChange, points events a
+// PointsChange and custody events a compliance.Handover.
+const (
+	PickupScheduled  = "pickup.scheduled"
+	PickupAssigned   = "pickup.assigned"
+	PickupUnassigned = "pickup.unassigned"
+	PickupCollected  = "pickup.collected"
+	PickupProcessed  = "pickup.processed"
+	PickupCancelled  = "pickup.cancelled"
+	PointsAwarded    = "points.awarded"
+	PointsDeducted   = "points.deducted"
+	HandoverRecorded = "custody.handover_recorded"
+)
+
+// Types lists every event type.
+var Types = []string{
+	PickupScheduled, PickupAssigned, PickupUnassigned, PickupCollected, PickupProcessed, PickupCancelled,
+	PointsAwarded, PointsDeducted, HandoverRecorded,
+}
+
+// pickupEvents maps the status a pickup moves to onto its event type. A
+// pickup moving back to scheduled has lost its collector; one moving from
+// assigned to assigned has been handed to another collector or partner.
+var pickupEvents = map[string]string{
+	pickups.StatusScheduled: PickupUnassigned,
+	pickups.StatusAssigned:  PickupAssigned,
+	pickups.StatusCollected: PickupCollected,
+	pickups.StatusProcessed: PickupProcessed,
+	pickups.StatusCancelled: PickupCancelled,
+}
+
+// PickupChange describes a pickup status change.
+type PickupChange struct {
+	PickupID    string         `json:"pickup_id"`
+	UserID      string         `json:"user_id"`
+	From        string         `json:"from,omitempty"`
+	Status      string         `json:"status"`
+	Actor       string         `json:"actor,omitempty"`
+	CollectorID string         `json:"collector_id,omitempty"`
+	PartnerID   string         `json:"partner_id,omitempty"`
+	County      string         `json:"county,omitempty"`
+	ServiceArea string         `json:"service_area,omitempty"`
+	Date        string         `json:"date"`
+	TimeSlot    string         `json:"time_slot"`
+	Items       []pickups.Item `json:"items"`
+}
+
+// PointsChange describes points credited to or debited from a user.
+type PointsChange struct {
+	UserID    string    `json:"user_id"`
+	Points    int64     `json:"points"`
+	PostingID string    `json:"posting_id"`
+	Reason    string    `json:"reason"`
+	Reference string    `json:"reference,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// OnPickupTransition is a pickups.Listener that publishes the event for
+// each status change.
+func (b *Bus) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	eventType := pickupEvents[p.Status]
+	if from == "" {
+		eventType = PickupScheduled
+	}
+	if eventType == "" {
+		return nil
+	}
+	change := PickupChange{
+		PickupID:    p.ID,
+		UserID:      p.UserID,
+		From:        from,
+		Status:      p.Status,
+		CollectorID: p.CollectorID,
+		PartnerID:   p.PartnerID,
+		County:      p.County,
+		ServiceArea: p.ServiceArea,
+		Date:        p.Date,
+		TimeSlot:    p.TimeSlot,
+		Items:       p.Items,
+	}
+	if n := len(p.History); n > 0 {
+		change.Actor = p.History[n-1].Actor
+	}
+	_, err := b.PublishTx(tx, eventType, p.ID, change)
+	return err
+}
+
+// OnPosting is a rewards.Listener that publishes an event for every user
+// account a posting credits or debits. Points held for review are not the
+// user's yet, so only their release is reported.
+func (b *Bus) OnPosting(tx *store.Tx, posting *rewards.Posting) error {
+	for _, line := range posting.Lines {
+		uid, ok := strings.CutPrefix(line.Account, rewards.UserAccount(""))
+		if !ok {
+			continue
+		}
+		eventType := PointsAwarded
+		if line.Direction == rewards.Debit {
+			eventType = PointsDeducted
+		}
+		_, err := b.PublishTx(tx, eventType, uid, PointsChange{
+			UserID:    uid,
+			Points:    line.Points,
+			PostingID: posting.ID,
+			Reason:    posting.Reason,
+			Reference: posting.Reference,
+			At:        posting.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnHandover is a compliance.HandoverListener that publishes the handover of
+// a pickup's items to a recycler.
+func (b *Bus) OnHandover(tx *store.Tx, h *compliance.Handover) error {
+	_, err := b.PublishTx(tx, HandoverRecorded, h.PickupID, h)
+	return err
+}
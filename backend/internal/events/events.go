@@ -0,0 +1,334 @@
+// Package events records domain events, such as a pickup being collected or
+// points being awarded, and delivers them to subscribers. Events are written
+// to an outbox in the same transaction as the change they describe, so one
+// is never lost or invented by a rollback; a dispatcher then hands each to
+// the background job queue once per subscriber, which delivers it at least
+// once, retrying with backoff.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets. Events are kept by sequence so their keys sort in the order
+// they happened; the outbox holds the sequence keys of events not yet handed
+// to subscribers.
+const (
+	eventsBucket = "events"
+	outboxBucket = "events_outbox"
+)
+
+// Headers the webhooks package sends with every delivery. Receivers should
+// use the event ID to ignore repeat deliveries.
+const (
+	HeaderEventID   = "X-Zingira-Event-Id"
+	HeaderEventType = "X-Zingira-Event-Type"
+)
+
+// DeliverKind is the job kind of a delivery of one event to one subscriber.
+const DeliverKind = "events.deliver"
+
+// dispatchBatch caps how many events one dispatch transaction moves out of
+// the outbox.
+const dispatchBatch = 100
+
+// DeliveryOptions govern how deliveries are retried. A subscriber that is
+// down for longer than the retries last leaves dead letters in the job queue,
+// which an admin can retry.
+var DeliveryOptions = jobs.Options{
+	Concurrency: 4,
+	MaxAttempts: 10,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  6 * time.Hour,
+	Timeout:     time.Minute,
+}
+
+// ErrNotFound is returned when an event does not exist.
+var ErrNotFound = errors.New("event not found")
+
+// Event is something that happened to the domain. Subject is the ID of the
+// thing it happened to, such as a pickup, and Data describes it in a form
+// that depends on Type.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Subject    string          `json:"subject"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Decode unmarshals the event's data into v.
+func (e *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("error decoding %s data: %w", e.Type, err)
+	}
+	return nil
+}
+
+// eventKey returns the store key of the event with the given ID.
+func eventKey(id string) (string, bool) {
+	seq, err := strconv.ParseUint(strings.TrimPrefix(id, "evt_"), 10, 64)
+	if err != nil || !strings.HasPrefix(id, "evt_") {
+		return "", false
+	}
+	return store.SequenceKey(seq), true
+}
+
+// Handler receives the events a subscriber is interested in. An event may be
+// delivered more than once, so handlers must tolerate repeats; returning an
+// error has it delivered again later, unless it wraps jobs.ErrPermanent.
+type Handler func(ctx context.Context, e *Event) error
+
+type subscriber struct {
+	name    string
+	types   map[string]bool
+	handler Handler
+}
+
+func (s *subscriber) wants(eventType string) bool {
+	return len(s.types) == 0 || s.types[eventType]
+}
+
+// delivery is the payload of a DeliverKind job.
+type delivery struct {
+	EventID    string `json:"event_id"`
+	Subscriber string `json:"subscriber"`
+}
+
+// Filter selects events.
+type Filter struct {
+	Type    string
+	Subject string
+	Limit   int
+}
+
+// Bus stores events and dispatches them to subscribers.
+type Bus struct {
+	store *store.Store
+	queue *jobs.Queue
+	now   func() time.Time
+
+	mu          sync.Mutex
+	subscribers map[string]*subscriber
+	wake        chan struct{}
+}
+
+// NewBus creates a bus backed by s that delivers events through queue.
+func NewBus(s *store.Store, queue *jobs.Queue) *Bus {
+	s.AppendOnly(eventsBucket)
+	b := &Bus{
+		store:       s,
+		queue:       queue,
+		now:         time.Now,
+		subscribers: map[string]*subscriber{},
+		wake:        make(chan struct{}, 1),
+	}
+	queue.Register(DeliverKind, b.deliver, DeliveryOptions)
+	return b
+}
+
+// Subscribe registers handler to receive events of the given types, or of
+// every type when none are given. The name identifies the subscriber in
+// queued deliveries, so it must stay the same across restarts. Subscribers
+// only receive events dispatched after they subscribe.
+func (b *Bus) Subscribe(name string, handler Handler, types ...string) {
+	sub := &subscriber{name: name, types: map[string]bool{}, handler: handler}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[name] = sub
+}
+
+func (b *Bus) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PublishTx records an event inside tx, the transaction making the change
+// it describes. It is dispatched once tx commits.
+func (b *Bus) PublishTx(tx *store.Tx, eventType, subject string, data interface{}) (*Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+	seq, err := tx.NextSequence(eventsBucket)
+	if err != nil {
+		return nil, err
+	}
+	e := &Event{
+		ID:         fmt.Sprintf("evt_%d", seq),
+		Type:       eventType,
+		Subject:    subject,
+		Data:       raw,
+		OccurredAt: b.now().UTC(),
+	}
+	key := store.SequenceKey(seq)
+	if err := tx.Insert(eventsBucket, key, e); err != nil {
+		return nil, err
+	}
+	if err := tx.Put(outboxBucket, key, e.ID); err != nil {
+		return nil, err
+	}
+	tx.OnCommit(b.signal)
+	return e, nil
+}
+
+// Dispatch moves the events waiting in the outbox onto the job queue, one
+// delivery per interested subscriber, and returns how many events it moved.
+// Each event leaves the outbox in the same transaction that queues its
+// deliveries.
+func (b *Bus) Dispatch() (int, error) {
+	b.mu.Lock()
+	subs := make([]*subscriber, 0, len(b.subscribers))
+	for _, sub := range b.subscribers {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+	sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+
+	total := 0
+	for {
+		n := 0
+		err := b.store.Update(func(tx *store.Tx) error {
+			n = 0
+			var keys []string
+			err := tx.ForEach(outboxBucket, func(key string, _ json.RawMessage) error {
+				if len(keys) < dispatchBatch {
+					keys = append(keys, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				var e Event
+				if err := tx.Get(eventsBucket, key, &e); err != nil {
+					return fmt.Errorf("error loading outbox event %s: %w", key, err)
+				}
+				for _, sub := range subs {
+					if !sub.wants(e.Type) {
+						continue
+					}
+					_, err := b.queue.EnqueueTx(tx, DeliverKind, delivery{EventID: e.ID, Subscriber: sub.name},
+						jobs.EnqueueOptions{UniqueKey: e.ID + "/" + sub.name})
+					if err != nil {
+						return err
+					}
+				}
+				if err := tx.Delete(outboxBucket, key); err != nil {
+					return err
+				}
+			}
+			n = len(keys)
+			return nil
+		})
+		total += n
+		if err != nil || n < dispatchBatch {
+			return total, err
+		}
+	}
+}
+
+// Run dispatches events as they are published, and every interval in case a
+// signal was missed, until ctx is done.
+func (b *Bus) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := b.Dispatch(); err != nil {
+			log.Printf("Events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// deliver runs a DeliverKind job.
+func (b *Bus) deliver(ctx context.Context, job *jobs.Job) error {
+	var d delivery
+	if err := job.Decode(&d); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	sub := b.subscribers[d.Subscriber]
+	b.mu.Unlock()
+	if sub == nil {
+		return fmt.Errorf("%w: no subscriber called %q", jobs.ErrPermanent, d.Subscriber)
+	}
+	e, err := b.Event(d.EventID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %v", jobs.ErrPermanent, err)
+	}
+	if err != nil {
+		return err
+	}
+	return sub.handler(ctx, e)
+}
+
+// Event returns the event with the given ID.
+func (b *Bus) Event(id string) (*Event, error) {
+	key, ok := eventKey(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	var e Event
+	err := b.store.View(func(tx *store.Tx) error {
+		return tx.Get(eventsBucket, key, &e)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Events returns the events matching filter, newest first, up to
+// filter.Limit when it is set.
+func (b *Bus) Events(filter Filter) ([]Event, error) {
+	list := []Event{}
+	err := b.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(eventsBucket, func(key string, raw json.RawMessage) error {
+			var e Event
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return fmt.Errorf("error decoding event %s: %w", key, err)
+			}
+			if (filter.Type == "" || e.Type == filter.Type) && (filter.Subject == "" || e.Subject == filter.Subject) {
+				list = append(list, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,211 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+type fixture struct {
+	db      *store.Store
+	bus     *Bus
+	queue   *jobs.Queue
+	pickups *pickups.Service
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	db := store.NewMemory()
+	queue := jobs.NewQueue(db, 4)
+	f := &fixture{db: db, queue: queue, bus: NewBus(db, queue), pickups: pickups.NewService(db)}
+	// Retry quickly so tests do not wait out the real backoff.
+	queue.Register(DeliverKind, f.bus.deliver, jobs.Options{Concurrency: 4, MaxAttempts: 3, Backoff: time.Millisecond})
+	f.pickups.Subscribe(f.bus.OnPickupTransition)
+	return f
+}
+
+// start runs the queue until the test ends.
+func (f *fixture) start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go f.queue.Run(ctx, 5*time.Millisecond)
+	t.Cleanup(func() {
+		cancel()
+		f.queue.Drain(context.Background())
+	})
+}
+
+func (f *fixture) book(t *testing.T) *pickups.Pickup {
+	t.Helper()
+	p, err := f.pickups.Create("amina", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "phones", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return p
+}
+
+func (f *fixture) dispatch(t *testing.T) int {
+	t.Helper()
+	n, err := f.bus.Dispatch()
+	if err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	return n
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+// recorder is a subscriber that remembers what it was sent.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+	fail   int
+}
+
+func (r *recorder) handle(ctx context.Context, e *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("subscriber unavailable")
+	}
+	r.events = append(r.events, e.Type+" "+e.Subject)
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+func TestEventsAreWrittenWithTheChange(t *testing.T) {
+	f := newFixture(t)
+	p := f.book(t)
+	if _, err := f.pickups.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	list, err := f.bus.Events(Filter{Subject: p.ID})
+	if err != nil || len(list) != 2 || list[0].Type != PickupAssigned || list[1].Type != PickupScheduled {
+		t.Fatalf("Events() = %+v, %v", list, err)
+	}
+	var change PickupChange
+	if err := list[0].Decode(&change); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if change.From != pickups.StatusScheduled || change.CollectorID != "col1" || change.Actor != "admin" || len(change.Items) != 1 {
+		t.Errorf("assignment event data = %+v", change)
+	}
+
+	// A change that is rolled back leaves no event behind.
+	err = f.db.Update(func(tx *store.Tx) error {
+		if _, err := f.pickups.TransitionTx(tx, p.ID, pickups.StatusCollected, "col1"); err != nil {
+			return err
+		}
+		return errors.New("photo upload failed")
+	})
+	if err == nil {
+		t.Fatal("Update() succeeded, want the injected error")
+	}
+	if list, _ := f.bus.Events(Filter{Type: PickupCollected}); len(list) != 0 {
+		t.Errorf("rolled-back change published %+v", list)
+	}
+	if n := f.dispatch(t); n != 2 {
+		t.Errorf("Dispatch() moved %d events, want 2", n)
+	}
+	if n := f.dispatch(t); n != 0 {
+		t.Errorf("second Dispatch() moved %d events", n)
+	}
+}
+
+func TestPostingsPublishPointsEvents(t *testing.T) {
+	f := newFixture(t)
+	ledger := rewards.NewLedger(f.db)
+	ledger.Subscribe(f.bus.OnPosting)
+
+	err := f.db.Update(func(tx *store.Tx) error {
+		_, err := ledger.PostTx(tx, rewards.PostingRequest{
+			IdempotencyKey: "hold:p1", Reason: "pickup_points", Reference: "p1",
+			Lines: rewards.Transfer(rewards.AccountIssued, rewards.PendingAccount("amina"), 50),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := ledger.PostTx(tx, rewards.PostingRequest{
+			IdempotencyKey: "release:p1", Reason: "hold_released", Reference: "p1",
+			Lines: rewards.Transfer(rewards.PendingAccount("amina"), rewards.UserAccount("amina"), 50),
+		}); err != nil {
+			return err
+		}
+		_, err = ledger.SpendTx(tx, "amina", 20, "redeem:1", "redemption", "rdm_1", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("posting error = %v", err)
+	}
+	// Replaying a posting does not publish it again.
+	if _, err := ledger.Post(rewards.PostingRequest{
+		IdempotencyKey: "release:p1", Reason: "hold_released", Reference: "p1",
+		Lines: rewards.Transfer(rewards.PendingAccount("amina"), rewards.UserAccount("amina"), 50),
+	}); err != nil {
+		t.Fatalf("replay error = %v", err)
+	}
+
+	list, _ := f.bus.Events(Filter{Subject: "amina"})
+	if len(list) != 2 || list[1].Type != PointsAwarded || list[0].Type != PointsDeducted {
+		t.Fatalf("Events() = %+v, want an award then a deduction", list)
+	}
+	var awarded PointsChange
+	list[1].Decode(&awarded)
+	if awarded.Points != 50 || awarded.Reason != "hold_released" || awarded.Reference != "p1" {
+		t.Errorf("award data = %+v", awarded)
+	}
+}
+
+func TestEachSubscriberGetsItsEventsAtLeastOnce(t *testing.T) {
+	f := newFixture(t)
+	everything, pickupsOnly, flaky := &recorder{}, &recorder{}, &recorder{fail: 2}
+	f.bus.Subscribe("audit", everything.handle)
+	f.bus.Subscribe("dispatch-board", pickupsOnly.handle, PickupAssigned)
+	f.bus.Subscribe("crm", flaky.handle, PickupScheduled)
+
+	p := f.book(t)
+	f.pickups.Assign(p.ID, "col1", "", "admin")
+	f.dispatch(t)
+	f.start(t)
+
+	waitFor(t, "deliveries", func() bool {
+		return everything.count() == 2 && pickupsOnly.count() == 1 && flaky.count() == 1
+	})
+	// The flaky subscriber's retries did not resend to the others.
+	time.Sleep(20 * time.Millisecond)
+	if everything.count() != 2 || pickupsOnly.events[0] != PickupAssigned+" "+p.ID {
+		t.Errorf("audit got %v, board got %v", everything.events, pickupsOnly.events)
+	}
+	deliveries, _ := f.queue.List(jobs.Filter{Kind: DeliverKind})
+	for _, job := range deliveries {
+		if job.Status != jobs.StatusSucceeded {
+			t.Errorf("delivery %s is %s", job.ID, job.Status)
+		}
+	}
+}
@@ -0,0 +1,516 @@
+package fraud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the fraud module.
+const (
+	casesBucket = "fraud_cases"
+	flagsBucket = "fraud_pickup_flags"
+)
+
+// Case types, one per detected pattern.
+const (
+	TypeSharedAddress       = "shared_address"
+	TypeDuplicateSerial     = "duplicate_serial"
+	TypeCancelledAfterAward = "cancelled_after_award"
+	TypeRedemptionVelocity  = "redemption_velocity"
+	TypeWeightMismatch      = "weight_mismatch"
+)
+
+// Case states.
+const (
+	StatusOpen      = "open"
+	StatusReleased  = "released"
+	StatusConfirmed = "confirmed"
+)
+
+var (
+	// ErrCaseNotFound is returned when a case does not exist.
+	ErrCaseNotFound = errors.New("fraud case not found")
+	// ErrCaseClosed is returned when resolving a case that is no longer open.
+	ErrCaseClosed = errors.New("fraud case already resolved")
+)
+
+// Thresholds tune the detectors.
+type Thresholds struct {
+	// MaxAccountsPerAddress is the number of distinct accounts allowed to book pickups at one address.
+	MaxAccountsPerAddress int
+	// MaxRedemptions is the number of redemptions allowed within RedemptionWindow.
+	MaxRedemptions   int
+	RedemptionWindow time.Duration
+	// MaxWeightDeviation is how far, as a fraction of the declared weight, the
+	// collector's measurement may differ before the pickup is reviewed.
+	MaxWeightDeviation float64
+}
+
+// DefaultThresholds are used in production.
+var DefaultThresholds = Thresholds{
+	MaxAccountsPerAddress: 3,
+	MaxRedemptions:        3,
+	RedemptionWindow:      24 * time.Hour,
+	MaxWeightDeviation:    0.5,
+}
+
+// Case is a suspicious pattern awaiting review by an admin.
+type Case struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	UserID     string    `json:"user_id"`
+	Subject    string    `json:"subject"`
+	Details    string    `json:"details"`
+	HeldPoints int64     `json:"held_points"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResolvedBy string    `json:"resolved_by,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"`
+	Notes      string    `json:"notes,omitempty"`
+}
+
+// Listener is notified when a case is resolved, inside the transaction that
+// records the outcome.
+type Listener func(tx *store.Tx, c *Case) error
+
+// Detector flags suspicious pickups and redemptions, holds the points
+// involved and keeps the review queue.
+type Detector struct {
+	store      *store.Store
+	ledger     *rewards.Ledger
+	catalogue  *rewards.Catalogue
+	thresholds Thresholds
+	now        func() time.Time
+	listeners  []Listener
+}
+
+// NewDetector creates a fraud detector.
+func NewDetector(s *store.Store, ledger *rewards.Ledger, catalogue *rewards.Catalogue, thresholds Thresholds) *Detector {
+	return &Detector{store: s, ledger: ledger, catalogue: catalogue, thresholds: thresholds, now: time.Now}
+}
+
+// Subscribe registers l to be called whenever a case is released or confirmed.
+func (d *Detector) Subscribe(l Listener) {
+	d.listeners = append(d.listeners, l)
+}
+
+// OnPickupTransition is a pickups.Listener. It must be subscribed after the
+// earning engine so that points awarded in the same transaction can be held.
+func (d *Detector) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	switch {
+	case from == "":
+		return d.screenNewPickup(tx, p)
+	case p.Status == pickups.StatusProcessed:
+		if err := d.screenWeights(tx, p); err != nil {
+			return err
+		}
+		return d.holdFlaggedAward(tx, p)
+	case p.Status == pickups.StatusCancelled && from == pickups.StatusProcessed:
+		return d.holdCancelledAward(tx, p)
+	}
+	return nil
+}
+
+// screenNewPickup looks for shared addresses and reused serial numbers.
+func (d *Detector) screenNewPickup(tx *store.Tx, p *pickups.Pickup) error {
+	address := NormalizeAddress(p.Address)
+	serials := make(map[string]bool)
+	for _, item := range p.Items {
+		if serial := strings.ToUpper(strings.TrimSpace(item.SerialNumber)); serial != "" {
+			serials[serial] = true
+		}
+	}
+
+	accounts := map[string]bool{p.UserID: true}
+	duplicates := make(map[string]string)
+	others, err := pickups.ListTx(tx, func(other *pickups.Pickup) bool { return other.ID != p.ID })
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if NormalizeAddress(other.Address) == address {
+			accounts[other.UserID] = true
+		}
+		for _, item := range other.Items {
+			serial := strings.ToUpper(strings.TrimSpace(item.SerialNumber))
+			if serials[serial] {
+				duplicates[serial] = other.ID
+			}
+		}
+	}
+
+	if d.thresholds.MaxAccountsPerAddress > 0 && len(accounts) > d.thresholds.MaxAccountsPerAddress {
+		details := fmt.Sprintf("%d accounts have booked pickups at %q", len(accounts), p.Address)
+		if err := d.flagPickup(tx, p, TypeSharedAddress, details); err != nil {
+			return err
+		}
+	}
+	for serial, otherID := range duplicates {
+		details := fmt.Sprintf("serial number %s was already handed over in pickup %s", serial, otherID)
+		if err := d.flagPickup(tx, p, TypeDuplicateSerial, details); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// screenWeights flags a processed pickup whose measured weights differ from
+// the declared ones by more than MaxWeightDeviation. Points are earned on the
+// measured weight, so a large gap points at a mis-recorded scale reading.
+func (d *Detector) screenWeights(tx *store.Tx, p *pickups.Pickup) error {
+	if d.thresholds.MaxWeightDeviation <= 0 {
+		return nil
+	}
+	var gaps []string
+	for i, item := range p.Items {
+		if item.WeightKg <= 0 || item.MeasuredWeightKg <= 0 {
+			continue
+		}
+		if math.Abs(item.MeasuredWeightKg-item.WeightKg) > d.thresholds.MaxWeightDeviation*item.WeightKg {
+			gaps = append(gaps, fmt.Sprintf("item %d (%s) declared %.1f kg, weighed %.1f kg", i, item.Category, item.WeightKg, item.MeasuredWeightKg))
+		}
+	}
+	if len(gaps) == 0 {
+		return nil
+	}
+	return d.flagPickup(tx, p, TypeWeightMismatch, strings.Join(gaps, "; "))
+}
+
+// flagPickup opens a case for a pickup and remembers it so that points are held when the pickup is processed.
+func (d *Detector) flagPickup(tx *store.Tx, p *pickups.Pickup, caseType, details string) error {
+	c, err := d.openCase(tx, caseType, p.UserID, p.ID, details)
+	if err != nil {
+		return err
+	}
+	var flags []string
+	if err := tx.Get(flagsBucket, p.ID, &flags); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return tx.Put(flagsBucket, p.ID, append(flags, c.ID))
+}
+
+// holdFlaggedAward moves the points awarded for a flagged pickup into the
+// pending account while its case is open, and forfeits them if the case was
+// already confirmed before the pickup was processed.
+func (d *Detector) holdFlaggedAward(tx *store.Tx, p *pickups.Pickup) error {
+	var flags []string
+	if err := tx.Get(flagsBucket, p.ID, &flags); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var target, confirmed *Case
+	for _, id := range flags {
+		c, err := getCase(tx, id)
+		if err != nil {
+			return err
+		}
+		if c.Status == StatusOpen {
+			target = c
+			break
+		}
+		if c.Status == StatusConfirmed && confirmed == nil {
+			confirmed = c
+		}
+	}
+	if target == nil && confirmed == nil {
+		return nil
+	}
+
+	awarded, err := d.awardedPoints(tx, p)
+	if err != nil || awarded == 0 {
+		return err
+	}
+	if target == nil {
+		return d.forfeit(tx, confirmed, p, awarded)
+	}
+	return d.hold(tx, target, awarded)
+}
+
+// forfeit returns the points awarded for pickup p to the issued account on
+// behalf of case c, which has already been confirmed.
+func (d *Detector) forfeit(tx *store.Tx, c *Case, p *pickups.Pickup, points int64) error {
+	_, err := d.ledger.PostTx(tx, rewards.PostingRequest{
+		IdempotencyKey: "fraud-forfeit:" + p.ID,
+		Reason:         "fraud_review",
+		Reference:      c.ID,
+		Lines:          rewards.Transfer(rewards.UserAccount(p.UserID), rewards.AccountIssued, points),
+	})
+	return err
+}
+
+// holdCancelledAward opens a case when a pickup is cancelled after points were
+// awarded, holding whatever part of the award the user has not yet spent and
+// that earlier cases on the pickup have not already held or forfeited.
+func (d *Detector) holdCancelledAward(tx *store.Tx, p *pickups.Pickup) error {
+	awarded, err := d.awardedPoints(tx, p)
+	if err != nil || awarded == 0 {
+		return err
+	}
+
+	c, err := d.openCase(tx, TypeCancelledAfterAward, p.UserID, p.ID,
+		fmt.Sprintf("pickup cancelled after %d points were awarded", awarded))
+	if err != nil {
+		return err
+	}
+
+	withheld, err := d.withheldPoints(tx, p)
+	if err != nil {
+		return err
+	}
+	awarded -= withheld
+	balance, err := d.ledger.BalanceTx(tx, rewards.UserAccount(p.UserID))
+	if err != nil {
+		return err
+	}
+	if balance < awarded {
+		awarded = balance
+	}
+	if awarded <= 0 {
+		return nil
+	}
+	return d.hold(tx, c, awarded)
+}
+
+// withheldPoints is the part of pickup p's award that its open or confirmed
+// cases already hold or have forfeited.
+func (d *Detector) withheldPoints(tx *store.Tx, p *pickups.Pickup) (int64, error) {
+	cases, err := PickupCasesTx(tx, p.ID)
+	if err != nil {
+		return 0, err
+	}
+	var withheld int64
+	for _, c := range cases {
+		if c.Status == StatusOpen || c.Status == StatusConfirmed {
+			withheld += c.HeldPoints
+		}
+	}
+
+	posting, err := d.ledger.PostingByKeyTx(tx, "fraud-forfeit:"+p.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return withheld, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range posting.Lines {
+		if line.Account == rewards.UserAccount(p.UserID) && line.Direction == rewards.Debit {
+			withheld += line.Points
+		}
+	}
+	return withheld, nil
+}
+
+func (d *Detector) awardedPoints(tx *store.Tx, p *pickups.Pickup) (int64, error) {
+	posting, err := d.ledger.PostingByKeyTx(tx, rewards.PickupAwardKey(p.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range posting.Lines {
+		if line.Account == rewards.UserAccount(p.UserID) && line.Direction == rewards.Credit {
+			return line.Points, nil
+		}
+	}
+	return 0, nil
+}
+
+// hold moves points from the user's account to their pending account on behalf of case c.
+func (d *Detector) hold(tx *store.Tx, c *Case, points int64) error {
+	if _, err := d.ledger.PostTx(tx, rewards.PostingRequest{
+		IdempotencyKey: "fraud-hold:" + c.ID,
+		Reason:         "fraud_hold",
+		Reference:      c.ID,
+		Lines:          rewards.Transfer(rewards.UserAccount(c.UserID), rewards.PendingAccount(c.UserID), points),
+	}); err != nil {
+		return err
+	}
+	c.HeldPoints = points
+	return tx.Put(casesBucket, c.ID, c)
+}
+
+// ScreenRedemption is a rewards.RedemptionScreen that holds redemptions made too quickly in succession.
+func (d *Detector) ScreenRedemption(tx *store.Tx, uid string, reward rewards.Reward, redemptionID string) (bool, error) {
+	if d.thresholds.MaxRedemptions <= 0 {
+		return false, nil
+	}
+	redemptions, err := rewards.RedemptionsTx(tx, uid)
+	if err != nil {
+		return false, err
+	}
+
+	since := d.now().UTC().Add(-d.thresholds.RedemptionWindow)
+	recent := 0
+	for _, r := range redemptions {
+		if r.CreatedAt.After(since) {
+			recent++
+		}
+	}
+	if recent < d.thresholds.MaxRedemptions {
+		return false, nil
+	}
+
+	details := fmt.Sprintf("%d redemptions within %s before redeeming %s", recent, d.thresholds.RedemptionWindow, reward.Name)
+	c, err := d.openCase(tx, TypeRedemptionVelocity, uid, redemptionID, details)
+	if err != nil {
+		return false, err
+	}
+	c.HeldPoints = reward.PointsCost
+	return true, tx.Put(casesBucket, c.ID, c)
+}
+
+func (d *Detector) openCase(tx *store.Tx, caseType, uid, subject, details string) (*Case, error) {
+	seq, err := tx.NextSequence(casesBucket)
+	if err != nil {
+		return nil, err
+	}
+	c := &Case{
+		ID:        fmt.Sprintf("case_%d", seq),
+		Type:      caseType,
+		UserID:    uid,
+		Subject:   subject,
+		Details:   details,
+		Status:    StatusOpen,
+		CreatedAt: d.now().UTC(),
+	}
+	if err := tx.Insert(casesBucket, c.ID, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// PickupCasesTx returns the cases that flagged the pickup with the given ID
+// before or when it was processed.
+func PickupCasesTx(tx *store.Tx, pickupID string) ([]*Case, error) {
+	var flags []string
+	if err := tx.Get(flagsBucket, pickupID, &flags); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	cases := make([]*Case, 0, len(flags))
+	for _, id := range flags {
+		c, err := getCase(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func getCase(tx *store.Tx, id string) (*Case, error) {
+	var c Case
+	if err := tx.Get(casesBucket, id, &c); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrCaseNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Case returns the case with the given ID.
+func (d *Detector) Case(id string) (*Case, error) {
+	var c *Case
+	err := d.store.View(func(tx *store.Tx) error {
+		var err error
+		c, err = getCase(tx, id)
+		return err
+	})
+	return c, err
+}
+
+// Cases returns the cases with the given status, oldest first. An empty status returns every case.
+func (d *Detector) Cases(status string) ([]Case, error) {
+	cases := []Case{}
+	err := d.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(casesBucket, func(key string, raw json.RawMessage) error {
+			var c Case
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return fmt.Errorf("error decoding fraud case %s: %w", key, err)
+			}
+			if status == "" || c.Status == status {
+				cases = append(cases, c)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(cases, func(i, j int) bool { return cases[i].CreatedAt.Before(cases[j].CreatedAt) })
+	return cases, err
+}
+
+// Resolve closes an open case. Releasing it returns any held points to the
+// user; confirming it forfeits them. Held redemptions are completed or
+// cancelled accordingly.
+func (d *Detector) Resolve(caseID string, release bool, actor, notes string) (*Case, error) {
+	var resolved *Case
+	err := d.store.Update(func(tx *store.Tx) error {
+		c, err := getCase(tx, caseID)
+		if err != nil {
+			return err
+		}
+		if c.Status != StatusOpen {
+			return ErrCaseClosed
+		}
+
+		if c.Type == TypeRedemptionVelocity {
+			if _, err := d.catalogue.ResolveHeldTx(tx, c.Subject, release); err != nil {
+				return err
+			}
+		} else if c.HeldPoints > 0 {
+			destination := rewards.AccountIssued
+			if release {
+				destination = rewards.UserAccount(c.UserID)
+			}
+			if _, err := d.ledger.PostTx(tx, rewards.PostingRequest{
+				IdempotencyKey: "fraud-resolve:" + c.ID,
+				Reason:         "fraud_review",
+				Reference:      c.ID,
+				Lines:          rewards.Transfer(rewards.PendingAccount(c.UserID), destination, c.HeldPoints),
+			}); err != nil {
+				return err
+			}
+		}
+
+		c.Status = StatusConfirmed
+		if release {
+			c.Status = StatusReleased
+		}
+		c.ResolvedBy = actor
+		c.ResolvedAt = d.now().UTC()
+		c.Notes = notes
+		resolved = c
+		if err := tx.Put(casesBucket, c.ID, c); err != nil {
+			return err
+		}
+		for _, listener := range d.listeners {
+			if err := listener(tx, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return resolved, err
+}
+
+// NormalizeAddress reduces an address to lower-case words so that trivially
+// different spellings of the same place compare equal.
+func NormalizeAddress(address string) string {
+	fields := strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,265 @@
+package fraud
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+type fixture struct {
+	db        *store.Store
+	ledger    *rewards.Ledger
+	catalogue *rewards.Catalogue
+	pickups   *pickups.Service
+	detector  *Detector
+}
+
+func newFixture(t *testing.T, thresholds Thresholds) *fixture {
+	t.Helper()
+	db := store.NewMemory()
+	ledger := rewards.NewLedger(db)
+	catalogue := rewards.NewCatalogue(db, ledger)
+	if err := catalogue.Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	detector := NewDetector(db, ledger, catalogue, thresholds)
+	catalogue.SetScreen(detector.ScreenRedemption)
+
+	svc := pickups.NewService(db)
+	svc.Subscribe(rewards.NewEngine(db, ledger).OnPickupTransition)
+	svc.Subscribe(detector.OnPickupTransition)
+	return &fixture{db: db, ledger: ledger, catalogue: catalogue, pickups: svc, detector: detector}
+}
+
+func (f *fixture) process(t *testing.T, uid, address, serial string) *pickups.Pickup {
+	t.Helper()
+	p, err := f.pickups.Create(uid, pickups.CreateRequest{
+		Address: address, Date: "2026-06-15", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "phones", Quantity: 1, SerialNumber: serial}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected, pickups.StatusProcessed} {
+		if _, err := f.pickups.Transition(p.ID, status, "collector"); err != nil {
+			t.Fatalf("Transition(%s) error = %v", status, err)
+		}
+	}
+	return p
+}
+
+func (f *fixture) balances(uid string) (int64, int64) {
+	spendable, _ := f.ledger.Balance(rewards.UserAccount(uid))
+	pending, _ := f.ledger.Balance(rewards.PendingAccount(uid))
+	return spendable, pending
+}
+
+func TestDuplicateSerialHoldsPoints(t *testing.T) {
+	f := newFixture(t, DefaultThresholds)
+	f.process(t, "u1", "Kibera Drive", "SN-1")
+	f.process(t, "u2", "Lavington", " sn-1 ")
+
+	if spendable, pending := f.balances("u2"); spendable != 0 || pending != 40 {
+		t.Fatalf("u2 balances = %d/%d, want 0/40", spendable, pending)
+	}
+
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 1 || cases[0].Type != TypeDuplicateSerial || cases[0].HeldPoints != 40 {
+		t.Fatalf("open cases = %+v", cases)
+	}
+
+	if _, err := f.detector.Resolve(cases[0].ID, true, "admin", "legitimate resale"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if spendable, pending := f.balances("u2"); spendable != 40 || pending != 0 {
+		t.Errorf("u2 balances after release = %d/%d, want 40/0", spendable, pending)
+	}
+	if _, err := f.detector.Resolve(cases[0].ID, true, "admin", ""); err != ErrCaseClosed {
+		t.Errorf("second Resolve() error = %v, want ErrCaseClosed", err)
+	}
+}
+
+func TestConfirmedCaseForfeitsLaterAward(t *testing.T) {
+	f := newFixture(t, DefaultThresholds)
+	f.process(t, "u1", "Kibera Drive", "SN-1")
+	p, err := f.pickups.Create("u2", pickups.CreateRequest{
+		Address: "Lavington", Date: "2026-06-15", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "phones", Quantity: 1, SerialNumber: "SN-1"}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 1 || cases[0].Subject != p.ID {
+		t.Fatalf("open cases = %+v", cases)
+	}
+	if _, err := f.detector.Resolve(cases[0].ID, false, "admin", "stolen device"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected, pickups.StatusProcessed} {
+		if _, err := f.pickups.Transition(p.ID, status, "collector"); err != nil {
+			t.Fatalf("Transition(%s) error = %v", status, err)
+		}
+	}
+	if spendable, pending := f.balances("u2"); spendable != 0 || pending != 0 {
+		t.Errorf("u2 balances after confirmed case = %d/%d, want 0/0", spendable, pending)
+	}
+}
+
+func TestWeightMismatchHoldsPoints(t *testing.T) {
+	f := newFixture(t, DefaultThresholds)
+	weigh := func(uid string, declared, measured float64) {
+		p, err := f.pickups.Create(uid, pickups.CreateRequest{
+			Address: uid + " Road", Date: "2026-06-15", TimeSlot: "morning",
+			Items: []pickups.Item{{Category: "phones", Quantity: 1, WeightKg: declared}},
+		})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected} {
+			if _, err := f.pickups.Transition(p.ID, status, "collector"); err != nil {
+				t.Fatalf("Transition(%s) error = %v", status, err)
+			}
+		}
+		err = f.db.Update(func(tx *store.Tx) error {
+			p, err := pickups.GetTx(tx, p.ID)
+			if err != nil {
+				return err
+			}
+			p.Items[0].MeasuredWeightKg = measured
+			return pickups.SaveTx(tx, p)
+		})
+		if err != nil {
+			t.Fatalf("recording weight: %v", err)
+		}
+		if _, err := f.pickups.Transition(p.ID, pickups.StatusProcessed, "collector"); err != nil {
+			t.Fatalf("Transition(processed) error = %v", err)
+		}
+	}
+	weigh("u1", 2, 2.5)
+	weigh("u2", 2, 9)
+
+	if spendable, pending := f.balances("u1"); spendable != 40 || pending != 0 {
+		t.Errorf("u1 balances = %d/%d, want 40/0", spendable, pending)
+	}
+	if spendable, pending := f.balances("u2"); spendable != 0 || pending != 40 {
+		t.Errorf("u2 balances = %d/%d, want 0/40", spendable, pending)
+	}
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 1 || cases[0].Type != TypeWeightMismatch || cases[0].UserID != "u2" {
+		t.Fatalf("open cases = %+v", cases)
+	}
+}
+
+func TestSharedAddressIsFlagged(t *testing.T) {
+	f := newFixture(t, Thresholds{MaxAccountsPerAddress: 2})
+	f.process(t, "u1", "Block 4, Umoja Estate", "")
+	f.process(t, "u2", "block 4 umoja estate", "")
+	f.process(t, "u3", "BLOCK 4 - UMOJA ESTATE", "")
+
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 1 || cases[0].Type != TypeSharedAddress || cases[0].UserID != "u3" {
+		t.Fatalf("open cases = %+v", cases)
+	}
+	if _, pending := f.balances("u3"); pending != 40 {
+		t.Errorf("u3 pending = %d, want 40", pending)
+	}
+}
+
+func TestCancelledAfterAwardIsConfirmed(t *testing.T) {
+	f := newFixture(t, DefaultThresholds)
+	p := f.process(t, "u1", "Kilimani", "")
+	if _, err := f.pickups.Transition(p.ID, pickups.StatusCancelled, "admin"); err != nil {
+		t.Fatalf("Transition(cancelled) error = %v", err)
+	}
+
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 1 || cases[0].Type != TypeCancelledAfterAward {
+		t.Fatalf("open cases = %+v", cases)
+	}
+	if _, err := f.detector.Resolve(cases[0].ID, false, "admin", "no device handed over"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if spendable, pending := f.balances("u1"); spendable != 0 || pending != 0 {
+		t.Errorf("u1 balances after confirm = %d/%d, want 0/0", spendable, pending)
+	}
+}
+
+func TestCancellingFlaggedPickupDoesNotHoldTwice(t *testing.T) {
+	f := newFixture(t, DefaultThresholds)
+	f.process(t, "u1", "Kibera Drive", "SN-1")
+	f.process(t, "u2", "Lavington", "")
+	flagged := f.process(t, "u2", "Lavington", "SN-1")
+	confirmed := f.process(t, "u2", "Lavington", "SN-1")
+
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 2 {
+		t.Fatalf("open cases = %+v", cases)
+	}
+	if _, err := f.detector.Resolve(cases[1].ID, false, "admin", "stolen device"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if spendable, pending := f.balances("u2"); spendable != 40 || pending != 40 {
+		t.Fatalf("u2 balances before cancelling = %d/%d, want 40/40", spendable, pending)
+	}
+
+	for _, p := range []*pickups.Pickup{flagged, confirmed} {
+		if _, err := f.pickups.Transition(p.ID, pickups.StatusCancelled, "admin"); err != nil {
+			t.Fatalf("Transition(cancelled) error = %v", err)
+		}
+	}
+	if spendable, pending := f.balances("u2"); spendable != 40 || pending != 40 {
+		t.Errorf("u2 balances after cancelling = %d/%d, want 40/40", spendable, pending)
+	}
+	cases, _ = f.detector.Cases(StatusOpen)
+	for _, c := range cases {
+		if c.Type == TypeCancelledAfterAward && c.HeldPoints != 0 {
+			t.Errorf("case %s held %d points already withheld", c.ID, c.HeldPoints)
+		}
+	}
+}
+
+func TestRedemptionVelocityHoldsRedemption(t *testing.T) {
+	f := newFixture(t, Thresholds{MaxRedemptions: 1, RedemptionWindow: time.Hour})
+	if _, err := f.ledger.Post(rewards.PostingRequest{
+		IdempotencyKey: "seed", Reason: "pickup",
+		Lines: rewards.Transfer(rewards.AccountIssued, rewards.UserAccount("u1"), 1000),
+	}); err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+
+	first, err := f.catalogue.Redeem("u1", "eco-bag-set", "a")
+	if err != nil || first.Status != rewards.RedemptionReserved {
+		t.Fatalf("first Redeem() = %+v, %v", first, err)
+	}
+	second, err := f.catalogue.Redeem("u1", "eco-bag-set", "b")
+	if err != nil || second.Status != rewards.RedemptionHeld || second.VoucherCode != "" {
+		t.Fatalf("second Redeem() = %+v, %v", second, err)
+	}
+	if spendable, pending := f.balances("u1"); spendable != 600 || pending != 200 {
+		t.Errorf("balances = %d/%d, want 600/200", spendable, pending)
+	}
+
+	cases, _ := f.detector.Cases(StatusOpen)
+	if len(cases) != 1 || cases[0].Subject != second.ID {
+		t.Fatalf("open cases = %+v", cases)
+	}
+	if _, err := f.detector.Resolve(cases[0].ID, true, "admin", ""); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	redemptions, _ := f.catalogue.Redemptions("u1")
+	if redemptions[0].Status != rewards.RedemptionReserved || redemptions[0].VoucherCode == "" {
+		t.Errorf("released redemption = %+v", redemptions[0])
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	if got := NormalizeAddress("  Block 4,  Umoja-Estate "); got != "block 4 umoja estate" {
+		t.Errorf("NormalizeAddress() = %q", got)
+	}
+}
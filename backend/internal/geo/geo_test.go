@@ -0,0 +1,106 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{name: "Same point", a: Point{-1.2921, 36.8219}, b: Point{-1.2921, 36.8219}, want: 0},
+		{name: "Nairobi to Mombasa", a: Point{-1.2921, 36.8219}, b: Point{-4.0435, 39.6682}, want: 440},
+		{name: "Nairobi to Kisumu", a: Point{-1.2921, 36.8219}, b: Point{-0.0917, 34.7680}, want: 264},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Haversine(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 5 {
+				t.Errorf("Haversine() = %.1f km, want about %.0f km", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	// A 4x4 square with a 2x2 hole in the middle.
+	poly := Polygon{
+		{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}},
+		{{1, 1}, {3, 1}, {3, 3}, {1, 3}, {1, 1}},
+	}
+	tests := []struct {
+		name string
+		p    Point
+		want bool
+	}{
+		{name: "Inside", p: Point{Lat: 0.5, Lng: 0.5}, want: true},
+		{name: "In the hole", p: Point{Lat: 2, Lng: 2}, want: false},
+		{name: "Outside", p: Point{Lat: 5, Lng: 2}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := poly.Contains(tt.p); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBoundaries(t *testing.T) {
+	data := []byte(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"code": "A", "name": "Islands", "level": "county"},
+		 "geometry": {"type": "MultiPolygon", "coordinates": [[[[0,0],[1,0],[1,1],[0,1],[0,0]]], [[[5,5],[6,5],[6,6],[5,6],[5,5]]]]}},
+		{"type": "Feature", "properties": {"code": "A-1", "name": "East Island", "level": "sub_county", "county": "A"},
+		 "geometry": {"type": "Polygon", "coordinates": [[[5,5],[6,5],[6,6],[5,6],[5,5]]]}}
+	]}`)
+	b, err := ParseBoundaries(data)
+	if err != nil {
+		t.Fatalf("ParseBoundaries() error = %v", err)
+	}
+	got := b.Locate(Point{Lat: 5.5, Lng: 5.5})
+	if got.CountyCode != "A" || got.SubCountyCode != "A-1" {
+		t.Errorf("Locate() = %+v, want county A, sub-county A-1", got)
+	}
+	if got := b.Locate(Point{Lat: 3, Lng: 3}); got.CountyCode != "" {
+		t.Errorf("Locate() between islands = %+v, want no county", got)
+	}
+
+	for _, bad := range []string{
+		`{"type": "Feature"}`,
+		`{"type": "FeatureCollection", "features": [{"properties": {"code": "A", "name": "A", "level": "county"}, "geometry": {"type": "Point", "coordinates": [0, 0]}}]}`,
+		`{"type": "FeatureCollection", "features": [{"properties": {"code": "A", "name": "A", "level": "sub_county"}, "geometry": {"type": "Polygon", "coordinates": []}}]}`,
+	} {
+		if _, err := ParseBoundaries([]byte(bad)); err == nil {
+			t.Errorf("ParseBoundaries(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDefaultBoundaries(t *testing.T) {
+	b, err := DefaultBoundaries()
+	if err != nil {
+		t.Fatalf("DefaultBoundaries() error = %v", err)
+	}
+	tests := []struct {
+		name          string
+		p             Point
+		wantCounty    string
+		wantSubCounty string
+	}{
+		{name: "Westlands", p: Point{Lat: -1.2676, Lng: 36.8108}, wantCounty: "Nairobi", wantSubCounty: "Westlands"},
+		{name: "Mombasa island", p: Point{Lat: -4.0435, Lng: 39.6682}, wantCounty: "Mombasa", wantSubCounty: "Mvita"},
+		{name: "Thika", p: Point{Lat: -1.0333, Lng: 37.0693}, wantCounty: "Kiambu"},
+		{name: "Garissa", p: Point{Lat: -0.4532, Lng: 39.6461}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := b.Locate(tt.p)
+			if got.County != tt.wantCounty || got.SubCounty != tt.wantSubCounty {
+				t.Errorf("Locate() = %+v, want %s / %s", got, tt.wantCounty, tt.wantSubCounty)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package geo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Administrative levels of a boundary.
+const (
+	LevelCounty    = "county"
+	LevelSubCounty = "sub_county"
+)
+
+// kenyaBoundaries is a simplified outline of the counties we operate in and
+// their sub-counties. It is coarse enough to ship with the binary; load the
+// official boundaries with LoadBoundaries where precision matters.
+//
+//go:embed data/kenya_boundaries.geojson
+var kenyaBoundaries []byte
+
+// Polygon is a list of linear rings: the outer boundary followed by any holes.
+// Positions are [longitude, latitude] as in GeoJSON.
+type Polygon [][][2]float64
+
+// Contains reports whether p lies inside the outer ring and outside every hole.
+func (poly Polygon) Contains(p Point) bool {
+	if len(poly) == 0 || !ringContains(poly[0], p) {
+		return false
+	}
+	for _, hole := range poly[1:] {
+		if ringContains(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains implements the even-odd ray casting test.
+func ringContains(ring [][2]float64, p Point) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > p.Lat) != (yj > p.Lat) && p.Lng < (xj-xi)*(p.Lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Region is a county or sub-county boundary.
+type Region struct {
+	Code     string    `json:"code"`
+	Name     string    `json:"name"`
+	Level    string    `json:"level"`
+	County   string    `json:"county,omitempty"`
+	Polygons []Polygon `json:"-"`
+}
+
+// Contains reports whether p falls inside the region.
+func (r *Region) Contains(p Point) bool {
+	for _, poly := range r.Polygons {
+		if poly.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Boundaries indexes county and sub-county regions.
+type Boundaries struct {
+	Counties    []*Region
+	SubCounties []*Region
+}
+
+// Placement is where a point falls administratively. Empty fields mean the
+// point is outside every known region of that level.
+type Placement struct {
+	CountyCode    string `json:"county_code,omitempty"`
+	County        string `json:"county,omitempty"`
+	SubCountyCode string `json:"sub_county_code,omitempty"`
+	SubCounty     string `json:"sub_county,omitempty"`
+}
+
+// Locate returns the county and sub-county containing p.
+func (b *Boundaries) Locate(p Point) Placement {
+	var placement Placement
+	for _, county := range b.Counties {
+		if county.Contains(p) {
+			placement.CountyCode, placement.County = county.Code, county.Name
+			break
+		}
+	}
+	if placement.CountyCode == "" {
+		return placement
+	}
+	for _, sub := range b.SubCounties {
+		if sub.County == placement.CountyCode && sub.Contains(p) {
+			placement.SubCountyCode, placement.SubCounty = sub.Code, sub.Name
+			break
+		}
+	}
+	return placement
+}
+
+// County returns the county with the given code.
+func (b *Boundaries) County(code string) (*Region, bool) {
+	for _, county := range b.Counties {
+		if county.Code == code {
+			return county, true
+		}
+	}
+	return nil, false
+}
+
+// DefaultBoundaries returns the boundaries bundled with the application.
+func DefaultBoundaries() (*Boundaries, error) {
+	return ParseBoundaries(kenyaBoundaries)
+}
+
+// LoadBoundaries reads a GeoJSON FeatureCollection from path.
+func LoadBoundaries(path string) (*Boundaries, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading boundaries: %w", err)
+	}
+	return ParseBoundaries(data)
+}
+
+// ParseBoundaries decodes a GeoJSON FeatureCollection of Polygon and
+// MultiPolygon features. Each feature needs "code", "name" and "level"
+// properties; sub-counties also need the "county" code they belong to.
+func ParseBoundaries(data []byte) (*Boundaries, error) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties struct {
+				Code   string `json:"code"`
+				Name   string `json:"name"`
+				Level  string `json:"level"`
+				County string `json:"county"`
+			} `json:"properties"`
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("error decoding boundaries: %w", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("boundaries must be a FeatureCollection, got %q", collection.Type)
+	}
+
+	b := &Boundaries{}
+	for i, feature := range collection.Features {
+		props := feature.Properties
+		region := &Region{Code: props.Code, Name: props.Name, Level: props.Level, County: props.County}
+		if region.Code == "" || region.Name == "" {
+			return nil, fmt.Errorf("feature %d needs code and name properties", i)
+		}
+
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var poly Polygon
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &poly); err != nil {
+				return nil, fmt.Errorf("error decoding %s geometry: %w", region.Name, err)
+			}
+			region.Polygons = []Polygon{poly}
+		case "MultiPolygon":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &region.Polygons); err != nil {
+				return nil, fmt.Errorf("error decoding %s geometry: %w", region.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s has unsupported geometry %q", region.Name, feature.Geometry.Type)
+		}
+
+		switch region.Level {
+		case LevelCounty:
+			b.Counties = append(b.Counties, region)
+		case LevelSubCounty:
+			if region.County == "" {
+				return nil, fmt.Errorf("sub-county %s needs a county property", region.Name)
+			}
+			b.SubCounties = append(b.SubCounties, region)
+		default:
+			return nil, fmt.Errorf("%s has unknown level %q", region.Name, region.Level)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,362 @@
+// Package geocode turns address text into candidate coordinates. The bundled
+// gazetteer works without network access; an online service can be plugged in
+// behind the Geocoder interface.
+package geocode
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+)
+
+// Kinds of gazetteer places, in the order they rank when matches tie.
+const (
+	KindEstate   = "estate"
+	KindLandmark = "landmark"
+	KindTown     = "town"
+)
+
+// Result limits for Autocomplete.
+const (
+	DefaultLimit = 8
+	MaxLimit     = 20
+)
+
+// minQueryLength is the shortest query worth searching for.
+const minQueryLength = 2
+
+// ErrInvalidGazetteer is returned when gazetteer data cannot be parsed.
+var ErrInvalidGazetteer = errors.New("invalid gazetteer")
+
+//go:embed data/gazetteer.csv
+var bundledGazetteer []byte
+
+// Candidate is a place that may match the text a user typed.
+type Candidate struct {
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	County   string    `json:"county"`
+	Label    string    `json:"label"`
+	Location geo.Point `json:"location"`
+	Source   string    `json:"source"`
+}
+
+// Geocoder suggests places for partial address text.
+type Geocoder interface {
+	Autocomplete(ctx context.Context, query string, limit int) ([]Candidate, error)
+}
+
+// Place is a gazetteer entry.
+type Place struct {
+	Name     string
+	Kind     string
+	County   string
+	Location geo.Point
+	Aliases  []string
+
+	// names holds the normalised tokens of the name and each alias.
+	names [][]string
+}
+
+// Gazetteer is an in-memory Geocoder over a fixed list of places.
+type Gazetteer struct {
+	places []*Place
+}
+
+// DefaultGazetteer returns the gazetteer bundled with the application.
+func DefaultGazetteer() (*Gazetteer, error) {
+	return ParseGazetteer(bytes.NewReader(bundledGazetteer))
+}
+
+// LoadGazetteer reads a gazetteer CSV file from path.
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening gazetteer: %w", err)
+	}
+	defer f.Close()
+	return ParseGazetteer(f)
+}
+
+// ParseGazetteer reads CSV with the header name,kind,county,lat,lng,aliases.
+// Aliases are separated by "|".
+func ParseGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 6
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGazetteer, err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != "name,kind,county,lat,lng,aliases" {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidGazetteer)
+	}
+
+	g := &Gazetteer{}
+	for i, record := range records[1:] {
+		line := i + 2
+		lat, latErr := strconv.ParseFloat(record[3], 64)
+		lng, lngErr := strconv.ParseFloat(record[4], 64)
+		place := &Place{
+			Name:     strings.TrimSpace(record[0]),
+			Kind:     strings.TrimSpace(record[1]),
+			County:   strings.TrimSpace(record[2]),
+			Location: geo.Point{Lat: lat, Lng: lng},
+		}
+		if latErr != nil || lngErr != nil || !place.Location.Valid() {
+			return nil, fmt.Errorf("%w: line %d has invalid coordinates", ErrInvalidGazetteer, line)
+		}
+		if place.Name == "" {
+			return nil, fmt.Errorf("%w: line %d has no name", ErrInvalidGazetteer, line)
+		}
+		if kindRank(place.Kind) < 0 {
+			return nil, fmt.Errorf("%w: line %d has unknown kind %q", ErrInvalidGazetteer, line, place.Kind)
+		}
+		for _, alias := range strings.Split(record[5], "|") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				place.Aliases = append(place.Aliases, alias)
+			}
+		}
+		for _, name := range append([]string{place.Name}, place.Aliases...) {
+			place.names = append(place.names, tokenize(name))
+		}
+		g.places = append(g.places, place)
+	}
+	return g, nil
+}
+
+// Len returns the number of places in the gazetteer.
+func (g *Gazetteer) Len() int {
+	return len(g.places)
+}
+
+// match is a place with how well it matched a query; lower cost is better.
+type match struct {
+	place    *Place
+	cost     int
+	anchored bool
+	// extra counts name words the query left unmatched, so "Kisumu" ranks
+	// the town above "Kisumu Bus Park".
+	extra int
+}
+
+// Autocomplete returns up to limit places matching query, best first. Every
+// word of the query must be the start of a word in the place's name or an
+// alias, allowing a typo in longer words. Words may also match the county,
+// so "kilimani nairobi" finds Kilimani.
+func (g *Gazetteer) Autocomplete(ctx context.Context, query string, limit int) ([]Candidate, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	terms := tokenize(query)
+	if len(strings.Join(terms, "")) < minQueryLength {
+		return []Candidate{}, nil
+	}
+
+	var matches []match
+	for _, place := range g.places {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if m, ok := place.match(terms); ok {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if better(a, b) || better(b, a) {
+			return better(a, b)
+		}
+		if kindRank(a.place.Kind) != kindRank(b.place.Kind) {
+			return kindRank(a.place.Kind) < kindRank(b.place.Kind)
+		}
+		return a.place.Name < b.place.Name
+	})
+
+	candidates := []Candidate{}
+	for _, m := range matches {
+		if len(candidates) == limit {
+			break
+		}
+		candidates = append(candidates, m.place.candidate())
+	}
+	return candidates, nil
+}
+
+// better reports whether a matched its query more closely than b.
+func better(a, b match) bool {
+	if a.cost != b.cost {
+		return a.cost < b.cost
+	}
+	if a.anchored != b.anchored {
+		return a.anchored
+	}
+	return a.extra < b.extra
+}
+
+// match scores terms against the place's best-matching name or alias.
+func (p *Place) match(terms []string) (match, bool) {
+	county := tokenize(p.County)
+	best, found := match{place: p}, false
+	for _, name := range p.names {
+		cost, anchored, matched, ok := matchTerms(terms, name, county)
+		if !ok {
+			continue
+		}
+		m := match{place: p, cost: cost, anchored: anchored, extra: len(name) - matched}
+		if !found || better(m, best) {
+			best, found = m, true
+		}
+	}
+	return best, found
+}
+
+func (p *Place) candidate() Candidate {
+	label := p.Name
+	if p.County != "" && !strings.EqualFold(p.County, p.Name) {
+		label += ", " + p.County
+	}
+	return Candidate{
+		Name:     p.Name,
+		Kind:     p.Kind,
+		County:   p.County,
+		Label:    label,
+		Location: p.Location,
+		Source:   "gazetteer",
+	}
+}
+
+// matchTerms matches each term to a distinct word of name, falling back to the
+// county's words. It reports the total typo cost, whether the first term
+// matched the first word of the name and how many name words were matched.
+func matchTerms(terms, name, county []string) (cost int, anchored bool, matched int, ok bool) {
+	used := make([]bool, len(name))
+	for i, term := range terms {
+		bestWord, bestCost := -1, 0
+		for w, word := range name {
+			if used[w] {
+				continue
+			}
+			if c, ok := prefixCost(term, word); ok && (bestWord < 0 || c < bestCost) {
+				bestWord, bestCost = w, c
+			}
+		}
+		if bestWord >= 0 {
+			used[bestWord] = true
+			matched++
+			cost += bestCost
+			if i == 0 && bestWord == 0 {
+				anchored = true
+			}
+			continue
+		}
+
+		// County words satisfy a term but never make a better match than the name.
+		inCounty := false
+		for _, word := range county {
+			if c, ok := prefixCost(term, word); ok {
+				cost += c + 1
+				inCounty = true
+				break
+			}
+		}
+		if !inCounty {
+			return 0, false, 0, false
+		}
+	}
+	return cost, anchored, matched, true
+}
+
+// prefixCost reports whether term is a prefix of word, allowing one edit for
+// terms of four or more letters and two for eight or more.
+func prefixCost(term, word string) (int, bool) {
+	if strings.HasPrefix(word, term) {
+		return 0, true
+	}
+	allowed := 0
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		allowed = 2
+	case n >= 4:
+		allowed = 1
+	}
+	if allowed == 0 {
+		return 0, false
+	}
+
+	// Compare against prefixes of word around the term's length so that an
+	// inserted or dropped letter still counts as one edit.
+	t, w := []rune(term), []rune(word)
+	best := allowed + 1
+	for n := len(t) - allowed; n <= len(t)+allowed; n++ {
+		if n <= 0 || n > len(w) {
+			continue
+		}
+		if d := editDistance(t, w[:n]); d < best {
+			best = d
+		}
+	}
+	if best > allowed {
+		return 0, false
+	}
+	return best, true
+}
+
+// editDistance is the Levenshtein distance with adjacent transpositions.
+func editDistance(a, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+// tokenize lower-cases s and splits it into words. Apostrophes are dropped so
+// "Lang'ata" and "Langata" compare equal.
+func tokenize(s string) []string {
+	s = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(s))
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func kindRank(kind string) int {
+	switch kind {
+	case KindEstate:
+		return 0
+	case KindLandmark:
+		return 1
+	case KindTown:
+		return 2
+	}
+	return -1
+}
@@ -0,0 +1,118 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testGazetteer = `name,kind,county,lat,lng,aliases
+Kilimani,estate,Nairobi,-1.2921,36.7856,
+Kileleshwa,estate,Nairobi,-1.2800,36.7830,
+Lang'ata,estate,Nairobi,-1.3480,36.7480,Langata
+Kisumu,town,Kisumu,-0.0917,34.7680,Kisumu City
+Kisumu Bus Park,landmark,Kisumu,-0.1000,34.7600,
+Jomo Kenyatta International Airport,landmark,Nairobi,-1.3190,36.9270,JKIA
+Kilifi,town,Kilifi,-3.6305,39.8499,
+`
+
+func newTestGazetteer(t *testing.T) *Gazetteer {
+	t.Helper()
+	g, err := ParseGazetteer(strings.NewReader(testGazetteer))
+	if err != nil {
+		t.Fatalf("ParseGazetteer() error = %v", err)
+	}
+	return g
+}
+
+func names(candidates []Candidate) []string {
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.Name
+	}
+	return out
+}
+
+func TestAutocomplete(t *testing.T) {
+	g := newTestGazetteer(t)
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "Prefix", query: "kil", want: []string{"Kileleshwa", "Kilimani", "Kilifi"}},
+		{name: "Case and spacing", query: "  KILIM ", want: []string{"Kilimani", "Kilifi"}},
+		{name: "Typo", query: "kilimnai", want: []string{"Kilimani"}},
+		{name: "Apostrophe", query: "langat", want: []string{"Lang'ata"}},
+		{name: "Alias", query: "jkia", want: []string{"Jomo Kenyatta International Airport"}},
+		{name: "Later word", query: "airport", want: []string{"Jomo Kenyatta International Airport"}},
+		{name: "Exact name first", query: "kisumu", want: []string{"Kisumu", "Kisumu Bus Park"}},
+		{name: "County narrows", query: "kisumu bus", want: []string{"Kisumu Bus Park"}},
+		{name: "County word", query: "kilimani nairobi", want: []string{"Kilimani"}},
+		{name: "Too short", query: "k", want: []string{}},
+		{name: "No match", query: "zzzz", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.Autocomplete(context.Background(), tt.query, 0)
+			if err != nil {
+				t.Fatalf("Autocomplete() error = %v", err)
+			}
+			if strings.Join(names(got), "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Autocomplete(%q) = %v, want %v", tt.query, names(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestAutocompleteCandidate(t *testing.T) {
+	g := newTestGazetteer(t)
+	got, err := g.Autocomplete(context.Background(), "kilimani", 1)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Autocomplete() = %v, %v", got, err)
+	}
+	c := got[0]
+	if c.Label != "Kilimani, Nairobi" || c.Kind != KindEstate || c.Source != "gazetteer" || c.Location.Lat != -1.2921 {
+		t.Errorf("unexpected candidate %+v", c)
+	}
+
+	got, _ = g.Autocomplete(context.Background(), "ki", 2)
+	if len(got) != 2 {
+		t.Errorf("limit not applied: %d candidates", len(got))
+	}
+}
+
+func TestParseGazetteerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "Missing header", data: "Kilimani,estate,Nairobi,-1.29,36.78,\n"},
+		{name: "Bad coordinates", data: "name,kind,county,lat,lng,aliases\nKilimani,estate,Nairobi,north,36.78,\n"},
+		{name: "Out of range", data: "name,kind,county,lat,lng,aliases\nKilimani,estate,Nairobi,-91,36.78,\n"},
+		{name: "Unknown kind", data: "name,kind,county,lat,lng,aliases\nKilimani,suburb,Nairobi,-1.29,36.78,\n"},
+		{name: "Short row", data: "name,kind,county,lat,lng,aliases\nKilimani,estate\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseGazetteer(strings.NewReader(tt.data)); !errors.Is(err, ErrInvalidGazetteer) {
+				t.Errorf("ParseGazetteer() error = %v, want ErrInvalidGazetteer", err)
+			}
+		})
+	}
+}
+
+func TestDefaultGazetteer(t *testing.T) {
+	g, err := DefaultGazetteer()
+	if err != nil {
+		t.Fatalf("DefaultGazetteer() error = %v", err)
+	}
+	if g.Len() < 50 {
+		t.Errorf("expected a populated gazetteer, got %d places", g.Len())
+	}
+	got, _ := g.Autocomplete(context.Background(), "westla", 0)
+	if len(got) == 0 || got[0].Name != "Westlands" {
+		t.Errorf("Autocomplete(westla) = %v", names(got))
+	}
+}
@@ -0,0 +1,587 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/compliance"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/fraud"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// Console limits.
+const (
+	maxConsoleForm    = 64 << 10
+	consoleListLimit  = 200
+	consoleUsersLimit = 50
+)
+
+// consoleNotices are the confirmations shown after a change. Pages are
+// redirected to with ?notice= set to one of the keys.
+var consoleNotices = map[string]string{
+	"role":       "Role updated. It applies when the user's session next refreshes.",
+	"disabled":   "Account disabled and signed out.",
+	"enabled":    "Account enabled.",
+	"reassigned": "Pickup reassigned.",
+	"cancelled":  "Pickup cancelled.",
+	"partner":    "Partner saved.",
+	"linked":     "Partner link updated. It applies when the user's session next refreshes.",
+	"resolved":   "Case resolved.",
+	"category":   "Catalogue category updated.",
+	"reward":     "Reward updated.",
+}
+
+// AdminConsole serves the server-rendered admin pages. Every change made
+// through it is written to the audit log.
+type AdminConsole struct {
+	Directory  auth.Directory
+	Pickups    *pickups.Service
+	Compliance *compliance.Service
+	Fraud      *fraud.Detector
+	Items      *items.Service
+	Rewards    *rewards.Catalogue
+	Audit      *audit.Log
+	csrfSecret []byte
+}
+
+// NewAdminConsole creates an AdminConsole. csrfSecret signs the tokens that
+// guard its forms.
+func NewAdminConsole(users auth.Directory, pickupService *pickups.Service, complianceService *compliance.Service,
+	detector *fraud.Detector, itemCatalogue *items.Service, rewardCatalogue *rewards.Catalogue, entries *audit.Log, csrfSecret []byte) *AdminConsole {
+	return &AdminConsole{
+		Directory: users, Pickups: pickupService, Compliance: complianceService, Fraud: detector,
+		Items: itemCatalogue, Rewards: rewardCatalogue, Audit: entries, csrfSecret: csrfSecret,
+	}
+}
+
+// adminPage is the part of every console page's data used by the layout.
+type adminPage struct {
+	Title   string
+	Section string
+	CSRF    string
+	Notice  string
+	Error   string
+}
+
+func (c *AdminConsole) page(r *http.Request, section, title, errMsg string) adminPage {
+	return adminPage{
+		Title:   title,
+		Section: section,
+		CSRF:    c.csrfToken(auth.UIDFromContext(r.Context())),
+		Notice:  consoleNotices[r.URL.Query().Get("notice")],
+		Error:   errMsg,
+	}
+}
+
+// csrfToken is the form token of uid. The session cookie is sent with any
+// request to the console, so forms prove they were served by it.
+func (c *AdminConsole) csrfToken(uid string) string {
+	mac := hmac.New(sha256.New, c.csrfSecret)
+	mac.Write([]byte("admin-console:" + uid))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseForm reads a console form and checks its CSRF token.
+func (c *AdminConsole) parseForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxConsoleForm)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return false
+	}
+	want := c.csrfToken(auth.UIDFromContext(r.Context()))
+	if !hmac.Equal([]byte(r.PostForm.Get("csrf")), []byte(want)) {
+		ForbiddenHandler(w, r)
+		return false
+	}
+	return true
+}
+
+// done redirects back to the page after a change, so reloading it does not
+// repeat the change.
+func done(w http.ResponseWriter, r *http.Request, notice string, keep ...string) {
+	q := url.Values{"notice": {notice}}
+	for _, name := range keep {
+		if v := r.URL.Query().Get(name); v != "" {
+			q.Set(name, v)
+		}
+	}
+	http.Redirect(w, r, r.URL.Path+"?"+q.Encode(), http.StatusSeeOther)
+}
+
+// record writes an audit entry for a change that has been made, with the
+// difference between the target's state before and after it. The change
+// stands even if auditing fails, so the failure is logged loudly instead.
+func (c *AdminConsole) record(r *http.Request, action, target string, before, after interface{}, details map[string]string) {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		log.Printf("ERROR: failed to describe %s on %s: %v", action, target, err)
+	}
+	entry := audit.Entry{Origin: audit.OriginOf(r), Action: action, Target: target, Changes: changes, Details: details}
+	if _, err := c.Audit.Record(entry); err != nil {
+		log.Printf("ERROR: failed to audit %s on %s: %v", action, target, err)
+	}
+}
+
+// Overview shows what needs attention.
+func (c *AdminConsole) Overview(w http.ResponseWriter, r *http.Request) {
+	counts := map[string]int{}
+	list, err := c.Pickups.List(nil)
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	for _, p := range list {
+		counts[p.Status]++
+	}
+	cases, err := c.Fraud.Cases(fraud.StatusOpen)
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	recent, err := c.Audit.List(audit.Filter{Limit: 10})
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	utils.RenderTemplate(w, "admin.page.html", struct {
+		adminPage
+		Scheduled, Assigned, Collected int
+		OpenCases                      int
+		Recent                         []audit.Entry
+	}{
+		adminPage: c.page(r, "overview", "Overview", ""),
+		Scheduled: counts[pickups.StatusScheduled], Assigned: counts[pickups.StatusAssigned], Collected: counts[pickups.StatusCollected],
+		OpenCases: len(cases),
+		Recent:    recent,
+	})
+}
+
+// Users lists accounts on GET and changes a role, partner link or access on
+// POST.
+func (c *AdminConsole) Users(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.renderUsers(w, r, http.StatusOK, "")
+	case http.MethodPost:
+		if !c.parseForm(w, r) {
+			return
+		}
+		uid, action := r.PostForm.Get("uid"), r.PostForm.Get("action")
+		if uid == "" {
+			c.renderUsers(w, r, http.StatusBadRequest, "Choose a user.")
+			return
+		}
+		if uid == auth.UIDFromContext(r.Context()) {
+			c.renderUsers(w, r, http.StatusBadRequest, "You cannot change your own role or access.")
+			return
+		}
+		before, err := c.Directory.User(r.Context(), uid)
+		if err != nil {
+			log.Printf("Admin console: %v", err)
+			c.renderUsers(w, r, http.StatusNotFound, "That user could not be found.")
+			return
+		}
+		after := *before
+		notice := action
+		switch action {
+		case "role":
+			after.Role = r.PostForm.Get("role")
+			if !auth.ValidRole(after.Role) {
+				c.renderUsers(w, r, http.StatusBadRequest, "Choose a valid role.")
+				return
+			}
+			err = c.Directory.SetRole(r.Context(), uid, after.Role)
+		case "partner":
+			notice = "linked"
+			after.PartnerID = strings.TrimSpace(r.PostForm.Get("partner_id"))
+			if after.PartnerID != "" {
+				if _, err := c.Compliance.Partner(after.PartnerID); err != nil {
+					c.renderUsers(w, r, http.StatusBadRequest, "Choose an existing partner.")
+					return
+				}
+				after.Role = auth.RolePartner
+			}
+			err = c.Directory.SetPartner(r.Context(), uid, after.PartnerID)
+		case "disable", "enable":
+			notice = action + "d"
+			after.Disabled = action == "disable"
+			err = c.Directory.SetDisabled(r.Context(), uid, after.Disabled)
+		default:
+			c.renderUsers(w, r, http.StatusBadRequest, "Unknown action.")
+			return
+		}
+		if err == nil {
+			c.record(r, "user."+action, uid, before, after, nil)
+		}
+		if err != nil {
+			log.Printf("Admin console: %v", err)
+			c.renderUsers(w, r, http.StatusBadGateway, "The account could not be updated. Try again.")
+			return
+		}
+		done(w, r, notice, "page")
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *AdminConsole) renderUsers(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	pageToken := r.URL.Query().Get("page")
+	users, next, err := c.Directory.Users(r.Context(), pageToken, consoleUsersLimit)
+	if err != nil {
+		log.Printf("Admin console: %v", err)
+		InternalServerHandler(w, r)
+		return
+	}
+	partners, err := c.Compliance.Partners()
+	if err != nil {
+		log.Printf("Admin console: %v", err)
+		InternalServerHandler(w, r)
+		return
+	}
+	w.WriteHeader(status)
+	utils.RenderTemplate(w, "admin-users.page.html", struct {
+		adminPage
+		Users    []auth.User
+		Roles    []string
+		Partners []compliance.Partner
+		Self     string
+		NextPage string
+	}{c.page(r, "users", "Users and roles", errMsg), users, auth.Roles, partners, auth.UIDFromContext(r.Context()), next})
+}
+
+// PickupsPage lists pickups, optionally by ?status=, on GET and reassigns
+// or cancels one on POST.
+func (c *AdminConsole) PickupsPage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.renderPickups(w, r, http.StatusOK, "")
+	case http.MethodPost:
+		if !c.parseForm(w, r) {
+			return
+		}
+		id, actor := r.PostForm.Get("id"), auth.UIDFromContext(r.Context())
+		var (
+			before, p *pickups.Pickup
+			err       error
+			notice    string
+		)
+		switch r.PostForm.Get("action") {
+		case "reassign":
+			collector := strings.TrimSpace(r.PostForm.Get("collector"))
+			if collector == "" {
+				c.renderPickups(w, r, http.StatusBadRequest, "Enter the collector's user ID.")
+				return
+			}
+			partner := r.PostForm.Get("partner")
+			if partner != "" {
+				if _, err := c.Compliance.Partner(partner); errors.Is(err, compliance.ErrPartnerNotFound) {
+					c.renderPickups(w, r, http.StatusBadRequest, "Choose a registered partner.")
+					return
+				} else if err != nil {
+					InternalServerHandler(w, r)
+					return
+				}
+			}
+			if before, err = c.Pickups.Get(id); err == nil {
+				if p, err = c.Pickups.Assign(id, collector, partner, actor); err == nil {
+					c.record(r, "pickup.reassign", id, before, p, nil)
+				}
+			}
+			notice = "reassigned"
+		case "cancel":
+			if before, err = c.Pickups.Get(id); err == nil {
+				if p, err = c.Pickups.Transition(id, pickups.StatusCancelled, actor); err == nil {
+					c.record(r, "pickup.cancel", id, before, p, nil)
+				}
+			}
+			notice = "cancelled"
+		default:
+			c.renderPickups(w, r, http.StatusBadRequest, "Unknown action.")
+			return
+		}
+		switch {
+		case errors.Is(err, pickups.ErrNotFound):
+			c.renderPickups(w, r, http.StatusNotFound, "That pickup no longer exists.")
+		case errors.Is(err, pickups.ErrInvalidTransition):
+			c.renderPickups(w, r, http.StatusConflict, "That change is not possible from the pickup's current status.")
+		case err != nil || p == nil:
+			InternalServerHandler(w, r)
+		default:
+			done(w, r, notice, "status")
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *AdminConsole) renderPickups(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	filter := r.URL.Query().Get("status")
+	list, err := c.Pickups.List(func(p *pickups.Pickup) bool { return filter == "" || p.Status == filter })
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if len(list) > consoleListLimit {
+		list = list[:consoleListLimit]
+	}
+	partners, err := c.Compliance.Partners()
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	w.WriteHeader(status)
+	utils.RenderTemplate(w, "admin-pickups.page.html", struct {
+		adminPage
+		Pickups  []*pickups.Pickup
+		Partners []compliance.Partner
+		Status   string
+		Statuses []string
+	}{
+		c.page(r, "pickups", "Pickups", errMsg), list, partners, filter,
+		[]string{pickups.StatusScheduled, pickups.StatusAssigned, pickups.StatusCollected, pickups.StatusProcessed, pickups.StatusCancelled},
+	})
+}
+
+// Partners lists recycling partners and open review cases on GET, and saves
+// a partner or resolves a case on POST.
+func (c *AdminConsole) Partners(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.renderPartners(w, r, http.StatusOK, "")
+	case http.MethodPost:
+		if !c.parseForm(w, r) {
+			return
+		}
+		actor := auth.UIDFromContext(r.Context())
+		switch r.PostForm.Get("action") {
+		case "partner":
+			from, errFrom := time.Parse("2006-01-02", r.PostForm.Get("certified_from"))
+			until, errUntil := time.Parse("2006-01-02", r.PostForm.Get("certified_until"))
+			if errFrom != nil || errUntil != nil {
+				c.renderPartners(w, r, http.StatusBadRequest, "Certification dates must be formatted YYYY-MM-DD.")
+				return
+			}
+			id := r.PostForm.Get("id")
+			before, err := c.Compliance.Partner(id)
+			if err != nil && !errors.Is(err, compliance.ErrPartnerNotFound) {
+				InternalServerHandler(w, r)
+				return
+			}
+			saved, err := c.Compliance.SavePartner(compliance.Partner{
+				ID: id, Name: r.PostForm.Get("name"), Licence: r.PostForm.Get("licence"),
+				County: r.PostForm.Get("county"), CertifiedFrom: from, CertifiedUntil: until,
+			}, actor)
+			if errors.Is(err, compliance.ErrInvalidPartner) {
+				c.renderPartners(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err != nil {
+				InternalServerHandler(w, r)
+				return
+			}
+			c.record(r, "partner.save", saved.ID, before, saved, nil)
+			done(w, r, "partner")
+		case "resolve":
+			id, decision := r.PostForm.Get("case_id"), r.PostForm.Get("decision")
+			if decision != "release" && decision != "confirm" {
+				c.renderPartners(w, r, http.StatusBadRequest, "Choose whether to release or confirm the hold.")
+				return
+			}
+			before, err := c.Fraud.Case(id)
+			if err == nil {
+				var resolved *fraud.Case
+				if resolved, err = c.Fraud.Resolve(id, decision == "release", actor, r.PostForm.Get("notes")); err == nil {
+					c.record(r, "case.resolve", id, before, resolved, map[string]string{"decision": decision})
+				}
+			}
+			if errors.Is(err, fraud.ErrCaseNotFound) {
+				c.renderPartners(w, r, http.StatusNotFound, "That case no longer exists.")
+				return
+			}
+			if err != nil {
+				c.renderPartners(w, r, http.StatusConflict, err.Error())
+				return
+			}
+			done(w, r, "resolved")
+		default:
+			c.renderPartners(w, r, http.StatusBadRequest, "Unknown action.")
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *AdminConsole) renderPartners(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	partners, err := c.Compliance.Partners()
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	cases, err := c.Fraud.Cases(fraud.StatusOpen)
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	w.WriteHeader(status)
+	utils.RenderTemplate(w, "admin-partners.page.html", struct {
+		adminPage
+		Partners []compliance.Partner
+		Cases    []fraud.Case
+		Today    time.Time
+	}{c.page(r, "partners", "Partners and approvals", errMsg), partners, cases, time.Now()})
+}
+
+// Catalogue lists item categories and rewards on GET and switches them on
+// or off, or reprices a reward, on POST.
+func (c *AdminConsole) Catalogue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.renderCatalogue(w, r, http.StatusOK, "")
+	case http.MethodPost:
+		if !c.parseForm(w, r) {
+			return
+		}
+		id, active := r.PostForm.Get("id"), r.PostForm.Get("active") == "true"
+		switch r.PostForm.Get("action") {
+		case "category":
+			category, err := c.Items.Get(id)
+			if errors.Is(err, items.ErrNotFound) {
+				c.renderCatalogue(w, r, http.StatusNotFound, "That category no longer exists.")
+				return
+			}
+			if err != nil {
+				InternalServerHandler(w, r)
+				return
+			}
+			changed := *category
+			changed.Active = active
+			saved, err := c.Items.Save(changed, auth.UIDFromContext(r.Context()))
+			if err != nil {
+				c.renderCatalogue(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			c.record(r, "catalogue.category", id, category, saved, nil)
+			done(w, r, "category")
+		case "reward":
+			reward, err := c.Rewards.Get(id)
+			if errors.Is(err, rewards.ErrRewardNotFound) {
+				c.renderCatalogue(w, r, http.StatusNotFound, "That reward no longer exists.")
+				return
+			}
+			if err != nil {
+				InternalServerHandler(w, r)
+				return
+			}
+			cost, err := strconv.ParseInt(r.PostForm.Get("points_cost"), 10, 64)
+			if err != nil {
+				c.renderCatalogue(w, r, http.StatusBadRequest, "The points cost must be a whole number.")
+				return
+			}
+			changed := *reward
+			changed.Active, changed.PointsCost = active, cost
+			saved, err := c.Rewards.Save(changed)
+			if err != nil {
+				c.renderCatalogue(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			c.record(r, "catalogue.reward", id, reward, saved, nil)
+			done(w, r, "reward")
+		default:
+			c.renderCatalogue(w, r, http.StatusBadRequest, "Unknown action.")
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *AdminConsole) renderCatalogue(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	categories, err := c.Items.List(true)
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	rewardList, err := c.Rewards.List("", true)
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	w.WriteHeader(status)
+	utils.RenderTemplate(w, "admin-catalogue.page.html", struct {
+		adminPage
+		Categories []items.Category
+		Rewards    []rewards.Reward
+	}{c.page(r, "catalogue", "Catalogue and rewards", errMsg), categories, rewardList})
+}
+
+// CompliancePage renders the page for downloading compliance reports. The
+// reports themselves load through the admin API.
+func (c *AdminConsole) CompliancePage(w http.ResponseWriter, r *http.Request) {
+	utils.RenderTemplate(w, "compliance.page.html", c.page(r, "compliance", "Compliance reports", ""))
+}
+
+// AuditLog shows the latest audit entries, filtered like the audit API, and
+// whether the log is intact.
+func (c *AdminConsole) AuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	errMsg := ""
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if filter.Limit > consoleListLimit {
+		filter.Limit = consoleListLimit
+	}
+	entries, err := c.Audit.List(filter)
+	if err != nil {
+		InternalServerHandler(w, r)
+		return
+	}
+	checked, err := c.Audit.Verify()
+	if err != nil && !errors.Is(err, audit.ErrTampered) {
+		InternalServerHandler(w, r)
+		return
+	}
+	broken := ""
+	if err != nil {
+		broken = err.Error()
+	}
+	exports := map[string]string{}
+	for format := range audit.ContentTypes {
+		q := r.URL.Query()
+		q.Del("notice")
+		q.Set("format", format)
+		exports[format] = "/admin/audit/export?" + q.Encode()
+	}
+	utils.RenderTemplate(w, "admin-audit.page.html", struct {
+		adminPage
+		Entries []audit.Entry
+		Query   url.Values
+		Exports map[string]string
+		Checked int
+		Broken  string
+	}{c.page(r, "audit", "Audit log", errMsg), entries, r.URL.Query(), exports, checked, broken})
+}
+
+// AuditExport downloads the audit log for an investigation, filtered like
+// AuditLog.
+func (c *AdminConsole) AuditExport(w http.ResponseWriter, r *http.Request) {
+	NewAuditHandler(c.Audit).Export(w, r)
+}
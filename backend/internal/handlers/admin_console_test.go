@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/compliance"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/fraud"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// fakeDirectory keeps accounts in memory.
+type fakeDirectory struct {
+	users map[string]*auth.User
+}
+
+func (d *fakeDirectory) User(ctx context.Context, uid string) (*auth.User, error) {
+	u, ok := d.users[uid]
+	if !ok {
+		return nil, errors.New("no such user")
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (d *fakeDirectory) Users(ctx context.Context, pageToken string, pageSize int) ([]auth.User, string, error) {
+	list := []auth.User{}
+	for _, u := range d.users {
+		list = append(list, *u)
+	}
+	return list, "", nil
+}
+
+func (d *fakeDirectory) SetRole(ctx context.Context, uid, role string) error {
+	d.users[uid].Role = role
+	return nil
+}
+
+func (d *fakeDirectory) SetPartner(ctx context.Context, uid, partnerID string) error {
+	if partnerID != "" {
+		d.users[uid].Role = auth.RolePartner
+	}
+	d.users[uid].PartnerID = partnerID
+	return nil
+}
+
+func (d *fakeDirectory) SetDisabled(ctx context.Context, uid string, disabled bool) error {
+	d.users[uid].Disabled = disabled
+	return nil
+}
+
+func newTestConsole(t *testing.T) (*AdminConsole, *fakeDirectory) {
+	t.Helper()
+	if err := utils.LoadTemplates(); err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+	db := store.NewMemory()
+	ledger := rewards.NewLedger(db)
+	catalogue := rewards.NewCatalogue(db, ledger)
+	if err := catalogue.Seed(); err != nil {
+		t.Fatalf("seeding rewards: %v", err)
+	}
+	itemCatalogue := items.NewService(db)
+	if err := itemCatalogue.Seed(); err != nil {
+		t.Fatalf("seeding items: %v", err)
+	}
+	directory := &fakeDirectory{users: map[string]*auth.User{
+		"admin1": {UID: "admin1", Email: "admin@example.com", Role: auth.RoleAdmin},
+		"u1":     {UID: "u1", Email: "<b>resident</b>@example.com", Role: auth.RoleResident},
+	}}
+	console := NewAdminConsole(directory, pickups.NewService(db), compliance.NewService(db, compliance.Operator{Name: "ZingiraTech Ltd", Licence: "EW/C/TEST", Address: "Nairobi"}),
+		fraud.NewDetector(db, ledger, catalogue, fraud.DefaultThresholds), itemCatalogue, catalogue, audit.NewLog(db), []byte("secret"))
+	return console, directory
+}
+
+// consolePost submits a console form as admin1.
+func consolePost(c *AdminConsole, h http.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = withUser(req, "admin1", map[string]interface{}{"role": auth.RoleAdmin})
+	resp := httptest.NewRecorder()
+	h(resp, req)
+	return resp
+}
+
+func TestAdminConsolePagesRender(t *testing.T) {
+	c, _ := newTestConsole(t)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		want    string
+	}{
+		{name: "Overview", handler: c.Overview, target: "/admin", want: "Recent changes"},
+		{name: "Users", handler: c.Users, target: "/admin/users", want: "&lt;b&gt;resident&lt;/b&gt;@example.com"},
+		{name: "Pickups", handler: c.PickupsPage, target: "/admin/pickups?status=scheduled", want: "No pickups."},
+		{name: "Partners", handler: c.Partners, target: "/admin/partners", want: "No cases awaiting review."},
+		{name: "Catalogue", handler: c.Catalogue, target: "/admin/catalogue", want: "Phones and tablets"},
+		{name: "Audit", handler: c.AuditLog, target: "/admin/audit", want: "No matching entries."},
+		{name: "Compliance", handler: c.CompliancePage, target: "/admin/compliance", want: "compliance.js"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodGet, tt.target, nil), "admin1", map[string]interface{}{"role": auth.RoleAdmin})
+			resp := httptest.NewRecorder()
+			tt.handler(resp, req)
+			if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), tt.want) {
+				t.Errorf("GET %s = %d, want 200 containing %q:\n%s", tt.target, resp.Code, tt.want, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminConsoleUsers(t *testing.T) {
+	c, directory := newTestConsole(t)
+	csrf := c.csrfToken("admin1")
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+	}{
+		{name: "Missing CSRF token", form: url.Values{"uid": {"u1"}, "action": {"role"}, "role": {auth.RoleCollector}}, wantStatus: http.StatusForbidden},
+		{name: "Own account", form: url.Values{"csrf": {csrf}, "uid": {"admin1"}, "action": {"disable"}}, wantStatus: http.StatusBadRequest},
+		{name: "Unknown role", form: url.Values{"csrf": {csrf}, "uid": {"u1"}, "action": {"role"}, "role": {"owner"}}, wantStatus: http.StatusBadRequest},
+		{name: "Role", form: url.Values{"csrf": {csrf}, "uid": {"u1"}, "action": {"role"}, "role": {auth.RoleCollector}}, wantStatus: http.StatusSeeOther},
+		{name: "Disable", form: url.Values{"csrf": {csrf}, "uid": {"u1"}, "action": {"disable"}}, wantStatus: http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := consolePost(c, c.Users, "/admin/users", tt.form); resp.Code != tt.wantStatus {
+				t.Errorf("expected status %v, got %v", tt.wantStatus, resp.Code)
+			}
+		})
+	}
+
+	if u := directory.users["u1"]; u.Role != auth.RoleCollector || !u.Disabled {
+		t.Errorf("u1 = %+v, want a disabled collector", u)
+	}
+	entries, _ := c.Audit.List(audit.Filter{Target: "u1"})
+	if len(entries) != 2 || entries[0].Action != "user.disable" || entries[1].Actor != "admin1" || entries[1].Role != auth.RoleAdmin ||
+		len(entries[1].Changes) != 1 || string(entries[1].Changes[0].After) != `"collector"` {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestAdminConsoleReassignAndCancelPickup(t *testing.T) {
+	c, _ := newTestConsole(t)
+	p, err := c.Pickups.Create("u1", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "phones", Condition: "working", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	csrf := c.csrfToken("admin1")
+	partner := compliance.Partner{
+		ID: "weee", Name: "WEEE Centre", Licence: "NEMA/EW/1",
+		CertifiedFrom: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), CertifiedUntil: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if _, err := c.Compliance.SavePartner(partner, "admin1"); err != nil {
+		t.Fatalf("SavePartner() error = %v", err)
+	}
+
+	if resp := consolePost(c, c.PickupsPage, "/admin/pickups", url.Values{"csrf": {csrf}, "id": {p.ID}, "action": {"reassign"}, "collector": {"c1"}, "partner": {"nobody"}}); resp.Code != http.StatusBadRequest {
+		t.Errorf("reassign to an unknown partner = %d, want %d", resp.Code, http.StatusBadRequest)
+	}
+	resp := consolePost(c, c.PickupsPage, "/admin/pickups?status=scheduled", url.Values{"csrf": {csrf}, "id": {p.ID}, "action": {"reassign"}, "collector": {"c1"}, "partner": {"weee"}})
+	if resp.Code != http.StatusSeeOther || resp.Header().Get("Location") != "/admin/pickups?notice=reassigned&status=scheduled" {
+		t.Fatalf("reassign = %d %s", resp.Code, resp.Header().Get("Location"))
+	}
+	if resp := consolePost(c, c.PickupsPage, "/admin/pickups", url.Values{"csrf": {csrf}, "id": {p.ID}, "action": {"cancel"}}); resp.Code != http.StatusSeeOther {
+		t.Fatalf("cancel = %d", resp.Code)
+	}
+	if resp := consolePost(c, c.PickupsPage, "/admin/pickups", url.Values{"csrf": {csrf}, "id": {p.ID}, "action": {"cancel"}}); resp.Code != http.StatusConflict {
+		t.Errorf("cancelling twice = %d, want %d", resp.Code, http.StatusConflict)
+	}
+
+	got, _ := c.Pickups.Get(p.ID)
+	if got.Status != pickups.StatusCancelled || got.CollectorID != "c1" || got.PartnerID != "weee" {
+		t.Errorf("pickup = %+v", got)
+	}
+	entries, _ := c.Audit.List(audit.Filter{Target: p.ID})
+	if len(entries) != 2 || entries[0].Action != "pickup.cancel" || !hasChange(entries[1].Changes, "collector_id", `"c1"`) {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestAdminConsoleCatalogue(t *testing.T) {
+	c, _ := newTestConsole(t)
+	csrf := c.csrfToken("admin1")
+
+	if resp := consolePost(c, c.Catalogue, "/admin/catalogue", url.Values{"csrf": {csrf}, "action": {"reward"}, "id": {"eco-bag-set"}, "points_cost": {"250"}, "active": {"false"}}); resp.Code != http.StatusSeeOther {
+		t.Fatalf("reward = %d", resp.Code)
+	}
+	if resp := consolePost(c, c.Catalogue, "/admin/catalogue", url.Values{"csrf": {csrf}, "action": {"category"}, "id": {"phones"}, "active": {"false"}}); resp.Code != http.StatusSeeOther {
+		t.Fatalf("category = %d", resp.Code)
+	}
+	if resp := consolePost(c, c.Catalogue, "/admin/catalogue", url.Values{"csrf": {csrf}, "action": {"reward"}, "id": {"missing"}, "points_cost": {"1"}}); resp.Code != http.StatusNotFound {
+		t.Errorf("missing reward = %d, want %d", resp.Code, http.StatusNotFound)
+	}
+
+	reward, _ := c.Rewards.Get("eco-bag-set")
+	category, _ := c.Items.Get("phones")
+	if reward.Active || reward.PointsCost != 250 || category.Active {
+		t.Errorf("reward = %+v, category active = %v", reward, category.Active)
+	}
+	entries, _ := c.Audit.List(audit.Filter{Action: "catalogue.reward"})
+	if len(entries) != 1 || !hasChange(entries[0].Changes, "points_cost", "250") || !hasChange(entries[0].Changes, "active", "false") {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+// hasChange reports whether changes set field to the JSON value after.
+func hasChange(changes []audit.Change, field, after string) bool {
+	for _, c := range changes {
+		if c.Field == field {
+			return string(c.After) == after
+		}
+	}
+	return false
+}
+
+func TestAuditExportAndVerify(t *testing.T) {
+	c, _ := newTestConsole(t)
+	consolePost(c, c.Users, "/admin/users", url.Values{"csrf": {c.csrfToken("admin1")}, "uid": {"u1"}, "action": {"disable"}})
+
+	req := withUser(httptest.NewRequest(http.MethodGet, "/admin/audit/export?format=csv&target=u1", nil), "admin1", map[string]interface{}{"role": auth.RoleAdmin})
+	resp := httptest.NewRecorder()
+	c.AuditExport(resp, req)
+	if resp.Code != http.StatusOK || !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/csv") || !strings.Contains(resp.Body.String(), "user.disable") {
+		t.Fatalf("export = %d %s:\n%s", resp.Code, resp.Header().Get("Content-Type"), resp.Body.String())
+	}
+	if entries, _ := c.Audit.List(audit.Filter{Action: "audit.export"}); len(entries) != 1 || entries[0].Actor != "admin1" {
+		t.Errorf("export audit entries = %+v", entries)
+	}
+
+	resp = httptest.NewRecorder()
+	NewAuditHandler(c.Audit).Verify(resp, httptest.NewRequest(http.MethodGet, "/api/admin/audit/verify", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"intact":true`) {
+		t.Errorf("verify = %d %s", resp.Code, resp.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/apikeys"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// APIKeysHandler serves the partner portal's API key settings and the admin
+// overview of every partner's keys. Keys are managed by signed-in partner
+// accounts; a key cannot issue other keys.
+type APIKeysHandler struct {
+	APIKeys *apikeys.Service
+}
+
+// NewAPIKeysHandler creates an APIKeysHandler.
+func NewAPIKeysHandler(service *apikeys.Service) *APIKeysHandler {
+	return &APIKeysHandler{APIKeys: service}
+}
+
+// writeAPIKeyError maps API key service errors onto responses.
+func writeAPIKeyError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, apikeys.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, apikeys.ErrInvalidRequest):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// Keys lists the partner's keys and the scopes on offer (GET), issues one
+// (POST) or revokes ?id= (DELETE). The key itself is only returned by POST.
+func (h *APIKeysHandler) Keys(w http.ResponseWriter, r *http.Request) {
+	partner := partnerID(w, r)
+	if partner == "" {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.APIKeys.Keys(partner)
+		if err != nil {
+			writeAPIKeyError(w, err, "could not load API keys")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"keys": list, "scopes": apikeys.Scopes})
+	case http.MethodPost:
+		var req apikeys.KeyRequest
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		key, raw, err := h.APIKeys.Create(partner, auth.UIDFromContext(r.Context()), req)
+		if err != nil {
+			writeAPIKeyError(w, err, "could not issue API key")
+			return
+		}
+		audit.Describe(r.Context(), key.ID, nil, key)
+		utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{"key": key, "secret": raw})
+	case http.MethodDelete:
+		before := h.key(partner, r.URL.Query().Get("id"))
+		key, err := h.APIKeys.Revoke(partner, r.URL.Query().Get("id"))
+		if err != nil {
+			writeAPIKeyError(w, err, "could not revoke API key")
+			return
+		}
+		audit.Describe(r.Context(), key.ID, before, key)
+		utils.WriteJSON(w, http.StatusOK, key)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// key returns the key with the given ID issued to partner, or to any partner
+// when partner is empty, or nil.
+func (h *APIKeysHandler) key(partner, id string) *apikeys.Key {
+	list, _ := h.APIKeys.Keys(partner)
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// Rotate issues a replacement for a key and returns it. The old key keeps
+// working for apikeys.RotationOverlap.
+func (h *APIKeysHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	partner := partnerID(w, r)
+	if partner == "" {
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key, raw, err := h.APIKeys.Rotate(partner, auth.UIDFromContext(r.Context()), req.ID)
+	if err != nil {
+		writeAPIKeyError(w, err, "could not rotate API key")
+		return
+	}
+	audit.Describe(r.Context(), key.ID, nil, key)
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{"key": key, "secret": raw})
+}
+
+// Admin lists every partner's keys (GET) or revokes ?id= (DELETE), for when
+// a key has leaked.
+func (h *APIKeysHandler) Admin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.APIKeys.Keys("")
+		if err != nil {
+			writeAPIKeyError(w, err, "could not load API keys")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"keys": list})
+	case http.MethodDelete:
+		before := h.key("", r.URL.Query().Get("id"))
+		key, err := h.APIKeys.Revoke("", r.URL.Query().Get("id"))
+		if err != nil {
+			writeAPIKeyError(w, err, "could not revoke API key")
+			return
+		}
+		audit.Describe(r.Context(), key.ID, before, key)
+		utils.WriteJSON(w, http.StatusOK, key)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxAuditEntries caps how many entries a single listing returns.
+const maxAuditEntries = 1000
+
+// AuditHandler lets admins search, export and verify the audit log.
+type AuditHandler struct {
+	Audit *audit.Log
+}
+
+// NewAuditHandler creates an AuditHandler.
+func NewAuditHandler(entries *audit.Log) *AuditHandler {
+	return &AuditHandler{Audit: entries}
+}
+
+// Entries returns the latest entries, newest first, filtered by ?actor=,
+// ?action=, ?target=, ?request_id=, ?from= and ?to= (YYYY-MM-DD, both
+// inclusive) and capped by ?limit=.
+func (h *AuditHandler) Entries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entries, err := h.Audit.List(filter)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load audit log")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+// Export downloads the entries matching the same filters as Entries, oldest
+// first, as ?format=jsonl (the default) or csv. The export is audited too.
+func (h *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get("limit") == "" {
+		filter.Limit = 0
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = audit.FormatJSONL
+	}
+	data, err := h.Audit.Export(filter, format)
+	if errors.Is(err, audit.ErrUnknownFormat) {
+		utils.WriteJSONError(w, http.StatusBadRequest, "format must be jsonl or csv")
+		return
+	}
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not export audit log")
+		return
+	}
+	// Who took a copy of the log is itself worth knowing.
+	details := map[string]string{"format": format}
+	if r.URL.RawQuery != "" {
+		details["query"] = r.URL.RawQuery
+	}
+	if _, err := h.Audit.Record(audit.Entry{Origin: audit.OriginOf(r), Action: "audit.export", Details: details}); err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not export audit log")
+		return
+	}
+	w.Header().Set("Content-Type", audit.ContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", audit.Filename(format, time.Now())))
+	w.Write(data)
+}
+
+// Verify checks that no recorded entry has been altered or removed.
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	n, err := h.Audit.Verify()
+	switch {
+	case errors.Is(err, audit.ErrTampered):
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"intact": false, "entries": n, "error": err.Error()})
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not verify audit log")
+	default:
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"intact": true, "entries": n})
+	}
+}
+
+// auditFilter reads audit filters from a query string. The limit defaults to,
+// and is capped at, maxAuditEntries.
+func auditFilter(q url.Values) (audit.Filter, error) {
+	dates, err := impactFilter(q)
+	if err != nil {
+		return audit.Filter{}, err
+	}
+	filter := audit.Filter{
+		Actor:     q.Get("actor"),
+		Action:    q.Get("action"),
+		Target:    q.Get("target"),
+		RequestID: q.Get("request_id"),
+		From:      dates.From,
+		To:        dates.To,
+		Limit:     maxAuditEntries,
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return filter, errors.New("limit must be a positive number")
+		}
+		if limit < maxAuditEntries {
+			filter.Limit = limit
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/collections"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/routing"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxSyncBody caps sync batches, which may carry photos.
+const maxSyncBody = 16 << 20
+
+// eat is the time zone collectors work in.
+var eat = time.FixedZone("EAT", 3*60*60)
+
+// CollectorHandler serves the collector mobile app.
+type CollectorHandler struct {
+	Routes      *routing.Service
+	Collections *collections.Service
+	now         func() time.Time
+}
+
+// NewCollectorHandler creates a CollectorHandler.
+func NewCollectorHandler(routeService *routing.Service, collectionService *collections.Service) *CollectorHandler {
+	return &CollectorHandler{Routes: routeService, Collections: collectionService, now: time.Now}
+}
+
+// Manifest returns the signed-in collector's run for ?date=, today by
+// default, with the server time so the app can correct its clock.
+func (h *CollectorHandler) Manifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = h.now().In(eat).Format("2006-01-02")
+	}
+	manifest, err := h.Routes.Plan(date, uid)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"manifest": manifest, "server_time": h.now().UTC()})
+}
+
+// Sync applies a batch of updates queued on the collector's device and
+// reports the outcome of each one.
+func (h *CollectorHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req struct {
+		DeviceID   string                  `json:"device_id"`
+		Operations []collections.Operation `json:"operations"`
+	}
+	if err := utils.DecodeJSONLimit(r, &req, maxSyncBody); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := h.Collections.Sync(uid, req.Operations)
+	if errors.Is(err, collections.ErrBatchTooLarge) {
+		utils.WriteJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not sync")
+		return
+	}
+	audit.Describe(r.Context(), req.DeviceID, nil, map[string]interface{}{"results": results})
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"results": results, "server_time": h.now().UTC()})
+}
+
+// Collection returns what has been captured at ?pickup_id=. Collectors see
+// their own pickups; admins see any.
+func (h *CollectorHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	collectorID := uid
+	if auth.RoleFromContext(r.Context()) == auth.RoleAdmin {
+		collectorID = ""
+	}
+	collection, err := h.Collections.Get(r.URL.Query().Get("pickup_id"), collectorID)
+	if errors.Is(err, pickups.ErrNotFound) {
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load collection")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, collection)
+}
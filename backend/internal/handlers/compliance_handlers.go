@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/compliance"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// ComplianceHandler serves regulatory compliance reports and the partner
+// and handover records they are built from.
+type ComplianceHandler struct {
+	Compliance *compliance.Service
+}
+
+// NewComplianceHandler creates a ComplianceHandler.
+func NewComplianceHandler(service *compliance.Service) *ComplianceHandler {
+	return &ComplianceHandler{Compliance: service}
+}
+
+// Reports lists the generated reports on GET and generates the report for
+// {"period": "2026-09"} on POST, replacing an earlier version.
+func (h *ComplianceHandler) Reports(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Compliance.List()
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load compliance reports")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"reports": list})
+	case http.MethodPost:
+		var req struct {
+			Period string `json:"period"`
+		}
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		report, err := h.Compliance.Generate(req.Period, auth.UIDFromContext(r.Context()))
+		if err != nil {
+			writeComplianceError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), report.ID, nil, report)
+		utils.WriteJSON(w, http.StatusCreated, report)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Document returns the report ?id= as JSON, or as a download with
+// ?format=csv, xlsx or pdf.
+func (h *ComplianceHandler) Document(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	report, err := h.Compliance.Get(r.URL.Query().Get("id"))
+	if err != nil {
+		writeComplianceError(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" || format == "json" {
+		utils.WriteJSON(w, http.StatusOK, report)
+		return
+	}
+	contentType, ok := compliance.ContentTypes[format]
+	if !ok {
+		utils.WriteJSONError(w, http.StatusBadRequest, "format must be json, csv, xlsx or pdf")
+		return
+	}
+	data, err := compliance.Render(report, format)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not render compliance report")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Filename(format)))
+	w.Write(data)
+}
+
+// Partners lists the recycling partners on GET and creates or replaces one on PUT.
+func (h *ComplianceHandler) Partners(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Compliance.Partners()
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load partners")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"partners": list})
+	case http.MethodPut:
+		var partner compliance.Partner
+		if err := utils.DecodeJSON(r, &partner); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Compliance.Partner(partner.ID)
+		saved, err := h.Compliance.SavePartner(partner, auth.UIDFromContext(r.Context()))
+		if err != nil {
+			writeComplianceError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), saved.ID, before, saved)
+		utils.WriteJSON(w, http.StatusOK, saved)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Handovers returns the handover of ?pickup_id= on GET and records a pickup
+// passing into a partner's custody on POST.
+func (h *ComplianceHandler) Handovers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handover, err := h.Compliance.Handover(r.URL.Query().Get("pickup_id"))
+		if err != nil {
+			writeComplianceError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, handover)
+	case http.MethodPost:
+		var req compliance.Handover
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		handover, err := h.Compliance.RecordHandover(req, auth.UIDFromContext(r.Context()))
+		if err != nil {
+			writeComplianceError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), handover.PickupID, nil, handover)
+		utils.WriteJSON(w, http.StatusCreated, handover)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func writeComplianceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, compliance.ErrNotFound), errors.Is(err, compliance.ErrHandoverNotFound),
+		errors.Is(err, compliance.ErrPartnerNotFound), errors.Is(err, pickups.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, compliance.ErrHandoverExists):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, compliance.ErrInvalidPeriod), errors.Is(err, compliance.ErrInvalidPartner),
+		errors.Is(err, compliance.ErrInvalidHandover):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not process compliance request")
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/events"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxEvents caps how many events a single listing returns.
+const maxEvents = 500
+
+// EventsHandler lets admins browse the domain events recorded so far.
+type EventsHandler struct {
+	Events *events.Bus
+}
+
+// NewEventsHandler creates an EventsHandler.
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{Events: bus}
+}
+
+// List returns the latest events, newest first, filtered by ?type= and
+// ?subject= and capped by ?limit=. Their deliveries are jobs of kind
+// events.DeliverKind.
+func (h *EventsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	filter := events.Filter{Type: query.Get("type"), Subject: query.Get("subject"), Limit: maxEvents}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxEvents {
+			utils.WriteJSONError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxEvents))
+			return
+		}
+		filter.Limit = limit
+	}
+	list, err := h.Events.Events(filter)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load events")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"events": list, "types": events.Types})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/fraud"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// FraudHandler serves the admin review queue for suspected rewards abuse.
+type FraudHandler struct {
+	Detector *fraud.Detector
+}
+
+// NewFraudHandler creates a FraudHandler.
+func NewFraudHandler(detector *fraud.Detector) *FraudHandler {
+	return &FraudHandler{Detector: detector}
+}
+
+// Cases lists fraud cases, open ones by default or filtered by ?status=.
+func (h *FraudHandler) Cases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = fraud.StatusOpen
+	} else if status == "all" {
+		status = ""
+	}
+
+	cases, err := h.Detector.Cases(status)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load cases")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"cases": cases})
+}
+
+// Resolve releases or confirms a case.
+func (h *FraudHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		ID       string `json:"id"`
+		Decision string `json:"decision"`
+		Notes    string `json:"notes"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Decision != "release" && req.Decision != "confirm" {
+		utils.WriteJSONError(w, http.StatusBadRequest, "decision must be release or confirm")
+		return
+	}
+
+	before, _ := h.Detector.Case(req.ID)
+	c, err := h.Detector.Resolve(req.ID, req.Decision == "release", auth.UIDFromContext(r.Context()), req.Notes)
+	switch {
+	case errors.Is(err, fraud.ErrCaseNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, fraud.ErrCaseClosed), errors.Is(err, rewards.ErrRedemptionClosed):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not resolve case")
+	default:
+		audit.Describe(r.Context(), c.ID, before, c)
+		utils.WriteJSON(w, http.StatusOK, c)
+	}
+}
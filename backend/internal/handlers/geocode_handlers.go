@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geocode"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// GeocodeHandler serves address suggestions for the pickup form.
+type GeocodeHandler struct {
+	Geocoder geocode.Geocoder
+}
+
+// NewGeocodeHandler creates a GeocodeHandler.
+func NewGeocodeHandler(geocoder geocode.Geocoder) *GeocodeHandler {
+	return &GeocodeHandler{Geocoder: geocoder}
+}
+
+// Autocomplete returns places matching ?q=, with an optional ?limit=.
+func (h *GeocodeHandler) Autocomplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			utils.WriteJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	candidates, err := h.Geocoder.Autocomplete(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not search addresses")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"candidates": candidates})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/referrals"
 	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
 )
 
@@ -22,7 +23,17 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	utils.RenderTemplate(w, "login.page.html", nil)
 }
 func SignupHandler(w http.ResponseWriter, r *http.Request) {
-	utils.RenderTemplate(w, "signup.page.html", nil)
+	// Only well-formed codes are echoed into the page
+	code, ok := referrals.NormalizeCode(r.URL.Query().Get("ref"))
+	if !ok {
+		code = ""
+	}
+	data := struct {
+		ReferralCode string
+	}{
+		ReferralCode: code,
+	}
+	utils.RenderTemplate(w, "signup.page.html", data)
 }
 func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	utils.RenderTemplate(w, "dashboard.page.html", nil)
@@ -30,6 +41,13 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 func SchedulePickupHandler(w http.ResponseWriter, r *http.Request) {
 	utils.RenderTemplate(w, "pickup.page.html", nil)
 }
+
+// PartnerPortalHandler renders the partner portal. The page loads its data
+// from the partner API, which checks the signed-in account.
+func PartnerPortalHandler(w http.ResponseWriter, r *http.Request) {
+	utils.RenderTemplate(w, "partner.page.html", nil)
+}
+
 func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	utils.RenderTemplate(w, "404.page.html", nil)
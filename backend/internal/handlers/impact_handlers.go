@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/impact"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// ImpactHandler serves environmental impact figures and their factor tables.
+type ImpactHandler struct {
+	Impact *impact.Engine
+}
+
+// NewImpactHandler creates an ImpactHandler.
+func NewImpactHandler(engine *impact.Engine) *ImpactHandler {
+	return &ImpactHandler{Impact: engine}
+}
+
+// Summary returns the signed-in user's impact over ?from= and ?to=
+// (YYYY-MM-DD, both inclusive), optionally split by ?group=month.
+func (h *ImpactHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	filter, err := impactFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.UserID = uid
+	report, err := h.Impact.Report(filter, r.URL.Query().Get("group"))
+	if err != nil {
+		writeImpactError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+// Pickup returns the impact recorded for ?id=. Admins may see any pickup;
+// other users only their own.
+func (h *ImpactHandler) Pickup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	record, err := h.Impact.Pickup(r.URL.Query().Get("id"))
+	if err == nil && record.UserID != uid && auth.RoleFromContext(r.Context()) != auth.RoleAdmin {
+		err = impact.ErrNotFound
+	}
+	if err != nil {
+		writeImpactError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, record)
+}
+
+// Report aggregates impact across users, filtered by ?user=, ?area=,
+// ?county=, ?from= and ?to= and split by ?group=month|area|county|user.
+func (h *ImpactHandler) Report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	filter, err := impactFilter(q)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.UserID, filter.Area, filter.County = q.Get("user"), q.Get("area"), q.Get("county")
+	report, err := h.Impact.Report(filter, q.Get("group"))
+	if err != nil {
+		writeImpactError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+// Factors returns the current factor set (or ?version=N) on GET and publishes a new version on PUT.
+func (h *ImpactHandler) Factors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var (
+			fs  *impact.FactorSet
+			err error
+		)
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, convErr := strconv.Atoi(v)
+			if convErr != nil {
+				utils.WriteJSONError(w, http.StatusBadRequest, "version must be a number")
+				return
+			}
+			fs, err = h.Impact.Version(version)
+		} else {
+			fs, err = h.Impact.Current()
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			utils.WriteJSONError(w, http.StatusNotFound, "factor set version not found")
+			return
+		}
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load impact factors")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, fs)
+	case http.MethodPut:
+		var fs impact.FactorSet
+		if err := utils.DecodeJSON(r, &fs); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Impact.Current()
+		published, err := h.Impact.Publish(fs, auth.UIDFromContext(r.Context()))
+		if err != nil {
+			writeImpactError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), "impact_factors", before, published)
+		utils.WriteJSON(w, http.StatusOK, published)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// impactFilter reads the ?from= and ?to= dates of a report. The end date is
+// inclusive, so the filter runs to the start of the following day.
+func impactFilter(q url.Values) (impact.Filter, error) {
+	var filter impact.Filter
+	if v := q.Get("from"); v != "" {
+		from, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, errors.New("from must be formatted YYYY-MM-DD")
+		}
+		filter.From = from
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, errors.New("to must be formatted YYYY-MM-DD")
+		}
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+func writeImpactError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, impact.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, impact.ErrInvalidReport), errors.Is(err, impact.ErrInvalidFactors):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not compute impact")
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/invoices"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// InvoicesHandler serves invoices, credit notes and billing details.
+type InvoicesHandler struct {
+	Invoices *invoices.Service
+}
+
+// NewInvoicesHandler creates an InvoicesHandler.
+func NewInvoicesHandler(service *invoices.Service) *InvoicesHandler {
+	return &InvoicesHandler{Invoices: service}
+}
+
+// List returns the signed-in user's invoices and credit notes, newest first,
+// optionally filtered by ?kind=invoice|credit_note.
+func (h *InvoicesHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	list, err := h.Invoices.List(invoices.ByUser(uid, r.URL.Query().Get("kind")))
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load invoices")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"invoices": list})
+}
+
+// Document returns one invoice as JSON, or as a PDF download with ?format=pdf.
+// Admins may fetch any document; other users only their own.
+func (h *InvoicesHandler) Document(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	invoice, err := h.Invoices.Get(r.URL.Query().Get("id"))
+	if err == nil && invoice.UserID != uid && auth.RoleFromContext(r.Context()) != auth.RoleAdmin {
+		err = invoices.ErrNotFound
+	}
+	if err != nil {
+		writeInvoiceError(w, err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		utils.WriteJSON(w, http.StatusOK, invoice)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Number+".pdf"))
+		w.Write(invoices.PDF(invoice))
+	default:
+		utils.WriteJSONError(w, http.StatusBadRequest, "format must be json or pdf")
+	}
+}
+
+// Billing returns the signed-in user's billing details on GET and updates them on PUT.
+func (h *InvoicesHandler) Billing(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		party, err := h.Invoices.Billing(uid)
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load billing details")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, party)
+	case http.MethodPut:
+		var party invoices.Party
+		if err := utils.DecodeJSON(r, &party); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Invoices.Billing(uid)
+		saved, err := h.Invoices.SetBilling(uid, party)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), uid, before, saved)
+		utils.WriteJSON(w, http.StatusOK, saved)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Credit lets an admin issue a credit note against an invoice.
+func (h *InvoicesHandler) Credit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		InvoiceID string `json:"invoice_id"`
+		Reason    string `json:"reason"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Reason == "" {
+		utils.WriteJSONError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	note, err := h.Invoices.Credit(req.InvoiceID, req.Reason)
+	if err != nil {
+		writeInvoiceError(w, err)
+		return
+	}
+	audit.Describe(r.Context(), note.ID, nil, note)
+	utils.WriteJSON(w, http.StatusCreated, note)
+}
+
+func writeInvoiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, invoices.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, invoices.ErrInvalidBilling):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, invoices.ErrAlreadyCredited), errors.Is(err, invoices.ErrNotCreditable):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not process invoice")
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// ItemsHandler serves the e-waste item catalogue.
+type ItemsHandler struct {
+	Catalogue *items.Service
+}
+
+// NewItemsHandler creates an ItemsHandler.
+func NewItemsHandler(service *items.Service) *ItemsHandler {
+	return &ItemsHandler{Catalogue: service}
+}
+
+// Categories returns the categories being collected, with the hazards they
+// refer to, for populating forms.
+func (h *ItemsHandler) Categories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	list, err := h.Catalogue.List(false)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load item catalogue")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"categories": list, "hazards": items.Hazards})
+}
+
+// AdminCategories lists every category, retired ones included, on GET and
+// creates or replaces one on PUT.
+func (h *ItemsHandler) AdminCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Catalogue.List(true)
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load item catalogue")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"categories": list})
+	case http.MethodPut:
+		var category items.Category
+		if err := utils.DecodeJSON(r, &category); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Catalogue.Get(category.ID)
+		saved, err := h.Catalogue.Save(category, auth.UIDFromContext(r.Context()))
+		if errors.Is(err, items.ErrInvalidCategory) {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not save item category")
+			return
+		}
+		audit.Describe(r.Context(), saved.ID, before, saved)
+		utils.WriteJSON(w, http.StatusOK, saved)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxJobs caps how many jobs a single listing returns.
+const maxJobs = 200
+
+// JobsHandler lets admins watch the background job queue and retry dead
+// letters.
+type JobsHandler struct {
+	Jobs *jobs.Queue
+}
+
+// NewJobsHandler creates a JobsHandler.
+func NewJobsHandler(queue *jobs.Queue) *JobsHandler {
+	return &JobsHandler{Jobs: queue}
+}
+
+// List returns the latest jobs, newest first, filtered by ?kind= and
+// ?status= and capped by ?limit=. ?status=dead lists the dead letters.
+func (h *JobsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	filter := jobs.Filter{Kind: query.Get("kind"), Status: query.Get("status"), Limit: maxJobs}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxJobs {
+			utils.WriteJSONError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxJobs))
+			return
+		}
+		filter.Limit = limit
+	}
+	list, err := h.Jobs.List(filter)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load jobs")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"jobs": list})
+}
+
+// Retry puts a dead letter back on the queue.
+func (h *JobsHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.Jobs.Retry(req.ID)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrNotDead):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not retry job")
+	default:
+		audit.Describe(r.Context(), job.ID, nil, job)
+		utils.WriteJSON(w, http.StatusOK, job)
+	}
+}
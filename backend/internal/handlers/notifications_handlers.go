@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/notifications"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxNotifications caps how many notifications a single listing returns.
+const maxNotifications = 100
+
+// NotificationsHandler serves notification history and preferences.
+type NotificationsHandler struct {
+	Notifications *notifications.Service
+}
+
+// NewNotificationsHandler creates a NotificationsHandler.
+func NewNotificationsHandler(service *notifications.Service) *NotificationsHandler {
+	return &NotificationsHandler{Notifications: service}
+}
+
+// List returns the notifications sent to the signed-in user, newest first.
+func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	list, err := h.Notifications.List(notifications.Filter{UserID: uid, Limit: maxNotifications})
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load notifications")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"notifications": list})
+}
+
+// Preferences returns the signed-in user's notification preferences on GET
+// and updates them on PUT. Both also list the notifications there are, so
+// the page can offer the optional ones for muting.
+func (h *NotificationsHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var prefs notifications.Preferences
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		prefs, err = h.Notifications.Preferences(uid)
+	case http.MethodPut:
+		if err := utils.DecodeJSON(r, &prefs); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Notifications.Preferences(uid)
+		prefs, err = h.Notifications.SetPreferences(uid, prefs)
+		if err == nil {
+			audit.Describe(r.Context(), uid, before, prefs)
+		}
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	switch {
+	case errors.Is(err, notifications.ErrInvalidPreferences):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not process notification preferences")
+	default:
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"preferences": prefs, "templates": notifications.Templates})
+	}
+}
+
+// Verify confirms a new email address or phone number with the code sent to
+// it, given as {"channel": "email"|"sms", "code": "123456"}.
+func (h *NotificationsHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	var req struct {
+		Channel string `json:"channel"`
+		Code    string `json:"code"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	before, _ := h.Notifications.Preferences(uid)
+	prefs, err := h.Notifications.VerifyContact(uid, req.Channel, req.Code)
+	if err == nil {
+		audit.Describe(r.Context(), uid, before, prefs)
+	}
+	switch {
+	case errors.Is(err, notifications.ErrInvalidCode):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not verify contact details")
+	default:
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"preferences": prefs})
+	}
+}
+
+// Admin lets an admin look into deliveries, filtered by ?user_id= and
+// ?status=pending|sent|failed|skipped.
+func (h *NotificationsHandler) Admin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	list, err := h.Notifications.List(notifications.Filter{UserID: q.Get("user_id"), Status: q.Get("status"), Limit: maxNotifications})
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load notifications")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"notifications": list})
+}
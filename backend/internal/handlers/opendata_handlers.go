@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/opendata"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// openDataCache lets clients and proxies reuse published statistics, which
+// only change when a new bucket completes.
+const openDataCache = "public, max-age=3600"
+
+// OpenDataHandler serves anonymised recycling statistics to the public.
+type OpenDataHandler struct {
+	OpenData *opendata.Service
+}
+
+// NewOpenDataHandler creates an OpenDataHandler.
+func NewOpenDataHandler(service *opendata.Service) *OpenDataHandler {
+	return &OpenDataHandler{OpenData: service}
+}
+
+// Datasets documents the published datasets, their schemas and the
+// suppression thresholds applied to them.
+func (h *OpenDataHandler) Datasets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", openDataCache)
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"datasets":   opendata.Datasets,
+		"buckets":    []string{opendata.BucketMonth, opendata.BucketQuarter, opendata.BucketYear},
+		"thresholds": h.OpenData.Thresholds(),
+		"licence":    opendata.Licence,
+	})
+}
+
+// Data returns ?dataset= split by ?bucket=month|quarter|year over ?from= and
+// ?to= (YYYY-MM-DD, widened to whole buckets), as JSON or with ?format=csv.
+func (h *OpenDataHandler) Data(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	period, err := impactFilter(q)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	table, err := h.OpenData.Query(q.Get("dataset"), q.Get("bucket"), period.From, period.To)
+	if err != nil {
+		writeOpenDataError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", openDataCache)
+	switch q.Get("format") {
+	case "", "json":
+		utils.WriteJSON(w, http.StatusOK, table)
+	case "csv":
+		data, err := opendata.CSV(table)
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not build dataset")
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", table.Dataset+"-"+table.Bucket+".csv"))
+		w.Write(data)
+	default:
+		utils.WriteJSONError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+// Export downloads every dataset split by ?bucket= as a zip archive with a
+// datapackage.json describing the files.
+func (h *OpenDataHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	archive, err := h.OpenData.Export(r.URL.Query().Get("bucket"))
+	if err != nil {
+		writeOpenDataError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", openDataCache)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="zingiratech-ewaste-statistics.zip"`)
+	w.Write(archive)
+}
+
+func writeOpenDataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, opendata.ErrUnknownDataset):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, opendata.ErrInvalidQuery):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not build dataset")
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxCallbackBody caps the size of provider callbacks.
+const maxCallbackBody = 64 << 10
+
+// PaymentsHandler serves the mobile-money payments API.
+type PaymentsHandler struct {
+	Payments *payments.Service
+}
+
+// NewPaymentsHandler creates a PaymentsHandler.
+func NewPaymentsHandler(service *payments.Service) *PaymentsHandler {
+	return &PaymentsHandler{Payments: service}
+}
+
+// Collection lists the signed-in user's payments on GET and starts a new one on POST.
+func (h *PaymentsHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Payments.List(payments.ByUser(uid))
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load payments")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"payments": list})
+	case http.MethodPost:
+		var req payments.InitiateRequest
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		payment, err := h.Payments.Initiate(r.Context(), uid, req)
+		if err != nil {
+			writePaymentError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), payment.ID, nil, payment)
+		utils.WriteJSON(w, http.StatusAccepted, payment)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Callback receives the provider's result for a payment. It is not behind the
+// auth middleware; the signed ref/sig query parameters authenticate it instead.
+func (h *PaymentsHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// Providers add fields over time, so unknown fields are tolerated here.
+	var cb payments.Callback
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBody)).Decode(&cb); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, "invalid callback body")
+		return
+	}
+
+	query := r.URL.Query()
+	payment, err := h.Payments.HandleCallback(query.Get("ref"), query.Get("sig"), &cb)
+	switch {
+	case errors.Is(err, payments.ErrInvalidSignature):
+		log.Printf("WARNING: rejected payment callback for %q: %v", query.Get("ref"), err)
+		utils.WriteJSONError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, payments.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not record payment result")
+	default:
+		log.Printf("Payment %s is %s", payment.ID, payment.Status)
+		audit.Describe(r.Context(), payment.ID, nil, payment)
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"ResultCode": 0, "ResultDesc": "Accepted"})
+	}
+}
+
+// Reconcile settles payments whose callbacks never arrived and reports
+// payments that disagree with the state of their pickups.
+func (h *PaymentsHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	report, err := h.Payments.Reconcile(r.Context())
+	if err != nil {
+		log.Printf("ERROR: reconciling payments: %v", err)
+		utils.WriteJSONError(w, http.StatusBadGateway, "could not reconcile payments")
+		return
+	}
+	audit.Describe(r.Context(), "payments", nil, report)
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func writePaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, payments.ErrInvalidPayment):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, payments.ErrIdempotencyConflict):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, payments.ErrProviderRejected):
+		utils.WriteJSONError(w, http.StatusBadGateway, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not start payment")
+	}
+}
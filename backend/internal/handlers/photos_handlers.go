@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/photos"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// maxPhotoForm caps a multipart upload: the photo plus room for the other fields.
+const maxPhotoForm = photos.MaxUploadBytes + 64<<10
+
+// PhotosHandler serves photo uploads and signed photo links.
+type PhotosHandler struct {
+	Photos *photos.Service
+}
+
+// NewPhotosHandler creates a PhotosHandler.
+func NewPhotosHandler(service *photos.Service) *PhotosHandler {
+	return &PhotosHandler{Photos: service}
+}
+
+// Collection lists the photos of ?pickup_id= with signed links on GET and
+// accepts a multipart upload (pickup_id, kind, caption and a "photo" file) on POST.
+func (h *PhotosHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	actor := photos.Actor{UID: uid, Admin: auth.RoleFromContext(r.Context()) == auth.RoleAdmin}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Photos.List(actor, r.URL.Query().Get("pickup_id"))
+		if err != nil {
+			writePhotoError(w, err)
+			return
+		}
+		signed := make([]photos.Signed, len(list))
+		for i, p := range list {
+			signed[i] = h.Photos.Sign(p, photos.DefaultURLTTL)
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"photos": signed})
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxPhotoForm)
+		if err := r.ParseMultipartForm(maxPhotoForm); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writePhotoError(w, photos.ErrTooLarge)
+				return
+			}
+			utils.WriteJSONError(w, http.StatusBadRequest, "expected a multipart form")
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, _, err := r.FormFile("photo")
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, "photo file is required")
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, photos.MaxUploadBytes+1))
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, "could not read photo")
+			return
+		}
+
+		photo, err := h.Photos.Upload(actor, r.FormValue("pickup_id"), r.FormValue("kind"), r.FormValue("caption"), data)
+		if err != nil {
+			writePhotoError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), photo.ID, nil, photo)
+		utils.WriteJSON(w, http.StatusCreated, h.Photos.Sign(photo, photos.DefaultURLTTL))
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// File serves a photo from a signed link. The signature stands in for a
+// session so the links work in <img> tags.
+func (h *PhotosHandler) File(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	rc, photo, err := h.Photos.Open(q.Get("id"), q.Get("size"), q.Get("expires"), q.Get("sig"))
+	if err != nil {
+		writePhotoError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", photo.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, rc)
+}
+
+func writePhotoError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, photos.ErrNotFound), errors.Is(err, pickups.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, photos.ErrTooLarge):
+		utils.WriteJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, photos.ErrInvalidImage), errors.Is(err, photos.ErrInvalidKind):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, photos.ErrForbidden), errors.Is(err, photos.ErrInvalidSignature), errors.Is(err, photos.ErrExpired):
+		utils.WriteJSONError(w, http.StatusForbidden, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not process photo")
+	}
+}
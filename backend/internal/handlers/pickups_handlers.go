@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// PickupsHandler serves the pickup scheduling API.
+type PickupsHandler struct {
+	Pickups *pickups.Service
+}
+
+// NewPickupsHandler creates a PickupsHandler.
+func NewPickupsHandler(service *pickups.Service) *PickupsHandler {
+	return &PickupsHandler{Pickups: service}
+}
+
+// Collection lists the signed-in user's pickups on GET and schedules a new one on POST.
+func (h *PickupsHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Pickups.List(pickups.ByUser(uid))
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load pickups")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"pickups": list})
+	case http.MethodPost:
+		var req pickups.CreateRequest
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pickup, err := h.Pickups.Create(uid, req)
+		if err != nil {
+			writePickupError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), pickup.ID, nil, pickup)
+		utils.WriteJSON(w, http.StatusCreated, pickup)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Status changes the status of a pickup. Residents may only cancel their own
+// pickups; the assigned collector and admins drive the rest of the lifecycle.
+func (h *PickupsHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	role := auth.RoleFromContext(r.Context())
+	before, pickup, err := h.Pickups.TransitionIf(req.ID, req.Status, uid, func(p *pickups.Pickup) bool {
+		switch {
+		case role == auth.RoleAdmin:
+			return true
+		case role == auth.RoleCollector && p.CollectorID == uid:
+			return true
+		}
+		return p.UserID == uid && req.Status == pickups.StatusCancelled &&
+			p.Status != pickups.StatusCollected && p.Status != pickups.StatusProcessed
+	})
+	if err != nil {
+		writePickupError(w, err)
+		return
+	}
+	audit.Describe(r.Context(), pickup.ID, before, pickup)
+	utils.WriteJSON(w, http.StatusOK, pickup)
+}
+
+// writePickupError maps pickup service errors to HTTP responses.
+func writePickupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pickups.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, pickups.ErrInvalidPickup):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, pickups.ErrNotAllowed):
+		utils.WriteJSONError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, pickups.ErrInvalidTransition):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, pickups.ErrOutsideServiceArea):
+		utils.WriteJSONError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not update pickup")
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// QuotesHandler serves the commercial quoting API.
+type QuotesHandler struct {
+	Quotes *quotes.Service
+}
+
+// NewQuotesHandler creates a QuotesHandler.
+func NewQuotesHandler(service *quotes.Service) *QuotesHandler {
+	return &QuotesHandler{Quotes: service}
+}
+
+// Collection returns one of the signed-in user's quotes on GET ?id= and issues a new quote on POST.
+func (h *QuotesHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		quote, err := h.Quotes.Get(r.URL.Query().Get("id"))
+		if err == nil && quote.UserID != uid {
+			err = quotes.ErrNotFound
+		}
+		if err != nil {
+			writeQuoteError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, quote)
+	case http.MethodPost:
+		var req quotes.Request
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		quote, err := h.Quotes.Issue(uid, req)
+		if err != nil {
+			writeQuoteError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), quote.ID, nil, quote)
+		utils.WriteJSON(w, http.StatusCreated, quote)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Accept books an accepted quote as a scheduled pickup.
+func (h *QuotesHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req quotes.AcceptRequest
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	quote, pickup, err := h.Quotes.Accept(uid, req)
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+	audit.Describe(r.Context(), pickup.ID, nil, pickup)
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{"quote": quote, "pickup": pickup})
+}
+
+func writeQuoteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, quotes.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, quotes.ErrInvalidQuote), errors.Is(err, quotes.ErrOutOfRange),
+		errors.Is(err, quotes.ErrInvalidSignature), errors.Is(err, pickups.ErrInvalidPickup):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, quotes.ErrExpired):
+		utils.WriteJSONError(w, http.StatusGone, err.Error())
+	case errors.Is(err, pickups.ErrOutsideServiceArea):
+		utils.WriteJSONError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, quotes.ErrAlreadyAccepted):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not process quote")
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/referrals"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// ReferralsHandler serves the referral programme API.
+type ReferralsHandler struct {
+	Referrals *referrals.Service
+}
+
+// NewReferralsHandler creates a ReferralsHandler.
+func NewReferralsHandler(service *referrals.Service) *ReferralsHandler {
+	return &ReferralsHandler{Referrals: service}
+}
+
+// Summary returns the signed-in user's referral code and the people they have invited.
+func (h *ReferralsHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	code, err := h.Referrals.CodeFor(uid)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load referral code")
+		return
+	}
+	list, err := h.Referrals.ReferralsBy(uid)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load referrals")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"code":        code,
+		"invite_link": "/signup?ref=" + code,
+		"referrals":   list,
+	})
+}
+
+// Attribute records the referral code a newly signed-up user arrived with.
+func (h *ReferralsHandler) Attribute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	referral, err := h.Referrals.Attribute(uid, req.Code)
+	switch {
+	case errors.Is(err, referrals.ErrInvalidCode), errors.Is(err, referrals.ErrSelfReferral):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, referrals.ErrAlreadyReferred), errors.Is(err, referrals.ErrNotNewUser):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not record referral")
+	default:
+		audit.Describe(r.Context(), referral.RefereeID, nil, referral)
+		utils.WriteJSON(w, http.StatusCreated, referral)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/reminders"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// RemindersHandler serves pickup ratings and the planned pickup follow-ups.
+type RemindersHandler struct {
+	Reminders *reminders.Scheduler
+}
+
+// NewRemindersHandler creates a RemindersHandler.
+func NewRemindersHandler(scheduler *reminders.Scheduler) *RemindersHandler {
+	return &RemindersHandler{Reminders: scheduler}
+}
+
+// Rate lets the signed-in resident rate one of their collected pickups.
+func (h *RemindersHandler) Rate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	var req struct {
+		PickupID string `json:"pickup_id"`
+		Score    int    `json:"score"`
+		Comment  string `json:"comment"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rating, err := h.Reminders.Rate(uid, req.PickupID, req.Score, req.Comment)
+	switch {
+	case errors.Is(err, pickups.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, reminders.ErrInvalidRating):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, reminders.ErrAlreadyRated):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not save rating")
+	default:
+		audit.Describe(r.Context(), req.PickupID, nil, rating)
+		utils.WriteJSON(w, http.StatusCreated, rating)
+	}
+}
+
+// Jobs lets an admin see the follow-ups planned for ?pickup_id=, or for
+// every pickup when it is omitted.
+func (h *RemindersHandler) Jobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	jobs, err := h.Reminders.Jobs(r.URL.Query().Get("pickup_id"))
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load reminders")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
+
+// Ratings lets an admin read every rating, newest first.
+func (h *RemindersHandler) Ratings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	ratings, err := h.Reminders.Ratings()
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load ratings")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"ratings": ratings})
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// RewardsHandler serves the rewards ledger and catalogue API.
+type RewardsHandler struct {
+	Ledger    *rewards.Ledger
+	Catalogue *rewards.Catalogue
+}
+
+// NewRewardsHandler creates a RewardsHandler.
+func NewRewardsHandler(ledger *rewards.Ledger, catalogue *rewards.Catalogue) *RewardsHandler {
+	return &RewardsHandler{Ledger: ledger, Catalogue: catalogue}
+}
+
+// Balance returns the spendable and pending points of the signed-in user.
+func (h *RewardsHandler) Balance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	balance, err := h.Ledger.Balance(rewards.UserAccount(uid))
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load balance")
+		return
+	}
+	pending, err := h.Ledger.Balance(rewards.PendingAccount(uid))
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load balance")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]int64{"balance": balance, "pending": pending})
+}
+
+// History returns a page of the signed-in user's ledger entries, newest first.
+func (h *RewardsHandler) History(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	page, pageSize := pagination(r)
+	entries, total, err := h.Ledger.History(rewards.UserAccount(uid), page, pageSize)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load history")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"entries":   entries,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// ListCatalogue returns the active rewards, optionally filtered by ?category=.
+func (h *RewardsHandler) ListCatalogue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	list, err := h.Catalogue.List(r.URL.Query().Get("category"), false)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load catalogue")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"rewards": list})
+}
+
+// Redeem exchanges the signed-in user's points for a reward.
+func (h *RewardsHandler) Redeem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req struct {
+		RewardID       string `json:"reward_id"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	redemption, err := h.Catalogue.Redeem(uid, req.RewardID, req.IdempotencyKey)
+	if err != nil {
+		writeRewardsError(w, err)
+		return
+	}
+	audit.Describe(r.Context(), redemption.ID, nil, redemption)
+	utils.WriteJSON(w, http.StatusCreated, redemption)
+}
+
+// Redemptions lists the signed-in user's redemptions.
+func (h *RewardsHandler) Redemptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	list, err := h.Catalogue.Redemptions(uid)
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load redemptions")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"redemptions": list})
+}
+
+// AdminCatalogue lists every reward, including inactive ones, on GET and saves a reward on PUT.
+func (h *RewardsHandler) AdminCatalogue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Catalogue.List("", true)
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load catalogue")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"rewards": list})
+	case http.MethodPut:
+		var reward rewards.Reward
+		if err := utils.DecodeJSON(r, &reward); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Catalogue.Get(reward.ID)
+		saved, err := h.Catalogue.Save(reward)
+		if err != nil {
+			writeRewardsError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), saved.ID, before, saved)
+		utils.WriteJSON(w, http.StatusOK, saved)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// AdminRedemption fulfils or cancels a reserved redemption.
+func (h *RewardsHandler) AdminRedemption(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		ID     string `json:"id"`
+		Action string `json:"action"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var (
+		redemption *rewards.Redemption
+		err        error
+	)
+	switch req.Action {
+	case "fulfil":
+		redemption, err = h.Catalogue.Fulfil(req.ID)
+	case "cancel":
+		redemption, err = h.Catalogue.Cancel(req.ID)
+	default:
+		utils.WriteJSONError(w, http.StatusBadRequest, "action must be fulfil or cancel")
+		return
+	}
+	if err != nil {
+		writeRewardsError(w, err)
+		return
+	}
+	audit.Describe(r.Context(), redemption.ID, nil, redemption)
+	utils.WriteJSON(w, http.StatusOK, redemption)
+}
+
+// writeRewardsError maps rewards errors to HTTP responses.
+func writeRewardsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rewards.ErrRewardNotFound), errors.Is(err, rewards.ErrRedemptionNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, rewards.ErrInsufficientPoints), errors.Is(err, rewards.ErrOutOfStock),
+		errors.Is(err, rewards.ErrIdempotencyConflict), errors.Is(err, rewards.ErrRedemptionClosed):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, rewards.ErrInvalidPosting), errors.Is(err, rewards.ErrInvalidReward):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not process rewards request")
+	}
+}
+
+// pagination reads the page and page_size query parameters, applying defaults and an upper bound.
+func pagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return page, pageSize
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	firebase "firebase.google.com/go/v4/auth"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// withUser attaches a verified token for uid to the request, as AuthMiddleware would.
+func withUser(req *http.Request, uid string, claims map[string]interface{}) *http.Request {
+	token := &firebase.Token{UID: uid, Claims: claims}
+	return req.WithContext(auth.WithToken(req.Context(), token))
+}
+
+func TestRewardsHandlerBalance(t *testing.T) {
+	ledger := rewards.NewLedger(store.NewMemory())
+	if _, err := ledger.Post(rewards.PostingRequest{
+		IdempotencyKey: "seed",
+		Reason:         "pickup",
+		Lines:          rewards.Transfer(rewards.AccountIssued, rewards.UserAccount("u1"), 250),
+	}); err != nil {
+		t.Fatalf("seeding ledger: %v", err)
+	}
+	h := NewRewardsHandler(ledger, nil)
+
+	tests := []struct {
+		name       string
+		uid        string
+		wantStatus int
+		wantPoints int64
+	}{
+		{name: "Signed in", uid: "u1", wantStatus: http.StatusOK, wantPoints: 250},
+		{name: "No user", uid: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/rewards/balance", nil)
+			if tt.uid != "" {
+				req = withUser(req, tt.uid, nil)
+			}
+			resp := httptest.NewRecorder()
+			h.Balance(resp, req)
+			if resp.Code != tt.wantStatus {
+				t.Fatalf("expected status %v, got %v", tt.wantStatus, resp.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body map[string]int64
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if body["balance"] != tt.wantPoints {
+				t.Errorf("expected balance %d, got %d", tt.wantPoints, body["balance"])
+			}
+		})
+	}
+}
+
+func TestRewardsHandlerHistory(t *testing.T) {
+	h := NewRewardsHandler(rewards.NewLedger(store.NewMemory()), nil)
+	req := withUser(httptest.NewRequest(http.MethodGet, "/api/rewards/history?page=2&page_size=500", nil), "u1", nil)
+	resp := httptest.NewRecorder()
+	h.History(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %v, got %v", http.StatusOK, resp.Code)
+	}
+	var body struct {
+		Page     int `json:"page"`
+		PageSize int `json:"page_size"`
+		Total    int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if body.Page != 2 || body.PageSize != 100 || body.Total != 0 {
+		t.Errorf("unexpected pagination %+v", body)
+	}
+}
+
+func TestRewardsHandlerRedeem(t *testing.T) {
+	db := store.NewMemory()
+	ledger := rewards.NewLedger(db)
+	catalogue := rewards.NewCatalogue(db, ledger)
+	if err := catalogue.Seed(); err != nil {
+		t.Fatalf("seeding catalogue: %v", err)
+	}
+	if _, err := ledger.Post(rewards.PostingRequest{
+		IdempotencyKey: "seed",
+		Reason:         "pickup",
+		Lines:          rewards.Transfer(rewards.AccountIssued, rewards.UserAccount("u1"), 300),
+	}); err != nil {
+		t.Fatalf("seeding ledger: %v", err)
+	}
+	h := NewRewardsHandler(ledger, catalogue)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "Redeem affordable reward", body: `{"reward_id":"eco-bag-set","idempotency_key":"a"}`, wantStatus: http.StatusCreated},
+		{name: "Retry is idempotent", body: `{"reward_id":"eco-bag-set","idempotency_key":"a"}`, wantStatus: http.StatusCreated},
+		{name: "Not enough points", body: `{"reward_id":"premium-pickup","idempotency_key":"b"}`, wantStatus: http.StatusConflict},
+		{name: "Unknown reward", body: `{"reward_id":"yacht","idempotency_key":"c"}`, wantStatus: http.StatusNotFound},
+		{name: "Missing key", body: `{"reward_id":"eco-bag-set"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodPost, "/api/rewards/redeem", bytes.NewBufferString(tt.body)), "u1", nil)
+			resp := httptest.NewRecorder()
+			h.Redeem(resp, req)
+			if resp.Code != tt.wantStatus {
+				t.Errorf("expected status %v, got %v: %s", tt.wantStatus, resp.Code, resp.Body.String())
+			}
+		})
+	}
+
+	if balance, _ := ledger.Balance(rewards.UserAccount("u1")); balance != 100 {
+		t.Errorf("expected balance 100 after one redemption, got %d", balance)
+	}
+}
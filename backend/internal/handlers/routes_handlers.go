@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/routing"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// RoutesHandler serves collectors' daily manifests and the vehicle register.
+type RoutesHandler struct {
+	Routes *routing.Service
+}
+
+// NewRoutesHandler creates a RoutesHandler.
+func NewRoutesHandler(service *routing.Service) *RoutesHandler {
+	return &RoutesHandler{Routes: service}
+}
+
+// Manifest returns a collector's run for ?date= as JSON, or as a printable
+// page with ?format=html. Collectors see their own run; admins pass ?collector=.
+func (h *RoutesHandler) Manifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	collectorID := r.URL.Query().Get("collector")
+	switch auth.RoleFromContext(r.Context()) {
+	case auth.RoleAdmin:
+		if collectorID == "" {
+			utils.WriteJSONError(w, http.StatusBadRequest, "collector is required")
+			return
+		}
+	case auth.RoleCollector:
+		if collectorID != "" && collectorID != uid {
+			utils.WriteJSONError(w, http.StatusForbidden, "not allowed to view this manifest")
+			return
+		}
+		collectorID = uid
+	default:
+		utils.WriteJSONError(w, http.StatusForbidden, "only collectors have manifests")
+		return
+	}
+
+	manifest, err := h.Routes.Plan(r.URL.Query().Get("date"), collectorID)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		utils.WriteJSON(w, http.StatusOK, manifest)
+	case "html":
+		page, err := routing.HTML(manifest)
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not render manifest")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	default:
+		utils.WriteJSONError(w, http.StatusBadRequest, "format must be json or html")
+	}
+}
+
+// Day returns the manifests of every collector working on ?date=.
+func (h *RoutesHandler) Day(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	manifests, err := h.Routes.PlanDay(r.URL.Query().Get("date"))
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"manifests": manifests})
+}
+
+// Vehicles lists registered vehicles on GET and registers or updates one on POST.
+func (h *RoutesHandler) Vehicles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		vehicles, err := h.Routes.Vehicles()
+		if err != nil {
+			writeRoutingError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"vehicles": vehicles})
+	case http.MethodPost:
+		var req routing.Vehicle
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before := h.vehicle(req.ID)
+		vehicle, err := h.Routes.SaveVehicle(req)
+		if err != nil {
+			writeRoutingError(w, err)
+			return
+		}
+		audit.Describe(r.Context(), vehicle.ID, before, vehicle)
+		utils.WriteJSON(w, http.StatusOK, vehicle)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// vehicle returns the registered vehicle with the given ID, or nil.
+func (h *RoutesHandler) vehicle(id string) *routing.Vehicle {
+	vehicles, _ := h.Routes.Vehicles()
+	for i := range vehicles {
+		if vehicles[i].ID == id {
+			return &vehicles[i]
+		}
+	}
+	return nil
+}
+
+func writeRoutingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, routing.ErrInvalidDate), errors.Is(err, routing.ErrInvalidVehicle):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not plan routes")
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// EarningRulesHandler lets admins inspect and publish points-earning rules.
+type EarningRulesHandler struct {
+	Engine *rewards.Engine
+}
+
+// NewEarningRulesHandler creates an EarningRulesHandler.
+func NewEarningRulesHandler(engine *rewards.Engine) *EarningRulesHandler {
+	return &EarningRulesHandler{Engine: engine}
+}
+
+// Rules returns the current rule set (or ?version=N) on GET and publishes a new version on PUT.
+func (h *EarningRulesHandler) Rules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var (
+			rs  *rewards.RuleSet
+			err error
+		)
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, convErr := strconv.Atoi(v)
+			if convErr != nil {
+				utils.WriteJSONError(w, http.StatusBadRequest, "version must be a number")
+				return
+			}
+			rs, err = h.Engine.Version(version)
+		} else {
+			rs, err = h.Engine.Current()
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			utils.WriteJSONError(w, http.StatusNotFound, "rule set version not found")
+			return
+		}
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not load rules")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, rs)
+	case http.MethodPut:
+		var rs rewards.RuleSet
+		if err := utils.DecodeJSON(r, &rs); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before, _ := h.Engine.Current()
+		published, err := h.Engine.Publish(rs, auth.UIDFromContext(r.Context()))
+		if errors.Is(err, rewards.ErrInvalidRules) {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteJSONError(w, http.StatusInternalServerError, "could not publish rules")
+			return
+		}
+		audit.Describe(r.Context(), "earning_rules", before, published)
+		utils.WriteJSON(w, http.StatusOK, published)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/serviceareas"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// ServiceAreasHandler serves service-area lookups and the expansion waitlist.
+type ServiceAreasHandler struct {
+	Areas *serviceareas.Service
+}
+
+// NewServiceAreasHandler creates a ServiceAreasHandler.
+func NewServiceAreasHandler(service *serviceareas.Service) *ServiceAreasHandler {
+	return &ServiceAreasHandler{Areas: service}
+}
+
+// List returns the areas in service.
+func (h *ServiceAreasHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"areas": h.Areas.Areas()})
+}
+
+// Locate reports the county, sub-county and service area of ?lat=&lng=.
+func (h *ServiceAreasHandler) Locate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	lat, latErr := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+	if latErr != nil || lngErr != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, "lat and lng are required")
+		return
+	}
+
+	result, err := h.Areas.Locate(geo.Point{Lat: lat, Lng: lng})
+	if err != nil {
+		writeServiceAreaError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// JoinWaitlist records that the signed-in user wants collections at a location we do not serve.
+func (h *ServiceAreasHandler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	uid := auth.UIDFromContext(r.Context())
+	if uid == "" {
+		utils.WriteJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req struct {
+		Address  string    `json:"address"`
+		Location geo.Point `json:"location"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entry, err := h.Areas.JoinWaitlist(uid, req.Address, req.Location)
+	if err != nil {
+		writeServiceAreaError(w, err)
+		return
+	}
+	audit.Describe(r.Context(), uid, nil, entry)
+	utils.WriteJSON(w, http.StatusCreated, entry)
+}
+
+// Waitlist lists waitlist entries and demand per county for admins planning expansion.
+func (h *ServiceAreasHandler) Waitlist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	entries, demand, err := h.Areas.Waitlist()
+	if err != nil {
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not load waitlist")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"entries": entries, "demand": demand})
+}
+
+func writeServiceAreaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, serviceareas.ErrInvalidLocation):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, "could not check service area")
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/webhooks"
+)
+
+// maxDeliveries caps how many deliveries a single listing returns.
+const maxDeliveries = 200
+
+// WebhooksHandler serves the partner portal's webhook settings and delivery
+// log, and the admin overview of every partner's endpoints.
+type WebhooksHandler struct {
+	Webhooks *webhooks.Service
+}
+
+// NewWebhooksHandler creates a WebhooksHandler.
+func NewWebhooksHandler(service *webhooks.Service) *WebhooksHandler {
+	return &WebhooksHandler{Webhooks: service}
+}
+
+// partnerID returns the partner the signed-in account acts for, writing an
+// error and returning "" if it is not linked to one.
+func partnerID(w http.ResponseWriter, r *http.Request) string {
+	id := auth.PartnerIDFromContext(r.Context())
+	if id == "" {
+		utils.WriteJSONError(w, http.StatusForbidden, "this account is not linked to a partner")
+	}
+	return id
+}
+
+// writeWebhookError maps webhook service errors onto responses.
+func writeWebhookError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		utils.WriteJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, webhooks.ErrInvalidEndpoint):
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, webhooks.ErrEndpointDisabled):
+		utils.WriteJSONError(w, http.StatusConflict, err.Error())
+	default:
+		utils.WriteJSONError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// Endpoints lists the partner's endpoints and the events on offer (GET),
+// registers one (POST), changes one (PUT) or removes ?id= (DELETE). The
+// signing secret is only returned by POST.
+func (h *WebhooksHandler) Endpoints(w http.ResponseWriter, r *http.Request) {
+	partner := partnerID(w, r)
+	if partner == "" {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.Webhooks.Endpoints(partner)
+		if err != nil {
+			writeWebhookError(w, err, "could not load webhooks")
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"endpoints": list, "events": webhooks.Events})
+	case http.MethodPost:
+		var req webhooks.EndpointRequest
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		endpoint, secret, err := h.Webhooks.Create(partner, auth.UIDFromContext(r.Context()), req)
+		if err != nil {
+			writeWebhookError(w, err, "could not save webhook")
+			return
+		}
+		audit.Describe(r.Context(), endpoint.ID, nil, endpoint)
+		utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{"endpoint": endpoint, "secret": secret})
+	case http.MethodPut:
+		var req struct {
+			ID     string   `json:"id"`
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+			Active *bool    `json:"active"`
+		}
+		if err := utils.DecodeJSON(r, &req); err != nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		before := h.endpoint(partner, req.ID)
+		var endpoint *webhooks.Endpoint
+		var err error
+		if req.URL != "" || len(req.Events) > 0 {
+			endpoint, err = h.Webhooks.Update(partner, req.ID, webhooks.EndpointRequest{URL: req.URL, Events: req.Events})
+		}
+		if err == nil && req.Active != nil {
+			endpoint, err = h.Webhooks.SetActive(partner, req.ID, *req.Active)
+		}
+		if err == nil && endpoint == nil {
+			utils.WriteJSONError(w, http.StatusBadRequest, "nothing to change")
+			return
+		}
+		if err != nil {
+			writeWebhookError(w, err, "could not save webhook")
+			return
+		}
+		audit.Describe(r.Context(), endpoint.ID, before, endpoint)
+		utils.WriteJSON(w, http.StatusOK, endpoint)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		before := h.endpoint(partner, id)
+		if err := h.Webhooks.Delete(partner, id); err != nil {
+			writeWebhookError(w, err, "could not remove webhook")
+			return
+		}
+		audit.Describe(r.Context(), id, before, nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// endpoint returns the partner's endpoint with the given ID, or nil.
+func (h *WebhooksHandler) endpoint(partner, id string) *webhooks.Endpoint {
+	list, _ := h.Webhooks.Endpoints(partner)
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// RotateSecret replaces the signing secret of an endpoint and returns it.
+func (h *WebhooksHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	partner := partnerID(w, r)
+	if partner == "" {
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	secret, err := h.Webhooks.RotateSecret(partner, req.ID)
+	if err != nil {
+		writeWebhookError(w, err, "could not rotate secret")
+		return
+	}
+	// The secret itself is never written to the audit log.
+	audit.Describe(r.Context(), req.ID, nil, nil)
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"id": req.ID, "secret": secret})
+}
+
+// Deliveries returns the partner's delivery log, newest first, for
+// ?endpoint_id= if given, capped by ?limit=.
+func (h *WebhooksHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	partner := partnerID(w, r)
+	if partner == "" {
+		return
+	}
+	limit := maxDeliveries
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxDeliveries {
+			utils.WriteJSONError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxDeliveries))
+			return
+		}
+		limit = n
+	}
+	list, err := h.Webhooks.Deliveries(partner, r.URL.Query().Get("endpoint_id"), limit)
+	if err != nil {
+		writeWebhookError(w, err, "could not load deliveries")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"deliveries": list})
+}
+
+// Replay sends one of the partner's deliveries again.
+func (h *WebhooksHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	partner := partnerID(w, r)
+	if partner == "" {
+		return
+	}
+	var req struct {
+		DeliveryID string `json:"delivery_id"`
+	}
+	if err := utils.DecodeJSON(r, &req); err != nil {
+		utils.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	delivery, err := h.Webhooks.Replay(partner, req.DeliveryID)
+	if err != nil {
+		writeWebhookError(w, err, "could not replay delivery")
+		return
+	}
+	audit.Describe(r.Context(), delivery.ID, nil, delivery)
+	utils.WriteJSON(w, http.StatusAccepted, delivery)
+}
+
+// Admin lists every partner's endpoints, including their failure counts.
+func (h *WebhooksHandler) Admin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	list, err := h.Webhooks.Endpoints("")
+	if err != nil {
+		writeWebhookError(w, err, "could not load webhooks")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"endpoints": list})
+}
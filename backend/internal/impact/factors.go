@@ -0,0 +1,180 @@
+package impact
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+)
+
+// Materials recovered from devices.
+const (
+	MaterialCopper    = "copper"
+	MaterialGold      = "gold"
+	MaterialAluminium = "aluminium"
+	MaterialPlastics  = "plastics"
+	MaterialSteel     = "steel"
+)
+
+// Toxic substances diverted from landfill and open burning. They share their
+// names with the catalogue's hazards.
+const (
+	ToxicLead        = items.HazardLead
+	ToxicMercury     = items.HazardMercury
+	ToxicCadmium     = items.HazardCadmium
+	ToxicRefrigerant = items.HazardRefrigerant
+)
+
+var (
+	materials = map[string]bool{MaterialCopper: true, MaterialGold: true, MaterialAluminium: true, MaterialPlastics: true, MaterialSteel: true}
+	toxics    = map[string]bool{ToxicLead: true, ToxicMercury: true, ToxicCadmium: true, ToxicRefrigerant: true}
+)
+
+// ErrInvalidFactors is returned when a factor set fails validation.
+var ErrInvalidFactors = errors.New("invalid impact factors")
+
+// Factor converts a kilogram of one catalogue category, or one of its
+// subcategories, into its impact. Materials and Toxics are kilograms per
+// kilogram of device; CO2eKg is the emissions avoided per kilogram by
+// recovering the materials instead of mining them.
+type Factor struct {
+	Category    string             `json:"category"`
+	Subcategory string             `json:"subcategory,omitempty"`
+	Materials   map[string]float64 `json:"materials"`
+	CO2eKg      float64            `json:"co2e_kg"`
+	Toxics      map[string]float64 `json:"toxics"`
+}
+
+// FactorSet is an immutable, versioned table of factors. Default applies to
+// categories without a factor of their own.
+type FactorSet struct {
+	Version   int       `json:"version"`
+	Factors   []Factor  `json:"factors"`
+	Default   Factor    `json:"default"`
+	Source    string    `json:"source"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultFactorSet is used until an admin publishes the first factor set. It
+// is reported as version 0. The figures are averages from published e-waste
+// composition studies and err on the low side.
+func DefaultFactorSet() *FactorSet {
+	return &FactorSet{
+		Version: 0,
+		Factors: []Factor{
+			{Category: "phones", CO2eKg: 6,
+				Materials: map[string]float64{MaterialCopper: 0.15, MaterialGold: 0.00025, MaterialAluminium: 0.05, MaterialPlastics: 0.4, MaterialSteel: 0.03},
+				Toxics:    map[string]float64{ToxicLead: 0.002}},
+			{Category: "computers", CO2eKg: 3,
+				Materials: map[string]float64{MaterialCopper: 0.07, MaterialGold: 0.00003, MaterialAluminium: 0.1, MaterialPlastics: 0.25, MaterialSteel: 0.45},
+				Toxics:    map[string]float64{ToxicLead: 0.003}},
+			{Category: "computers", Subcategory: "laptops", CO2eKg: 5,
+				Materials: map[string]float64{MaterialCopper: 0.1, MaterialGold: 0.0001, MaterialAluminium: 0.15, MaterialPlastics: 0.35, MaterialSteel: 0.15},
+				Toxics:    map[string]float64{ToxicLead: 0.003, ToxicMercury: 0.000005}},
+			{Category: "crt_monitors", CO2eKg: 0.8,
+				Materials: map[string]float64{MaterialCopper: 0.03, MaterialGold: 0.000002, MaterialAluminium: 0.01, MaterialPlastics: 0.2, MaterialSteel: 0.1},
+				Toxics:    map[string]float64{ToxicLead: 0.07}},
+			{Category: "batteries", CO2eKg: 1.5,
+				Materials: map[string]float64{MaterialCopper: 0.03, MaterialPlastics: 0.1, MaterialSteel: 0.2},
+				Toxics:    map[string]float64{ToxicLead: 0.3, ToxicCadmium: 0.01}},
+			{Category: "batteries", Subcategory: "lead_acid", CO2eKg: 1.2,
+				Materials: map[string]float64{MaterialPlastics: 0.1},
+				Toxics:    map[string]float64{ToxicLead: 0.65}},
+			{Category: "batteries", Subcategory: "lithium_ion", CO2eKg: 4,
+				Materials: map[string]float64{MaterialCopper: 0.1, MaterialAluminium: 0.08, MaterialSteel: 0.1},
+				Toxics:    map[string]float64{}},
+			{Category: "batteries", Subcategory: "nickel_cadmium", CO2eKg: 1.5,
+				Materials: map[string]float64{MaterialSteel: 0.35},
+				Toxics:    map[string]float64{ToxicCadmium: 0.15}},
+			{Category: "appliances", CO2eKg: 1.2,
+				Materials: map[string]float64{MaterialCopper: 0.04, MaterialAluminium: 0.03, MaterialPlastics: 0.2, MaterialSteel: 0.5},
+				Toxics:    map[string]float64{}},
+			// Recovering the refrigerant avoids most of a fridge's footprint.
+			{Category: "appliances", Subcategory: "refrigerators", CO2eKg: 4.5,
+				Materials: map[string]float64{MaterialCopper: 0.04, MaterialAluminium: 0.03, MaterialPlastics: 0.25, MaterialSteel: 0.45},
+				Toxics:    map[string]float64{ToxicRefrigerant: 0.0025}},
+			{Category: "electronics", CO2eKg: 2,
+				Materials: map[string]float64{MaterialCopper: 0.06, MaterialGold: 0.00002, MaterialAluminium: 0.05, MaterialPlastics: 0.3, MaterialSteel: 0.3},
+				Toxics:    map[string]float64{ToxicLead: 0.002}},
+			{Category: "electronics", Subcategory: "flat_screens", CO2eKg: 1.5,
+				Materials: map[string]float64{MaterialCopper: 0.03, MaterialGold: 0.00001, MaterialAluminium: 0.08, MaterialPlastics: 0.35, MaterialSteel: 0.3},
+				Toxics:    map[string]float64{ToxicLead: 0.002, ToxicMercury: 0.00001}},
+		},
+		Default: Factor{CO2eKg: 1,
+			Materials: map[string]float64{MaterialCopper: 0.02, MaterialPlastics: 0.2, MaterialSteel: 0.3},
+			Toxics:    map[string]float64{}},
+		Source:    "Default factors",
+		UpdatedBy: "system",
+	}
+}
+
+// Validate checks that a factor set can be applied.
+func (fs *FactorSet) Validate() error {
+	seen := map[string]bool{}
+	for _, f := range fs.Factors {
+		key := f.Category + "/" + f.Subcategory
+		if f.Category == "" || seen[key] {
+			return fmt.Errorf("%w: factors need a category and must not repeat one", ErrInvalidFactors)
+		}
+		seen[key] = true
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidFactors, key, err)
+		}
+	}
+	if err := fs.Default.validate(); err != nil {
+		return fmt.Errorf("%w: default: %v", ErrInvalidFactors, err)
+	}
+	return nil
+}
+
+func (f *Factor) validate() error {
+	if f.CO2eKg < 0 {
+		return errors.New("CO2e cannot be negative")
+	}
+	total := 0.0
+	for name, v := range f.Materials {
+		if !materials[name] {
+			return fmt.Errorf("unknown material %q", name)
+		}
+		if v < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+		total += v
+	}
+	for name, v := range f.Toxics {
+		if !toxics[name] {
+			return fmt.Errorf("unknown substance %q", name)
+		}
+		if v < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+		total += v
+	}
+	if total > 1 {
+		return errors.New("materials and substances add up to more than the device weighs")
+	}
+	return nil
+}
+
+// factor returns the most specific factor for an item.
+func (fs *FactorSet) factor(category, subcategory string) *Factor {
+	var best *Factor
+	for i := range fs.Factors {
+		f := &fs.Factors[i]
+		if f.Category != category {
+			continue
+		}
+		if f.Subcategory == subcategory {
+			return f
+		}
+		if f.Subcategory == "" {
+			best = f
+		}
+	}
+	if best == nil {
+		return &fs.Default
+	}
+	return best
+}
@@ -0,0 +1,401 @@
+// Package impact estimates the environmental benefit of collected e-waste:
+// materials recovered, emissions avoided and toxic substances kept out of
+// landfill, per pickup and in aggregate.
+package impact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the impact engine.
+const (
+	factorSetsBucket = "impact_factor_sets"
+	factorSetCurrent = "current"
+	recordsBucket    = "pickup_impacts"
+)
+
+// Ways a report can be grouped.
+const (
+	GroupMonth  = "month"
+	GroupArea   = "area"
+	GroupCounty = "county"
+	GroupUser   = "user"
+)
+
+var (
+	// ErrNotFound is returned when a pickup has no impact record, usually
+	// because it has not been processed yet.
+	ErrNotFound = errors.New("no impact recorded for this pickup")
+	// ErrInvalidReport is returned for an unknown grouping or an inverted period.
+	ErrInvalidReport = errors.New("invalid impact report")
+)
+
+// Totals is the impact of some amount of e-waste. Weights are in kilograms.
+type Totals struct {
+	Pickups   int                `json:"pickups"`
+	WeightKg  float64            `json:"weight_kg"`
+	Materials map[string]float64 `json:"materials"`
+	CO2eKg    float64            `json:"co2e_kg"`
+	Toxics    map[string]float64 `json:"toxics"`
+}
+
+func newTotals() Totals {
+	return Totals{Materials: map[string]float64{}, Toxics: map[string]float64{}}
+}
+
+func (t *Totals) add(o Totals) {
+	t.Pickups += o.Pickups
+	t.WeightKg += o.WeightKg
+	t.CO2eKg += o.CO2eKg
+	for name, v := range o.Materials {
+		t.Materials[name] += v
+	}
+	for name, v := range o.Toxics {
+		t.Toxics[name] += v
+	}
+}
+
+// round keeps milligram precision, enough for the gold in a single phone.
+func (t *Totals) round() {
+	t.WeightKg, t.CO2eKg = round(t.WeightKg), round(t.CO2eKg)
+	for name, v := range t.Materials {
+		t.Materials[name] = round(v)
+	}
+	for name, v := range t.Toxics {
+		t.Toxics[name] = round(v)
+	}
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// Line is the impact of one pickup item. Estimated is set when the weight
+// comes from the catalogue because the item was not weighed.
+type Line struct {
+	Category    string `json:"category"`
+	Subcategory string `json:"subcategory,omitempty"`
+	Quantity    int    `json:"quantity"`
+	Estimated   bool   `json:"estimated"`
+	Totals
+}
+
+// Record is the impact of a processed pickup, computed once with the factor
+// set in force at the time so that reports do not shift when factors change.
+type Record struct {
+	PickupID      string    `json:"pickup_id"`
+	UserID        string    `json:"user_id"`
+	ServiceArea   string    `json:"service_area,omitempty"`
+	County        string    `json:"county,omitempty"`
+	ProcessedAt   time.Time `json:"processed_at"`
+	FactorVersion int       `json:"factor_version"`
+	Lines         []Line    `json:"lines"`
+	Totals        Totals    `json:"totals"`
+}
+
+// Filter selects the records a report covers. Empty fields match everything;
+// the period runs from From up to but excluding To.
+type Filter struct {
+	UserID string
+	Area   string
+	County string
+	From   time.Time
+	To     time.Time
+}
+
+func (f Filter) match(r *Record) bool {
+	switch {
+	case f.UserID != "" && r.UserID != f.UserID,
+		f.Area != "" && r.ServiceArea != f.Area,
+		f.County != "" && r.County != f.County,
+		!f.From.IsZero() && r.ProcessedAt.Before(f.From),
+		!f.To.IsZero() && !r.ProcessedAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// Group is the impact of the records sharing one key.
+type Group struct {
+	Key    string `json:"key"`
+	Totals Totals `json:"totals"`
+}
+
+// Report aggregates impact records.
+type Report struct {
+	Totals Totals  `json:"totals"`
+	Groups []Group `json:"groups,omitempty"`
+}
+
+// Engine records the impact of processed pickups.
+type Engine struct {
+	store *store.Store
+	now   func() time.Time
+}
+
+// NewEngine creates an impact engine backed by s. Item weights are estimated
+// from the item catalogue in the same store.
+func NewEngine(s *store.Store) *Engine {
+	return &Engine{store: s, now: time.Now}
+}
+
+// Current returns the factor set in force.
+func (e *Engine) Current() (*FactorSet, error) {
+	var fs *FactorSet
+	err := e.store.View(func(tx *store.Tx) error {
+		var err error
+		fs, err = currentFactorSet(tx)
+		return err
+	})
+	return fs, err
+}
+
+// Version returns a previously published factor set.
+func (e *Engine) Version(version int) (*FactorSet, error) {
+	if version == 0 {
+		return DefaultFactorSet(), nil
+	}
+	var fs FactorSet
+	err := e.store.View(func(tx *store.Tx) error {
+		return tx.Get(factorSetsBucket, strconv.Itoa(version), &fs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fs, nil
+}
+
+func currentFactorSet(tx *store.Tx) (*FactorSet, error) {
+	var version int
+	if err := tx.Get(factorSetsBucket, factorSetCurrent, &version); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return DefaultFactorSet(), nil
+		}
+		return nil, err
+	}
+	var fs FactorSet
+	if err := tx.Get(factorSetsBucket, strconv.Itoa(version), &fs); err != nil {
+		return nil, err
+	}
+	return &fs, nil
+}
+
+// Publish validates fs and stores it as the next version. Pickups already
+// recorded keep the figures of the version they were computed with.
+func (e *Engine) Publish(fs FactorSet, actor string) (*FactorSet, error) {
+	if err := fs.Validate(); err != nil {
+		return nil, err
+	}
+	err := e.store.Update(func(tx *store.Tx) error {
+		current, err := currentFactorSet(tx)
+		if err != nil {
+			return err
+		}
+		fs.Version = current.Version + 1
+		fs.UpdatedBy = actor
+		fs.UpdatedAt = e.now().UTC()
+		if err := tx.Insert(factorSetsBucket, strconv.Itoa(fs.Version), fs); err != nil {
+			return err
+		}
+		return tx.Put(factorSetsBucket, factorSetCurrent, fs.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fs, nil
+}
+
+// OnPickupTransition is a pickups.Listener that records the impact of a
+// pickup when it is processed and withdraws it if the pickup is cancelled.
+func (e *Engine) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	switch {
+	case p.Status == pickups.StatusProcessed:
+		_, err := e.RecordTx(tx, p)
+		return err
+	case from == pickups.StatusProcessed:
+		return tx.Delete(recordsBucket, p.ID)
+	}
+	return nil
+}
+
+// RecordTx computes and stores the impact of p with the current factors.
+func (e *Engine) RecordTx(tx *store.Tx, p *pickups.Pickup) (*Record, error) {
+	fs, err := currentFactorSet(tx)
+	if err != nil {
+		return nil, err
+	}
+	processedAt := p.ChangedAt(pickups.StatusProcessed)
+	if processedAt.IsZero() {
+		processedAt = e.now().UTC()
+	}
+	record := &Record{
+		PickupID:      p.ID,
+		UserID:        p.UserID,
+		ServiceArea:   p.ServiceArea,
+		County:        p.County,
+		ProcessedAt:   processedAt,
+		FactorVersion: fs.Version,
+		Lines:         []Line{},
+		Totals:        newTotals(),
+	}
+	for _, item := range p.Items {
+		line, err := computeLine(tx, fs, item)
+		if err != nil {
+			return nil, err
+		}
+		record.Lines = append(record.Lines, line)
+		record.Totals.add(line.Totals)
+	}
+	record.Totals.Pickups = 1
+	record.Totals.round()
+	if err := tx.Put(recordsBucket, p.ID, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func computeLine(tx *store.Tx, fs *FactorSet, item pickups.Item) (Line, error) {
+	line := Line{Category: item.Category, Subcategory: item.Subcategory, Quantity: item.Quantity, Totals: newTotals()}
+	weight := item.EarningWeightKg()
+	if weight <= 0 {
+		perUnit, err := items.UnitWeightKgTx(tx, item)
+		if err != nil {
+			return line, err
+		}
+		weight, line.Estimated = perUnit*float64(item.Quantity), true
+	}
+
+	f := fs.factor(item.Category, item.Subcategory)
+	line.WeightKg = weight
+	line.CO2eKg = f.CO2eKg * weight
+	for name, v := range f.Materials {
+		line.Materials[name] = v * weight
+	}
+	for name, v := range f.Toxics {
+		line.Toxics[name] = v * weight
+	}
+	line.Totals.round()
+	return line, nil
+}
+
+// Pickup returns the impact recorded for a pickup.
+func (e *Engine) Pickup(pickupID string) (*Record, error) {
+	var r Record
+	err := e.store.View(func(tx *store.Tx) error {
+		return tx.Get(recordsBucket, pickupID, &r)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Backfill records the impact of processed pickups that have none, such as
+// those processed before the engine was installed. It returns how many it recorded.
+func (e *Engine) Backfill() (int, error) {
+	count := 0
+	err := e.store.Update(func(tx *store.Tx) error {
+		list, err := pickups.ListTx(tx, func(p *pickups.Pickup) bool { return p.Status == pickups.StatusProcessed })
+		if err != nil {
+			return err
+		}
+		for _, p := range list {
+			if tx.Exists(recordsBucket, p.ID) {
+				continue
+			}
+			if _, err := e.RecordTx(tx, p); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Report totals the records matching filter and, when group is set, splits
+// them by month, service area, county or user.
+func (e *Engine) Report(filter Filter, group string) (*Report, error) {
+	if group != "" && group != GroupMonth && group != GroupArea && group != GroupCounty && group != GroupUser {
+		return nil, fmt.Errorf("%w: unknown grouping %q", ErrInvalidReport, group)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: the period must end after it starts", ErrInvalidReport)
+	}
+
+	records, err := e.Records(filter)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Totals: newTotals()}
+	groups := map[string]*Totals{}
+	for i := range records {
+		r := &records[i]
+		report.Totals.add(r.Totals)
+		if group == "" {
+			continue
+		}
+		k := groupKey(r, group)
+		if groups[k] == nil {
+			t := newTotals()
+			groups[k] = &t
+		}
+		groups[k].add(r.Totals)
+	}
+
+	report.Totals.round()
+	for k, t := range groups {
+		t.round()
+		report.Groups = append(report.Groups, Group{Key: k, Totals: *t})
+	}
+	sort.SliceStable(report.Groups, func(i, j int) bool { return report.Groups[i].Key < report.Groups[j].Key })
+	return report, nil
+}
+
+// Records returns the records matching filter, oldest first.
+func (e *Engine) Records(filter Filter) ([]Record, error) {
+	records := []Record{}
+	err := e.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(recordsBucket, func(key string, raw json.RawMessage) error {
+			var r Record
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return fmt.Errorf("error decoding impact record %s: %w", key, err)
+			}
+			if filter.match(&r) {
+				records = append(records, r)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].ProcessedAt.Before(records[j].ProcessedAt) })
+	return records, nil
+}
+
+func groupKey(r *Record, group string) string {
+	switch group {
+	case GroupMonth:
+		return r.ProcessedAt.Format("2006-01")
+	case GroupArea:
+		return r.ServiceArea
+	case GroupCounty:
+		return r.County
+	default:
+		return r.UserID
+	}
+}
@@ -0,0 +1,190 @@
+package impact
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func newTestEngine(t *testing.T) (*Engine, *pickups.Service, *store.Store) {
+	t.Helper()
+	db := store.NewMemory()
+	if err := items.NewService(db).Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	engine := NewEngine(db)
+	pickupService := pickups.NewService(db)
+	pickupService.Subscribe(engine.OnPickupTransition)
+	return engine, pickupService, db
+}
+
+// process takes a new pickup of items through to processed.
+func process(t *testing.T, pickupService *pickups.Service, uid string, list ...pickups.Item) *pickups.Pickup {
+	t.Helper()
+	p, err := pickupService.Create(uid, pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning", Items: list,
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := pickupService.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	for _, status := range []string{pickups.StatusCollected, pickups.StatusProcessed} {
+		if p, err = pickupService.Transition(p.ID, status, "admin"); err != nil {
+			t.Fatalf("Transition(%s) error = %v", status, err)
+		}
+	}
+	return p
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRecordOnProcessed(t *testing.T) {
+	engine, pickupService, _ := newTestEngine(t)
+	p := process(t, pickupService, "resident",
+		pickups.Item{Category: "computers", Subcategory: "laptops", Quantity: 1, WeightKg: 3},
+		pickups.Item{Category: "phones", Quantity: 2})
+
+	r, err := engine.Pickup(p.ID)
+	if err != nil {
+		t.Fatalf("Pickup() error = %v", err)
+	}
+	if r.FactorVersion != 0 || r.UserID != "resident" || len(r.Lines) != 2 {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	if r.Lines[0].Estimated || !r.Lines[1].Estimated || !near(r.Lines[1].WeightKg, 0.4) {
+		t.Errorf("unexpected weights %+v", r.Lines)
+	}
+	// Laptop: 3 kg x 5 CO2e; phones: 2 x 0.2 kg x 6 CO2e.
+	if !near(r.Totals.WeightKg, 3.4) || !near(r.Totals.CO2eKg, 17.4) || r.Totals.Pickups != 1 {
+		t.Errorf("unexpected totals %+v", r.Totals)
+	}
+	if !near(r.Totals.Materials[MaterialGold], 0.0004) || !near(r.Totals.Toxics[ToxicMercury], 0.000015) {
+		t.Errorf("unexpected gold or mercury %+v", r.Totals)
+	}
+}
+
+func TestCancelWithdrawsRecord(t *testing.T) {
+	engine, pickupService, _ := newTestEngine(t)
+	p := process(t, pickupService, "resident", pickups.Item{Category: "phones", Quantity: 1})
+	if _, err := pickupService.Transition(p.ID, pickups.StatusCancelled, "admin"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	if _, err := engine.Pickup(p.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Pickup() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPublishKeepsEarlierRecords(t *testing.T) {
+	engine, pickupService, _ := newTestEngine(t)
+	phone := pickups.Item{Category: "phones", Quantity: 1, WeightKg: 1}
+	before := process(t, pickupService, "resident", phone)
+
+	fs := *DefaultFactorSet()
+	fs.Factors = []Factor{{Category: "phones", CO2eKg: 10}}
+	published, err := engine.Publish(fs, "admin")
+	if err != nil || published.Version != 1 {
+		t.Fatalf("Publish() = %+v, %v", published, err)
+	}
+	after := process(t, pickupService, "resident", phone)
+
+	old, _ := engine.Pickup(before.ID)
+	fresh, _ := engine.Pickup(after.ID)
+	if old.FactorVersion != 0 || old.Totals.CO2eKg != 6 || fresh.FactorVersion != 1 || fresh.Totals.CO2eKg != 10 {
+		t.Errorf("records = v%d %.1f and v%d %.1f", old.FactorVersion, old.Totals.CO2eKg, fresh.FactorVersion, fresh.Totals.CO2eKg)
+	}
+	if v0, _ := engine.Version(0); v0.Factors[0].CO2eKg != 6 {
+		t.Errorf("version 0 changed: %+v", v0.Factors[0])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		factors []Factor
+	}{
+		{"Missing category", []Factor{{CO2eKg: 1}}},
+		{"Duplicate", []Factor{{Category: "phones"}, {Category: "phones"}}},
+		{"Unknown material", []Factor{{Category: "phones", Materials: map[string]float64{"unobtainium": 0.1}}}},
+		{"Heavier than the device", []Factor{{Category: "phones", Materials: map[string]float64{MaterialSteel: 0.8, MaterialPlastics: 0.4}}}},
+		{"Negative CO2e", []Factor{{Category: "phones", CO2eKg: -1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := FactorSet{Factors: tt.factors}
+			if err := fs.Validate(); !errors.Is(err, ErrInvalidFactors) {
+				t.Errorf("Validate() error = %v, want ErrInvalidFactors", err)
+			}
+		})
+	}
+	if err := DefaultFactorSet().Validate(); err != nil {
+		t.Errorf("default factors invalid: %v", err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	engine, _, db := newTestEngine(t)
+	record := func(id, uid, area string, at time.Time) {
+		p := &pickups.Pickup{
+			ID: id, UserID: uid, ServiceArea: area, Status: pickups.StatusProcessed,
+			Items:   []pickups.Item{{Category: "computers", Quantity: 1, WeightKg: 10}},
+			History: []pickups.StatusChange{{To: pickups.StatusProcessed, At: at}},
+		}
+		if err := db.Update(func(tx *store.Tx) error {
+			_, err := engine.RecordTx(tx, p)
+			return err
+		}); err != nil {
+			t.Fatalf("RecordTx() error = %v", err)
+		}
+	}
+	record("pk_1", "alice", "nairobi", time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC))
+	record("pk_2", "alice", "mombasa", time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC))
+	record("pk_3", "bob", "nairobi", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC))
+
+	all, err := engine.Report(Filter{}, GroupMonth)
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+	if all.Totals.Pickups != 3 || !near(all.Totals.CO2eKg, 90) || len(all.Groups) != 2 || all.Groups[1].Key != "2026-10" || all.Groups[1].Totals.Pickups != 2 {
+		t.Errorf("unexpected report %+v", all)
+	}
+
+	october := Filter{UserID: "alice", From: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)}
+	if r, _ := engine.Report(october, ""); r.Totals.Pickups != 1 || !near(r.Totals.Materials[MaterialSteel], 4.5) || r.Groups != nil {
+		t.Errorf("alice in October = %+v", r)
+	}
+	if r, _ := engine.Report(Filter{Area: "nairobi"}, GroupUser); len(r.Groups) != 2 || r.Groups[0].Key != "alice" {
+		t.Errorf("nairobi by user = %+v", r.Groups)
+	}
+	if _, err := engine.Report(Filter{}, "weekday"); !errors.Is(err, ErrInvalidReport) {
+		t.Errorf("Report(unknown group) error = %v, want ErrInvalidReport", err)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	db := store.NewMemory()
+	items.NewService(db).Seed()
+	pickupService := pickups.NewService(db)
+	// Processed before the engine was subscribed.
+	p := process(t, pickupService, "resident", pickups.Item{Category: "batteries", Subcategory: "lead_acid", Quantity: 1})
+
+	engine := NewEngine(db)
+	if n, err := engine.Backfill(); err != nil || n != 1 {
+		t.Fatalf("Backfill() = %d, %v", n, err)
+	}
+	if n, _ := engine.Backfill(); n != 0 {
+		t.Errorf("second Backfill() = %d, want 0", n)
+	}
+	r, err := engine.Pickup(p.ID)
+	if err != nil || !near(r.Totals.Toxics[ToxicLead], 7.8) {
+		t.Errorf("Pickup() = %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,398 @@
+package invoices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the invoicing module.
+const (
+	invoicesBucket        = "invoices"
+	paymentInvoicesBucket = "invoice_payments"
+	billingBucket         = "invoice_billing"
+)
+
+// Document kinds. Each kind is numbered in its own gapless sequence.
+const (
+	KindInvoice    = "invoice"
+	KindCreditNote = "credit_note"
+)
+
+var numberPrefixes = map[string]string{KindInvoice: "INV", KindCreditNote: "CN"}
+
+// Invoice states. Credit notes are always issued.
+const (
+	StatusIssued   = "issued"
+	StatusCredited = "credited"
+)
+
+// DefaultVATRate is the Kenyan standard VAT rate in percent.
+const DefaultVATRate = 16
+
+// taxPINPattern is the shape of a KRA personal identification number.
+var taxPINPattern = regexp.MustCompile(`^[AP][0-9]{9}[A-Z]$`)
+
+var (
+	// ErrNotFound is returned when an invoice does not exist.
+	ErrNotFound = errors.New("invoice not found")
+	// ErrAlreadyCredited is returned when crediting an invoice a second time.
+	ErrAlreadyCredited = errors.New("invoice has already been credited")
+	// ErrNotCreditable is returned when crediting a credit note.
+	ErrNotCreditable = errors.New("only invoices can be credited")
+	// ErrInvalidBilling is returned when billing details fail validation.
+	ErrInvalidBilling = errors.New("invalid billing details")
+	// ErrNoSeller is returned when the seller printed on invoices is missing
+	// or incomplete; nothing is issued without it.
+	ErrNoSeller = errors.New("invoice seller is not configured")
+)
+
+// Party is the seller or customer named on an invoice.
+type Party struct {
+	Name    string `json:"name"`
+	TaxPIN  string `json:"tax_pin,omitempty"`
+	Address string `json:"address,omitempty"`
+	Email   string `json:"email,omitempty"`
+}
+
+// ValidateSeller checks that the issuer printed on every invoice has a name,
+// a KRA PIN and an address, as a tax invoice requires.
+func ValidateSeller(seller Party) error {
+	switch {
+	case strings.TrimSpace(seller.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrNoSeller)
+	case !taxPINPattern.MatchString(seller.TaxPIN):
+		return fmt.Errorf("%w: %q is not a KRA PIN", ErrNoSeller, seller.TaxPIN)
+	case strings.TrimSpace(seller.Address) == "":
+		return fmt.Errorf("%w: address is required", ErrNoSeller)
+	}
+	return nil
+}
+
+// Line is one charge on an invoice. Amounts are in cents; UnitPrice and Net
+// exclude VAT and Gross includes it.
+type Line struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   int64  `json:"unit_price"`
+	Net         int64  `json:"net"`
+	VAT         int64  `json:"vat"`
+	Gross       int64  `json:"gross"`
+}
+
+// Invoice is a tax invoice or a credit note. Amounts are in cents.
+type Invoice struct {
+	ID             string    `json:"id"`
+	Number         string    `json:"number"`
+	Kind           string    `json:"kind"`
+	UserID         string    `json:"user_id"`
+	Seller         Party     `json:"seller"`
+	Customer       Party     `json:"customer"`
+	PaymentID      string    `json:"payment_id,omitempty"`
+	ReceiptNumber  string    `json:"receipt_number,omitempty"`
+	PickupID       string    `json:"pickup_id,omitempty"`
+	QuoteID        string    `json:"quote_id,omitempty"`
+	OriginalID     string    `json:"original_id,omitempty"`
+	OriginalNumber string    `json:"original_number,omitempty"`
+	CreditNoteID   string    `json:"credit_note_id,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Lines          []Line    `json:"lines"`
+	Currency       string    `json:"currency"`
+	VATRate        int       `json:"vat_rate"`
+	Subtotal       int64     `json:"subtotal"`
+	VAT            int64     `json:"vat"`
+	Total          int64     `json:"total"`
+	Status         string    `json:"status"`
+	IssuedAt       time.Time `json:"issued_at"`
+}
+
+// Service issues invoices for paid services and credit notes for cancellations.
+type Service struct {
+	store   *store.Store
+	seller  Party
+	vatRate int
+	now     func() time.Time
+}
+
+// NewService creates an invoicing service. Invoices are only issued if
+// seller passes ValidateSeller.
+func NewService(s *store.Store, seller Party, vatRate int) *Service {
+	return &Service{store: s, seller: seller, vatRate: vatRate, now: time.Now}
+}
+
+// OnPaymentSettled is a payments.Listener that invoices every successful payment once.
+func (s *Service) OnPaymentSettled(tx *store.Tx, p *payments.Payment) error {
+	if p.Status != payments.StatusPaid || tx.Exists(paymentInvoicesBucket, p.ID) {
+		return nil
+	}
+
+	invoice := &Invoice{
+		Kind:          KindInvoice,
+		UserID:        p.UserID,
+		PaymentID:     p.ID,
+		ReceiptNumber: p.ReceiptNumber,
+		PickupID:      p.PickupID,
+	}
+	amount := p.PaidAmount
+	if amount == 0 {
+		amount = p.Amount
+	}
+
+	// Itemise from the quote the pickup was booked from, which is what the
+	// payment was charged for.
+	if p.PickupID != "" {
+		quote, err := quotes.ByPickupTx(tx, p.PickupID)
+		if err != nil && !errors.Is(err, quotes.ErrNotFound) {
+			return err
+		}
+		if quote != nil {
+			invoice.QuoteID = quote.ID
+			for _, line := range quote.Lines {
+				invoice.Lines = append(invoice.Lines, s.line(line.Description, 1, line.Amount*100))
+			}
+		}
+	}
+	if len(invoice.Lines) == 0 {
+		invoice.Lines = []Line{s.line(purposeDescription(p), 1, amount*100)}
+	}
+
+	if err := s.issueTx(tx, invoice); err != nil {
+		return err
+	}
+	return tx.Insert(paymentInvoicesBucket, p.ID, invoice.ID)
+}
+
+func purposeDescription(p *payments.Payment) string {
+	switch p.Purpose {
+	case payments.PurposePremiumPickup:
+		return fmt.Sprintf("Premium pickup %s", p.PickupID)
+	case payments.PurposeBulkCollection:
+		return "Bulk corporate collection"
+	default:
+		return p.Purpose
+	}
+}
+
+// OnPickupTransition is a pickups.Listener that credits the invoices of a cancelled pickup.
+func (s *Service) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	if p.Status != pickups.StatusCancelled {
+		return nil
+	}
+	list, err := listTx(tx, func(inv *Invoice) bool {
+		return inv.Kind == KindInvoice && inv.PickupID == p.ID && inv.Status == StatusIssued
+	})
+	if err != nil {
+		return err
+	}
+	for _, invoice := range list {
+		if _, err := s.CreditTx(tx, invoice.ID, "Pickup "+p.ID+" cancelled"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Credit issues a credit note cancelling an invoice in full.
+func (s *Service) Credit(invoiceID, reason string) (*Invoice, error) {
+	var note *Invoice
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		note, err = s.CreditTx(tx, invoiceID, reason)
+		return err
+	})
+	return note, err
+}
+
+// CreditTx issues a credit note inside an existing transaction.
+func (s *Service) CreditTx(tx *store.Tx, invoiceID, reason string) (*Invoice, error) {
+	original, err := getTx(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if original.Kind != KindInvoice {
+		return nil, ErrNotCreditable
+	}
+	if original.Status == StatusCredited {
+		return nil, ErrAlreadyCredited
+	}
+
+	note := &Invoice{
+		Kind:           KindCreditNote,
+		UserID:         original.UserID,
+		Customer:       original.Customer,
+		PaymentID:      original.PaymentID,
+		PickupID:       original.PickupID,
+		QuoteID:        original.QuoteID,
+		OriginalID:     original.ID,
+		OriginalNumber: original.Number,
+		Reason:         strings.TrimSpace(reason),
+		Lines:          original.Lines,
+	}
+	if err := s.issueTx(tx, note); err != nil {
+		return nil, err
+	}
+	original.Status = StatusCredited
+	original.CreditNoteID = note.ID
+	if err := tx.Put(invoicesBucket, original.ID, original); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// issueTx numbers, totals and stores inv.
+func (s *Service) issueTx(tx *store.Tx, inv *Invoice) error {
+	if err := ValidateSeller(s.seller); err != nil {
+		return err
+	}
+	id, err := tx.NextSequence(invoicesBucket)
+	if err != nil {
+		return err
+	}
+	number, err := tx.NextSequence("invoice_number_" + inv.Kind)
+	if err != nil {
+		return err
+	}
+	// Credit notes keep the customer details of the invoice they cancel.
+	if inv.Kind == KindInvoice {
+		inv.Customer, err = billingTx(tx, inv.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	inv.ID = fmt.Sprintf("inv_%d", id)
+	inv.Number = fmt.Sprintf("%s-%06d", numberPrefixes[inv.Kind], number)
+	inv.Seller = s.seller
+	inv.Currency = "KES"
+	inv.VATRate = s.vatRate
+	inv.Status = StatusIssued
+	inv.IssuedAt = s.now().UTC()
+	inv.Subtotal, inv.VAT, inv.Total = 0, 0, 0
+	for _, line := range inv.Lines {
+		inv.Subtotal += line.Net
+		inv.VAT += line.VAT
+		inv.Total += line.Gross
+	}
+	return tx.Insert(invoicesBucket, inv.ID, inv)
+}
+
+// line splits a VAT-inclusive amount into its net and VAT parts. Prices
+// shown to customers already include VAT.
+func (s *Service) line(description string, quantity int, gross int64) Line {
+	net := (gross*100 + int64(100+s.vatRate)/2) / int64(100+s.vatRate)
+	return Line{
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   net / int64(quantity),
+		Net:         net,
+		VAT:         gross - net,
+		Gross:       gross,
+	}
+}
+
+// Get returns the invoice or credit note with the given ID.
+func (s *Service) Get(id string) (*Invoice, error) {
+	var invoice *Invoice
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		invoice, err = getTx(tx, id)
+		return err
+	})
+	return invoice, err
+}
+
+func getTx(tx *store.Tx, id string) (*Invoice, error) {
+	var invoice Invoice
+	if err := tx.Get(invoicesBucket, id, &invoice); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// List returns the documents accepted by match, newest first. A nil match returns every document.
+func (s *Service) List(match func(*Invoice) bool) ([]*Invoice, error) {
+	var result []*Invoice
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		result, err = listTx(tx, match)
+		return err
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].IssuedAt.After(result[j].IssuedAt)
+	})
+	return result, err
+}
+
+func listTx(tx *store.Tx, match func(*Invoice) bool) ([]*Invoice, error) {
+	result := []*Invoice{}
+	err := tx.ForEach(invoicesBucket, func(key string, raw json.RawMessage) error {
+		var invoice Invoice
+		if err := json.Unmarshal(raw, &invoice); err != nil {
+			return fmt.Errorf("error decoding invoice %s: %w", key, err)
+		}
+		if match == nil || match(&invoice) {
+			result = append(result, &invoice)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ByUser matches the documents addressed to uid, optionally of one kind.
+func ByUser(uid, kind string) func(*Invoice) bool {
+	return func(inv *Invoice) bool {
+		return inv.UserID == uid && (kind == "" || inv.Kind == kind)
+	}
+}
+
+// Billing returns the billing details uid has saved, or an empty Party.
+func (s *Service) Billing(uid string) (Party, error) {
+	var party Party
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		party, err = billingTx(tx, uid)
+		return err
+	})
+	return party, err
+}
+
+func billingTx(tx *store.Tx, uid string) (Party, error) {
+	var party Party
+	if err := tx.Get(billingBucket, uid, &party); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return Party{}, err
+	}
+	return party, nil
+}
+
+// SetBilling saves the details printed on uid's future invoices.
+func (s *Service) SetBilling(uid string, party Party) (Party, error) {
+	party.Name = strings.TrimSpace(party.Name)
+	party.TaxPIN = strings.ToUpper(strings.TrimSpace(party.TaxPIN))
+	party.Address = strings.TrimSpace(party.Address)
+	party.Email = strings.TrimSpace(party.Email)
+	if party.Name == "" {
+		return Party{}, fmt.Errorf("%w: name is required", ErrInvalidBilling)
+	}
+	if party.TaxPIN != "" && !taxPINPattern.MatchString(party.TaxPIN) {
+		return Party{}, fmt.Errorf("%w: %q is not a KRA PIN", ErrInvalidBilling, party.TaxPIN)
+	}
+	err := s.store.Update(func(tx *store.Tx) error {
+		return tx.Put(billingBucket, uid, party)
+	})
+	if err != nil {
+		return Party{}, err
+	}
+	return party, nil
+}
@@ -0,0 +1,193 @@
+package invoices
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var testSeller = Party{Name: "ZingiraTech Ltd", TaxPIN: "P000000000A", Address: "Nairobi, Kenya"}
+
+func newTestService() (*Service, *store.Store, *pickups.Service) {
+	db := store.NewMemory()
+	svc := NewService(db, testSeller, DefaultVATRate)
+	pickupService := pickups.NewService(db)
+	pickupService.Subscribe(svc.OnPickupTransition)
+	return svc, db, pickupService
+}
+
+func settle(t *testing.T, db *store.Store, svc *Service, p *payments.Payment) {
+	t.Helper()
+	err := db.Update(func(tx *store.Tx) error {
+		return svc.OnPaymentSettled(tx, p)
+	})
+	if err != nil {
+		t.Fatalf("OnPaymentSettled() error = %v", err)
+	}
+}
+
+func TestLineVATSplit(t *testing.T) {
+	svc := NewService(store.NewMemory(), testSeller, 16)
+	tests := []struct {
+		gross   int64
+		wantNet int64
+		wantVAT int64
+	}{
+		{gross: 116000, wantNet: 100000, wantVAT: 16000},
+		{gross: 100, wantNet: 86, wantVAT: 14},
+		{gross: 150000, wantNet: 129310, wantVAT: 20690},
+	}
+	for _, tt := range tests {
+		line := svc.line("x", 1, tt.gross)
+		if line.Net != tt.wantNet || line.VAT != tt.wantVAT || line.Net+line.VAT != tt.gross {
+			t.Errorf("line(%d) = net %d, vat %d; want %d, %d", tt.gross, line.Net, line.VAT, tt.wantNet, tt.wantVAT)
+		}
+	}
+}
+
+func TestInvoicePaidPayment(t *testing.T) {
+	svc, db, _ := newTestService()
+	if _, err := svc.SetBilling("acme", Party{Name: "Acme Ltd", TaxPIN: "p051111111a"}); err != nil {
+		t.Fatalf("SetBilling() error = %v", err)
+	}
+	if _, err := svc.SetBilling("acme", Party{Name: "Acme Ltd", TaxPIN: "12345"}); !errors.Is(err, ErrInvalidBilling) {
+		t.Errorf("SetBilling(bad PIN) error = %v, want ErrInvalidBilling", err)
+	}
+
+	failed := &payments.Payment{ID: "pay_1", UserID: "acme", Purpose: payments.PurposeBulkCollection, Amount: 5800, Status: payments.StatusFailed}
+	settle(t, db, svc, failed)
+	paid := &payments.Payment{ID: "pay_2", UserID: "acme", Purpose: payments.PurposeBulkCollection, Amount: 5800, PaidAmount: 5800, Status: payments.StatusPaid, ReceiptNumber: "QKT1"}
+	settle(t, db, svc, paid)
+	settle(t, db, svc, paid)
+	second := &payments.Payment{ID: "pay_3", UserID: "acme", Purpose: payments.PurposeBulkCollection, Amount: 1160, Status: payments.StatusPaid}
+	settle(t, db, svc, second)
+
+	list, err := svc.List(ByUser("acme", KindInvoice))
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 invoices, got %d", len(list))
+	}
+	numbers := map[string]bool{}
+	for _, inv := range list {
+		numbers[inv.Number] = true
+	}
+	if !numbers["INV-000001"] || !numbers["INV-000002"] {
+		t.Errorf("invoice numbers are not sequential: %v", numbers)
+	}
+
+	inv, _ := svc.Get("inv_1")
+	if inv.Total != 580000 || inv.Subtotal != 500000 || inv.VAT != 80000 {
+		t.Errorf("totals = %d/%d/%d, want 500000/80000/580000", inv.Subtotal, inv.VAT, inv.Total)
+	}
+	if inv.Customer.Name != "Acme Ltd" || inv.Customer.TaxPIN != "P051111111A" || inv.ReceiptNumber != "QKT1" {
+		t.Errorf("unexpected invoice details %+v", inv)
+	}
+	if doc := PDF(inv); !bytes.HasPrefix(doc, []byte("%PDF-")) || !bytes.Contains(doc, []byte("INV-000001")) {
+		t.Errorf("PDF does not contain the invoice number")
+	}
+}
+
+func TestNoInvoiceWithoutSeller(t *testing.T) {
+	for _, seller := range []Party{{}, {Name: "ZingiraTech Ltd", TaxPIN: "P0512", Address: "Nairobi"}, {Name: "ZingiraTech Ltd", TaxPIN: "P000000000A"}} {
+		if err := ValidateSeller(seller); !errors.Is(err, ErrNoSeller) {
+			t.Errorf("ValidateSeller(%+v) error = %v, want ErrNoSeller", seller, err)
+		}
+	}
+
+	db := store.NewMemory()
+	svc := NewService(db, Party{}, DefaultVATRate)
+	err := db.Update(func(tx *store.Tx) error {
+		return svc.OnPaymentSettled(tx, &payments.Payment{ID: "pay_1", UserID: "acme", Amount: 1160, Status: payments.StatusPaid})
+	})
+	if !errors.Is(err, ErrNoSeller) {
+		t.Errorf("OnPaymentSettled() error = %v, want ErrNoSeller", err)
+	}
+	if list, _ := svc.List(nil); len(list) != 0 {
+		t.Errorf("issued %d invoices without a seller", len(list))
+	}
+}
+
+func TestInvoiceItemisesBookedQuote(t *testing.T) {
+	svc, db, pickupService := newTestService()
+	if err := items.NewService(db).Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	quoteService := quotes.NewService(db, pickupService, quotes.DefaultPriceList, quotes.DefaultHubs, []byte("secret"))
+	quote, err := quoteService.Issue("acme", quotes.Request{
+		Address: "Westlands", Location: geo.Point{Lat: -1.2676, Lng: 36.8108},
+		Items: []pickups.Item{{Category: "computers", Subcategory: "laptops", Quantity: 20}},
+	})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	_, pickup, err := quoteService.Accept("acme", quotes.AcceptRequest{QuoteID: quote.ID, Signature: quote.Signature, Date: "2026-06-15", TimeSlot: "morning"})
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+
+	// The provider reports a different amount; the invoice still lists the quote.
+	settle(t, db, svc, &payments.Payment{
+		ID: "pay_1", UserID: "acme", Purpose: payments.PurposeBulkCollection, PickupID: pickup.ID,
+		Amount: quote.Total, PaidAmount: quote.Total - 1, Status: payments.StatusPaid,
+	})
+	inv, _ := svc.Get("inv_1")
+	if inv.QuoteID != quote.ID || len(inv.Lines) != len(quote.Lines) || inv.Total != quote.Total*100 {
+		t.Errorf("invoice = %+v, want the lines of %s", inv, quote.ID)
+	}
+}
+
+func TestCreditNoteOnCancellation(t *testing.T) {
+	svc, db, pickupService := newTestService()
+	pickup, err := pickupService.Create("acme", pickups.CreateRequest{
+		Address: "Industrial Area", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "computers", Quantity: 40}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	settle(t, db, svc, &payments.Payment{
+		ID: "pay_1", UserID: "acme", Purpose: payments.PurposePremiumPickup, PickupID: pickup.ID,
+		Amount: 3000, PaidAmount: 3000, Status: payments.StatusPaid,
+	})
+
+	if _, err := pickupService.Transition(pickup.ID, pickups.StatusCancelled, "acme"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+
+	notes, _ := svc.List(ByUser("acme", KindCreditNote))
+	if len(notes) != 1 {
+		t.Fatalf("expected 1 credit note, got %d", len(notes))
+	}
+	note := notes[0]
+	if note.Number != "CN-000001" || note.OriginalID != "inv_1" || note.Total != 300000 {
+		t.Errorf("unexpected credit note %+v", note)
+	}
+	original, _ := svc.Get("inv_1")
+	if original.Status != StatusCredited || original.CreditNoteID != note.ID {
+		t.Errorf("original not marked credited: %+v", original)
+	}
+	if _, err := svc.Credit("inv_1", "again"); !errors.Is(err, ErrAlreadyCredited) {
+		t.Errorf("second credit error = %v, want ErrAlreadyCredited", err)
+	}
+	if _, err := svc.Credit(note.ID, "credit a credit"); !errors.Is(err, ErrNotCreditable) {
+		t.Errorf("crediting a credit note error = %v, want ErrNotCreditable", err)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := map[int64]string{0: "0.00", 5: "0.05", 123456: "1,234.56", 100000000: "1,000,000.00", -2550: "-25.50"}
+	for cents, want := range tests {
+		if got := FormatAmount(cents); got != want {
+			t.Errorf("FormatAmount(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
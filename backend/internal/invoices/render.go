@@ -0,0 +1,148 @@
+package invoices
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pdf"
+)
+
+// Column positions of the line-item table, in points from the left edge.
+const (
+	marginLeft  = 50.0
+	marginRight = pdf.PageWidth - 50
+	colQuantity = 330.0
+	colUnit     = 400.0
+	colVAT      = 470.0
+	pageBottom  = pdf.PageHeight - 80
+)
+
+// FormatAmount renders an amount in cents as "1,234.56".
+func FormatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	whole := fmt.Sprintf("%d", cents/100)
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, b.String(), cents%100)
+}
+
+// PDF renders inv as a printable document.
+func PDF(inv *Invoice) []byte {
+	title := "TAX INVOICE"
+	if inv.Kind == KindCreditNote {
+		title = "CREDIT NOTE"
+	}
+	doc := pdf.New(fmt.Sprintf("%s %s", title, inv.Number))
+
+	doc.Text(marginLeft, 60, 18, true, inv.Seller.Name)
+	y := 78.0
+	for _, line := range []string{inv.Seller.Address, pinLine(inv.Seller.TaxPIN), inv.Seller.Email} {
+		if line != "" {
+			doc.Text(marginLeft, y, 9, false, line)
+			y += 12
+		}
+	}
+	doc.TextRight(marginRight, 60, 16, true, title)
+	doc.TextRight(marginRight, 78, 10, false, "No. "+inv.Number)
+	doc.TextRight(marginRight, 90, 10, false, "Date: "+inv.IssuedAt.Format("02 Jan 2006"))
+	if inv.OriginalNumber != "" {
+		doc.TextRight(marginRight, 102, 10, false, "Credits invoice "+inv.OriginalNumber)
+	}
+
+	y = 140
+	doc.Text(marginLeft, y, 10, true, "Bill to")
+	y += 14
+	customer := inv.Customer
+	if customer.Name == "" {
+		customer.Name = "Customer " + inv.UserID
+	}
+	for _, line := range []string{customer.Name, customer.Address, pinLine(customer.TaxPIN), customer.Email} {
+		if line != "" {
+			doc.Text(marginLeft, y, 10, false, line)
+			y += 13
+		}
+	}
+	for _, ref := range []struct{ label, value string }{
+		{"Pickup", inv.PickupID}, {"Quote", inv.QuoteID}, {"M-Pesa receipt", inv.ReceiptNumber}, {"Reason", inv.Reason},
+	} {
+		if ref.value != "" {
+			doc.Text(marginLeft, y, 9, false, ref.label+": "+ref.value)
+			y += 12
+		}
+	}
+
+	y += 16
+	header := func() {
+		doc.Text(marginLeft, y, 9, true, "Description")
+		doc.TextRight(colQuantity, y, 9, true, "Qty")
+		doc.TextRight(colUnit, y, 9, true, "Unit (excl.)")
+		doc.TextRight(colVAT, y, 9, true, fmt.Sprintf("VAT %d%%", inv.VATRate))
+		doc.TextRight(marginRight, y, 9, true, "Amount ("+inv.Currency+")")
+		doc.Line(marginLeft, y+5, marginRight, y+5)
+		y += 20
+	}
+	header()
+	for _, line := range inv.Lines {
+		if y > pageBottom {
+			doc.AddPage()
+			y = 60
+			header()
+		}
+		doc.Text(marginLeft, y, 9, false, truncate(line.Description, 48))
+		doc.TextRight(colQuantity, y, 9, false, fmt.Sprintf("%d", line.Quantity))
+		doc.TextRight(colUnit, y, 9, false, FormatAmount(line.UnitPrice))
+		doc.TextRight(colVAT, y, 9, false, FormatAmount(line.VAT))
+		doc.TextRight(marginRight, y, 9, false, FormatAmount(line.Gross))
+		y += 16
+	}
+
+	if y > pageBottom-50 {
+		doc.AddPage()
+		y = 60
+	}
+	doc.Line(colUnit-60, y-6, marginRight, y-6)
+	y += 8
+	for _, total := range []struct {
+		label  string
+		amount int64
+		bold   bool
+	}{
+		{"Subtotal (excl. VAT)", inv.Subtotal, false},
+		{fmt.Sprintf("VAT @ %d%%", inv.VATRate), inv.VAT, false},
+		{"Total " + inv.Currency, inv.Total, true},
+	} {
+		doc.TextRight(colVAT, y, 10, total.bold, total.label)
+		doc.TextRight(marginRight, y, 10, total.bold, FormatAmount(total.amount))
+		y += 15
+	}
+
+	footer := "Thank you for recycling responsibly."
+	if inv.Kind == KindCreditNote {
+		footer = "This credit note cancels the invoice referenced above."
+	}
+	doc.Text(marginLeft, pdf.PageHeight-50, 8, false, footer)
+	return doc.Bytes()
+}
+
+func pinLine(pin string) string {
+	if pin == "" {
+		return ""
+	}
+	return "KRA PIN: " + pin
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,435 @@
+// Package items manages the catalogue of e-waste the service collects: device
+// categories and subcategories with their typical weights, hazardous
+// components, handling instructions and point values.
+package items
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// categoriesBucket holds categories keyed by ID.
+const categoriesBucket = "item_categories"
+
+// Hazardous components a device may contain.
+const (
+	HazardLead        = "lead"
+	HazardMercury     = "mercury"
+	HazardLithium     = "lithium"
+	HazardCadmium     = "cadmium"
+	HazardRefrigerant = "refrigerant"
+)
+
+// Hazards describes each hazardous component for display.
+var Hazards = map[string]string{
+	HazardLead:        "Lead in solder, CRT glass and lead-acid batteries",
+	HazardMercury:     "Mercury in lamp backlights, switches and button cells",
+	HazardLithium:     "Lithium cells that can ignite if punctured or crushed",
+	HazardCadmium:     "Cadmium in nickel-cadmium batteries",
+	HazardRefrigerant: "Refrigerant gases that must be recovered before dismantling",
+}
+
+var (
+	// ErrNotFound is returned when a category or subcategory does not exist.
+	ErrNotFound = errors.New("item category not found")
+	// ErrInvalidCategory is returned when a category fails validation.
+	ErrInvalidCategory = errors.New("invalid item category")
+)
+
+var validID = regexp.MustCompile(`^[a-z0-9_]{1,40}$`)
+
+// Subcategory narrows a category. Empty fields inherit the category's values.
+type Subcategory struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	TypicalWeightKg float64  `json:"typical_weight_kg,omitempty"`
+	Hazards         []string `json:"hazards,omitempty"`
+	Handling        string   `json:"handling,omitempty"`
+	Points          int64    `json:"points,omitempty"`
+}
+
+// Category is a kind of device residents hand over. Points is the reward per
+// unit: it sets the earning rules in force until an admin publishes their own.
+type Category struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description,omitempty"`
+	TypicalWeightKg float64       `json:"typical_weight_kg"`
+	Hazards         []string      `json:"hazards"`
+	Handling        string        `json:"handling"`
+	Points          int64         `json:"points"`
+	Subcategories   []Subcategory `json:"subcategories"`
+	Position        int           `json:"position"`
+	Active          bool          `json:"active"`
+	UpdatedBy       string        `json:"updated_by,omitempty"`
+	UpdatedAt       time.Time     `json:"updated_at,omitempty"`
+}
+
+// Spec is what the catalogue knows about one category, or one subcategory
+// with the category's values filled in.
+type Spec struct {
+	Category        string   `json:"category"`
+	Subcategory     string   `json:"subcategory,omitempty"`
+	Name            string   `json:"name"`
+	TypicalWeightKg float64  `json:"typical_weight_kg"`
+	Hazards         []string `json:"hazards"`
+	Handling        string   `json:"handling"`
+	Points          int64    `json:"points"`
+}
+
+// Hazardous reports whether the item contains any hazardous component.
+func (s *Spec) Hazardous() bool {
+	return len(s.Hazards) > 0
+}
+
+// Spec returns the values that apply to subcategory, or to the category
+// itself when subcategory is empty.
+func (c *Category) Spec(subcategory string) (*Spec, error) {
+	spec := &Spec{
+		Category:        c.ID,
+		Name:            c.Name,
+		TypicalWeightKg: c.TypicalWeightKg,
+		Hazards:         append([]string{}, c.Hazards...),
+		Handling:        c.Handling,
+		Points:          c.Points,
+	}
+	if subcategory == "" {
+		return spec, nil
+	}
+	for _, sub := range c.Subcategories {
+		if sub.ID != subcategory {
+			continue
+		}
+		spec.Subcategory, spec.Name = sub.ID, sub.Name
+		if sub.TypicalWeightKg > 0 {
+			spec.TypicalWeightKg = sub.TypicalWeightKg
+		}
+		if sub.Handling != "" {
+			spec.Handling = sub.Handling
+		}
+		if sub.Points > 0 {
+			spec.Points = sub.Points
+		}
+		if len(sub.Hazards) > 0 {
+			spec.Hazards = append([]string{}, sub.Hazards...)
+		}
+		return spec, nil
+	}
+	return nil, fmt.Errorf("%w: %s has no subcategory %q", ErrNotFound, c.ID, subcategory)
+}
+
+// DefaultCatalogue is the catalogue seeded into an empty store.
+func DefaultCatalogue() []Category {
+	return []Category{
+		{
+			ID: "phones", Name: "Phones and tablets", Position: 1, Active: true,
+			TypicalWeightKg: 0.2, Hazards: []string{HazardLithium}, Points: 40,
+			Handling: "Remove SIM and memory cards. Leave the battery in place and do not crush or puncture the device.",
+			Subcategories: []Subcategory{
+				{ID: "smartphones", Name: "Smartphones", TypicalWeightKg: 0.2},
+				{ID: "feature_phones", Name: "Feature phones", TypicalWeightKg: 0.1, Points: 20},
+				{ID: "tablets", Name: "Tablets", TypicalWeightKg: 0.5, Points: 60},
+			},
+		},
+		{
+			ID: "computers", Name: "Computers", Position: 2, Active: true,
+			TypicalWeightKg: 8, Hazards: []string{HazardLead}, Points: 100,
+			Handling: "Wipe or remove storage drives before handover. Keep units dry and upright.",
+			Subcategories: []Subcategory{
+				{ID: "laptops", Name: "Laptops", TypicalWeightKg: 2.5, Hazards: []string{HazardLead, HazardLithium, HazardMercury},
+					Handling: "Wipe storage. Leave the battery in place unless it is swollen; bag swollen batteries separately."},
+				{ID: "desktops", Name: "Desktop towers", TypicalWeightKg: 9},
+				{ID: "servers", Name: "Servers and network racks", TypicalWeightKg: 20, Points: 150},
+			},
+		},
+		{
+			ID: "crt_monitors", Name: "CRT monitors and televisions", Position: 3, Active: true,
+			TypicalWeightKg: 15, Hazards: []string{HazardLead}, Points: 60,
+			Handling: "Leaded glass: carry screen-side in, never stack or drop. A cracked tube must be wrapped before loading.",
+			Subcategories: []Subcategory{
+				{ID: "monitors", Name: "CRT computer monitors", TypicalWeightKg: 15},
+				{ID: "televisions", Name: "CRT televisions", TypicalWeightKg: 25},
+			},
+		},
+		{
+			ID: "batteries", Name: "Batteries", Position: 4, Active: true,
+			TypicalWeightKg: 1, Hazards: []string{HazardLead, HazardLithium}, Points: 30,
+			Handling: "Tape the terminals and keep batteries dry in a non-metal container. Never load damaged cells with other items.",
+			Subcategories: []Subcategory{
+				{ID: "lithium_ion", Name: "Lithium-ion packs", TypicalWeightKg: 0.5, Hazards: []string{HazardLithium}},
+				{ID: "lead_acid", Name: "Lead-acid (car, UPS, solar)", TypicalWeightKg: 12, Hazards: []string{HazardLead},
+					Handling: "Keep upright to avoid acid leaks and load on a drip tray."},
+				{ID: "nickel_cadmium", Name: "Nickel-cadmium", TypicalWeightKg: 0.3, Hazards: []string{HazardCadmium}},
+				{ID: "button_cells", Name: "Button cells", TypicalWeightKg: 0.01, Hazards: []string{HazardMercury}},
+			},
+		},
+		{
+			ID: "appliances", Name: "Household appliances", Position: 5, Active: true,
+			TypicalWeightKg: 30, Hazards: []string{}, Points: 50,
+			Handling: "Empty and disconnect the appliance. Two people are needed for anything over 25 kg.",
+			Subcategories: []Subcategory{
+				{ID: "refrigerators", Name: "Fridges and freezers", TypicalWeightKg: 50, Hazards: []string{HazardRefrigerant},
+					Handling: "Transport upright and do not damage the cooling circuit; refrigerant is recovered at the hub."},
+				{ID: "washing_machines", Name: "Washing machines", TypicalWeightKg: 65},
+				{ID: "microwaves", Name: "Microwave ovens", TypicalWeightKg: 12},
+				{ID: "small_appliances", Name: "Small appliances", TypicalWeightKg: 3, Points: 15},
+			},
+		},
+		{
+			ID: "electronics", Name: "Other electronics", Position: 6, Active: true,
+			TypicalWeightKg: 3, Hazards: []string{}, Points: 20,
+			Handling: "Remove batteries where they come out easily and hand them over separately.",
+			Subcategories: []Subcategory{
+				{ID: "flat_screens", Name: "Flat-screen TVs and monitors", TypicalWeightKg: 10, Hazards: []string{HazardMercury},
+					Handling: "Older LCDs have mercury backlight tubes: keep the panel intact."},
+				{ID: "printers", Name: "Printers and copiers", TypicalWeightKg: 8},
+				{ID: "audio_video", Name: "Audio and video equipment", TypicalWeightKg: 4},
+				{ID: "networking", Name: "Routers and networking", TypicalWeightKg: 1},
+			},
+		},
+		{
+			ID: "other", Name: "Other", Position: 7, Active: true,
+			TypicalWeightKg: 5, Hazards: []string{}, Points: 10,
+			Handling:      "Describe the item in the notes so the collector can bring the right equipment.",
+			Subcategories: []Subcategory{},
+		},
+	}
+}
+
+// Service manages the item catalogue.
+type Service struct {
+	store *store.Store
+	now   func() time.Time
+}
+
+// NewService creates an item catalogue backed by s.
+func NewService(s *store.Store) *Service {
+	return &Service{store: s, now: time.Now}
+}
+
+// Seed stores the default catalogue if the catalogue is empty.
+func (s *Service) Seed() error {
+	return s.store.Update(func(tx *store.Tx) error {
+		empty := true
+		if err := tx.ForEach(categoriesBucket, func(string, json.RawMessage) error {
+			empty = false
+			return nil
+		}); err != nil {
+			return err
+		}
+		if !empty {
+			return nil
+		}
+		for _, category := range DefaultCatalogue() {
+			category.UpdatedBy, category.UpdatedAt = "system", s.now().UTC()
+			if err := tx.Put(categoriesBucket, category.ID, category); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns the active categories in display order, or all of them when
+// includeInactive is set.
+func (s *Service) List(includeInactive bool) ([]Category, error) {
+	var list []Category
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		list, err = ListTx(tx, includeInactive)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListTx is List within tx.
+func ListTx(tx *store.Tx, includeInactive bool) ([]Category, error) {
+	list := []Category{}
+	err := tx.ForEach(categoriesBucket, func(key string, raw json.RawMessage) error {
+		var c Category
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return fmt.Errorf("error decoding item category %s: %w", key, err)
+		}
+		if c.Active || includeInactive {
+			list = append(list, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Position != list[j].Position {
+			return list[i].Position < list[j].Position
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// Get returns the category with the given ID, including inactive ones.
+func (s *Service) Get(id string) (*Category, error) {
+	var c *Category
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		c, err = getTx(tx, id)
+		return err
+	})
+	return c, err
+}
+
+func getTx(tx *store.Tx, id string) (*Category, error) {
+	var c Category
+	if err := tx.Get(categoriesBucket, id, &c); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Lookup returns the spec of an active category or one of its subcategories.
+func (s *Service) Lookup(category, subcategory string) (*Spec, error) {
+	var spec *Spec
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		spec, err = LookupTx(tx, category, subcategory)
+		return err
+	})
+	return spec, err
+}
+
+// LookupTx is Lookup inside an existing transaction.
+func LookupTx(tx *store.Tx, category, subcategory string) (*Spec, error) {
+	c, err := getTx(tx, category)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Active {
+		return nil, fmt.Errorf("%w: %q is no longer collected", ErrNotFound, category)
+	}
+	return c.Spec(subcategory)
+}
+
+// Save creates or replaces a category on behalf of actor.
+func (s *Service) Save(c Category, actor string) (*Category, error) {
+	c.ID = strings.TrimSpace(c.ID)
+	c.Name = strings.TrimSpace(c.Name)
+	c.Handling = strings.TrimSpace(c.Handling)
+	if c.Hazards == nil {
+		c.Hazards = []string{}
+	}
+	if c.Subcategories == nil {
+		c.Subcategories = []Subcategory{}
+	}
+	if err := validate(&c); err != nil {
+		return nil, err
+	}
+	c.UpdatedBy, c.UpdatedAt = actor, s.now().UTC()
+	err := s.store.Update(func(tx *store.Tx) error {
+		return tx.Put(categoriesBucket, c.ID, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func validate(c *Category) error {
+	if !validID.MatchString(c.ID) || c.Name == "" {
+		return fmt.Errorf("%w: id (lowercase letters, digits and underscores) and name are required", ErrInvalidCategory)
+	}
+	if c.TypicalWeightKg <= 0 || c.Points < 0 {
+		return fmt.Errorf("%w: typical weight must be positive and points not negative", ErrInvalidCategory)
+	}
+	if err := validateHazards(c.Hazards); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for i := range c.Subcategories {
+		sub := &c.Subcategories[i]
+		sub.ID, sub.Name = strings.TrimSpace(sub.ID), strings.TrimSpace(sub.Name)
+		if !validID.MatchString(sub.ID) || sub.Name == "" || seen[sub.ID] {
+			return fmt.Errorf("%w: subcategories need a unique id and a name", ErrInvalidCategory)
+		}
+		seen[sub.ID] = true
+		if sub.TypicalWeightKg < 0 || sub.Points < 0 {
+			return fmt.Errorf("%w: subcategory %s has a negative weight or points", ErrInvalidCategory, sub.ID)
+		}
+		if err := validateHazards(sub.Hazards); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateHazards(hazards []string) error {
+	for _, h := range hazards {
+		if _, ok := Hazards[h]; !ok {
+			return fmt.Errorf("%w: unknown hazard %q", ErrInvalidCategory, h)
+		}
+	}
+	return nil
+}
+
+// ScreenPickup is a pickups.Screen that refuses items the catalogue does not
+// list or no longer collects.
+func (s *Service) ScreenPickup(tx *store.Tx, p *pickups.Pickup) error {
+	for _, item := range p.Items {
+		if _, err := LookupTx(tx, item.Category, item.Subcategory); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w: %v", pickups.ErrInvalidPickup, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// UnitWeightKg returns the typical weight of one unit of item, or 0 when the
+// catalogue does not list it. Categories no longer collected still count, so
+// pickups booked before they were withdrawn keep their weight.
+func (s *Service) UnitWeightKg(item pickups.Item) float64 {
+	var weight float64
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		weight, err = UnitWeightKgTx(tx, item)
+		return err
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to look up the weight of %s: %v", item.Category, err)
+	}
+	return weight
+}
+
+// UnitWeightKgTx is UnitWeightKg inside an existing transaction.
+func UnitWeightKgTx(tx *store.Tx, item pickups.Item) (float64, error) {
+	c, err := getTx(tx, item.Category)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	spec, err := c.Spec(item.Subcategory)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return spec.TypicalWeightKg, nil
+}
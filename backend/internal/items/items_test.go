@@ -0,0 +1,142 @@
+package items
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func newTestService(t *testing.T) (*Service, *pickups.Service) {
+	t.Helper()
+	db := store.NewMemory()
+	svc := NewService(db)
+	if err := svc.Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	pickupService := pickups.NewService(db)
+	pickupService.AddScreen(svc.ScreenPickup)
+	return svc, pickupService
+}
+
+func TestDefaultCatalogueIsValid(t *testing.T) {
+	for _, c := range DefaultCatalogue() {
+		if err := validate(&c); err != nil {
+			t.Errorf("%s: %v", c.ID, err)
+		}
+	}
+}
+
+func TestListOrdersAndHidesInactive(t *testing.T) {
+	svc, _ := newTestService(t)
+	other, _ := svc.Get("other")
+	other.Active = false
+	if _, err := svc.Save(*other, "admin"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	active, err := svc.List(false)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(active) != len(DefaultCatalogue())-1 || active[0].ID != "phones" {
+		t.Errorf("List(false) = %d categories starting %s", len(active), active[0].ID)
+	}
+	all, _ := svc.List(true)
+	if len(all) != len(DefaultCatalogue()) || all[len(all)-1].ID != "other" {
+		t.Errorf("List(true) = %d categories", len(all))
+	}
+}
+
+func TestLookup(t *testing.T) {
+	svc, _ := newTestService(t)
+	tests := []struct {
+		name        string
+		category    string
+		subcategory string
+		weight      float64
+		hazards     []string
+		points      int64
+		err         error
+	}{
+		{"Category", "batteries", "", 1, []string{HazardLead, HazardLithium}, 30, nil},
+		{"Subcategory overrides", "batteries", "lead_acid", 12, []string{HazardLead}, 30, nil},
+		{"Subcategory inherits hazards", "computers", "desktops", 9, []string{HazardLead}, 100, nil},
+		{"Unknown subcategory", "computers", "abacus", 0, nil, 0, ErrNotFound},
+		{"Unknown category", "spaceships", "", 0, nil, 0, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := svc.Lookup(tt.category, tt.subcategory)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Lookup() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if spec.TypicalWeightKg != tt.weight || spec.Points != tt.points || !reflect.DeepEqual(spec.Hazards, tt.hazards) {
+				t.Errorf("Lookup() = %+v", spec)
+			}
+		})
+	}
+}
+
+func TestSaveValidates(t *testing.T) {
+	svc, _ := newTestService(t)
+	valid := Category{ID: "solar", Name: "Solar panels", TypicalWeightKg: 18, Handling: "Carry flat.", Active: true}
+	tests := []struct {
+		name   string
+		modify func(*Category)
+	}{
+		{"Bad ID", func(c *Category) { c.ID = "Solar Panels" }},
+		{"No weight", func(c *Category) { c.TypicalWeightKg = 0 }},
+		{"Unknown hazard", func(c *Category) { c.Hazards = []string{"kryptonite"} }},
+		{"Duplicate subcategory", func(c *Category) {
+			c.Subcategories = []Subcategory{{ID: "mono", Name: "Mono"}, {ID: "mono", Name: "Mono again"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			if _, err := svc.Save(c, "admin"); !errors.Is(err, ErrInvalidCategory) {
+				t.Errorf("Save() error = %v, want ErrInvalidCategory", err)
+			}
+		})
+	}
+
+	saved, err := svc.Save(valid, "admin")
+	if err != nil || saved.UpdatedBy != "admin" || saved.Hazards == nil {
+		t.Fatalf("Save() = %+v, %v", saved, err)
+	}
+}
+
+func TestScreenPickup(t *testing.T) {
+	svc, pickupService := newTestService(t)
+	create := func(item pickups.Item) error {
+		item.Quantity = 1
+		_, err := pickupService.Create("resident", pickups.CreateRequest{
+			Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning", Items: []pickups.Item{item},
+		})
+		return err
+	}
+
+	if err := create(pickups.Item{Category: "computers", Subcategory: "laptops"}); err != nil {
+		t.Errorf("Create(laptop) error = %v", err)
+	}
+	if err := create(pickups.Item{Category: "computers", Subcategory: "abacus"}); !errors.Is(err, pickups.ErrInvalidPickup) {
+		t.Errorf("Create(unknown subcategory) error = %v, want ErrInvalidPickup", err)
+	}
+
+	phones, _ := svc.Get("phones")
+	phones.Active = false
+	svc.Save(*phones, "admin")
+	if err := create(pickups.Item{Category: "phones"}); !errors.Is(err, pickups.ErrInvalidPickup) {
+		t.Errorf("Create(retired category) error = %v, want ErrInvalidPickup", err)
+	}
+	if w := svc.UnitWeightKg(pickups.Item{Category: "appliances", Subcategory: "refrigerators"}); w != 50 {
+		t.Errorf("UnitWeightKg(fridge) = %v, want 50", w)
+	}
+}
@@ -0,0 +1,683 @@
+// Package jobs is a durable queue for work done in the background. Jobs are
+// stored before they run, so they survive restarts; each kind has its own
+// handler and concurrency limit, failed jobs are retried with exponential
+// backoff, and jobs that keep failing are set aside as dead letters for an
+// admin to inspect and retry. Succeeded jobs are pruned after a while.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the queue. The ready bucket indexes queued jobs by
+// "<run at>|<job ID>" so its key order is the order they fall due; the
+// running bucket maps running jobs to when their lease runs out; the unique
+// bucket maps "<kind>:<unique key>" to the unfinished job holding it.
+const (
+	jobsBucket    = "jobs"
+	readyBucket   = "jobs_ready"
+	runningBucket = "jobs_running"
+	uniqueBucket  = "jobs_unique"
+)
+
+// Job states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	// StatusDead marks a job that failed permanently or ran out of attempts.
+	StatusDead = "dead"
+)
+
+// Defaults for Options fields left at zero.
+const (
+	DefaultConcurrency = 1
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultTimeout     = 5 * time.Minute
+)
+
+// DefaultRetention is how long succeeded jobs are kept before Run prunes
+// them. Dead letters are kept until they are retried.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// pruneInterval is how often Run prunes succeeded jobs.
+const pruneInterval = time.Hour
+
+// leaseGrace is how long past its timeout a running job is left before it is
+// presumed lost, e.g. because the server stopped while running it.
+const leaseGrace = time.Minute
+
+// drainGrace is how long Drain waits for cancelled jobs to return.
+const drainGrace = 5 * time.Second
+
+var (
+	// ErrUnknownKind is returned when enqueueing a kind no handler is registered for.
+	ErrUnknownKind = errors.New("unknown job kind")
+	// ErrPermanent wraps handler errors that retrying cannot fix. Jobs that
+	// fail with it go straight to the dead letters.
+	ErrPermanent = errors.New("permanent job failure")
+	// ErrNotFound is returned when a job does not exist.
+	ErrNotFound = errors.New("job not found")
+	// ErrNotDead is returned when retrying a job that is not a dead letter.
+	ErrNotDead = errors.New("job is not a dead letter")
+)
+
+// Job is a unit of background work. Payload is the JSON encoding of the
+// value it was enqueued with; handlers read it back with Decode.
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LeaseUntil  time.Time       `json:"lease_until,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  time.Time       `json:"finished_at,omitempty"`
+}
+
+// Decode unmarshals the job's payload into v. A payload that does not fit v
+// will never fit it, so the error is permanent.
+func (j *Job) Decode(v interface{}) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return fmt.Errorf("%w: cannot decode %s payload: %v", ErrPermanent, j.Kind, err)
+	}
+	return nil
+}
+
+func (j *Job) readyKey() string {
+	return j.RunAt.UTC().Format("20060102T150405.000000000Z") + "|" + j.ID
+}
+
+// Handler does the work of a job. It should return when ctx is done.
+type Handler func(ctx context.Context, job *Job) error
+
+// Options tune how the jobs of one kind are run. The nth retry waits
+// Backoff doubled n-1 times, up to MaxBackoff.
+type Options struct {
+	Concurrency int
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = DefaultBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return o
+}
+
+// delay returns how long to wait before retrying after attempt failed.
+func (o Options) delay(attempt int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < attempt && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+// EnqueueOptions control a single job. While a job with the same kind and
+// UniqueKey is queued or running, enqueueing another returns it instead.
+// RunAt delays the job; it runs as soon as possible when zero.
+type EnqueueOptions struct {
+	UniqueKey string
+	RunAt     time.Time
+}
+
+// Filter selects jobs.
+type Filter struct {
+	Kind   string
+	Status string
+	Limit  int
+}
+
+type registration struct {
+	handler Handler
+	opts    Options
+	running int
+}
+
+// Queue stores jobs and runs them with the registered handlers.
+type Queue struct {
+	store     *store.Store
+	workers   int
+	retention time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	kinds    map[string]*registration
+	running  int
+	inflight map[string]bool
+	draining bool
+	wg       sync.WaitGroup
+	wake     chan struct{}
+	work     context.Context
+	stop     context.CancelFunc
+}
+
+// NewQueue creates a queue backed by s that runs at most workers jobs at once.
+func NewQueue(s *store.Store, workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	work, stop := context.WithCancel(context.Background())
+	return &Queue{
+		store:     s,
+		workers:   workers,
+		retention: DefaultRetention,
+		now:       time.Now,
+		kinds:     map[string]*registration{},
+		inflight:  map[string]bool{},
+		wake:      make(chan struct{}, 1),
+		work:      work,
+		stop:      stop,
+	}
+}
+
+// SetRetention sets how long succeeded jobs are kept, DefaultRetention
+// unless changed.
+func (q *Queue) SetRetention(d time.Duration) {
+	q.retention = d
+}
+
+// SetClock sets the clock jobs are scheduled and claimed by, time.Now unless
+// changed.
+func (q *Queue) SetClock(now func() time.Time) {
+	q.now = now
+}
+
+// Register installs the handler for jobs of kind. Handlers must be
+// registered before jobs of their kind are enqueued or run.
+func (q *Queue) Register(kind string, handler Handler, opts Options) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.kinds[kind] = &registration{handler: handler, opts: opts.withDefaults()}
+}
+
+// signal wakes Run to look for work.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue stores a job of kind in its own transaction.
+func (q *Queue) Enqueue(kind string, payload interface{}, opts EnqueueOptions) (*Job, error) {
+	var job *Job
+	err := q.store.Update(func(tx *store.Tx) error {
+		var err error
+		job, err = q.EnqueueTx(tx, kind, payload, opts)
+		return err
+	})
+	return job, err
+}
+
+// EnqueueTx stores a job of kind inside tx, so it only runs if tx commits.
+func (q *Queue) EnqueueTx(tx *store.Tx, kind string, payload interface{}, opts EnqueueOptions) (*Job, error) {
+	q.mu.Lock()
+	reg, ok := q.kinds[kind]
+	q.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+	if opts.UniqueKey != "" {
+		var id string
+		err := tx.Get(uniqueBucket, kind+":"+opts.UniqueKey, &id)
+		if err == nil {
+			return getTx(tx, id)
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s payload: %w", kind, err)
+	}
+
+	seq, err := tx.NextSequence(jobsBucket)
+	if err != nil {
+		return nil, err
+	}
+	now := q.now().UTC()
+	runAt := opts.RunAt.UTC()
+	if runAt.Before(now) {
+		runAt = now
+	}
+	job := &Job{
+		ID:          fmt.Sprintf("job_%d", seq),
+		Kind:        kind,
+		Payload:     data,
+		UniqueKey:   opts.UniqueKey,
+		Status:      StatusQueued,
+		MaxAttempts: reg.opts.MaxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.Insert(jobsBucket, job.ID, job); err != nil {
+		return nil, err
+	}
+	if err := tx.Put(readyBucket, job.readyKey(), job.ID); err != nil {
+		return nil, err
+	}
+	if job.UniqueKey != "" {
+		if err := tx.Put(uniqueBucket, kind+":"+job.UniqueKey, job.ID); err != nil {
+			return nil, err
+		}
+	}
+	tx.OnCommit(q.signal)
+	return job, nil
+}
+
+func getTx(tx *store.Tx, id string) (*Job, error) {
+	var job Job
+	err := tx.Get(jobsBucket, id, &job)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// Get returns the job with the given ID.
+func (q *Queue) Get(id string) (*Job, error) {
+	var job *Job
+	err := q.store.View(func(tx *store.Tx) error {
+		var err error
+		job, err = getTx(tx, id)
+		return err
+	})
+	return job, err
+}
+
+// List returns the jobs matching filter, newest first, up to filter.Limit
+// when it is set.
+func (q *Queue) List(filter Filter) ([]Job, error) {
+	list := []Job{}
+	err := q.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(jobsBucket, func(key string, raw json.RawMessage) error {
+			var job Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return fmt.Errorf("error decoding job %s: %w", key, err)
+			}
+			if (filter.Kind == "" || job.Kind == filter.Kind) && (filter.Status == "" || job.Status == filter.Status) {
+				list = append(list, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+	return list, nil
+}
+
+// Retry puts a dead letter back on the queue with a fresh set of attempts.
+func (q *Queue) Retry(id string) (*Job, error) {
+	var job *Job
+	err := q.store.Update(func(tx *store.Tx) error {
+		var err error
+		if job, err = getTx(tx, id); err != nil {
+			return err
+		}
+		if job.Status != StatusDead {
+			return fmt.Errorf("%w: %s is %s", ErrNotDead, id, job.Status)
+		}
+		// Another job may have taken the unique key meanwhile; the retried
+		// one then runs without it rather than not at all.
+		if job.UniqueKey != "" {
+			key := job.Kind + ":" + job.UniqueKey
+			if tx.Exists(uniqueBucket, key) {
+				job.UniqueKey = ""
+			} else if err := tx.Put(uniqueBucket, key, id); err != nil {
+				return err
+			}
+		}
+		now := q.now().UTC()
+		job.Status = StatusQueued
+		job.Attempts = 0
+		job.RunAt = now
+		job.UpdatedAt = now
+		job.FinishedAt = time.Time{}
+		if err := tx.Put(jobsBucket, id, job); err != nil {
+			return err
+		}
+		tx.OnCommit(q.signal)
+		return tx.Put(readyBucket, job.readyKey(), id)
+	})
+	return job, err
+}
+
+// Run starts due jobs as workers and concurrency limits allow, checking
+// every poll interval and whenever a job is enqueued or finishes, until ctx
+// is done. Jobs already running carry on; use Drain to wait for them. Once
+// an hour it prunes the jobs that succeeded longer ago than the retention.
+func (q *Queue) Run(ctx context.Context, poll time.Duration) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		if err := q.tick(); err != nil {
+			log.Printf("Jobs: %v", err)
+		}
+		if now := q.now(); now.Sub(pruned) >= pruneInterval {
+			pruned = now
+			if _, err := q.Prune(now.Add(-q.retention)); err != nil {
+				log.Printf("Jobs: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// Prune deletes the jobs that succeeded before cutoff and returns how many
+// it deleted.
+func (q *Queue) Prune(cutoff time.Time) (int, error) {
+	var done []string
+	err := q.store.Update(func(tx *store.Tx) error {
+		done = nil
+		err := tx.ForEach(jobsBucket, func(key string, raw json.RawMessage) error {
+			var job Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return fmt.Errorf("error decoding job %s: %w", key, err)
+			}
+			if job.Status == StatusSucceeded && job.FinishedAt.Before(cutoff) {
+				done = append(done, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range done {
+			if err := tx.Delete(jobsBucket, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(done), err
+}
+
+// tick requeues lost jobs and starts the due ones there is room for.
+func (q *Queue) tick() error {
+	if err := q.reclaim(); err != nil {
+		return err
+	}
+	claimed, err := q.claim()
+	if err != nil {
+		return err
+	}
+	for _, job := range claimed {
+		go q.execute(job)
+	}
+	return nil
+}
+
+// reclaim requeues jobs whose lease has run out without this process
+// running them, which happens when the server stopped mid-job.
+func (q *Queue) reclaim() error {
+	now := q.now().UTC()
+	q.mu.Lock()
+	inflight := make(map[string]bool, len(q.inflight))
+	for id := range q.inflight {
+		inflight[id] = true
+	}
+	q.mu.Unlock()
+
+	return q.store.Update(func(tx *store.Tx) error {
+		var lost []string
+		err := tx.ForEach(runningBucket, func(id string, raw json.RawMessage) error {
+			var lease time.Time
+			if err := json.Unmarshal(raw, &lease); err != nil {
+				return fmt.Errorf("error decoding lease of job %s: %w", id, err)
+			}
+			if !inflight[id] && lease.Before(now) {
+				lost = append(lost, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range lost {
+			job, err := getTx(tx, id)
+			if err != nil {
+				return err
+			}
+			log.Printf("Job %s (%s) was interrupted; requeueing it.", job.ID, job.Kind)
+			if err := q.settleTx(tx, job, errors.New("interrupted before it finished"), now, DefaultBackoff); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// claim marks the due jobs there is room for as running and returns them.
+func (q *Queue) claim() ([]*Job, error) {
+	now := q.now().UTC()
+	cutoff := now.Format("20060102T150405.000000000Z")
+
+	q.mu.Lock()
+	if q.draining {
+		q.mu.Unlock()
+		return nil, nil
+	}
+	free := q.workers - q.running
+	room := map[string]int{}
+	timeouts := map[string]time.Duration{}
+	for kind, reg := range q.kinds {
+		room[kind] = reg.opts.Concurrency - reg.running
+		timeouts[kind] = reg.opts.Timeout
+	}
+	q.mu.Unlock()
+	if free <= 0 {
+		return nil, nil
+	}
+
+	var claimed []*Job
+	err := q.store.Update(func(tx *store.Tx) error {
+		claimed = nil
+		var due []*Job
+		err := tx.ForEach(readyBucket, func(key string, raw json.RawMessage) error {
+			if at, _, _ := strings.Cut(key, "|"); at > cutoff || len(due) >= free {
+				return nil
+			}
+			var id string
+			if err := json.Unmarshal(raw, &id); err != nil {
+				return fmt.Errorf("error decoding ready job %s: %w", key, err)
+			}
+			job, err := getTx(tx, id)
+			if err != nil {
+				return err
+			}
+			if room[job.Kind] <= 0 {
+				return nil
+			}
+			room[job.Kind]--
+			due = append(due, job)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, job := range due {
+			if err := tx.Delete(readyBucket, job.readyKey()); err != nil {
+				return err
+			}
+			job.Status = StatusRunning
+			job.Attempts++
+			job.LeaseUntil = now.Add(timeouts[job.Kind] + leaseGrace)
+			job.UpdatedAt = now
+			if err := tx.Put(jobsBucket, job.ID, job); err != nil {
+				return err
+			}
+			if err := tx.Put(runningBucket, job.ID, job.LeaseUntil); err != nil {
+				return err
+			}
+		}
+		claimed = due
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	for _, job := range claimed {
+		q.kinds[job.Kind].running++
+		q.running++
+		q.inflight[job.ID] = true
+		q.wg.Add(1)
+	}
+	q.mu.Unlock()
+	return claimed, nil
+}
+
+// execute runs a claimed job and records the outcome.
+func (q *Queue) execute(job *Job) {
+	defer q.wg.Done()
+	q.mu.Lock()
+	reg := q.kinds[job.Kind]
+	q.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(q.work, reg.opts.Timeout)
+	runErr := call(ctx, reg.handler, job)
+	cancel()
+
+	settleErr := q.store.Update(func(tx *store.Tx) error {
+		current, err := getTx(tx, job.ID)
+		if err != nil {
+			return err
+		}
+		return q.settleTx(tx, current, runErr, q.now().UTC(), reg.opts.delay(current.Attempts))
+	})
+	if settleErr != nil {
+		log.Printf("Job %s: could not record the outcome: %v", job.ID, settleErr)
+	}
+
+	q.mu.Lock()
+	reg.running--
+	q.running--
+	delete(q.inflight, job.ID)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// call runs handler, turning a panic into an error.
+func call(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// settleTx records that a run of job ended with runErr: it succeeded, is
+// queued again after retryIn, or becomes a dead letter.
+func (q *Queue) settleTx(tx *store.Tx, job *Job, runErr error, now time.Time, retryIn time.Duration) error {
+	if err := tx.Delete(runningBucket, job.ID); err != nil {
+		return err
+	}
+	job.LeaseUntil = time.Time{}
+	job.UpdatedAt = now
+	switch {
+	case runErr == nil:
+		job.Status = StatusSucceeded
+		job.LastError = ""
+		job.FinishedAt = now
+	case errors.Is(runErr, ErrPermanent) || job.Attempts >= job.MaxAttempts:
+		log.Printf("Job %s (%s) failed for good after %d attempts: %v", job.ID, job.Kind, job.Attempts, runErr)
+		job.Status = StatusDead
+		job.LastError = runErr.Error()
+		job.FinishedAt = now
+	default:
+		job.Status = StatusQueued
+		job.LastError = runErr.Error()
+		job.RunAt = now.Add(retryIn)
+		if err := tx.Put(readyBucket, job.readyKey(), job.ID); err != nil {
+			return err
+		}
+	}
+	if job.Status != StatusQueued && job.UniqueKey != "" {
+		if err := tx.Delete(uniqueBucket, job.Kind+":"+job.UniqueKey); err != nil {
+			return err
+		}
+	}
+	return tx.Put(jobsBucket, job.ID, job)
+}
+
+// Drain stops jobs from starting and waits for the running ones to finish.
+// If ctx ends first, running jobs are cancelled through their context and
+// Drain returns ctx.Err() once they have returned, or after a short grace
+// period; jobs that are cut off are retried on the next start.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	q.draining = true
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	q.stop()
+	select {
+	case <-done:
+	case <-time.After(drainGrace):
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,303 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+type fixture struct {
+	queue *Queue
+	clock time.Time
+}
+
+func newFixture(db *store.Store, workers int) *fixture {
+	f := &fixture{queue: NewQueue(db, workers), clock: time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)}
+	f.queue.now = func() time.Time { return f.clock }
+	return f
+}
+
+// runAt moves the clock to at, starts the due jobs and waits for them.
+func (f *fixture) runAt(t *testing.T, at time.Time) {
+	t.Helper()
+	f.clock = at
+	if err := f.queue.tick(); err != nil {
+		t.Fatalf("tick() error = %v", err)
+	}
+	f.queue.wg.Wait()
+}
+
+func (f *fixture) get(t *testing.T, id string) *Job {
+	t.Helper()
+	job, err := f.queue.Get(id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	return job
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestJobsRunWithTheirPayload(t *testing.T) {
+	f := newFixture(store.NewMemory(), 2)
+	var got []string
+	f.queue.Register("greet", func(ctx context.Context, job *Job) error {
+		var g greeting
+		if err := job.Decode(&g); err != nil {
+			return err
+		}
+		got = append(got, g.Name)
+		return nil
+	}, Options{})
+
+	if _, err := f.queue.Enqueue("send", greeting{}, EnqueueOptions{}); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("Enqueue() of an unregistered kind error = %v, want ErrUnknownKind", err)
+	}
+	now, err := f.queue.Enqueue("greet", greeting{Name: "Amina"}, EnqueueOptions{})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	later, _ := f.queue.Enqueue("greet", greeting{Name: "Otieno"}, EnqueueOptions{RunAt: f.clock.Add(time.Hour)})
+
+	f.runAt(t, f.clock)
+	if len(got) != 1 || got[0] != "Amina" {
+		t.Fatalf("ran %v, want only the job due now", got)
+	}
+	if job := f.get(t, now.ID); job.Status != StatusSucceeded || job.Attempts != 1 || job.FinishedAt.IsZero() {
+		t.Errorf("finished job = %+v", job)
+	}
+	f.runAt(t, f.clock.Add(time.Hour))
+	if job := f.get(t, later.ID); job.Status != StatusSucceeded || len(got) != 2 {
+		t.Errorf("delayed job = %+v, ran %v", job, got)
+	}
+}
+
+func TestFailedJobsBackOffThenDie(t *testing.T) {
+	f := newFixture(store.NewMemory(), 1)
+	f.queue.Register("flaky", func(context.Context, *Job) error {
+		return errors.New("gateway timeout")
+	}, Options{MaxAttempts: 3, Backoff: time.Minute})
+	job, _ := f.queue.Enqueue("flaky", nil, EnqueueOptions{})
+
+	start := f.clock
+	f.runAt(t, start)
+	if got := f.get(t, job.ID); got.Status != StatusQueued || !got.RunAt.Equal(start.Add(time.Minute)) || got.LastError != "gateway timeout" {
+		t.Fatalf("after one failure = %+v", got)
+	}
+	f.runAt(t, start.Add(59*time.Second))
+	if got := f.get(t, job.ID); got.Attempts != 1 {
+		t.Fatalf("retried before the backoff: %+v", got)
+	}
+	f.runAt(t, start.Add(time.Minute))
+	if got := f.get(t, job.ID); !got.RunAt.Equal(start.Add(3 * time.Minute)) {
+		t.Fatalf("second retry at %v, want the backoff doubled", got.RunAt)
+	}
+	f.runAt(t, start.Add(3*time.Minute))
+	if got := f.get(t, job.ID); got.Status != StatusDead || got.Attempts != 3 {
+		t.Fatalf("after three failures = %+v", got)
+	}
+
+	dead, err := f.queue.List(Filter{Status: StatusDead})
+	if err != nil || len(dead) != 1 || dead[0].ID != job.ID {
+		t.Fatalf("List(dead) = %+v, %v", dead, err)
+	}
+	if _, err := f.queue.Retry("job_99"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Retry() of a missing job error = %v, want ErrNotFound", err)
+	}
+	retried, err := f.queue.Retry(job.ID)
+	if err != nil || retried.Status != StatusQueued || retried.Attempts != 0 {
+		t.Fatalf("Retry() = %+v, %v", retried, err)
+	}
+	if _, err := f.queue.Retry(job.ID); !errors.Is(err, ErrNotDead) {
+		t.Errorf("Retry() of a queued job error = %v, want ErrNotDead", err)
+	}
+}
+
+func TestPermanentFailuresAndPanicsAreRecorded(t *testing.T) {
+	f := newFixture(store.NewMemory(), 2)
+	f.queue.Register("strict", func(ctx context.Context, job *Job) error {
+		var g greeting
+		return job.Decode(&g)
+	}, Options{})
+	f.queue.Register("broken", func(context.Context, *Job) error {
+		panic("nil map")
+	}, Options{})
+
+	strict, _ := f.queue.Enqueue("strict", []int{1}, EnqueueOptions{})
+	broken, _ := f.queue.Enqueue("broken", nil, EnqueueOptions{})
+	f.runAt(t, f.clock)
+	if got := f.get(t, strict.ID); got.Status != StatusDead || got.Attempts != 1 {
+		t.Errorf("job with a bad payload = %+v, want dead after one attempt", got)
+	}
+	if got := f.get(t, broken.ID); got.Status != StatusQueued || got.LastError != "panic: nil map" {
+		t.Errorf("job that panicked = %+v", got)
+	}
+}
+
+func TestUniqueJobsAreNotDuplicated(t *testing.T) {
+	f := newFixture(store.NewMemory(), 1)
+	runs := 0
+	f.queue.Register("report", func(context.Context, *Job) error {
+		runs++
+		return nil
+	}, Options{})
+
+	first, _ := f.queue.Enqueue("report", "2026-10", EnqueueOptions{UniqueKey: "2026-10"})
+	again, err := f.queue.Enqueue("report", "2026-10", EnqueueOptions{UniqueKey: "2026-10"})
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("second Enqueue() = %+v, %v; want job %s", again, err, first.ID)
+	}
+	other, _ := f.queue.Enqueue("report", "2026-09", EnqueueOptions{UniqueKey: "2026-09"})
+	if other.ID == first.ID {
+		t.Fatalf("a different key reused job %s", first.ID)
+	}
+
+	f.runAt(t, f.clock)
+	if runs != 1 {
+		t.Fatalf("ran %d jobs, want 1 with one worker", runs)
+	}
+	f.runAt(t, f.clock)
+	// Once the job has finished its key is free again.
+	rerun, _ := f.queue.Enqueue("report", "2026-10", EnqueueOptions{UniqueKey: "2026-10"})
+	if rerun.ID == first.ID || runs != 2 {
+		t.Errorf("Enqueue() after the job finished = %s, ran %d", rerun.ID, runs)
+	}
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	f := newFixture(store.NewMemory(), 3)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running := map[string]int{}
+	block := func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		running[job.Kind]++
+		mu.Unlock()
+		<-release
+		return nil
+	}
+	f.queue.Register("render", block, Options{Concurrency: 2})
+	f.queue.Register("match", block, Options{})
+	for i := 0; i < 3; i++ {
+		f.queue.Enqueue("render", i, EnqueueOptions{})
+		f.queue.Enqueue("match", i, EnqueueOptions{})
+	}
+
+	if err := f.queue.tick(); err != nil {
+		t.Fatalf("tick() error = %v", err)
+	}
+	// More ticks find no room.
+	f.queue.tick()
+	close(release)
+	f.queue.wg.Wait()
+	if running["render"] != 2 || running["match"] != 1 {
+		t.Errorf("started %v, want 2 render and 1 match", running)
+	}
+	queued, _ := f.queue.List(Filter{Status: StatusQueued})
+	if len(queued) != 3 {
+		t.Errorf("%d jobs still queued, want 3", len(queued))
+	}
+}
+
+func TestDrain(t *testing.T) {
+	f := newFixture(store.NewMemory(), 2)
+	started := make(chan struct{})
+	f.queue.Register("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options{})
+	job, _ := f.queue.Enqueue("slow", nil, EnqueueOptions{})
+	f.queue.tick()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.queue.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain() error = %v, want DeadlineExceeded", err)
+	}
+	// The cut-off job is kept for the next start, and nothing new starts.
+	if got := f.get(t, job.ID); got.Status != StatusQueued || got.LastError != context.Canceled.Error() {
+		t.Errorf("interrupted job = %+v", got)
+	}
+	f.clock = f.clock.Add(time.Hour)
+	if claimed, _ := f.queue.claim(); len(claimed) != 0 {
+		t.Errorf("claimed %d jobs while draining", len(claimed))
+	}
+}
+
+func TestInterruptedJobsAreReclaimedAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	open := func() *fixture {
+		db, err := store.Open(path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		return newFixture(db, 1)
+	}
+	var runs []string
+	handler := func(ctx context.Context, job *Job) error {
+		runs = append(runs, job.ID)
+		return nil
+	}
+
+	// The first server claims the job and stops before running it.
+	first := open()
+	first.queue.Register("mail", handler, Options{Timeout: time.Minute})
+	job, _ := first.queue.Enqueue("mail", nil, EnqueueOptions{})
+	if claimed, err := first.queue.claim(); err != nil || len(claimed) != 1 {
+		t.Fatalf("claim() = %v, %v", claimed, err)
+	}
+
+	second := open()
+	second.queue.Register("mail", handler, Options{Timeout: time.Minute})
+	second.runAt(t, first.clock.Add(time.Minute))
+	if len(runs) != 0 {
+		t.Fatalf("ran %v while the first lease held", runs)
+	}
+	second.runAt(t, first.clock.Add(2*time.Minute+time.Second))
+	second.runAt(t, second.clock.Add(DefaultBackoff))
+	got := second.get(t, job.ID)
+	if fmt.Sprint(runs) != "["+job.ID+"]" || got.Status != StatusSucceeded || got.Attempts != 2 {
+		t.Errorf("after restart ran %v, job = %+v", runs, got)
+	}
+}
+
+func TestPruneKeepsDeadLettersAndRecentJobs(t *testing.T) {
+	f := newFixture(store.NewMemory(), 2)
+	f.queue.Register("greet", func(ctx context.Context, job *Job) error {
+		var g greeting
+		if err := job.Decode(&g); err != nil {
+			return err
+		}
+		if g.Name == "" {
+			return ErrPermanent
+		}
+		return nil
+	}, Options{Concurrency: 2})
+
+	old, _ := f.queue.Enqueue("greet", greeting{Name: "Amina"}, EnqueueOptions{})
+	dead, _ := f.queue.Enqueue("greet", greeting{}, EnqueueOptions{})
+	f.runAt(t, f.clock)
+	recent, _ := f.queue.Enqueue("greet", greeting{Name: "Otieno"}, EnqueueOptions{})
+	f.runAt(t, f.clock.Add(DefaultRetention))
+
+	n, err := f.queue.Prune(f.clock.Add(-time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v; want 1", n, err)
+	}
+	if _, err := f.queue.Get(old.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(pruned) error = %v, want ErrNotFound", err)
+	}
+	if f.get(t, dead.ID).Status != StatusDead || f.get(t, recent.ID).Status != StatusSucceeded {
+		t.Errorf("Prune() removed a dead letter or a recent job")
+	}
+}
@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	firebase "firebase.google.com/go/v4/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/handlers"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// SessionCookie is the cookie the sign-in page stores the ID token in for
+// the server-rendered admin pages.
+const SessionCookie = "authToken"
+
+// TokenVerifier checks Firebase ID tokens, including whether the user has
+// since been disabled or had their sessions revoked, so that disabling or
+// demoting a user takes effect at once. *auth.AuthService implements it.
+type TokenVerifier interface {
+	VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*firebase.Token, error)
+}
+
+// AdminPages protects server-rendered admin pages. Browsers do not send the
+// Authorization header on navigation, so the token may also come from the
+// session cookie. Visitors without a valid token are sent to sign in;
+// signed-in users without the admin role get the forbidden page.
+func AdminPages(verifier TokenVerifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if idToken == "" {
+				if cookie, err := r.Cookie(SessionCookie); err == nil {
+					idToken = cookie.Value
+				}
+			}
+			var token *firebase.Token
+			if idToken != "" {
+				token, _ = verifier.VerifyIDTokenAndCheckRevoked(r.Context(), idToken)
+			}
+			if token == nil {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+
+			ctx := auth.WithToken(r.Context(), token)
+			if auth.RoleFromContext(ctx) != auth.RoleAdmin {
+				handlers.ForbiddenHandler(w, r)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("X-Frame-Options", "DENY")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bufferedResponse holds back what a handler writes until the request has
+// been audited. Headers go straight to the underlying writer's map, which is
+// only sent once the buffered status is written.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// flush sends the held-back response.
+func (b *bufferedResponse) flush() {
+	b.ResponseWriter.WriteHeader(b.status)
+	if _, err := b.ResponseWriter.Write(b.body.Bytes()); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// AuditMutations records every successful request that is not a GET, HEAD
+// or OPTIONS in the audit log, with the signed-in user, request ID and client
+// address. Handlers add the target and what changed with audit.Describe;
+// otherwise the target is taken from ?id=. The response is held back until
+// the entry is recorded, and replaced by an error if it cannot be, so no
+// change is reported as done without a record of it. It must run after
+// AuthMiddleware.
+func AuditMutations(entries *audit.Log) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, described := audit.WithCapture(r.Context())
+			r = r.WithContext(ctx)
+			buf := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(buf, r)
+			if buf.status >= http.StatusBadRequest {
+				buf.flush()
+				return
+			}
+			target, changes := described()
+			if target == "" {
+				target = r.URL.Query().Get("id")
+			}
+			details := map[string]string{"status": strconv.Itoa(buf.status)}
+			if r.URL.RawQuery != "" {
+				details["query"] = r.URL.RawQuery
+			}
+			entry := audit.Entry{
+				Origin:  audit.OriginOf(r),
+				Action:  r.Method + " " + r.URL.Path,
+				Target:  target,
+				Changes: changes,
+				Details: details,
+			}
+			if _, err := entries.Record(entry); err != nil {
+				log.Printf("ERROR: failed to audit %s %s: %v", r.Method, r.URL.Path, err)
+				utils.WriteJSONError(w, http.StatusInternalServerError, "the change could not be recorded in the audit log")
+				return
+			}
+			buf.flush()
+		})
+	}
+}
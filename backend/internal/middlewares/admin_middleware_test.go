@@ -0,0 +1,202 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	firebase "firebase.google.com/go/v4/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/audit"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// tokenTable verifies the tokens it maps to a role. Tokens mapped to
+// "disabled" belong to admins who have since been disabled: their tokens are
+// still valid, but revoked.
+type tokenTable map[string]string
+
+func (tt tokenTable) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*firebase.Token, error) {
+	role, ok := tt[idToken]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	if role == "disabled" {
+		return nil, errors.New("user has been disabled")
+	}
+	return &firebase.Token{UID: idToken, Claims: map[string]interface{}{"role": role}}, nil
+}
+
+func TestAdminPages(t *testing.T) {
+	verifier := tokenTable{"admin1": auth.RoleAdmin, "u1": auth.RoleResident, "admin2": "disabled"}
+	h := AdminPages(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		cookie     string
+		header     string
+		wantStatus int
+	}{
+		{name: "Signed out", wantStatus: http.StatusSeeOther},
+		{name: "Invalid cookie", cookie: "forged", wantStatus: http.StatusSeeOther},
+		{name: "Resident", cookie: "u1", wantStatus: http.StatusForbidden},
+		{name: "Admin cookie", cookie: "admin1", wantStatus: http.StatusOK},
+		{name: "Admin header", header: "Bearer admin1", wantStatus: http.StatusOK},
+		{name: "Disabled admin", cookie: "admin2", wantStatus: http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+			if resp.Code != tt.wantStatus {
+				t.Errorf("expected status %v, got %v", tt.wantStatus, resp.Code)
+			}
+		})
+	}
+}
+
+func TestStaffAuth(t *testing.T) {
+	verifier := tokenTable{"admin1": auth.RoleAdmin, "admin2": "disabled"}
+	h := ChainMiddlewares(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), RequireRole(auth.RoleAdmin), StaffAuth(verifier))
+
+	for token, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"admin1":        http.StatusUnauthorized,
+		"Bearer admin1": http.StatusOK,
+		"Bearer admin2": http.StatusUnauthorized,
+		"Bearer forged": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/routes", nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		if resp.Code != want {
+			t.Errorf("Authorization %q: status = %d, want %d", token, resp.Code, want)
+		}
+	}
+}
+
+func TestCheckStaffRevoked(t *testing.T) {
+	verifier := tokenTable{"admin1": auth.RoleAdmin, "admin2": "disabled"}
+	h := CheckStaffRevoked(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Each token claims the role it was issued with; AuthMiddleware does not
+	// see that admin2 has since been disabled.
+	for _, tt := range []struct {
+		token, role string
+		want        int
+	}{
+		{"u1", auth.RoleResident, http.StatusOK},
+		{"admin1", auth.RoleAdmin, http.StatusOK},
+		{"admin2", auth.RoleAdmin, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/pickups/status", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		req = req.WithContext(auth.WithToken(req.Context(), &firebase.Token{UID: tt.token, Claims: map[string]interface{}{"role": tt.role}}))
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		if resp.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.token, resp.Code, tt.want)
+		}
+	}
+}
+
+func TestAuditMutations(t *testing.T) {
+	entries := audit.NewLog(store.NewMemory())
+	h := RequestID(AuditMutations(entries)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		audit.Describe(r.Context(), "phones", map[string]bool{"active": true}, map[string]bool{"active": false})
+	})))
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/admin/routes", nil),
+		httptest.NewRequest(http.MethodPost, "/api/admin/fraud/cases/resolve?fail=1", nil),
+		httptest.NewRequest(http.MethodPut, "/api/admin/items/categories", nil),
+	} {
+		req.Header.Set(RequestIDHeader, "req-1")
+		req = req.WithContext(auth.WithToken(req.Context(), &firebase.Token{UID: "admin1", Claims: map[string]interface{}{"role": auth.RoleAdmin}}))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	list, _ := entries.List(audit.Filter{})
+	if len(list) != 1 {
+		t.Fatalf("audit entries = %+v, want only the successful PUT", list)
+	}
+	e := list[0]
+	if e.Action != "PUT /api/admin/items/categories" || e.Target != "phones" || e.Actor != "admin1" || e.Role != auth.RoleAdmin ||
+		e.RequestID != "req-1" || e.IP != "192.0.2.1" || len(e.Changes) != 1 {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
+
+func TestAuditMutationsFailsWhenNotRecorded(t *testing.T) {
+	// A file takes the place of the store's directory, so no entry can be recorded.
+	dir := filepath.Join(t.TempDir(), "data")
+	db, err := store.Open(filepath.Join(dir, "store.json"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	h := AuditMutations(audit.NewLog(db))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"phones"}`))
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/admin/items/categories", nil))
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "phones") {
+		t.Errorf("response = %d %s, want the unaudited change reported as failed", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = audit.RequestIDFromContext(r.Context())
+	}))
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "Generated", incoming: "", keep: false},
+		{name: "From proxy", incoming: "abc-123", keep: true},
+		{name: "Malformed", incoming: "<script>", keep: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+			if seen == "" || resp.Header().Get(RequestIDHeader) != seen || (seen == tt.incoming) != tt.keep {
+				t.Errorf("request ID = %q, header %q", seen, resp.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+}
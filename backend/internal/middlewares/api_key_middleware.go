@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/apikeys"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// APIKeyHeader carries a partner API key. Keys may also be sent as the
+// bearer token of the Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+// KeyAuthenticator checks partner API keys. *apikeys.Service implements it.
+type KeyAuthenticator interface {
+	Authenticate(raw string) (*apikeys.Key, error)
+}
+
+// PartnerKeys authenticates partner systems by API key and holds each key
+// to its own rate limit.
+type PartnerKeys struct {
+	keys     KeyAuthenticator
+	sessions TokenVerifier
+	now      func() time.Time
+	mu       sync.Mutex
+	limiters map[int]*RateLimiter // by requests per minute, shared by keys with that limit
+}
+
+// NewPartnerKeys creates a PartnerKeys that checks keys with keys and the ID
+// tokens of signed-in partner accounts with sessions.
+func NewPartnerKeys(keys KeyAuthenticator, sessions TokenVerifier) *PartnerKeys {
+	return &PartnerKeys{keys: keys, sessions: sessions, now: time.Now, limiters: map[int]*RateLimiter{}}
+}
+
+// limiter returns the rate limiter for keys allowed perMinute requests.
+func (p *PartnerKeys) limiter(perMinute int) *RateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.limiters[perMinute]
+	if l == nil {
+		l = NewRateLimiter(perMinute, time.Minute)
+		l.now = p.now
+		p.limiters[perMinute] = l
+	}
+	return l
+}
+
+// apiKey returns the API key r carries, or "".
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); strings.HasPrefix(bearer, apikeys.Prefix) {
+		return bearer
+	}
+	return ""
+}
+
+// UserOrKey lets the request through with either a partner API key or, as
+// StaffAuth does, a Firebase ID token that has not been revoked. Partner
+// systems are stored on the context with auth.WithClient and act with the
+// partner role.
+func (p *PartnerKeys) UserOrKey(next http.Handler) http.Handler {
+	users := StaffAuth(p.sessions)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := apiKey(r)
+		if raw == "" {
+			users.ServeHTTP(w, r)
+			return
+		}
+		key, err := p.keys.Authenticate(raw)
+		if errors.Is(err, apikeys.ErrKeyExpired) {
+			http.Error(w, "API key has expired", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, apikeys.ErrPartnerInactive) {
+			http.Error(w, "API key's partner is no longer certified", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if ok, wait := p.limiter(key.RateLimit).Allow(key.ID); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			utils.WriteJSONError(w, http.StatusTooManyRequests, "rate limit for this API key exceeded, please slow down")
+			return
+		}
+		ctx := auth.WithClient(r.Context(), &auth.Client{KeyID: key.ID, PartnerID: key.PartnerID, Scopes: key.Scopes})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireScope only lets partner systems through if their key has the read
+// scope, for GET and HEAD requests, or the write scope otherwise. Signed-in
+// users are not limited by scopes. It must run after UserOrKey.
+func RequireScope(read, write string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, ok := auth.ClientFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			scope := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = read
+			}
+			for _, s := range client.Scopes {
+				if s == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "API key lacks the "+scope+" scope", http.StatusForbidden)
+		})
+	}
+}
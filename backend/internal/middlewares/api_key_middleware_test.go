@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/apikeys"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKeys knows a fixed set of keys.
+type fakeKeys map[string]*apikeys.Key
+
+func (f fakeKeys) Authenticate(raw string) (*apikeys.Key, error) {
+	if raw == "zk_expired" {
+		return nil, apikeys.ErrKeyExpired
+	}
+	if key, ok := f[raw]; ok {
+		return key, nil
+	}
+	return nil, apikeys.ErrInvalidKey
+}
+
+func TestPartnerKeys(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	keys := NewPartnerKeys(fakeKeys{
+		"zk_reader": {ID: "key_1", PartnerID: "weee", Scopes: []string{apikeys.ScopeWebhooksRead}, RateLimit: 2},
+		"zk_writer": {ID: "key_2", PartnerID: "weee", Scopes: apikeys.Scopes, RateLimit: 2},
+	}, tokenTable{"partner1": auth.RolePartner, "partner2": "disabled"})
+	keys.now = func() time.Time { return now }
+	handler := ChainMiddlewares(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.UIDFromContext(r.Context()) + " " + auth.PartnerIDFromContext(r.Context())))
+	}), RequireScope(apikeys.ScopeWebhooksRead, apikeys.ScopeWebhooksWrite), RequireRole(auth.RolePartner), keys.UserOrKey)
+	request := func(method string, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/partner/webhooks", nil)
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	ok := request(http.MethodGet, APIKeyHeader, "zk_reader")
+	assert.Equal(t, http.StatusOK, ok.Code)
+	assert.Equal(t, "key:key_1 weee", ok.Body.String())
+
+	// Keys are also accepted as bearer tokens.
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "Authorization", "Bearer zk_writer").Code)
+
+	forbidden := request(http.MethodPost, APIKeyHeader, "zk_reader")
+	assert.Equal(t, http.StatusForbidden, forbidden.Code)
+	assert.Contains(t, forbidden.Body.String(), apikeys.ScopeWebhooksWrite)
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, APIKeyHeader, "zk_unknown").Code)
+	expired := request(http.MethodGet, APIKeyHeader, "zk_expired")
+	assert.Equal(t, http.StatusUnauthorized, expired.Code)
+	assert.Contains(t, expired.Body.String(), "expired")
+
+	// Each key has its own allowance: key_1 has used both of its requests.
+	limited := request(http.MethodGet, APIKeyHeader, "zk_reader")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "30", limited.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, APIKeyHeader, "zk_writer").Code)
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, APIKeyHeader, "zk_reader").Code)
+
+	// Partner accounts sign in with ID tokens, which are checked for revocation.
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "Authorization", "Bearer partner1").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "Authorization", "Bearer partner2").Code)
+}
+
+func TestRequireScopeIgnoresUsers(t *testing.T) {
+	handler := RequireScope(apikeys.ScopeWebhooksRead, apikeys.ScopeWebhooksWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/partner/webhooks", nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
@@ -37,7 +37,73 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Add the verified user info to the request context
-		ctx := context.WithValue(r.Context(), "user", token)
+		ctx := context.WithValue(r.Context(), auth.UserContextKey, token)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// StaffAuth is AuthMiddleware for the collector, admin and partner API: it also
+// rejects tokens of users who have been disabled, or whose role has changed,
+// since the token was issued.
+func StaffAuth(verifier TokenVerifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				return
+			}
+			idToken := strings.TrimPrefix(authHeader, "Bearer ")
+			if idToken == authHeader {
+				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+				return
+			}
+			token, err := verifier.VerifyIDTokenAndCheckRevoked(r.Context(), idToken)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+		})
+	}
+}
+
+// CheckStaffRevoked runs after AuthMiddleware on routes open to every user.
+// When the token carries a role other than resident, it verifies the token
+// again as StaffAuth does, so a collector, admin or partner who has been
+// disabled or demoted loses the extra powers of the role at once. Residents
+// are spared the extra lookup.
+func CheckStaffRevoked(verifier TokenVerifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if role := auth.RoleFromContext(r.Context()); role == auth.RoleResident {
+				next.ServeHTTP(w, r)
+				return
+			}
+			idToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			token, err := verifier.VerifyIDTokenAndCheckRevoked(r.Context(), idToken)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+		})
+	}
+}
+
+// RequireRole only lets the request through if the authenticated user has one
+// of the given roles. It must run after AuthMiddleware.
+func RequireRole(roles ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := auth.RoleFromContext(r.Context())
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		})
+	}
+}
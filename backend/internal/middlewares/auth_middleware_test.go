@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	firebase "firebase.google.com/go/v4/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -110,3 +112,31 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireRole(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		withToken  bool
+		wantStatus int
+	}{
+		{name: "Admin allowed", claims: map[string]interface{}{"role": "admin"}, withToken: true, wantStatus: http.StatusOK},
+		{name: "Resident forbidden", claims: nil, withToken: true, wantStatus: http.StatusForbidden},
+		{name: "No token", withToken: false, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/test", nil)
+			if tt.withToken {
+				req = req.WithContext(auth.WithToken(req.Context(), &firebase.Token{UID: "u1", Claims: tt.claims}))
+			}
+			rr := httptest.NewRecorder()
+			RequireRole(auth.RoleAdmin)(ok).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
@@ -18,6 +18,19 @@ var routes = map[string]struct {
 	"/signup":    {RequiresAuth: false},
 	"/login":     {RequiresAuth: false},
 	"/dashboard": {RequiresAuth: true},
+	// The partner portal loads its data from the partner API, which checks
+	// the signed-in account.
+	"/partner": {RequiresAuth: false},
+	// Admin console pages authenticate themselves via AdminPages, which
+	// also accepts the session cookie.
+	"/admin":              {RequiresAuth: false},
+	"/admin/users":        {RequiresAuth: false},
+	"/admin/pickups":      {RequiresAuth: false},
+	"/admin/partners":     {RequiresAuth: false},
+	"/admin/catalogue":    {RequiresAuth: false},
+	"/admin/audit":        {RequiresAuth: false},
+	"/admin/audit/export": {RequiresAuth: false},
+	"/admin/compliance":   {RequiresAuth: false},
 }
 
 // Supported static file extensions
@@ -73,6 +86,12 @@ func RouteChecker(next http.Handler) http.Handler {
 			return
 		}
 
+		// API endpoints authenticate themselves via AuthMiddleware
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		if route, exists := routes[r.URL.Path]; exists {
 			if route.RequiresAuth && !isAuthenticated(r) {
 				handlers.ForbiddenHandler(w, r)
@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/utils"
+)
+
+// RateLimiter allows each client a burst of requests that refills evenly
+// over a window. Clients are identified by their remote IP address.
+type RateLimiter struct {
+	burst  float64
+	rate   float64 // requests per second
+	now    func() time.Time
+	mu     sync.Mutex
+	bucket map[string]*tokenBucket
+	swept  time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	seen   time.Time
+}
+
+// NewRateLimiter allows limit requests per window from each client.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		burst:  float64(limit),
+		rate:   float64(limit) / window.Seconds(),
+		now:    time.Now,
+		bucket: map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token for client and reports whether one was available.
+// When it was not, it also returns how long until the next one is.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b := l.bucket[client]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, seen: now}
+		l.bucket[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.seen).Seconds()*l.rate)
+	b.seen = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets have refilled, at most once a minute,
+// so the map does not grow with every address ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.bucket {
+		if now.Sub(b.seen) >= full {
+			delete(l.bucket, client)
+		}
+	}
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, wait := l.Allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			utils.WriteJSONError(w, http.StatusTooManyRequests, "too many requests, please slow down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+)
+
+// AfricasTalkingConfig holds the credentials of an Africa's Talking app.
+// SenderID is the registered short code or alphanumeric sender, if any.
+type AfricasTalkingConfig struct {
+	BaseURL  string
+	Username string
+	APIKey   string
+	SenderID string
+}
+
+// Africa's Talking recipient status codes. 100 to 102 mean the message was
+// accepted; the rest are failures, some of which no retry will fix.
+var atPermanentStatuses = map[int]bool{
+	403: true, // InvalidPhoneNumber
+	404: true, // UnsupportedNumberType
+	406: true, // UserInBlacklist
+}
+
+// AfricasTalkingProvider sends SMS through the Africa's Talking messaging API.
+type AfricasTalkingProvider struct {
+	config AfricasTalkingConfig
+	client *http.Client
+}
+
+// NewAfricasTalkingProvider creates an Africa's Talking client.
+func NewAfricasTalkingProvider(config AfricasTalkingConfig) *AfricasTalkingProvider {
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &AfricasTalkingProvider{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Channel reports that the provider delivers SMS.
+func (p *AfricasTalkingProvider) Channel() string {
+	return ChannelSMS
+}
+
+// messagingResponse is the body returned by POST /version1/messaging.
+type messagingResponse struct {
+	SMSMessageData struct {
+		Message    string `json:"Message"`
+		Recipients []struct {
+			StatusCode int    `json:"statusCode"`
+			Number     string `json:"number"`
+			Status     string `json:"status"`
+			MessageID  string `json:"messageId"`
+		} `json:"Recipients"`
+	} `json:"SMSMessageData"`
+}
+
+// Send texts msg.Text to the Kenyan number msg.To.
+func (p *AfricasTalkingProvider) Send(ctx context.Context, msg Message) error {
+	phone, ok := payments.NormalizePhone(msg.To)
+	if !ok {
+		return fmt.Errorf("%w: invalid phone number %q", ErrPermanent, msg.To)
+	}
+	form := url.Values{
+		"username": {p.config.Username},
+		"to":       {"+" + phone},
+		"message":  {msg.Text},
+	}
+	if p.config.SenderID != "" {
+		form.Set("from", p.config.SenderID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+"/version1/messaging", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("apiKey", p.config.APIKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Africa's Talking: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: Africa's Talking rejected the request", ErrPermanent)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Africa's Talking returned status %d", resp.StatusCode)
+	}
+
+	var body messagingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("error decoding Africa's Talking response: %w", err)
+	}
+	recipients := body.SMSMessageData.Recipients
+	if len(recipients) == 0 {
+		return fmt.Errorf("Africa's Talking sent to no one: %s", body.SMSMessageData.Message)
+	}
+	r := recipients[0]
+	switch {
+	case r.StatusCode >= 100 && r.StatusCode <= 102:
+		return nil
+	case atPermanentStatuses[r.StatusCode]:
+		return fmt.Errorf("%w: %s (%d)", ErrPermanent, r.Status, r.StatusCode)
+	default:
+		return fmt.Errorf("Africa's Talking could not send: %s (%d)", r.Status, r.StatusCode)
+	}
+}
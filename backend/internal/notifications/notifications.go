@@ -0,0 +1,776 @@
+// Package notifications tells residents about their pickups by email and SMS.
+// Notifications are stored in the same transaction as the change they
+// announce, along with a background job per channel that sends them; the job
+// queue retries failed sends with backoff, so a provider outage delays
+// messages rather than losing them.
+package notifications
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the notifications module.
+const (
+	notificationsBucket = "notifications"
+	keysBucket          = "notification_keys"
+	preferencesBucket   = "notification_preferences"
+	verificationsBucket = "notification_verifications"
+)
+
+// VerificationTTL is how long a code sent to confirm a new address is valid.
+// A code can be tried maxVerifyAttempts times.
+const (
+	VerificationTTL   = 30 * time.Minute
+	maxVerifyAttempts = 5
+)
+
+// Delivery states.
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	// StatusSkipped marks a delivery that could not be attempted because
+	// the recipient has no address for its channel.
+	StatusSkipped = "skipped"
+)
+
+// DeliverKind is the job kind of sending a notification on one channel.
+const DeliverKind = "notifications.deliver"
+
+// DeliveryOptions is the retry schedule: a failed delivery is tried again
+// after 2, 4, 8, ... minutes, at most 6 hours apart, 8 times in all, and
+// then given up on.
+var DeliveryOptions = jobs.Options{
+	Concurrency: 4,
+	MaxAttempts: 8,
+	Backoff:     2 * time.Minute,
+	MaxBackoff:  6 * time.Hour,
+	Timeout:     time.Minute,
+}
+
+var (
+	// ErrUnknownTemplate is returned when asked to send a template that does not exist.
+	ErrUnknownTemplate = errors.New("unknown notification template")
+	// ErrInvalidPreferences is returned when notification preferences fail validation.
+	ErrInvalidPreferences = errors.New("invalid notification preferences")
+	// ErrInvalidCode is returned for a wrong, expired or used verification code.
+	ErrInvalidCode = errors.New("invalid or expired verification code")
+)
+
+// Preferences are how a user wants to be contacted. Email and Phone override
+// the address on their account once verified: a new address waits in
+// PendingEmail or PendingPhone until the code sent to it is entered. Muted
+// lists optional templates they do not want to receive.
+type Preferences struct {
+	UserID       string    `json:"user_id"`
+	Email        string    `json:"email,omitempty"`
+	Phone        string    `json:"phone,omitempty"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	PendingPhone string    `json:"pending_phone,omitempty"`
+	Channels     []string  `json:"channels"`
+	Muted        []string  `json:"muted"`
+	UpdatedAt    time.Time `json:"updated_at,omitempty"`
+}
+
+func (p Preferences) has(channel string) bool {
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Preferences) muted(template string) bool {
+	for _, m := range p.Muted {
+		if m == template {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is the attempt to send a notification on one channel. To is the
+// address it was last sent to, resolved when it is attempted so that
+// changes to the user's details still apply to queued messages.
+type Delivery struct {
+	Channel   string    `json:"channel"`
+	To        string    `json:"to,omitempty"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	SentAt    time.Time `json:"sent_at,omitempty"`
+}
+
+// deliveryJob is the payload of a DeliverKind job.
+type deliveryJob struct {
+	NotificationID string `json:"notification_id"`
+	Channel        string `json:"channel"`
+}
+
+// Notification is one message to a user, rendered from Template and Data
+// and delivered on each channel they have enabled. Address, when set, is
+// the only address it is sent to, as for verification codes.
+type Notification struct {
+	ID         string            `json:"id"`
+	UserID     string            `json:"user_id"`
+	Template   string            `json:"template"`
+	Key        string            `json:"key"`
+	Address    string            `json:"address,omitempty"`
+	Data       map[string]string `json:"data"`
+	Deliveries []Delivery        `json:"deliveries"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// delivery returns n's delivery on channel, or nil if it has none.
+func (n *Notification) delivery(channel string) *Delivery {
+	for i := range n.Deliveries {
+		if n.Deliveries[i].Channel == channel {
+			return &n.Deliveries[i]
+		}
+	}
+	return nil
+}
+
+// pending reports whether any delivery of n has yet to succeed or be given up on.
+func (n *Notification) pending() bool {
+	for _, d := range n.Deliveries {
+		if d.Status == StatusPending {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter selects notifications. Status matches notifications with at least
+// one delivery in that state.
+type Filter struct {
+	UserID string
+	Status string
+	Limit  int
+}
+
+func (f Filter) match(n *Notification) bool {
+	if f.UserID != "" && n.UserID != f.UserID {
+		return false
+	}
+	if f.Status == "" {
+		return true
+	}
+	for _, d := range n.Deliveries {
+		if d.Status == f.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// Directory looks up the account a notification is for, for its name and
+// default contact details.
+type Directory interface {
+	User(ctx context.Context, uid string) (*auth.User, error)
+}
+
+// Service stores and delivers notifications.
+type Service struct {
+	store     *store.Store
+	queue     *jobs.Queue
+	directory Directory
+	providers map[string]Provider
+	renderer  *renderer
+	now       func() time.Time
+}
+
+// NewService creates a notification service that sends through queue and
+// providers, at most one per channel. Channels without a provider are not
+// offered.
+func NewService(s *store.Store, queue *jobs.Queue, directory Directory, providers ...Provider) (*Service, error) {
+	r, err := newRenderer()
+	if err != nil {
+		return nil, err
+	}
+	byChannel := map[string]Provider{}
+	for _, p := range providers {
+		byChannel[p.Channel()] = p
+	}
+	svc := &Service{store: s, queue: queue, directory: directory, providers: byChannel, renderer: r, now: time.Now}
+	queue.Register(DeliverKind, svc.deliver, DeliveryOptions)
+	return svc, nil
+}
+
+// Notify stores a notification for uid in its own transaction.
+func (s *Service) Notify(uid, template, key string, data map[string]string) (*Notification, error) {
+	var n *Notification
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		n, err = s.NotifyTx(tx, uid, template, key, data)
+		return err
+	})
+	return n, err
+}
+
+// NotifyTx stores a notification for uid inside tx, to be delivered once tx
+// commits. Key makes the call idempotent: the notification already stored
+// under it is returned instead of a second one. It returns nil when the user
+// has muted the template or has no channel it can be sent on.
+func (s *Service) NotifyTx(tx *store.Tx, uid, template, key string, data map[string]string) (*Notification, error) {
+	t, ok := lookupTemplate(template)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTemplate, template)
+	}
+	var existingID string
+	if err := tx.Get(keysBucket, key, &existingID); err == nil {
+		return getTx(tx, existingID)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	prefs, err := preferencesTx(tx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Optional && prefs.muted(template) {
+		return nil, nil
+	}
+	now := s.now().UTC()
+	var deliveries []Delivery
+	for _, channel := range Channels {
+		if prefs.has(channel) && s.providers[channel] != nil {
+			deliveries = append(deliveries, Delivery{Channel: channel, Status: StatusPending})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	seq, err := tx.NextSequence(notificationsBucket)
+	if err != nil {
+		return nil, err
+	}
+	n := &Notification{
+		ID:         fmt.Sprintf("ntf_%d", seq),
+		UserID:     uid,
+		Template:   template,
+		Key:        key,
+		Data:       data,
+		Deliveries: deliveries,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := tx.Insert(keysBucket, key, n.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Insert(notificationsBucket, n.ID, n); err != nil {
+		return nil, err
+	}
+	return n, s.enqueueTx(tx, n)
+}
+
+// enqueueTx queues a job for each pending delivery of n. A delivery already
+// queued is not queued twice.
+func (s *Service) enqueueTx(tx *store.Tx, n *Notification) error {
+	for _, d := range n.Deliveries {
+		if d.Status != StatusPending {
+			continue
+		}
+		_, err := s.queue.EnqueueTx(tx, DeliverKind, deliveryJob{NotificationID: n.ID, Channel: d.Channel},
+			jobs.EnqueueOptions{UniqueKey: n.ID + ":" + d.Channel})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getTx(tx *store.Tx, id string) (*Notification, error) {
+	var n Notification
+	if err := tx.Get(notificationsBucket, id, &n); err != nil {
+		return nil, fmt.Errorf("error loading notification %s: %w", id, err)
+	}
+	return &n, nil
+}
+
+// List returns the notifications matching filter, newest first, up to
+// filter.Limit when it is set.
+func (s *Service) List(filter Filter) ([]Notification, error) {
+	list := []Notification{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(notificationsBucket, func(key string, raw json.RawMessage) error {
+			var n Notification
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return fmt.Errorf("error decoding notification %s: %w", key, err)
+			}
+			if filter.match(&n) {
+				list = append(list, n)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		// IDs share a prefix, so the longer one was numbered later.
+		if len(a.ID) != len(b.ID) {
+			return len(a.ID) > len(b.ID)
+		}
+		return a.ID > b.ID
+	})
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+	return list, nil
+}
+
+// Preferences returns the preferences uid has saved, or the defaults.
+func (s *Service) Preferences(uid string) (Preferences, error) {
+	var prefs Preferences
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		prefs, err = preferencesTx(tx, uid)
+		return err
+	})
+	return prefs, err
+}
+
+// preferencesTx returns uid's preferences. Until they choose, users get
+// every channel and every template.
+func preferencesTx(tx *store.Tx, uid string) (Preferences, error) {
+	var prefs Preferences
+	err := tx.Get(preferencesBucket, uid, &prefs)
+	if errors.Is(err, store.ErrNotFound) {
+		return Preferences{UserID: uid, Channels: append([]string(nil), Channels...), Muted: []string{}}, nil
+	}
+	return prefs, err
+}
+
+// SetPreferences validates and saves uid's preferences. Phone numbers are
+// stored in the 2547XXXXXXXX form. A new email address or phone number is
+// not used until it is verified: it is kept as pending and a code is sent to
+// it for VerifyContact. Asking for the verified address again cancels a
+// pending change; an empty one goes back to the address on the account.
+func (s *Service) SetPreferences(uid string, prefs Preferences) (Preferences, error) {
+	prefs.UserID = uid
+	prefs.Email = strings.TrimSpace(prefs.Email)
+	if prefs.Email != "" {
+		addr, err := mail.ParseAddress(prefs.Email)
+		if err != nil || addr.Address != prefs.Email {
+			return Preferences{}, fmt.Errorf("%w: %q is not an email address", ErrInvalidPreferences, prefs.Email)
+		}
+	}
+	if phone := strings.TrimSpace(prefs.Phone); phone != "" {
+		normalized, ok := payments.NormalizePhone(phone)
+		if !ok {
+			return Preferences{}, fmt.Errorf("%w: %q is not a Kenyan mobile number", ErrInvalidPreferences, phone)
+		}
+		prefs.Phone = normalized
+	}
+
+	chosen := map[string]bool{}
+	for _, c := range prefs.Channels {
+		if c != ChannelEmail && c != ChannelSMS {
+			return Preferences{}, fmt.Errorf("%w: unknown channel %q", ErrInvalidPreferences, c)
+		}
+		chosen[c] = true
+	}
+	prefs.Channels = []string{}
+	for _, c := range Channels {
+		if chosen[c] {
+			prefs.Channels = append(prefs.Channels, c)
+		}
+	}
+	if len(prefs.Channels) == 0 {
+		return Preferences{}, fmt.Errorf("%w: at least one channel is required", ErrInvalidPreferences)
+	}
+
+	muted := map[string]bool{}
+	for _, name := range prefs.Muted {
+		t, ok := lookupTemplate(name)
+		if !ok {
+			return Preferences{}, fmt.Errorf("%w: unknown notification %q", ErrInvalidPreferences, name)
+		}
+		if !t.Optional {
+			return Preferences{}, fmt.Errorf("%w: %s cannot be muted", ErrInvalidPreferences, name)
+		}
+		muted[name] = true
+	}
+	prefs.Muted = []string{}
+	for _, t := range Templates {
+		if muted[t.Name] {
+			prefs.Muted = append(prefs.Muted, t.Name)
+		}
+	}
+
+	prefs.UpdatedAt = s.now().UTC()
+	err := s.store.Update(func(tx *store.Tx) error {
+		current, err := preferencesTx(tx, uid)
+		if err != nil {
+			return err
+		}
+		for _, c := range []struct {
+			channel                   string
+			requested                 string
+			verified, pending, target *string
+		}{
+			{ChannelEmail, prefs.Email, &current.Email, &current.PendingEmail, &prefs.PendingEmail},
+			{ChannelSMS, prefs.Phone, &current.Phone, &current.PendingPhone, &prefs.PendingPhone},
+		} {
+			switch c.requested {
+			case "":
+				*c.verified, *c.target = "", ""
+				if err := tx.Delete(verificationsBucket, uid+":"+c.channel); err != nil {
+					return err
+				}
+			case *c.verified:
+				*c.target = ""
+				if err := tx.Delete(verificationsBucket, uid+":"+c.channel); err != nil {
+					return err
+				}
+			case *c.pending:
+				*c.target = *c.pending
+			default:
+				*c.target = c.requested
+				if err := s.sendCodeTx(tx, uid, c.channel, c.requested); err != nil {
+					return err
+				}
+			}
+		}
+		prefs.Email, prefs.Phone = current.Email, current.Phone
+		return tx.Put(preferencesBucket, uid, prefs)
+	})
+	if err != nil {
+		return Preferences{}, err
+	}
+	return prefs, nil
+}
+
+// verification is a code sent to confirm a new address. Only a hash of the
+// code is kept.
+type verification struct {
+	Address   string    `json:"address"`
+	CodeHash  string    `json:"code_hash"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func hashCode(uid, channel, code string) string {
+	sum := sha256.Sum256([]byte(uid + ":" + channel + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendCodeTx replaces any code pending for uid's channel with a new one and
+// queues a notification sending it to address alone.
+func (s *Service) sendCodeTx(tx *store.Tx, uid, channel, address string) error {
+	if s.providers[channel] == nil {
+		return fmt.Errorf("%w: %s is not available", ErrInvalidPreferences, channel)
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	now := s.now().UTC()
+	v := verification{Address: address, CodeHash: hashCode(uid, channel, code), ExpiresAt: now.Add(VerificationTTL)}
+	if err := tx.Put(verificationsBucket, uid+":"+channel, v); err != nil {
+		return err
+	}
+
+	seq, err := tx.NextSequence(notificationsBucket)
+	if err != nil {
+		return err
+	}
+	notification := &Notification{
+		ID:         fmt.Sprintf("ntf_%d", seq),
+		UserID:     uid,
+		Template:   TemplateVerifyContact,
+		Key:        fmt.Sprintf("%s:%s:%d", TemplateVerifyContact, uid, seq),
+		Address:    address,
+		Data:       map[string]string{"code": code},
+		Deliveries: []Delivery{{Channel: channel, Status: StatusPending}},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := tx.Insert(keysBucket, notification.Key, notification.ID); err != nil {
+		return err
+	}
+	if err := tx.Insert(notificationsBucket, notification.ID, notification); err != nil {
+		return err
+	}
+	return s.enqueueTx(tx, notification)
+}
+
+// VerifyContact confirms the pending address for channel with the code sent
+// to it, after which notifications go there.
+func (s *Service) VerifyContact(uid, channel, code string) (Preferences, error) {
+	var prefs Preferences
+	verified := false
+	err := s.store.Update(func(tx *store.Tx) error {
+		key := uid + ":" + channel
+		var v verification
+		if err := tx.Get(verificationsBucket, key, &v); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !s.now().Before(v.ExpiresAt) {
+			return tx.Delete(verificationsBucket, key)
+		}
+		if subtle.ConstantTimeCompare([]byte(hashCode(uid, channel, strings.TrimSpace(code))), []byte(v.CodeHash)) != 1 {
+			// Failed attempts are kept, so the error is reported after commit.
+			if v.Attempts++; v.Attempts >= maxVerifyAttempts {
+				return tx.Delete(verificationsBucket, key)
+			}
+			return tx.Put(verificationsBucket, key, v)
+		}
+
+		var err error
+		if prefs, err = preferencesTx(tx, uid); err != nil {
+			return err
+		}
+		switch {
+		case channel == ChannelEmail && prefs.PendingEmail == v.Address:
+			prefs.Email, prefs.PendingEmail = v.Address, ""
+		case channel == ChannelSMS && prefs.PendingPhone == v.Address:
+			prefs.Phone, prefs.PendingPhone = v.Address, ""
+		default:
+			return tx.Delete(verificationsBucket, key)
+		}
+		verified = true
+		prefs.UpdatedAt = s.now().UTC()
+		if err := tx.Delete(verificationsBucket, key); err != nil {
+			return err
+		}
+		return tx.Put(preferencesBucket, uid, prefs)
+	})
+	if err != nil {
+		return Preferences{}, err
+	}
+	if !verified {
+		return Preferences{}, ErrInvalidCode
+	}
+	return prefs, nil
+}
+
+// deliver runs a DeliverKind job: it sends a notification on one channel
+// and records the outcome, leaving the job queue to retry failures on
+// DeliveryOptions' schedule. Providers are called outside any transaction
+// so a slow gateway does not block the store.
+func (s *Service) deliver(ctx context.Context, job *jobs.Job) error {
+	var task deliveryJob
+	if err := job.Decode(&task); err != nil {
+		return err
+	}
+	var n *Notification
+	var prefs Preferences
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		if n, err = getTx(tx, task.NotificationID); err != nil {
+			return err
+		}
+		prefs, err = preferencesTx(tx, n.UserID)
+		return err
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("%w: %v", jobs.ErrPermanent, err)
+	}
+	if err != nil {
+		return err
+	}
+	// A dead letter retried by an admin sends a failed delivery again.
+	if d := n.delivery(task.Channel); d == nil || (d.Status != StatusPending && d.Status != StatusFailed) {
+		return nil
+	}
+
+	data := map[string]string{"name": "there"}
+	for k, v := range n.Data {
+		data[k] = v
+	}
+	var user *auth.User
+	var lookupErr error
+	if s.directory != nil {
+		user, lookupErr = s.directory.User(ctx, n.UserID)
+		if user != nil && user.DisplayName != "" {
+			data["name"] = user.DisplayName
+		}
+	}
+	to := prefs.Email
+	if task.Channel == ChannelSMS {
+		to = prefs.Phone
+	}
+	if n.Address != "" {
+		to = n.Address
+	}
+	if to == "" && user != nil {
+		to = user.Email
+		if task.Channel == ChannelSMS {
+			to = user.Phone
+		}
+	}
+	var sendErr error
+	switch {
+	case to == "" && lookupErr != nil:
+		sendErr = lookupErr
+	case to != "":
+		sendErr = s.send(ctx, n.Template, task.Channel, to, data)
+	}
+
+	now := s.now().UTC()
+	permanent := errors.Is(sendErr, ErrPermanent)
+	final := sendErr == nil || permanent || job.Attempts >= job.MaxAttempts
+	err = s.store.Update(func(tx *store.Tx) error {
+		current, err := getTx(tx, n.ID)
+		if err != nil {
+			return err
+		}
+		d := current.delivery(task.Channel)
+		switch {
+		case to == "" && sendErr == nil:
+			d.Status = StatusSkipped
+			d.LastError = "no " + d.Channel + " address on file"
+		case sendErr == nil:
+			d.To = to
+			d.Attempts++
+			d.Status = StatusSent
+			d.SentAt = now
+			d.LastError = ""
+		default:
+			d.To = to
+			d.Attempts++
+			d.Status = StatusPending
+			if final {
+				d.Status = StatusFailed
+			}
+			d.LastError = sendErr.Error()
+		}
+		// A verification code is only kept until it has been sent.
+		if current.Template == TemplateVerifyContact && !current.pending() {
+			delete(current.Data, "code")
+		}
+		current.UpdatedAt = now
+		return tx.Put(notificationsBucket, current.ID, current)
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case sendErr == nil:
+		return nil
+	case permanent:
+		return fmt.Errorf("%w: %w", jobs.ErrPermanent, sendErr)
+	case final:
+		log.Printf("Giving up on %s notification %s: %v", task.Channel, n.ID, sendErr)
+	}
+	return sendErr
+}
+
+// Backfill queues the pending deliveries of every notification, such as
+// those stored before deliveries ran on the job queue, and returns how many
+// notifications had some. Deliveries already queued keep their job.
+func (s *Service) Backfill() (int, error) {
+	count := 0
+	err := s.store.Update(func(tx *store.Tx) error {
+		var pending []*Notification
+		err := tx.ForEach(notificationsBucket, func(key string, raw json.RawMessage) error {
+			var n Notification
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return fmt.Errorf("error decoding notification %s: %w", key, err)
+			}
+			if n.pending() {
+				pending = append(pending, &n)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, n := range pending {
+			if err := s.enqueueTx(tx, n); err != nil {
+				return err
+			}
+		}
+		count = len(pending)
+		return nil
+	})
+	return count, err
+}
+
+// send renders the template for channel and hands it to the channel's provider.
+func (s *Service) send(ctx context.Context, template, channel, to string, data map[string]string) error {
+	provider := s.providers[channel]
+	if provider == nil {
+		return fmt.Errorf("%w: no %s provider is configured", ErrPermanent, channel)
+	}
+	msg, err := s.renderer.render(template, channel, data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	msg.To = to
+	return provider.Send(ctx, msg)
+}
+
+// OnPickupTransition is a pickups.Listener that tells the resident when a
+// pickup is booked, assigned, collected or cancelled.
+func (s *Service) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	var template string
+	switch {
+	case p.Status == pickups.StatusScheduled && from == "":
+		template = TemplatePickupScheduled
+	case p.Status == pickups.StatusAssigned:
+		template = TemplatePickupAssigned
+	case p.Status == pickups.StatusCollected:
+		template = TemplatePickupCollected
+	case p.Status == pickups.StatusCancelled:
+		template = TemplatePickupCancelled
+	default:
+		return nil
+	}
+	// Each transition is announced once, even if a pickup passes through
+	// the same status twice.
+	key := fmt.Sprintf("%s:%s:%d", template, p.ID, len(p.History))
+	_, err := s.NotifyTx(tx, p.UserID, template, key, PickupData(p))
+	return err
+}
+
+// PickupData is the template data describing p.
+func PickupData(p *pickups.Pickup) map[string]string {
+	date := p.Date
+	if d, err := time.Parse("2006-01-02", p.Date); err == nil {
+		date = d.Format("Monday 2 January")
+	}
+	items := make([]string, 0, len(p.Items))
+	for _, item := range p.Items {
+		items = append(items, fmt.Sprintf("%d x %s", item.Quantity, item.Category))
+	}
+	return map[string]string{
+		"pickup_id": p.ID,
+		"date":      date,
+		"time_slot": p.TimeSlot,
+		"address":   p.Address,
+		"items":     strings.Join(items, ", "),
+	}
+}
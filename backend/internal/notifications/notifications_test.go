@@ -0,0 +1,390 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// fakeProvider records what it sends and fails with the queued errors first.
+type fakeProvider struct {
+	channel string
+
+	mu     sync.Mutex
+	errs   []error
+	sent   []Message
+	called int
+}
+
+func (p *fakeProvider) Channel() string { return p.channel }
+
+func (p *fakeProvider) Send(ctx context.Context, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.called++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return err
+	}
+	p.sent = append(p.sent, msg)
+	return nil
+}
+
+type fakeDirectory map[string]auth.User
+
+func (d fakeDirectory) User(ctx context.Context, uid string) (*auth.User, error) {
+	u, ok := d[uid]
+	if !ok {
+		return nil, errors.New("no such user")
+	}
+	return &u, nil
+}
+
+type fixture struct {
+	svc   *Service
+	queue *jobs.Queue
+	email *fakeProvider
+	sms   *fakeProvider
+	clock time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{
+		email: &fakeProvider{channel: ChannelEmail},
+		sms:   &fakeProvider{channel: ChannelSMS},
+		clock: time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+	}
+	directory := fakeDirectory{
+		"amina":  {UID: "amina", DisplayName: "Amina", Email: "amina@example.com", Phone: "+254712345678"},
+		"otieno": {UID: "otieno", Email: "otieno@example.com"},
+	}
+	db := store.NewMemory()
+	f.queue = jobs.NewQueue(db, 2)
+	svc, err := NewService(db, f.queue, directory, f.email, f.sms)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	svc.now = func() time.Time { return f.clock }
+	f.svc = svc
+	// Retry quickly so tests do not wait out the real schedule.
+	f.queue.Register(DeliverKind, svc.deliver, jobs.Options{Concurrency: 2, MaxAttempts: DeliveryOptions.MaxAttempts, Backoff: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	go f.queue.Run(ctx, 5*time.Millisecond)
+	t.Cleanup(func() {
+		cancel()
+		f.queue.Drain(context.Background())
+	})
+	return f
+}
+
+var pickupData = map[string]string{
+	"pickup_id": "pk_1", "date": "Monday 2 November", "time_slot": "morning",
+	"address": "Kilimani <Nairobi>", "items": "2 x laptops", "rating_url": "https://zingiratech.co.ke/dashboard?rate=pk_1",
+}
+
+// settle waits until every queued delivery has been sent or given up on.
+func (f *fixture) settle(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		queued, _ := f.queue.List(jobs.Filter{Status: jobs.StatusQueued})
+		running, _ := f.queue.List(jobs.Filter{Status: jobs.StatusRunning})
+		if len(queued)+len(running) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries still queued: %+v %+v", queued, running)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestNotifyIsIdempotent(t *testing.T) {
+	f := newFixture(t)
+	first, err := f.svc.Notify("amina", TemplatePickupScheduled, "k1", pickupData)
+	if err != nil || first == nil {
+		t.Fatalf("Notify() = %v, %v", first, err)
+	}
+	again, err := f.svc.Notify("amina", TemplatePickupScheduled, "k1", pickupData)
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("repeated Notify() = %v, %v; want %s", again, err, first.ID)
+	}
+	if _, err := f.svc.Notify("amina", "no_such_template", "k2", nil); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Notify(unknown) error = %v, want ErrUnknownTemplate", err)
+	}
+
+	f.settle(t)
+	if len(f.email.sent) != 1 || len(f.sms.sent) != 1 {
+		t.Fatalf("sent %d emails and %d texts, want 1 each", len(f.email.sent), len(f.sms.sent))
+	}
+
+	email := f.email.sent[0]
+	if email.To != "amina@example.com" || !strings.Contains(email.Subject, "Monday 2 November") {
+		t.Errorf("unexpected email %+v", email)
+	}
+	if !strings.Contains(email.Text, "Hello Amina") || !strings.Contains(email.Text, "Kilimani <Nairobi>") {
+		t.Errorf("text body = %q", email.Text)
+	}
+	if !strings.Contains(email.HTML, "Kilimani &lt;Nairobi&gt;") {
+		t.Errorf("HTML body does not escape data: %q", email.HTML)
+	}
+	if sms := f.sms.sent[0]; sms.To != "+254712345678" || !strings.Contains(sms.Text, "pk_1") || sms.Subject != "" {
+		t.Errorf("unexpected SMS %+v", sms)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	f := newFixture(t)
+	prefs, err := f.svc.Preferences("amina")
+	if err != nil || len(prefs.Channels) != 2 {
+		t.Fatalf("default Preferences() = %+v, %v", prefs, err)
+	}
+
+	invalid := []Preferences{
+		{Channels: []string{}},
+		{Channels: []string{"pigeon"}},
+		{Channels: []string{ChannelEmail}, Email: "not an address"},
+		{Channels: []string{ChannelSMS}, Phone: "12345"},
+		{Channels: []string{ChannelEmail}, Muted: []string{TemplatePickupCancelled}},
+	}
+	for _, p := range invalid {
+		if _, err := f.svc.SetPreferences("amina", p); !errors.Is(err, ErrInvalidPreferences) {
+			t.Errorf("SetPreferences(%+v) error = %v, want ErrInvalidPreferences", p, err)
+		}
+	}
+
+	saved, err := f.svc.SetPreferences("amina", Preferences{
+		Channels: []string{ChannelSMS, ChannelSMS},
+		Phone:    "0798 765 432",
+		Muted:    []string{TemplatePickupAssigned},
+	})
+	if err != nil {
+		t.Fatalf("SetPreferences() error = %v", err)
+	}
+	if saved.Phone != "" || saved.PendingPhone != "254798765432" || len(saved.Channels) != 1 || saved.Channels[0] != ChannelSMS {
+		t.Errorf("unexpected saved preferences %+v", saved)
+	}
+
+	if n, err := f.svc.Notify("amina", TemplatePickupAssigned, "muted", pickupData); err != nil || n != nil {
+		t.Errorf("muted Notify() = %+v, %v; want nothing", n, err)
+	}
+	if _, err := f.svc.Notify("amina", TemplatePickupCancelled, "required", pickupData); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	f.settle(t)
+	// The code goes to the new number; everything else waits until it is verified.
+	if len(f.email.sent) != 0 || len(f.sms.sent) != 2 {
+		t.Fatalf("sent emails %+v and texts %+v, want two texts", f.email.sent, f.sms.sent)
+	}
+	var code string
+	for _, sms := range f.sms.sent {
+		switch sms.To {
+		case "254798765432":
+			code = strings.Fields(strings.SplitAfter(sms.Text, "code is ")[1])[0]
+			code = strings.TrimSuffix(code, ".")
+		case "+254712345678":
+		default:
+			t.Errorf("text sent to %s", sms.To)
+		}
+	}
+	if len(code) != 6 {
+		t.Fatalf("no verification code was sent: %+v", f.sms.sent)
+	}
+	if list, _ := f.svc.List(Filter{UserID: "amina"}); strings.Contains(list[len(list)-1].Data["code"], code) {
+		t.Errorf("the sent code is still stored: %+v", list[len(list)-1])
+	}
+
+	if _, err := f.svc.VerifyContact("amina", ChannelSMS, "000000x"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("VerifyContact(wrong code) error = %v, want ErrInvalidCode", err)
+	}
+	if _, err := f.svc.VerifyContact("otieno", ChannelSMS, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("VerifyContact(another user) error = %v, want ErrInvalidCode", err)
+	}
+	verified, err := f.svc.VerifyContact("amina", ChannelSMS, code)
+	if err != nil || verified.Phone != "254798765432" || verified.PendingPhone != "" {
+		t.Fatalf("VerifyContact() = %+v, %v", verified, err)
+	}
+	if _, err := f.svc.VerifyContact("amina", ChannelSMS, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("reused VerifyContact() error = %v, want ErrInvalidCode", err)
+	}
+
+	if _, err := f.svc.Notify("amina", TemplatePickupCancelled, "verified", pickupData); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	f.settle(t)
+	if last := f.sms.sent[len(f.sms.sent)-1]; last.To != "254798765432" {
+		t.Errorf("text sent to %s, want the verified number", last.To)
+	}
+}
+
+func TestVerificationCodesExpireAndLockOut(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.svc.SetPreferences("amina", Preferences{Channels: []string{ChannelEmail}, Email: "new@example.com"}); err != nil {
+		t.Fatalf("SetPreferences() error = %v", err)
+	}
+	for i := 0; i < maxVerifyAttempts; i++ {
+		f.svc.VerifyContact("amina", ChannelEmail, "wrong")
+	}
+	f.settle(t)
+	code := strings.TrimSuffix(strings.Fields(strings.SplitAfter(f.email.sent[0].Text, "code is ")[1])[0], ".")
+	if _, err := f.svc.VerifyContact("amina", ChannelEmail, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("VerifyContact() after too many attempts error = %v, want ErrInvalidCode", err)
+	}
+
+	// Asking again sends a new code, which expires.
+	if _, err := f.svc.SetPreferences("amina", Preferences{Channels: []string{ChannelEmail}, Email: "newer@example.com"}); err != nil {
+		t.Fatalf("SetPreferences() error = %v", err)
+	}
+	f.settle(t)
+	code = strings.TrimSuffix(strings.Fields(strings.SplitAfter(f.email.sent[1].Text, "code is ")[1])[0], ".")
+	f.clock = f.clock.Add(VerificationTTL)
+	if _, err := f.svc.VerifyContact("amina", ChannelEmail, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("VerifyContact() after expiry error = %v, want ErrInvalidCode", err)
+	}
+	if prefs, _ := f.svc.Preferences("amina"); prefs.Email != "" || prefs.PendingEmail != "newer@example.com" {
+		t.Errorf("Preferences() = %+v", prefs)
+	}
+}
+
+func TestFailedDeliveriesAreRetried(t *testing.T) {
+	f := newFixture(t)
+	f.email.errs = []error{errors.New("relay unavailable"), errors.New("relay unavailable")}
+	for i := 0; i < DeliveryOptions.MaxAttempts; i++ {
+		f.sms.errs = append(f.sms.errs, errors.New("gateway down"))
+	}
+
+	n, err := f.svc.Notify("amina", TemplatePickupScheduled, "k1", pickupData)
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	f.settle(t)
+	if len(f.email.sent) != 1 {
+		t.Errorf("email sent %d times, want 1", len(f.email.sent))
+	}
+	if f.sms.called != DeliveryOptions.MaxAttempts || len(f.sms.sent) != 0 {
+		t.Errorf("SMS attempted %d times and sent %d, want %d attempts and none sent", f.sms.called, len(f.sms.sent), DeliveryOptions.MaxAttempts)
+	}
+
+	list, err := f.svc.List(Filter{UserID: "amina"})
+	if err != nil || len(list) != 1 || list[0].ID != n.ID {
+		t.Fatalf("List() = %+v, %v", list, err)
+	}
+	for _, d := range list[0].Deliveries {
+		switch d.Channel {
+		case ChannelEmail:
+			if d.Status != StatusSent || d.Attempts != 3 || d.SentAt.IsZero() {
+				t.Errorf("email delivery %+v", d)
+			}
+		case ChannelSMS:
+			if d.Status != StatusFailed || d.LastError != "gateway down" {
+				t.Errorf("SMS delivery %+v", d)
+			}
+		}
+	}
+	if failed, _ := f.svc.List(Filter{Status: StatusFailed}); len(failed) != 1 {
+		t.Errorf("List(failed) returned %d notifications, want 1", len(failed))
+	}
+	if dead, _ := f.queue.List(jobs.Filter{Kind: DeliverKind, Status: jobs.StatusDead}); len(dead) != 1 {
+		t.Errorf("dead letters = %+v, want the SMS", dead)
+	}
+}
+
+func TestPermanentFailuresAreNotRetried(t *testing.T) {
+	f := newFixture(t)
+	f.email.errs = []error{ErrPermanent}
+	if _, err := f.svc.Notify("otieno", TemplatePickupCancelled, "k1", pickupData); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	f.settle(t)
+
+	list, _ := f.svc.List(Filter{UserID: "otieno"})
+	statuses := map[string]string{}
+	for _, d := range list[0].Deliveries {
+		statuses[d.Channel] = d.Status
+	}
+	// Otieno has no phone number, so the text is skipped rather than retried.
+	if statuses[ChannelEmail] != StatusFailed || statuses[ChannelSMS] != StatusSkipped {
+		t.Errorf("delivery statuses = %v", statuses)
+	}
+	if f.email.called != 1 || f.sms.called != 0 {
+		t.Errorf("providers called %d and %d times, want 1 and 0", f.email.called, f.sms.called)
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	r, err := newRenderer()
+	if err != nil {
+		t.Fatalf("newRenderer() error = %v", err)
+	}
+	data := map[string]string{"name": "Amina", "code": "123456"}
+	for k, v := range pickupData {
+		data[k] = v
+	}
+	for _, tmpl := range Templates {
+		for _, channel := range Channels {
+			msg, err := r.render(tmpl.Name, channel, data)
+			if err != nil {
+				t.Errorf("render(%s, %s) error = %v", tmpl.Name, channel, err)
+				continue
+			}
+			if channel == ChannelSMS && (msg.Text == "" || len(msg.Text) > 160) {
+				t.Errorf("%s SMS is %d characters: %q", tmpl.Name, len(msg.Text), msg.Text)
+			}
+			if channel == ChannelEmail && (msg.Subject == "" || msg.Text == "" || msg.HTML == "") {
+				t.Errorf("%s email is incomplete: %+v", tmpl.Name, msg)
+			}
+		}
+	}
+	if _, err := r.render(TemplatePickupScheduled, ChannelSMS, map[string]string{}); err == nil {
+		t.Error("render() with missing data succeeded")
+	}
+}
+
+func TestOnPickupTransition(t *testing.T) {
+	f := newFixture(t)
+	pickupService := pickups.NewService(f.svc.store)
+	pickupService.Subscribe(f.svc.OnPickupTransition)
+
+	p, err := pickupService.Create("amina", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "laptops", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := pickupService.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if _, err := pickupService.Transition(p.ID, pickups.StatusScheduled, "admin"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	if _, err := pickupService.Assign(p.ID, "col2", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	list, err := f.svc.List(Filter{UserID: "amina"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var templates []string
+	for i := len(list) - 1; i >= 0; i-- {
+		templates = append(templates, list[i].Template)
+	}
+	want := []string{TemplatePickupScheduled, TemplatePickupAssigned, TemplatePickupAssigned}
+	if strings.Join(templates, ",") != strings.Join(want, ",") {
+		t.Errorf("notified %v, want %v", templates, want)
+	}
+	if list[0].Data["date"] != "Monday 2 November" || list[0].Data["items"] != "2 x laptops" {
+		t.Errorf("unexpected pickup data %v", list[0].Data)
+	}
+}
@@ -0,0 +1,34 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+)
+
+// Channels a notification can be delivered on.
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Channels lists every channel, in the order deliveries are attempted.
+var Channels = []string{ChannelEmail, ChannelSMS}
+
+// ErrPermanent wraps provider errors that retrying cannot fix, such as an
+// address the provider refuses. Deliveries that fail with it are not retried.
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Message is a rendered notification addressed to one recipient. SMS
+// providers send Text and ignore Subject and HTML.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Provider delivers messages on one channel.
+type Provider interface {
+	Channel() string
+	Send(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,319 @@
+// Package sandbox provides local stand-ins for the notification providers: an
+// SMTP sink that accepts any email and an Africa's Talking mock that accepts
+// any SMS. Both keep what they receive, so notifications can be developed
+// and tested without credentials or network access.
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// APIKey is the only API key the SMS mock accepts.
+const APIKey = "sandbox-api-key"
+
+// Mail is an email received by the SMTP sink. Data is the message exactly
+// as sent, headers included.
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Data    string
+}
+
+// SMTPSink is an SMTP server that accepts every message and keeps it.
+type SMTPSink struct {
+	// Echo, when true, logs the recipients and subject of every message
+	// received, so deliveries can be followed during development. Bodies
+	// are never logged: they can hold verification codes.
+	Echo bool
+
+	mu       sync.Mutex
+	messages []Mail
+	reject   map[string]bool
+}
+
+// NewSMTPSink creates an empty sink.
+func NewSMTPSink() *SMTPSink {
+	return &SMTPSink{reject: map[string]bool{}}
+}
+
+// Start serves the sink on a free local port and returns its host:port.
+func (s *SMTPSink) Start() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("error starting SMTP sink: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("SMTP sink stopped: %v", err)
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+// Reject makes the sink refuse mail for address with a permanent 550 reply,
+// as a relay does for a mailbox that does not exist.
+func (s *SMTPSink) Reject(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject[strings.ToLower(address)] = true
+}
+
+// Messages returns the messages received so far, oldest first.
+func (s *SMTPSink) Messages() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.messages...)
+}
+
+// serve speaks just enough SMTP for net/smtp: no extensions are offered,
+// so clients send plain text without TLS or authentication.
+func (s *SMTPSink) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(code int, msg string) { text.PrintfLine("%d %s", code, msg) }
+
+	reply(220, "sandbox ESMTP ready")
+	var current Mail
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO", "EHLO":
+			reply(250, "sandbox")
+		case "MAIL":
+			current = Mail{From: address(arg)}
+			reply(250, "OK")
+		case "RCPT":
+			to := address(arg)
+			s.mu.Lock()
+			rejected := s.reject[strings.ToLower(to)]
+			s.mu.Unlock()
+			if rejected {
+				reply(550, "mailbox unavailable")
+				continue
+			}
+			current.To = append(current.To, to)
+			reply(250, "OK")
+		case "DATA":
+			if len(current.To) == 0 {
+				reply(503, "need RCPT first")
+				continue
+			}
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			current.Data = string(data)
+			current.Subject = subject(current.Data)
+			s.keep(current)
+			current = Mail{}
+			reply(250, "OK: queued")
+		case "RSET":
+			current = Mail{}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+func (s *SMTPSink) keep(m Mail) {
+	s.mu.Lock()
+	s.messages = append(s.messages, m)
+	s.mu.Unlock()
+	if s.Echo {
+		log.Printf("SMTP sink: email to %s: %s", strings.Join(m.To, ", "), m.Subject)
+	}
+}
+
+// address extracts the address from a "FROM:<a@b>" or "TO:<a@b>" argument.
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// subject returns the decoded Subject header of a raw message.
+func subject(data string) string {
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(data)))
+	if err != nil {
+		return ""
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return msg.Header.Get("Subject")
+	}
+	return decoded
+}
+
+// SMS is a text message received by the SMS mock.
+type SMS struct {
+	Username string
+	To       string
+	From     string
+	Message  string
+}
+
+// SMSServer mimics the Africa's Talking messaging endpoint used by
+// notifications.AfricasTalkingProvider.
+type SMSServer struct {
+	// Echo, when true, logs the recipient and length of every message
+	// received, but never its text.
+	Echo bool
+
+	mu       sync.Mutex
+	seq      int
+	messages []SMS
+	outages  int
+	statuses map[string]int
+}
+
+// NewSMSServer creates an empty SMS mock.
+func NewSMSServer() *SMSServer {
+	return &SMSServer{statuses: map[string]int{}}
+}
+
+// Start serves the mock on a free local port and returns its base URL.
+func (s *SMSServer) Start() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("error starting SMS sandbox: %w", err)
+	}
+	go func() {
+		if err := http.Serve(listener, s.Handler()); err != nil {
+			log.Printf("SMS sandbox stopped: %v", err)
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Handler returns the mock's HTTP handler.
+func (s *SMSServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version1/messaging", s.messaging)
+	return mux
+}
+
+// FailNext makes the next n requests fail with a 500, as during an outage.
+func (s *SMSServer) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outages = n
+}
+
+// SetStatus makes messages to number, in +254... form, report the given
+// Africa's Talking recipient status code, e.g. 403 for InvalidPhoneNumber.
+func (s *SMSServer) SetStatus(number string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[number] = code
+}
+
+// Messages returns the messages accepted so far, oldest first.
+func (s *SMSServer) Messages() []SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMS(nil), s.messages...)
+}
+
+func (s *SMSServer) messaging(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("apiKey") != APIKey {
+		http.Error(w, "The supplied authentication is invalid", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("username") == "" || r.PostForm.Get("to") == "" || r.PostForm.Get("message") == "" {
+		http.Error(w, "Request is missing required form field", http.StatusBadRequest)
+		return
+	}
+	sms := SMS{
+		Username: r.PostForm.Get("username"),
+		To:       r.PostForm.Get("to"),
+		From:     r.PostForm.Get("from"),
+		Message:  r.PostForm.Get("message"),
+	}
+
+	s.mu.Lock()
+	if s.outages > 0 {
+		s.outages--
+		s.mu.Unlock()
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	code, ok := s.statuses[sms.To]
+	if !ok {
+		code = 101
+	}
+	s.seq++
+	id := fmt.Sprintf("ATXid_sandbox_%d", s.seq)
+	if code == 101 {
+		s.messages = append(s.messages, sms)
+	}
+	s.mu.Unlock()
+	if code == 101 && s.Echo {
+		log.Printf("SMS sandbox: text to %s (%d characters)", sms.To, len(sms.Message))
+	}
+
+	status, cost, sent := statusName(code), "KES 0.8000", 1
+	if code != 101 {
+		cost, sent = "0", 0
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"SMSMessageData": map[string]interface{}{
+			"Message": fmt.Sprintf("Sent to %d/1 Total Cost: %s", sent, cost),
+			"Recipients": []map[string]interface{}{{
+				"statusCode": code,
+				"number":     sms.To,
+				"status":     status,
+				"cost":       cost,
+				"messageId":  id,
+			}},
+		},
+	})
+}
+
+func statusName(code int) string {
+	switch code {
+	case 101:
+		return "Success"
+	case 403:
+		return "InvalidPhoneNumber"
+	case 405:
+		return "InsufficientBalance"
+	case 406:
+		return "UserInBlacklist"
+	default:
+		return "GatewayError"
+	}
+}
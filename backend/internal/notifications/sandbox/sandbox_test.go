@@ -0,0 +1,88 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/notifications"
+)
+
+func TestSMTPProviderDeliversToSink(t *testing.T) {
+	sink := NewSMTPSink()
+	addr, err := sink.Start()
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	provider := notifications.NewSMTPProvider(notifications.SMTPConfig{Addr: addr, From: "ZingiraTech <no-reply@zingiratech.co.ke>"})
+
+	err = provider.Send(context.Background(), notifications.Message{
+		To: "amina@example.com", Subject: "Pickup booked for Jumatatu", Text: "Hello Amina", HTML: "<p>Hello Amina</p>",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	messages := sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	m := messages[0]
+	if m.From != "no-reply@zingiratech.co.ke" || len(m.To) != 1 || m.To[0] != "amina@example.com" {
+		t.Errorf("unexpected envelope %+v", m)
+	}
+	if m.Subject != "Pickup booked for Jumatatu" {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if !strings.Contains(m.Data, "multipart/alternative") || !strings.Contains(m.Data, "<p>Hello Amina</p>") {
+		t.Errorf("message is not multipart with an HTML part:\n%s", m.Data)
+	}
+
+	sink.Reject("nobody@example.com")
+	err = provider.Send(context.Background(), notifications.Message{To: "nobody@example.com", Subject: "s", Text: "t"})
+	if !errors.Is(err, notifications.ErrPermanent) {
+		t.Errorf("Send() to a rejected mailbox error = %v, want ErrPermanent", err)
+	}
+}
+
+func TestAfricasTalkingProviderAgainstMock(t *testing.T) {
+	server := NewSMSServer()
+	mock := httptest.NewServer(server.Handler())
+	t.Cleanup(mock.Close)
+	provider := notifications.NewAfricasTalkingProvider(notifications.AfricasTalkingConfig{
+		BaseURL: mock.URL, Username: "sandbox", APIKey: APIKey, SenderID: "ZINGIRA",
+	})
+	send := func(to string) error {
+		return provider.Send(context.Background(), notifications.Message{To: to, Text: "ZingiraTech: pickup booked."})
+	}
+
+	if err := send("0712 345 678"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := server.Messages()
+	if len(got) != 1 || got[0].To != "+254712345678" || got[0].From != "ZINGIRA" || got[0].Username != "sandbox" {
+		t.Fatalf("unexpected messages %+v", got)
+	}
+
+	server.FailNext(1)
+	if err := send("0712345678"); err == nil || errors.Is(err, notifications.ErrPermanent) {
+		t.Errorf("Send() during an outage error = %v, want a retryable error", err)
+	}
+	if err := send("0712345678"); err != nil {
+		t.Errorf("Send() after the outage error = %v", err)
+	}
+
+	server.SetStatus("+254799999999", 403)
+	if err := send("0799999999"); !errors.Is(err, notifications.ErrPermanent) {
+		t.Errorf("Send() to an invalid number error = %v, want ErrPermanent", err)
+	}
+	if err := send("12345"); !errors.Is(err, notifications.ErrPermanent) {
+		t.Errorf("Send() to a malformed number error = %v, want ErrPermanent", err)
+	}
+
+	wrongKey := notifications.NewAfricasTalkingProvider(notifications.AfricasTalkingConfig{BaseURL: mock.URL, Username: "sandbox", APIKey: "wrong"})
+	if err := wrongKey.Send(context.Background(), notifications.Message{To: "0712345678", Text: "hi"}); err == nil {
+		t.Error("Send() with a wrong API key succeeded")
+	}
+}
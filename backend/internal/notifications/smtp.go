@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// SMTPConfig holds the address and credentials of an SMTP relay. From is the
+// sender shown to residents, e.g. "ZingiraTech <no-reply@zingiratech.co.ke>".
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPProvider sends email through an SMTP relay, upgrading to TLS when the
+// relay offers STARTTLS.
+type SMTPProvider struct {
+	config  SMTPConfig
+	timeout time.Duration
+	now     func() time.Time
+}
+
+// NewSMTPProvider creates an SMTP client.
+func NewSMTPProvider(config SMTPConfig) *SMTPProvider {
+	return &SMTPProvider{config: config, timeout: 30 * time.Second, now: time.Now}
+}
+
+// Channel reports that the provider delivers email.
+func (p *SMTPProvider) Channel() string {
+	return ChannelEmail
+}
+
+// Send delivers msg to a single recipient. Addresses the relay rejects with
+// a 5xx reply are reported as permanent failures.
+func (p *SMTPProvider) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(p.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", p.config.From, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: invalid email address %q", ErrPermanent, msg.To)
+	}
+	body, err := p.compose(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.config.Addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP relay: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	host, _, _ := net.SplitHostPort(p.config.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error greeting SMTP relay: %w", err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("error starting TLS with SMTP relay: %w", err)
+		}
+	}
+	if p.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", p.config.Username, p.config.Password, host)); err != nil {
+			return fmt.Errorf("error authenticating with SMTP relay: %w", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return smtpError(err)
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return smtpError(err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("error writing email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	return c.Quit()
+}
+
+// compose builds the email, as multipart/alternative when msg has an HTML body.
+func (p *SMTPProvider) compose(from, to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", p.now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuoted(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuoted(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuoted(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// smtpError marks 5xx replies, which the relay will give again, as permanent.
+func smtpError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return fmt.Errorf("SMTP relay error: %w", err)
+}
@@ -0,0 +1,115 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Notification templates. Each is defined in templates/<name>.tmpl as
+// "<name>.subject", "<name>.text" and "<name>.html" for email and
+// "<name>.sms" for SMS.
+const (
+	TemplatePickupScheduled  = "pickup_scheduled"
+	TemplatePickupAssigned   = "pickup_assigned"
+	TemplatePickupCollected  = "pickup_collected"
+	TemplatePickupCancelled  = "pickup_cancelled"
+	TemplateReminderDay      = "pickup_reminder_day"
+	TemplateReminderHour     = "pickup_reminder_hour"
+	TemplateCollectorOverdue = "collector_overdue"
+	TemplateRatingRequest    = "rating_request"
+	TemplateVerifyContact    = "contact_verification"
+)
+
+// Template describes a kind of notification to the people receiving it.
+// Optional ones can be muted; the rest are always sent.
+type Template struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Optional    bool   `json:"optional"`
+}
+
+// Templates lists every notification, in the order preferences show them.
+var Templates = []Template{
+	{Name: TemplatePickupScheduled, Description: "Confirmation when you book a pickup"},
+	{Name: TemplatePickupAssigned, Description: "When a collector is assigned to your pickup", Optional: true},
+	{Name: TemplatePickupCollected, Description: "When your items have been collected", Optional: true},
+	{Name: TemplatePickupCancelled, Description: "When a pickup is cancelled"},
+	{Name: TemplateReminderDay, Description: "A reminder the day before your pickup", Optional: true},
+	{Name: TemplateReminderHour, Description: "A reminder an hour before your pickup", Optional: true},
+	{Name: TemplateRatingRequest, Description: "A request to rate the service after a pickup", Optional: true},
+	{Name: TemplateCollectorOverdue, Description: "For collectors: when an assigned pickup is overdue"},
+	{Name: TemplateVerifyContact, Description: "A code to confirm a new email address or phone number"},
+}
+
+// lookupTemplate returns the template called name.
+func lookupTemplate(name string) (Template, bool) {
+	for _, t := range Templates {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// renderer renders messages from the bundled templates. Subjects, plain text
+// and SMS use text/template; HTML bodies use html/template so the data is
+// escaped.
+type renderer struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func newRenderer() (*renderer, error) {
+	text, err := texttemplate.New("notifications").Option("missingkey=error").ParseFS(templateFiles, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing notification templates: %w", err)
+	}
+	html, err := htmltemplate.New("notifications").Option("missingkey=error").ParseFS(templateFiles, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing notification templates: %w", err)
+	}
+	for _, t := range Templates {
+		for _, part := range []string{".subject", ".text", ".html", ".sms"} {
+			if text.Lookup(t.Name+part) == nil {
+				return nil, fmt.Errorf("notification template %s is missing %q", t.Name, t.Name+part)
+			}
+		}
+	}
+	return &renderer{text: text, html: html}, nil
+}
+
+// render builds the message for one channel from the template called name.
+func (r *renderer) render(name, channel string, data map[string]string) (Message, error) {
+	if channel == ChannelSMS {
+		sms, err := r.execText(name+".sms", data)
+		return Message{Text: sms}, err
+	}
+	subject, err := r.execText(name+".subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := r.execText(name+".text", data)
+	if err != nil {
+		return Message{}, err
+	}
+	var html bytes.Buffer
+	if err := r.html.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s.html: %w", name, err)
+	}
+	return Message{Subject: subject, Text: text, HTML: strings.TrimSpace(html.String())}, nil
+}
+
+func (r *renderer) execText(name string, data map[string]string) (string, error) {
+	var buf bytes.Buffer
+	if err := r.text.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("error rendering %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
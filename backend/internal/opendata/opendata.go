@@ -0,0 +1,334 @@
+// Package opendata publishes aggregate recycling statistics for researchers
+// and policy makers. Figures are bucketed by month, quarter or year and any
+// cell built from too few households is suppressed, in every bucket that
+// contains it, so no one's recycling can be picked out of the published
+// tables.
+package opendata
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/impact"
+)
+
+// Time buckets the statistics can be grouped into.
+const (
+	BucketMonth   = "month"
+	BucketQuarter = "quarter"
+	BucketYear    = "year"
+)
+
+// Licence is the licence the data is published under.
+const Licence = "CC-BY-4.0"
+
+var (
+	// ErrUnknownDataset is returned for a dataset that is not published.
+	ErrUnknownDataset = errors.New("unknown dataset")
+	// ErrInvalidQuery is returned for an unknown bucket or an inverted period.
+	ErrInvalidQuery = errors.New("invalid open data query")
+)
+
+// Thresholds set how much aggregation a cell needs before it is published.
+// MinHouseholds is the k of k-anonymity.
+type Thresholds struct {
+	MinHouseholds int `json:"min_households"`
+	MinPickups    int `json:"min_pickups"`
+}
+
+// DefaultThresholds are used in production.
+var DefaultThresholds = Thresholds{
+	MinHouseholds: 5,
+	MinPickups:    5,
+}
+
+// Cell is one row of a dataset. The measures are nil when the cell is
+// suppressed.
+type Cell struct {
+	Period     string   `json:"period"`
+	County     string   `json:"county,omitempty"`
+	Category   string   `json:"category,omitempty"`
+	Suppressed bool     `json:"suppressed"`
+	Households *int     `json:"households"`
+	Pickups    *int     `json:"pickups"`
+	Units      *int     `json:"units"`
+	WeightKg   *float64 `json:"weight_kg"`
+	CO2eKg     *float64 `json:"co2e_kg"`
+}
+
+// Table is a dataset over a period.
+type Table struct {
+	Dataset     string     `json:"dataset"`
+	Bucket      string     `json:"bucket"`
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Thresholds  Thresholds `json:"thresholds"`
+	Licence     string     `json:"licence"`
+	GeneratedAt time.Time  `json:"generated_at"`
+	Cells       []Cell     `json:"cells"`
+}
+
+// Service builds the published datasets from pickup impact records.
+type Service struct {
+	impact     *impact.Engine
+	thresholds Thresholds
+	now        func() time.Time
+}
+
+// NewService creates an open data service over the records of engine.
+func NewService(engine *impact.Engine, thresholds Thresholds) *Service {
+	return &Service{impact: engine, thresholds: thresholds, now: time.Now}
+}
+
+// Thresholds returns the suppression thresholds in force.
+func (s *Service) Thresholds() Thresholds {
+	return s.thresholds
+}
+
+// bucketStart returns the start of the bucket containing t.
+func bucketStart(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case BucketQuarter:
+		return time.Date(t.Year(), time.Month((int(t.Month())-1)/3*3+1), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// nextBucket returns the start of the bucket after the one starting at t.
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketMonth:
+		return t.AddDate(0, 1, 0)
+	case BucketQuarter:
+		return t.AddDate(0, 3, 0)
+	default:
+		return t.AddDate(1, 0, 0)
+	}
+}
+
+// periodKey names a bucket: "2026-09", "2026-Q3" or "2026".
+func periodKey(t time.Time, bucket string) string {
+	switch bucket {
+	case BucketMonth:
+		return t.Format("2006-01")
+	case BucketQuarter:
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	default:
+		return t.Format("2006")
+	}
+}
+
+// cell accumulates one cell before suppression.
+type cell struct {
+	Cell
+	start      time.Time
+	households map[string]bool
+	pickups    map[string]bool
+	units      int
+	weightKg   float64
+	co2eKg     float64
+}
+
+// rollUp merges cells into the coarser bucket. A merged cell is suppressed
+// if any cell it is made of was, so the coarser figure minus the published
+// finer ones cannot reveal a suppressed cell.
+func rollUp(cells map[string]*cell, bucket string) map[string]*cell {
+	merged := map[string]*cell{}
+	for _, c := range cells {
+		start := bucketStart(c.start, bucket)
+		period := periodKey(start, bucket)
+		key := period + "/" + c.County + "/" + c.Category
+		acc := merged[key]
+		if acc == nil {
+			acc = &cell{Cell: Cell{Period: period, County: c.County, Category: c.Category}, start: start,
+				households: map[string]bool{}, pickups: map[string]bool{}}
+			merged[key] = acc
+		}
+		for uid := range c.households {
+			acc.households[uid] = true
+		}
+		for id := range c.pickups {
+			acc.pickups[id] = true
+		}
+		acc.units += c.units
+		acc.weightKg += c.weightKg
+		acc.co2eKg += c.co2eKg
+		acc.Suppressed = acc.Suppressed || c.Suppressed
+	}
+	return merged
+}
+
+// Query builds dataset for the buckets overlapping from and to. The period
+// is widened to whole buckets, so that shifting it by a day cannot reveal
+// part of a bucket, and ends before the bucket in progress. Zero times leave
+// the period open.
+func (s *Service) Query(dataset, bucket string, from, to time.Time) (*Table, error) {
+	d, ok := datasetByID(dataset)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownDataset, dataset)
+	}
+	if bucket == "" {
+		bucket = BucketMonth
+	}
+	if bucket != BucketMonth && bucket != BucketQuarter && bucket != BucketYear {
+		return nil, fmt.Errorf("%w: bucket must be month, quarter or year", ErrInvalidQuery)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, fmt.Errorf("%w: the period must end after it starts", ErrInvalidQuery)
+	}
+
+	now := s.now().UTC()
+	current := bucketStart(now, bucket)
+	if !from.IsZero() {
+		from = bucketStart(from, bucket)
+	}
+	if to.IsZero() || !to.Before(current) {
+		to = current
+	} else if start := bucketStart(to, bucket); !start.Equal(to) {
+		to = nextBucket(start, bucket)
+	}
+
+	records, err := s.impact.Records(impact.Filter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	// Cells are built by month and suppressed before being rolled up into
+	// quarters and years, so every bucket hides the same months.
+	cells := map[string]*cell{}
+	add := func(r *impact.Record, county, category string, units int, weight, co2e float64) {
+		start := bucketStart(r.ProcessedAt, BucketMonth)
+		c := Cell{Period: periodKey(start, BucketMonth), County: county, Category: category}
+		key := c.Period + "/" + c.County + "/" + c.Category
+		acc := cells[key]
+		if acc == nil {
+			acc = &cell{Cell: c, start: start, households: map[string]bool{}, pickups: map[string]bool{}}
+			cells[key] = acc
+		}
+		acc.households[r.UserID] = true
+		acc.pickups[r.PickupID] = true
+		acc.units += units
+		acc.weightKg += weight
+		acc.co2eKg += co2e
+	}
+	for i := range records {
+		r := &records[i]
+		county := r.County
+		if county == "" {
+			county = "unknown"
+		}
+		switch d.ID {
+		case DatasetNational:
+			add(r, "", "", units(r), r.Totals.WeightKg, r.Totals.CO2eKg)
+		case DatasetByCounty:
+			add(r, county, "", units(r), r.Totals.WeightKg, r.Totals.CO2eKg)
+		case DatasetByCategory:
+			for _, line := range r.Lines {
+				add(r, "", line.Category, line.Quantity, line.WeightKg, line.CO2eKg)
+			}
+		}
+	}
+
+	s.suppress(cells)
+	if bucket != BucketMonth {
+		cells = rollUp(cells, BucketQuarter)
+		s.suppress(cells)
+	}
+	if bucket == BucketYear {
+		cells = rollUp(cells, BucketYear)
+		s.suppress(cells)
+	}
+
+	table := &Table{
+		Dataset: d.ID, Bucket: bucket, From: from, To: to,
+		Thresholds: s.thresholds, Licence: Licence, GeneratedAt: now,
+		Cells: publish(cells),
+	}
+	if table.From.IsZero() && len(records) > 0 {
+		table.From = bucketStart(records[0].ProcessedAt, bucket)
+	}
+	return table, nil
+}
+
+func units(r *impact.Record) int {
+	n := 0
+	for _, line := range r.Lines {
+		n += line.Quantity
+	}
+	return n
+}
+
+// suppress marks the cells to withhold. A cell below either threshold is
+// suppressed, and within each period further cells are suppressed, smallest
+// first, until the suppressed cells together cover at least MinHouseholds
+// households and MinPickups pickups. Otherwise a suppressed cell could be
+// recovered by subtracting the others from the national figure. Cells
+// already suppressed by rollUp count towards the thresholds.
+func (s *Service) suppress(cells map[string]*cell) {
+	byPeriod := map[string][]*cell{}
+	for _, c := range cells {
+		byPeriod[c.Period] = append(byPeriod[c.Period], c)
+	}
+
+	for _, group := range byPeriod {
+		sort.SliceStable(group, func(i, j int) bool {
+			if len(group[i].households) != len(group[j].households) {
+				return len(group[i].households) < len(group[j].households)
+			}
+			return group[i].County+group[i].Category < group[j].County+group[j].Category
+		})
+		households, pickups := map[string]bool{}, map[string]bool{}
+		hide := func(c *cell) {
+			c.Suppressed = true
+			for uid := range c.households {
+				households[uid] = true
+			}
+			for id := range c.pickups {
+				pickups[id] = true
+			}
+		}
+		for _, c := range group {
+			if c.Suppressed || len(c.households) < s.thresholds.MinHouseholds || len(c.pickups) < s.thresholds.MinPickups {
+				hide(c)
+			}
+		}
+		for _, c := range group {
+			if len(households) == 0 ||
+				(len(households) >= s.thresholds.MinHouseholds && len(pickups) >= s.thresholds.MinPickups) {
+				break
+			}
+			if !c.Suppressed {
+				hide(c)
+			}
+		}
+	}
+}
+
+// publish returns the cells sorted by period and key, without the measures
+// of suppressed cells.
+func publish(cells map[string]*cell) []Cell {
+	result := []Cell{}
+	for _, c := range cells {
+		out := c.Cell
+		if !out.Suppressed {
+			households, pickups := len(c.households), len(c.pickups)
+			weight, co2e := math.Round(c.weightKg*10)/10, math.Round(c.co2eKg*10)/10
+			units := c.units
+			out.Households, out.Pickups, out.Units, out.WeightKg, out.CO2eKg = &households, &pickups, &units, &weight, &co2e
+		}
+		result = append(result, out)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Period != result[j].Period {
+			return result[i].Period < result[j].Period
+		}
+		return result[i].County+result[i].Category < result[j].County+result[j].Category
+	})
+	return result
+}
@@ -0,0 +1,198 @@
+package opendata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/impact"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// newTestService records one phone pickup per household: twelve in
+// September 2026 (six in Nairobi, four in Kisumu, two in Mombasa) and one
+// in October, the month in progress. more may record further pickups.
+func newTestService(t *testing.T, more ...func(record func(county string, at time.Time))) *Service {
+	t.Helper()
+	db := store.NewMemory()
+	engine := impact.NewEngine(db)
+	n := 0
+	record := func(county string, at time.Time) {
+		n++
+		p := &pickups.Pickup{
+			ID: fmt.Sprintf("pk_%d", n), UserID: fmt.Sprintf("user%d", n), County: county, Status: pickups.StatusProcessed,
+			Items:   []pickups.Item{{Category: "phones", Quantity: 1, WeightKg: 0.5}},
+			History: []pickups.StatusChange{{To: pickups.StatusProcessed, At: at}},
+		}
+		if err := db.Update(func(tx *store.Tx) error {
+			_, err := engine.RecordTx(tx, p)
+			return err
+		}); err != nil {
+			t.Fatalf("RecordTx() error = %v", err)
+		}
+	}
+	september := time.Date(2026, 9, 10, 0, 0, 0, 0, time.UTC)
+	for county, households := range map[string]int{"Nairobi": 6, "Kisumu": 4, "Mombasa": 2} {
+		for i := 0; i < households; i++ {
+			record(county, september)
+		}
+	}
+	record("Nairobi", time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC))
+	for _, f := range more {
+		f(record)
+	}
+
+	svc := NewService(engine, DefaultThresholds)
+	svc.now = func() time.Time { return time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC) }
+	return svc
+}
+
+func TestQueryByCountySuppressesSmallCells(t *testing.T) {
+	svc := newTestService(t)
+	table, err := svc.Query(DatasetByCounty, BucketMonth, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(table.Cells) != 3 || !table.To.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Query() = %+v", table)
+	}
+	published := map[string]bool{}
+	for _, c := range table.Cells {
+		published[c.County] = !c.Suppressed
+		if c.Suppressed && c.WeightKg != nil {
+			t.Errorf("%s is suppressed but has a weight", c.County)
+		}
+	}
+	// Mombasa is below k; Kisumu is suppressed too so Mombasa cannot be
+	// recovered from the national figure.
+	if !published["Nairobi"] || published["Kisumu"] || published["Mombasa"] {
+		t.Errorf("published = %v, want only Nairobi", published)
+	}
+	nairobi := table.Cells[2]
+	if nairobi.County != "Nairobi" || *nairobi.Households != 6 || *nairobi.WeightKg != 3 {
+		t.Errorf("Nairobi = %+v", nairobi)
+	}
+}
+
+func TestQueryBuckets(t *testing.T) {
+	svc := newTestService(t)
+	// The year in progress has no complete bucket yet.
+	if table, _ := svc.Query(DatasetNational, BucketYear, time.Time{}, time.Time{}); len(table.Cells) != 0 {
+		t.Errorf("yearly cells = %+v, want none", table.Cells)
+	}
+	table, err := svc.Query(DatasetByCategory, BucketQuarter, time.Date(2026, 8, 15, 0, 0, 0, 0, time.UTC), time.Time{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if !table.From.Equal(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)) || len(table.Cells) != 1 {
+		t.Fatalf("Query() = %+v", table)
+	}
+	if c := table.Cells[0]; c.Period != "2026-Q3" || c.Category != "phones" || c.Suppressed || *c.Pickups != 12 {
+		t.Errorf("cell = %+v", c)
+	}
+}
+
+func TestQuarterDoesNotRevealSuppressedMonth(t *testing.T) {
+	// Five Mombasa households in August are published; without carrying
+	// September's suppression into the quarter, Q3 minus August would give
+	// September's two.
+	svc := newTestService(t, func(record func(string, time.Time)) {
+		for i := 0; i < 5; i++ {
+			record("Mombasa", time.Date(2026, 8, 20, 0, 0, 0, 0, time.UTC))
+		}
+	})
+	months, _ := svc.Query(DatasetByCounty, BucketMonth, time.Time{}, time.Time{})
+	if c := months.Cells[0]; c.Period != "2026-08" || c.County != "Mombasa" || c.Suppressed {
+		t.Fatalf("August cell = %+v", c)
+	}
+
+	quarters, err := svc.Query(DatasetByCounty, BucketQuarter, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	published := map[string]bool{}
+	for _, c := range quarters.Cells {
+		published[c.County] = !c.Suppressed
+	}
+	if !published["Nairobi"] || published["Kisumu"] || published["Mombasa"] {
+		t.Errorf("published = %v, want only Nairobi", published)
+	}
+}
+
+func TestComplementarySuppressionCoversMinPickups(t *testing.T) {
+	svc := newTestService(t)
+	// Mombasa's two households meet k but its two pickups do not, so
+	// Kisumu must be suppressed as well.
+	svc.thresholds = Thresholds{MinHouseholds: 2, MinPickups: 3}
+	table, _ := svc.Query(DatasetByCounty, BucketMonth, time.Time{}, time.Time{})
+	published := map[string]bool{}
+	for _, c := range table.Cells {
+		published[c.County] = !c.Suppressed
+	}
+	if !published["Nairobi"] || published["Kisumu"] || published["Mombasa"] {
+		t.Errorf("published = %v, want only Nairobi", published)
+	}
+}
+
+func TestQueryValidates(t *testing.T) {
+	svc := newTestService(t)
+	if _, err := svc.Query("households", BucketMonth, time.Time{}, time.Time{}); !errors.Is(err, ErrUnknownDataset) {
+		t.Errorf("Query(unknown dataset) error = %v, want ErrUnknownDataset", err)
+	}
+	if _, err := svc.Query(DatasetNational, "week", time.Time{}, time.Time{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Query(week) error = %v, want ErrInvalidQuery", err)
+	}
+	day := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := svc.Query(DatasetNational, BucketMonth, day, day); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Query(empty period) error = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestCSVAndExport(t *testing.T) {
+	svc := newTestService(t)
+	table, _ := svc.Query(DatasetByCounty, BucketMonth, time.Time{}, time.Time{})
+	data, err := CSV(table)
+	if err != nil {
+		t.Fatalf("CSV() error = %v", err)
+	}
+	want := "period,county,suppressed,households,pickups,units,weight_kg,co2e_kg\n" +
+		"2026-09,Kisumu,true,,,,,\n" +
+		"2026-09,Mombasa,true,,,,,\n" +
+		"2026-09,Nairobi,false,6,6,6,3,18\n"
+	if string(data) != want {
+		t.Errorf("CSV() =\n%s\nwant\n%s", data, want)
+	}
+
+	archive, err := svc.Export("")
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Export() is not a zip archive: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if len(files) != len(Datasets)+1 || files["datapackage.json"] == nil || files[DatasetByCategory+".csv"] == nil {
+		t.Fatalf("Export() files = %v", files)
+	}
+	rc, _ := files["datapackage.json"].Open()
+	defer rc.Close()
+	var pkg struct {
+		Resources []struct {
+			Name   string
+			Schema struct{ Fields []Field }
+		}
+	}
+	if err := json.NewDecoder(rc).Decode(&pkg); err != nil || len(pkg.Resources) != len(Datasets) || !strings.HasPrefix(pkg.Resources[1].Schema.Fields[1].Description, "County") {
+		t.Errorf("datapackage.json = %+v, %v", pkg, err)
+	}
+}
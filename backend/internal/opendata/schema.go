@@ -0,0 +1,200 @@
+package opendata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Published datasets.
+const (
+	DatasetNational   = "collections"
+	DatasetByCounty   = "collections_by_county"
+	DatasetByCategory = "collections_by_category"
+)
+
+// Field documents one column of a dataset. Types follow the Frictionless
+// Table Schema: string, integer, number or boolean.
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Dataset documents a published dataset.
+type Dataset struct {
+	ID          string  `json:"name"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Fields      []Field `json:"fields"`
+}
+
+var (
+	fieldPeriod   = Field{"period", "string", "Time bucket: YYYY-MM for months, YYYY-Qn for quarters, YYYY for years."}
+	fieldCounty   = Field{"county", "string", "County the e-waste was collected in, or \"unknown\" for pickups without a location."}
+	fieldCategory = Field{"category", "string", "Device category from the e-waste item catalogue."}
+	measureFields = []Field{
+		{"suppressed", "boolean", "True when the cell, or a month within it, covers too few households or pickups to publish. Its measures are then empty."},
+		{"households", "integer", "Number of distinct households whose e-waste is counted."},
+		{"pickups", "integer", "Number of processed pickups."},
+		{"units", "integer", "Number of devices."},
+		{"weight_kg", "number", "Weight in kilograms, measured at collection or estimated from catalogue weights."},
+		{"co2e_kg", "number", "Estimated emissions avoided by recycling, in kilograms of CO2 equivalent."},
+	}
+)
+
+// Datasets lists the published datasets with their schemas.
+var Datasets = []Dataset{
+	{
+		ID:          DatasetNational,
+		Title:       "E-waste processed nationally",
+		Description: "Processed e-waste pickups across all service areas, per time bucket.",
+		Fields:      append([]Field{fieldPeriod}, measureFields...),
+	},
+	{
+		ID:          DatasetByCounty,
+		Title:       "E-waste processed by county",
+		Description: "Processed e-waste pickups per county and time bucket.",
+		Fields:      append([]Field{fieldPeriod, fieldCounty}, measureFields...),
+	},
+	{
+		ID:          DatasetByCategory,
+		Title:       "E-waste processed by device category",
+		Description: "Processed e-waste per device category and time bucket. A pickup with several categories counts once in each.",
+		Fields:      append([]Field{fieldPeriod, fieldCategory}, measureFields...),
+	},
+}
+
+func datasetByID(id string) (Dataset, bool) {
+	for _, d := range Datasets {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Dataset{}, false
+}
+
+// CSV writes a table with the columns of its dataset's schema.
+func CSV(t *Table) ([]byte, error) {
+	d, _ := datasetByID(t.Dataset)
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := make([]string, len(d.Fields))
+	for i, f := range d.Fields {
+		header[i] = f.Name
+	}
+	w.Write(header)
+	for _, c := range t.Cells {
+		record := make([]string, 0, len(d.Fields))
+		for _, f := range d.Fields {
+			record = append(record, c.value(f.Name))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// value returns the CSV text of one field; suppressed measures are empty.
+func (c *Cell) value(field string) string {
+	switch field {
+	case "period":
+		return c.Period
+	case "county":
+		return c.County
+	case "category":
+		return c.Category
+	case "suppressed":
+		return strconv.FormatBool(c.Suppressed)
+	}
+	if c.Suppressed {
+		return ""
+	}
+	switch field {
+	case "households":
+		return strconv.Itoa(*c.Households)
+	case "pickups":
+		return strconv.Itoa(*c.Pickups)
+	case "units":
+		return strconv.Itoa(*c.Units)
+	case "weight_kg":
+		return strconv.FormatFloat(*c.WeightKg, 'f', -1, 64)
+	case "co2e_kg":
+		return strconv.FormatFloat(*c.CO2eKg, 'f', -1, 64)
+	}
+	return ""
+}
+
+// Export builds every dataset for bucket and packages them as a zip archive
+// holding one CSV per dataset and a Frictionless datapackage.json that
+// documents them.
+func (s *Service) Export(bucket string) ([]byte, error) {
+	type resource struct {
+		Name        string `json:"name"`
+		Path        string `json:"path"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Format      string `json:"format"`
+		Schema      struct {
+			Fields []Field `json:"fields"`
+		} `json:"schema"`
+	}
+	pkg := struct {
+		Name       string              `json:"name"`
+		Title      string              `json:"title"`
+		Licenses   []map[string]string `json:"licenses"`
+		Created    time.Time           `json:"created"`
+		Bucket     string              `json:"bucket"`
+		Thresholds Thresholds          `json:"thresholds"`
+		Resources  []resource          `json:"resources"`
+	}{
+		Name:       "zingiratech-ewaste-statistics",
+		Title:      "ZingiraTech e-waste recycling statistics",
+		Licenses:   []map[string]string{{"name": Licence}},
+		Created:    s.now().UTC(),
+		Thresholds: s.thresholds,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, d := range Datasets {
+		table, err := s.Query(d.ID, bucket, time.Time{}, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		pkg.Bucket = table.Bucket
+		data, err := CSV(table)
+		if err != nil {
+			return nil, err
+		}
+		f, err := zw.Create(d.ID + ".csv")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return nil, err
+		}
+		r := resource{Name: d.ID, Path: d.ID + ".csv", Title: d.Title, Description: d.Description, Format: "csv"}
+		r.Schema.Fields = d.Fields
+		pkg.Resources = append(pkg.Resources, r)
+	}
+
+	descriptor, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	f, err := zw.Create("datapackage.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(descriptor); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
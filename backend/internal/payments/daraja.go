@@ -0,0 +1,267 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DarajaConfig holds the credentials of a Daraja (M-Pesa Express) app.
+type DarajaConfig struct {
+	BaseURL        string
+	ConsumerKey    string
+	ConsumerSecret string
+	ShortCode      string
+	Passkey        string
+}
+
+// DarajaProvider implements Provider against the Daraja STK push API.
+type DarajaProvider struct {
+	config DarajaConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewDarajaProvider creates a Daraja client.
+func NewDarajaProvider(config DarajaConfig) *DarajaProvider {
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &DarajaProvider{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Name identifies the provider on stored payments.
+func (d *DarajaProvider) Name() string {
+	return "mpesa"
+}
+
+// stkPushRequest is the body of POST /mpesa/stkpush/v1/processrequest.
+type stkPushRequest struct {
+	BusinessShortCode string `json:"BusinessShortCode"`
+	Password          string `json:"Password"`
+	Timestamp         string `json:"Timestamp"`
+	TransactionType   string `json:"TransactionType"`
+	Amount            int64  `json:"Amount"`
+	PartyA            string `json:"PartyA"`
+	PartyB            string `json:"PartyB"`
+	PhoneNumber       string `json:"PhoneNumber"`
+	CallBackURL       string `json:"CallBackURL"`
+	AccountReference  string `json:"AccountReference"`
+	TransactionDesc   string `json:"TransactionDesc"`
+}
+
+type stkPushResponse struct {
+	MerchantRequestID   string `json:"MerchantRequestID"`
+	CheckoutRequestID   string `json:"CheckoutRequestID"`
+	ResponseCode        string `json:"ResponseCode"`
+	ResponseDescription string `json:"ResponseDescription"`
+	CustomerMessage     string `json:"CustomerMessage"`
+	ErrorMessage        string `json:"errorMessage"`
+}
+
+// stkQueryRequest is the body of POST /mpesa/stkpushquery/v1/query.
+type stkQueryRequest struct {
+	BusinessShortCode string `json:"BusinessShortCode"`
+	Password          string `json:"Password"`
+	Timestamp         string `json:"Timestamp"`
+	CheckoutRequestID string `json:"CheckoutRequestID"`
+}
+
+type stkQueryResponse struct {
+	ResponseCode string `json:"ResponseCode"`
+	ResultCode   string `json:"ResultCode"`
+	ResultDesc   string `json:"ResultDesc"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// InitiatePush sends an STK push prompt to the customer's phone.
+func (d *DarajaProvider) InitiatePush(ctx context.Context, req PushRequest) (*PushResponse, error) {
+	timestamp, password := d.password()
+	body := stkPushRequest{
+		BusinessShortCode: d.config.ShortCode,
+		Password:          password,
+		Timestamp:         timestamp,
+		TransactionType:   "CustomerPayBillOnline",
+		Amount:            req.Amount,
+		PartyA:            req.Phone,
+		PartyB:            d.config.ShortCode,
+		PhoneNumber:       req.Phone,
+		CallBackURL:       req.CallbackURL,
+		AccountReference:  req.Reference,
+		TransactionDesc:   req.Description,
+	}
+
+	var resp stkPushResponse
+	status, err := d.post(ctx, "/mpesa/stkpush/v1/processrequest", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || resp.ResponseCode != "0" {
+		msg := resp.ResponseDescription
+		if msg == "" {
+			msg = resp.ErrorMessage
+		}
+		return nil, fmt.Errorf("%w: %s", ErrProviderRejected, msg)
+	}
+	return &PushResponse{
+		MerchantRequestID: resp.MerchantRequestID,
+		CheckoutRequestID: resp.CheckoutRequestID,
+		CustomerMessage:   resp.CustomerMessage,
+	}, nil
+}
+
+// QueryStatus asks Daraja for the outcome of an STK push.
+func (d *DarajaProvider) QueryStatus(ctx context.Context, checkoutRequestID string) (*StatusResult, error) {
+	timestamp, password := d.password()
+	body := stkQueryRequest{
+		BusinessShortCode: d.config.ShortCode,
+		Password:          password,
+		Timestamp:         timestamp,
+		CheckoutRequestID: checkoutRequestID,
+	}
+
+	var resp stkQueryResponse
+	status, err := d.post(ctx, "/mpesa/stkpushquery/v1/query", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	// Daraja answers with an error while the customer is still being prompted.
+	if status != http.StatusOK || resp.ResultCode == "" {
+		return &StatusResult{Pending: true, Description: resp.ErrorMessage}, nil
+	}
+	code, err := strconv.Atoi(resp.ResultCode)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected result code %q", resp.ResultCode)
+	}
+	return &StatusResult{ResultCode: code, Description: resp.ResultDesc}, nil
+}
+
+// password returns the request timestamp and the matching base64(shortcode+passkey+timestamp) password.
+func (d *DarajaProvider) password() (string, string) {
+	timestamp := d.now().In(nairobi).Format("20060102150405")
+	raw := d.config.ShortCode + d.config.Passkey + timestamp
+	return timestamp, base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+// nairobi is East Africa Time, which Daraja expects timestamps in.
+var nairobi = time.FixedZone("EAT", 3*60*60)
+
+// accessToken returns a cached OAuth token, fetching a new one when it has expired.
+func (d *DarajaProvider) accessToken(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.token != "" && d.now().Before(d.tokenExpiry) {
+		return d.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.config.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(d.config.ConsumerKey, d.config.ConsumerSecret)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("access token request failed with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding access token: %w", err)
+	}
+	seconds, err := strconv.Atoi(body.ExpiresIn)
+	if err != nil || seconds <= 60 {
+		seconds = 3599
+	}
+	d.token = body.AccessToken
+	// Refresh a minute early so that a token never expires mid-request.
+	d.tokenExpiry = d.now().Add(time.Duration(seconds-60) * time.Second)
+	return d.token, nil
+}
+
+func (d *DarajaProvider) post(ctx context.Context, path string, body, out interface{}) (int, error) {
+	token, err := d.accessToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error calling %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("error decoding %s response: %w", path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// Callback is the body Daraja posts to the callback URL once the customer responds.
+type Callback struct {
+	Body struct {
+		STKCallback struct {
+			MerchantRequestID string `json:"MerchantRequestID"`
+			CheckoutRequestID string `json:"CheckoutRequestID"`
+			ResultCode        int    `json:"ResultCode"`
+			ResultDesc        string `json:"ResultDesc"`
+			CallbackMetadata  struct {
+				Item []CallbackItem `json:"Item"`
+			} `json:"CallbackMetadata"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+}
+
+// CallbackItem is one name/value pair in the callback metadata.
+type CallbackItem struct {
+	Name  string      `json:"Name"`
+	Value interface{} `json:"Value,omitempty"`
+}
+
+// metadata returns the callback metadata value called name as a string.
+func (c *Callback) metadata(name string) string {
+	for _, item := range c.Body.STKCallback.CallbackMetadata.Item {
+		if item.Name != name || item.Value == nil {
+			continue
+		}
+		switch v := item.Value.(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
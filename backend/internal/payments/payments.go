@@ -0,0 +1,520 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the payments module.
+const (
+	paymentsBucket = "payments"
+	keysBucket     = "payment_idempotency_keys"
+)
+
+// Payment states.
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusFailed  = "failed"
+)
+
+// Services that must be paid for.
+const (
+	PurposePremiumPickup  = "premium_pickup"
+	PurposeBulkCollection = "bulk_collection"
+)
+
+var purposes = map[string]bool{PurposePremiumPickup: true, PurposeBulkCollection: true}
+
+// Reconciliation findings.
+const (
+	// MismatchRefundDue flags a paid payment whose pickup was cancelled.
+	MismatchRefundDue = "refund_due"
+	// MismatchUnpaidPickup flags a pickup that was collected without a completed payment.
+	MismatchUnpaidPickup = "unpaid_pickup"
+	// MismatchAmount flags a payment where the provider confirmed a different amount.
+	MismatchAmount = "amount_mismatch"
+	// MismatchDuplicate flags a pickup that has been paid for more than once.
+	MismatchDuplicate = "duplicate_payment"
+)
+
+var (
+	// ErrNotFound is returned when a payment does not exist.
+	ErrNotFound = errors.New("payment not found")
+	// ErrInvalidPayment is returned when a payment request fails validation.
+	ErrInvalidPayment = errors.New("invalid payment")
+	// ErrInvalidSignature is returned for callbacks that were not issued by this service.
+	ErrInvalidSignature = errors.New("invalid callback signature")
+	// ErrIdempotencyConflict is returned when an idempotency key is reused for a different payment.
+	ErrIdempotencyConflict = errors.New("idempotency key already used for a different payment")
+)
+
+// Payment is a mobile-money charge for a paid service.
+type Payment struct {
+	ID                string    `json:"id"`
+	UserID            string    `json:"user_id"`
+	Purpose           string    `json:"purpose"`
+	PickupID          string    `json:"pickup_id,omitempty"`
+	Amount            int64     `json:"amount"`
+	PaidAmount        int64     `json:"paid_amount,omitempty"`
+	Phone             string    `json:"phone"`
+	Status            string    `json:"status"`
+	Provider          string    `json:"provider"`
+	MerchantRequestID string    `json:"merchant_request_id,omitempty"`
+	CheckoutRequestID string    `json:"checkout_request_id,omitempty"`
+	ReceiptNumber     string    `json:"receipt_number,omitempty"`
+	FailureReason     string    `json:"failure_reason,omitempty"`
+	IdempotencyKey    string    `json:"idempotency_key"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	CompletedAt       time.Time `json:"completed_at,omitempty"`
+}
+
+// InitiateRequest holds the fields a user submits to pay for a service.
+// The amount charged is the total of the quote the pickup was booked from;
+// Amount is optional and, if set, must agree with it.
+type InitiateRequest struct {
+	Purpose        string `json:"purpose"`
+	PickupID       string `json:"pickup_id"`
+	Amount         int64  `json:"amount"`
+	Phone          string `json:"phone"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// Mismatch is a disagreement between a payment and the pickup it pays for.
+type Mismatch struct {
+	Type      string `json:"type"`
+	PaymentID string `json:"payment_id"`
+	PickupID  string `json:"pickup_id,omitempty"`
+	Details   string `json:"details"`
+}
+
+// Report summarises a reconciliation run.
+type Report struct {
+	Checked    int        `json:"checked"`
+	Updated    []Payment  `json:"updated"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// Listener is notified when a payment settles, inside the transaction that
+// records the outcome.
+type Listener func(tx *store.Tx, p *Payment) error
+
+// Service takes payments through a Provider and tracks their outcome.
+type Service struct {
+	store       *store.Store
+	provider    Provider
+	callbackURL string
+	secret      []byte
+	now         func() time.Time
+	listeners   []Listener
+}
+
+// NewService creates a payment service. callbackURL is the public address of
+// the callback endpoint; secret signs the per-payment callback URLs.
+func NewService(s *store.Store, provider Provider, callbackURL string, secret []byte) *Service {
+	return &Service{store: s, provider: provider, callbackURL: callbackURL, secret: secret, now: time.Now}
+}
+
+// Subscribe registers l to be called whenever a payment is marked paid or failed.
+func (s *Service) Subscribe(l Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// Initiate records a pending payment for uid and sends the STK push prompt
+// for the total of the accepted quote that booked the pickup. Repeating a
+// request with the same idempotency key returns the original payment, and so
+// does any request for a pickup that is already paid or being paid for.
+func (s *Service) Initiate(ctx context.Context, uid string, req InitiateRequest) (*Payment, error) {
+	phone, err := validate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var payment *Payment
+	existing := false
+	err = s.store.Update(func(tx *store.Tx) error {
+		var id string
+		if err := tx.Get(keysBucket, idempotencyKey(uid, req.IdempotencyKey), &id); err == nil {
+			payment, err = GetTx(tx, id)
+			if err != nil {
+				return err
+			}
+			if (req.Amount != 0 && payment.Amount != req.Amount) || payment.Purpose != req.Purpose || payment.PickupID != req.PickupID {
+				return ErrIdempotencyConflict
+			}
+			existing = true
+			return nil
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		pickup, err := pickups.GetTx(tx, req.PickupID)
+		if errors.Is(err, pickups.ErrNotFound) || (err == nil && pickup.UserID != uid) {
+			return fmt.Errorf("%w: unknown pickup %q", ErrInvalidPayment, req.PickupID)
+		}
+		if err != nil {
+			return err
+		}
+		if pickup.Status == pickups.StatusCancelled {
+			return fmt.Errorf("%w: pickup %s has been cancelled", ErrInvalidPayment, pickup.ID)
+		}
+		open, err := listTx(tx, func(p *Payment) bool {
+			return p.PickupID == pickup.ID && (p.Status == StatusPending || p.Status == StatusPaid)
+		})
+		if err != nil {
+			return err
+		}
+		if len(open) > 0 {
+			payment, existing = open[0], true
+			return tx.Insert(keysBucket, idempotencyKey(uid, req.IdempotencyKey), payment.ID)
+		}
+		quote, err := quotes.ByPickupTx(tx, pickup.ID)
+		if errors.Is(err, quotes.ErrNotFound) {
+			return fmt.Errorf("%w: pickup %s was not booked from a quote, so there is nothing to pay", ErrInvalidPayment, pickup.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if req.Amount != 0 && req.Amount != quote.Total {
+			return fmt.Errorf("%w: amount %d does not match the quoted %d", ErrInvalidPayment, req.Amount, quote.Total)
+		}
+
+		seq, err := tx.NextSequence(paymentsBucket)
+		if err != nil {
+			return err
+		}
+		now := s.now().UTC()
+		payment = &Payment{
+			ID:             fmt.Sprintf("pay_%d", seq),
+			UserID:         uid,
+			Purpose:        req.Purpose,
+			PickupID:       req.PickupID,
+			Amount:         quote.Total,
+			Phone:          phone,
+			Status:         StatusPending,
+			Provider:       s.provider.Name(),
+			IdempotencyKey: req.IdempotencyKey,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := tx.Insert(keysBucket, idempotencyKey(uid, req.IdempotencyKey), payment.ID); err != nil {
+			return err
+		}
+		return tx.Insert(paymentsBucket, payment.ID, payment)
+	})
+	if err != nil || existing {
+		return payment, err
+	}
+
+	// The provider is called outside the transaction so a slow gateway does not block the store.
+	resp, pushErr := s.provider.InitiatePush(ctx, PushRequest{
+		Phone:       payment.Phone,
+		Amount:      payment.Amount,
+		Reference:   payment.ID,
+		Description: "ZingiraTech " + payment.Purpose,
+		CallbackURL: s.CallbackURL(payment.ID),
+	})
+	err = s.store.Update(func(tx *store.Tx) error {
+		current, err := GetTx(tx, payment.ID)
+		if err != nil {
+			return err
+		}
+		current.UpdatedAt = s.now().UTC()
+		if pushErr != nil {
+			current.Status = StatusFailed
+			current.FailureReason = pushErr.Error()
+			current.CompletedAt = current.UpdatedAt
+		} else {
+			current.MerchantRequestID = resp.MerchantRequestID
+			current.CheckoutRequestID = resp.CheckoutRequestID
+		}
+		payment = current
+		return tx.Put(paymentsBucket, current.ID, current)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pushErr != nil {
+		return payment, pushErr
+	}
+	return payment, nil
+}
+
+func validate(req InitiateRequest) (string, error) {
+	if !purposes[req.Purpose] {
+		return "", fmt.Errorf("%w: unknown purpose %q", ErrInvalidPayment, req.Purpose)
+	}
+	if req.PickupID == "" {
+		return "", fmt.Errorf("%w: pickup_id is required", ErrInvalidPayment)
+	}
+	if req.Amount < 0 {
+		return "", fmt.Errorf("%w: amount must be positive", ErrInvalidPayment)
+	}
+	if req.IdempotencyKey == "" {
+		return "", fmt.Errorf("%w: idempotency_key is required", ErrInvalidPayment)
+	}
+	phone, ok := NormalizePhone(req.Phone)
+	if !ok {
+		return "", fmt.Errorf("%w: %q is not a Kenyan mobile number", ErrInvalidPayment, req.Phone)
+	}
+	return phone, nil
+}
+
+func idempotencyKey(uid, key string) string {
+	return uid + ":" + key
+}
+
+// CallbackURL returns the signed callback address given to the provider for paymentID.
+func (s *Service) CallbackURL(paymentID string) string {
+	query := url.Values{"ref": {paymentID}, "sig": {s.sign(paymentID)}}
+	return s.callbackURL + "?" + query.Encode()
+}
+
+func (s *Service) sign(paymentID string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(paymentID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallback reports whether sig is the signature issued for paymentID.
+func (s *Service) VerifyCallback(paymentID, sig string) bool {
+	return hmac.Equal([]byte(s.sign(paymentID)), []byte(sig))
+}
+
+// HandleCallback applies a provider callback to the payment it was issued
+// for. Callbacks for payments that are already settled are ignored, so the
+// provider may safely deliver the same callback more than once.
+func (s *Service) HandleCallback(paymentID, sig string, cb *Callback) (*Payment, error) {
+	if !s.VerifyCallback(paymentID, sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	var payment *Payment
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		payment, err = GetTx(tx, paymentID)
+		if err != nil {
+			return err
+		}
+		result := cb.Body.STKCallback
+		if result.CheckoutRequestID != payment.CheckoutRequestID {
+			return fmt.Errorf("%w: checkout request does not match payment", ErrInvalidSignature)
+		}
+		if payment.Status != StatusPending {
+			return nil
+		}
+		paid, _ := strconv.ParseFloat(cb.metadata("Amount"), 64)
+		s.settle(payment, result.ResultCode, result.ResultDesc, cb.metadata("MpesaReceiptNumber"), int64(paid))
+		if err := tx.Put(paymentsBucket, payment.ID, payment); err != nil {
+			return err
+		}
+		return s.notify(tx, payment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// settle records the final outcome of a pending payment.
+func (s *Service) settle(p *Payment, resultCode int, description, receipt string, paid int64) {
+	now := s.now().UTC()
+	p.UpdatedAt = now
+	p.CompletedAt = now
+	if resultCode != ResultSuccess {
+		p.Status = StatusFailed
+		p.FailureReason = description
+		return
+	}
+	p.Status = StatusPaid
+	p.ReceiptNumber = receipt
+	p.PaidAmount = paid
+	if p.PaidAmount == 0 {
+		p.PaidAmount = p.Amount
+	}
+}
+
+func (s *Service) notify(tx *store.Tx, p *Payment) error {
+	for _, listener := range s.listeners {
+		if err := listener(tx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the payment with the given ID.
+func (s *Service) Get(id string) (*Payment, error) {
+	var payment *Payment
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		payment, err = GetTx(tx, id)
+		return err
+	})
+	return payment, err
+}
+
+// GetTx loads a payment inside an existing transaction.
+func GetTx(tx *store.Tx, id string) (*Payment, error) {
+	var payment Payment
+	if err := tx.Get(paymentsBucket, id, &payment); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// List returns the payments accepted by match, oldest first. A nil match returns every payment.
+func (s *Service) List(match func(*Payment) bool) ([]*Payment, error) {
+	var result []*Payment
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		result, err = listTx(tx, match)
+		return err
+	})
+	return result, err
+}
+
+func listTx(tx *store.Tx, match func(*Payment) bool) ([]*Payment, error) {
+	result := []*Payment{}
+	err := tx.ForEach(paymentsBucket, func(key string, raw json.RawMessage) error {
+		var payment Payment
+		if err := json.Unmarshal(raw, &payment); err != nil {
+			return fmt.Errorf("error decoding payment %s: %w", key, err)
+		}
+		if match == nil || match(&payment) {
+			result = append(result, &payment)
+		}
+		return nil
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result, err
+}
+
+// ByUser matches the payments made by uid.
+func ByUser(uid string) func(*Payment) bool {
+	return func(p *Payment) bool { return p.UserID == uid }
+}
+
+// Reconcile asks the provider for the outcome of every pending payment whose
+// callback never arrived, then checks paid services against their pickups.
+func (s *Service) Reconcile(ctx context.Context) (*Report, error) {
+	pending, err := s.List(func(p *Payment) bool {
+		return p.Status == StatusPending && p.CheckoutRequestID != ""
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Updated: []Payment{}, Mismatches: []Mismatch{}}
+	for _, p := range pending {
+		report.Checked++
+		status, err := s.provider.QueryStatus(ctx, p.CheckoutRequestID)
+		if err != nil {
+			return report, fmt.Errorf("error querying payment %s: %w", p.ID, err)
+		}
+		if status.Pending {
+			continue
+		}
+		var updated *Payment
+		err = s.store.Update(func(tx *store.Tx) error {
+			current, err := GetTx(tx, p.ID)
+			if err != nil {
+				return err
+			}
+			// A callback may have settled the payment while the provider was queried.
+			if current.Status != StatusPending {
+				return nil
+			}
+			s.settle(current, status.ResultCode, status.Description, "", 0)
+			updated = current
+			if err := tx.Put(paymentsBucket, current.ID, current); err != nil {
+				return err
+			}
+			return s.notify(tx, current)
+		})
+		if err != nil {
+			return report, err
+		}
+		if updated != nil {
+			report.Updated = append(report.Updated, *updated)
+		}
+	}
+
+	err = s.store.View(func(tx *store.Tx) error {
+		var err error
+		report.Mismatches, err = mismatchesTx(tx)
+		return err
+	})
+	return report, err
+}
+
+// mismatchesTx compares every pickup-linked payment with the state of its pickup.
+func mismatchesTx(tx *store.Tx) ([]Mismatch, error) {
+	list, err := listTx(tx, func(p *Payment) bool { return p.PickupID != "" })
+	if err != nil {
+		return nil, err
+	}
+
+	// A pickup may have several attempts; only one of them needs to have succeeded.
+	paid := map[string]bool{}
+	mismatches := []Mismatch{}
+	for _, p := range list {
+		if p.Status != StatusPaid {
+			continue
+		}
+		if paid[p.PickupID] {
+			mismatches = append(mismatches, Mismatch{
+				Type: MismatchDuplicate, PaymentID: p.ID, PickupID: p.PickupID,
+				Details: "pickup was already paid for by another payment",
+			})
+		}
+		paid[p.PickupID] = true
+	}
+
+	reported := map[string]bool{}
+	for _, p := range list {
+		pickup, err := pickups.GetTx(tx, p.PickupID)
+		if err != nil && !errors.Is(err, pickups.ErrNotFound) {
+			return nil, err
+		}
+		switch {
+		case p.Status == StatusPaid && p.PaidAmount != p.Amount:
+			mismatches = append(mismatches, Mismatch{
+				Type: MismatchAmount, PaymentID: p.ID, PickupID: p.PickupID,
+				Details: fmt.Sprintf("expected %d, provider confirmed %d", p.Amount, p.PaidAmount),
+			})
+		case p.Status == StatusPaid && (pickup == nil || pickup.Status == pickups.StatusCancelled):
+			mismatches = append(mismatches, Mismatch{
+				Type: MismatchRefundDue, PaymentID: p.ID, PickupID: p.PickupID,
+				Details: "payment received for a cancelled pickup",
+			})
+		case p.Status != StatusPaid && !paid[p.PickupID] && !reported[p.PickupID] && pickup != nil &&
+			(pickup.Status == pickups.StatusCollected || pickup.Status == pickups.StatusProcessed):
+			reported[p.PickupID] = true
+			mismatches = append(mismatches, Mismatch{
+				Type: MismatchUnpaidPickup, PaymentID: p.ID, PickupID: p.PickupID,
+				Details: fmt.Sprintf("pickup is %s but payment is %s", pickup.Status, p.Status),
+			})
+		}
+	}
+	return mismatches, nil
+}
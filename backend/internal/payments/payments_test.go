@@ -0,0 +1,320 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// fakeProvider accepts every push and reports the configured status on query.
+type fakeProvider struct {
+	pushes int
+	status StatusResult
+	reject bool
+}
+
+func (f *fakeProvider) Name() string { return "fake" }
+
+func (f *fakeProvider) InitiatePush(ctx context.Context, req PushRequest) (*PushResponse, error) {
+	if f.reject {
+		return nil, ErrProviderRejected
+	}
+	f.pushes++
+	return &PushResponse{MerchantRequestID: "m", CheckoutRequestID: "co_" + req.Reference}, nil
+}
+
+func (f *fakeProvider) QueryStatus(ctx context.Context, checkoutRequestID string) (*StatusResult, error) {
+	status := f.status
+	return &status, nil
+}
+
+// booking books pickups from quotes, the only pickups that can be paid for.
+type booking struct {
+	pickups *pickups.Service
+	quotes  *quotes.Service
+}
+
+func newTestService(t *testing.T, provider Provider) (*Service, *booking) {
+	db := store.NewMemory()
+	if err := items.NewService(db).Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	pickupService := pickups.NewService(db)
+	quoteService := quotes.NewService(db, pickupService, quotes.DefaultPriceList, quotes.DefaultHubs, []byte("secret"))
+	return NewService(db, provider, "https://example.com/api/payments/callback", []byte("secret")), &booking{pickupService, quoteService}
+}
+
+// schedule books a pickup for uid from a quote and returns it with the
+// quoted total.
+func schedule(t *testing.T, b *booking, uid string) (*pickups.Pickup, int64) {
+	t.Helper()
+	quote, err := b.quotes.Issue(uid, quotes.Request{
+		Address: "Westlands", Location: geo.Point{Lat: -1.2676, Lng: 36.8108},
+		Items: []pickups.Item{{Category: "computers", Subcategory: "laptops", Quantity: 20}},
+	})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	_, p, err := b.quotes.Accept(uid, quotes.AcceptRequest{QuoteID: quote.ID, Signature: quote.Signature, Date: "2026-06-15", TimeSlot: "morning"})
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	return p, quote.Total
+}
+
+func successCallback(checkoutID string, amount int64) *Callback {
+	var cb Callback
+	cb.Body.STKCallback.CheckoutRequestID = checkoutID
+	cb.Body.STKCallback.ResultCode = ResultSuccess
+	cb.Body.STKCallback.CallbackMetadata.Item = []CallbackItem{
+		{Name: "Amount", Value: float64(amount)},
+		{Name: "MpesaReceiptNumber", Value: "QKT1234567"},
+	}
+	return &cb
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"0712345678", "254712345678", true},
+		{"+254 712 345 678", "254712345678", true},
+		{"712345678", "254712345678", true},
+		{"0110123456", "254110123456", true},
+		{"0202345678", "", false},
+		{"12345", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizePhone(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInitiateValidationAndIdempotency(t *testing.T) {
+	provider := &fakeProvider{}
+	svc, b := newTestService(t, provider)
+	pickup, total := schedule(t, b, "alice")
+	unquoted, err := b.pickups.Create("alice", pickups.CreateRequest{
+		Address: "Westlands", Date: "2026-06-15", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "computers", Subcategory: "laptops", Quantity: 20}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	req := InitiateRequest{Purpose: PurposePremiumPickup, PickupID: pickup.ID, Phone: "0712345678", IdempotencyKey: "k1"}
+
+	invalid := []InitiateRequest{
+		{Purpose: "donation", PickupID: pickup.ID, Phone: "0712345678", IdempotencyKey: "x"},
+		{Purpose: PurposePremiumPickup, Phone: "0712345678", IdempotencyKey: "x"},
+		{Purpose: PurposeBulkCollection, PickupID: pickup.ID, Amount: -5, Phone: "0712345678", IdempotencyKey: "x"},
+		{Purpose: PurposeBulkCollection, PickupID: pickup.ID, Phone: "999", IdempotencyKey: "x"},
+		{Purpose: PurposeBulkCollection, PickupID: pickup.ID, Phone: "0712345678"},
+		// The client cannot choose what it pays.
+		{Purpose: PurposeBulkCollection, PickupID: pickup.ID, Amount: 1, Phone: "0712345678", IdempotencyKey: "x"},
+		// Pickups booked without a quote have nothing to pay.
+		{Purpose: PurposeBulkCollection, PickupID: unquoted.ID, Phone: "0712345678", IdempotencyKey: "x"},
+	}
+	for _, bad := range invalid {
+		if _, err := svc.Initiate(context.Background(), "alice", bad); !errors.Is(err, ErrInvalidPayment) {
+			t.Errorf("Initiate(%+v) error = %v, want ErrInvalidPayment", bad, err)
+		}
+	}
+	if _, err := svc.Initiate(context.Background(), "bob", req); !errors.Is(err, ErrInvalidPayment) {
+		t.Errorf("paying for another user's pickup: error = %v, want ErrInvalidPayment", err)
+	}
+
+	first, err := svc.Initiate(context.Background(), "alice", req)
+	if err != nil {
+		t.Fatalf("Initiate() error = %v", err)
+	}
+	if first.Status != StatusPending || first.CheckoutRequestID == "" || first.Phone != "254712345678" || first.Amount != total {
+		t.Errorf("unexpected payment %+v", first)
+	}
+	again, err := svc.Initiate(context.Background(), "alice", req)
+	if err != nil || again.ID != first.ID || provider.pushes != 1 {
+		t.Errorf("retry created a new push: id %s, pushes %d, err %v", again.ID, provider.pushes, err)
+	}
+	req.Amount = total
+	if again, err := svc.Initiate(context.Background(), "alice", req); err != nil || again.ID != first.ID {
+		t.Errorf("retry with the quoted amount: id %s, err %v", again.ID, err)
+	}
+	req.Purpose = PurposeBulkCollection
+	if _, err := svc.Initiate(context.Background(), "alice", req); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("reused key error = %v, want ErrIdempotencyConflict", err)
+	}
+
+	// A fresh key cannot start a second payment for the same pickup.
+	req.Purpose, req.IdempotencyKey = PurposePremiumPickup, "k2"
+	if again, err := svc.Initiate(context.Background(), "alice", req); err != nil || again.ID != first.ID || provider.pushes != 1 {
+		t.Errorf("second payment for the pickup: id %s, pushes %d, err %v", again.ID, provider.pushes, err)
+	}
+
+	cancelled, _ := schedule(t, b, "alice")
+	if _, err := b.pickups.Transition(cancelled.ID, pickups.StatusCancelled, "alice"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	req.PickupID, req.IdempotencyKey = cancelled.ID, "k3"
+	if _, err := svc.Initiate(context.Background(), "alice", req); !errors.Is(err, ErrInvalidPayment) {
+		t.Errorf("paying for a cancelled pickup: error = %v, want ErrInvalidPayment", err)
+	}
+}
+
+func TestInitiateProviderRejection(t *testing.T) {
+	svc, b := newTestService(t, &fakeProvider{reject: true})
+	pickup, _ := schedule(t, b, "alice")
+	payment, err := svc.Initiate(context.Background(), "alice", InitiateRequest{
+		Purpose: PurposeBulkCollection, PickupID: pickup.ID, Phone: "0712345678", IdempotencyKey: "k1",
+	})
+	if !errors.Is(err, ErrProviderRejected) {
+		t.Fatalf("Initiate() error = %v, want ErrProviderRejected", err)
+	}
+	if payment.Status != StatusFailed {
+		t.Errorf("status = %s, want %s", payment.Status, StatusFailed)
+	}
+}
+
+func TestHandleCallback(t *testing.T) {
+	svc, b := newTestService(t, &fakeProvider{})
+	pickup, total := schedule(t, b, "alice")
+	payment, err := svc.Initiate(context.Background(), "alice", InitiateRequest{
+		Purpose: PurposeBulkCollection, PickupID: pickup.ID, Phone: "0712345678", IdempotencyKey: "k1",
+	})
+	if err != nil {
+		t.Fatalf("Initiate() error = %v", err)
+	}
+	callback, _ := url.Parse(svc.CallbackURL(payment.ID))
+	sig := callback.Query().Get("sig")
+
+	if _, err := svc.HandleCallback(payment.ID, "forged", successCallback(payment.CheckoutRequestID, total)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("forged signature error = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := svc.HandleCallback(payment.ID, sig, successCallback("co_other", total)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("mismatched checkout error = %v, want ErrInvalidSignature", err)
+	}
+
+	paid, err := svc.HandleCallback(payment.ID, sig, successCallback(payment.CheckoutRequestID, total))
+	if err != nil {
+		t.Fatalf("HandleCallback() error = %v", err)
+	}
+	if paid.Status != StatusPaid || paid.ReceiptNumber != "QKT1234567" || paid.PaidAmount != total {
+		t.Errorf("unexpected payment after callback %+v", paid)
+	}
+
+	// A late failure callback for the same push must not undo the payment.
+	failed := successCallback(payment.CheckoutRequestID, 0)
+	failed.Body.STKCallback.ResultCode = ResultCancelled
+	again, err := svc.HandleCallback(payment.ID, sig, failed)
+	if err != nil || again.Status != StatusPaid {
+		t.Errorf("duplicate callback changed payment: %+v, %v", again, err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	provider := &fakeProvider{status: StatusResult{ResultCode: ResultSuccess}}
+	svc, b := newTestService(t, provider)
+	pickupService := b.pickups
+
+	cancelled, _ := schedule(t, b, "alice")
+	collected, _ := schedule(t, b, "alice")
+	for _, p := range []*pickups.Pickup{cancelled, collected} {
+		if _, err := svc.Initiate(context.Background(), "alice", InitiateRequest{
+			Purpose: PurposePremiumPickup, PickupID: p.ID, Phone: "0712345678", IdempotencyKey: p.ID,
+		}); err != nil {
+			t.Fatalf("Initiate() error = %v", err)
+		}
+	}
+
+	if _, err := pickupService.Transition(cancelled.ID, pickups.StatusCancelled, "alice"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected} {
+		if _, err := pickupService.Transition(collected.ID, status, "collector"); err != nil {
+			t.Fatalf("Transition() error = %v", err)
+		}
+	}
+
+	report, err := svc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if report.Checked != 2 || len(report.Updated) != 2 {
+		t.Fatalf("checked %d, updated %d; want 2, 2", report.Checked, len(report.Updated))
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Type != MismatchRefundDue || report.Mismatches[0].PickupID != cancelled.ID {
+		t.Errorf("unexpected mismatches %+v", report.Mismatches)
+	}
+
+	// With the provider reporting cancellation, the collected pickup is left unpaid.
+	provider.status = StatusResult{ResultCode: ResultCancelled, Description: "Request cancelled by user"}
+	third, _ := schedule(t, b, "alice")
+	if _, err := svc.Initiate(context.Background(), "alice", InitiateRequest{
+		Purpose: PurposePremiumPickup, PickupID: third.ID, Phone: "0712345678", IdempotencyKey: third.ID,
+	}); err != nil {
+		t.Fatalf("Initiate() error = %v", err)
+	}
+	for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected} {
+		if _, err := pickupService.Transition(third.ID, status, "collector"); err != nil {
+			t.Fatalf("Transition() error = %v", err)
+		}
+	}
+	report, err = svc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	var unpaid int
+	for _, m := range report.Mismatches {
+		if m.Type == MismatchUnpaidPickup && m.PickupID == third.ID {
+			unpaid++
+		}
+	}
+	if unpaid != 1 {
+		t.Errorf("expected one unpaid_pickup mismatch for %s, got %+v", third.ID, report.Mismatches)
+	}
+}
+
+func TestReconcileReportsDuplicatePayments(t *testing.T) {
+	svc, b := newTestService(t, &fakeProvider{status: StatusResult{ResultCode: ResultSuccess}})
+	pickup, _ := schedule(t, b, "alice")
+	payment, err := svc.Initiate(context.Background(), "alice", InitiateRequest{
+		Purpose: PurposePremiumPickup, PickupID: pickup.ID, Phone: "0712345678", IdempotencyKey: "k1",
+	})
+	if err != nil {
+		t.Fatalf("Initiate() error = %v", err)
+	}
+	if _, err := svc.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if payment, err = svc.Get(payment.ID); err != nil || payment.Status != StatusPaid {
+		t.Fatalf("payment after reconcile: %+v, %v", payment, err)
+	}
+
+	// A second confirmed payment, as left behind before duplicates were refused.
+	duplicate := *payment
+	duplicate.ID, duplicate.IdempotencyKey, duplicate.CheckoutRequestID = "dup", "k2", "ws_CO_dup"
+	duplicate.CreatedAt = duplicate.CreatedAt.Add(time.Minute)
+	if err := svc.store.Update(func(tx *store.Tx) error {
+		return tx.Put(paymentsBucket, duplicate.ID, &duplicate)
+	}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	report, err := svc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Type != MismatchDuplicate || report.Mismatches[0].PaymentID != "dup" {
+		t.Errorf("unexpected mismatches %+v", report.Mismatches)
+	}
+}
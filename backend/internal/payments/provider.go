@@ -0,0 +1,70 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Provider result codes shared by all providers. They follow Daraja, where 0 is success.
+const (
+	ResultSuccess   = 0
+	ResultCancelled = 1032
+	ResultTimeout   = 1037
+)
+
+// ErrProviderRejected is returned when the provider refuses to start a payment.
+var ErrProviderRejected = errors.New("payment provider rejected the request")
+
+// PushRequest asks the provider to prompt a customer's phone for payment.
+type PushRequest struct {
+	Phone       string
+	Amount      int64
+	Reference   string
+	Description string
+	CallbackURL string
+}
+
+// PushResponse identifies a prompt sent by the provider.
+type PushResponse struct {
+	MerchantRequestID string
+	CheckoutRequestID string
+	CustomerMessage   string
+}
+
+// StatusResult is the outcome of a payment as reported by the provider.
+// Pending is true while the customer has not yet responded.
+type StatusResult struct {
+	Pending     bool
+	ResultCode  int
+	Description string
+}
+
+// Provider is a mobile-money gateway that can push payment prompts to phones.
+type Provider interface {
+	Name() string
+	InitiatePush(ctx context.Context, req PushRequest) (*PushResponse, error)
+	QueryStatus(ctx context.Context, checkoutRequestID string) (*StatusResult, error)
+}
+
+// NormalizePhone converts Kenyan mobile numbers such as 0712345678 or
+// +254712345678 into the 2547XXXXXXXX form expected by providers.
+func NormalizePhone(phone string) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	switch {
+	case len(digits) == 10 && strings.HasPrefix(digits, "0"):
+		digits = "254" + digits[1:]
+	case len(digits) == 9 && (digits[0] == '7' || digits[0] == '1'):
+		digits = "254" + digits
+	}
+	if len(digits) != 12 || !strings.HasPrefix(digits, "254") || (digits[3] != '7' && digits[3] != '1') {
+		return "", false
+	}
+	return digits, true
+}
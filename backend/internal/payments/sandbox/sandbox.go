@@ -0,0 +1,271 @@
+// Package sandbox is a local stand-in for the Daraja API. It accepts the same
+// OAuth, STK push and query requests and delivers callbacks, so payments can
+// be developed and tested without Safaricom credentials or network access.
+package sandbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+)
+
+// Token is the access token issued by the sandbox.
+const Token = "sandbox-token"
+
+// push is an STK push the sandbox has accepted.
+type push struct {
+	merchantRequestID string
+	receipt           string
+	amount            int64
+	phone             string
+	callbackURL       string
+	completed         bool
+	resultCode        int
+}
+
+// Server mimics the Daraja endpoints used by payments.DarajaProvider.
+type Server struct {
+	// AutoComplete, when positive, settles every push successfully after the
+	// given delay, as if the customer had entered their PIN.
+	AutoComplete time.Duration
+
+	mu     sync.Mutex
+	seq    int
+	pushes map[string]*push
+	client *http.Client
+}
+
+// NewServer creates an empty sandbox.
+func NewServer() *Server {
+	return &Server{pushes: map[string]*push{}, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Start serves the sandbox on a free local port and returns its base URL.
+func (s *Server) Start() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("error starting payments sandbox: %w", err)
+	}
+	go func() {
+		if err := http.Serve(listener, s.Handler()); err != nil {
+			log.Printf("payments sandbox stopped: %v", err)
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Handler returns the sandbox's HTTP handler.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/v1/generate", s.oauth)
+	mux.HandleFunc("/mpesa/stkpush/v1/processrequest", s.stkPush)
+	mux.HandleFunc("/mpesa/stkpushquery/v1/query", s.stkQuery)
+	return mux
+}
+
+func (s *Server) oauth(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok || r.URL.Query().Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorMessage": "Invalid grant type passed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": Token, "expires_in": "3599"})
+}
+
+func (s *Server) stkPush(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	var req struct {
+		Amount      int64  `json:"Amount"`
+		PhoneNumber string `json:"PhoneNumber"`
+		CallBackURL string `json:"CallBackURL"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 || req.CallBackURL == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorMessage": "Bad Request - Invalid request"})
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	checkoutID := fmt.Sprintf("ws_CO_sandbox_%d", s.seq)
+	p := &push{
+		merchantRequestID: fmt.Sprintf("sandbox-%d", s.seq),
+		receipt:           fmt.Sprintf("SBX%07d", s.seq),
+		amount:            req.Amount,
+		phone:             req.PhoneNumber,
+		callbackURL:       req.CallBackURL,
+	}
+	s.pushes[checkoutID] = p
+	s.mu.Unlock()
+
+	if s.AutoComplete > 0 {
+		time.AfterFunc(s.AutoComplete, func() {
+			if err := s.Complete(checkoutID, payments.ResultSuccess); err != nil {
+				log.Printf("payments sandbox: %v", err)
+			}
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"MerchantRequestID":   p.merchantRequestID,
+		"CheckoutRequestID":   checkoutID,
+		"ResponseCode":        "0",
+		"ResponseDescription": "Success. Request accepted for processing",
+		"CustomerMessage":     "Success. Request accepted for processing",
+	})
+}
+
+func (s *Server) stkQuery(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	var req struct {
+		CheckoutRequestID string `json:"CheckoutRequestID"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errorMessage": "Bad Request - Invalid request"})
+		return
+	}
+
+	s.mu.Lock()
+	p, ok := s.pushes[req.CheckoutRequestID]
+	var completed bool
+	var code int
+	if ok {
+		completed, code = p.completed, p.resultCode
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusNotFound, map[string]string{"errorCode": "404.001.04", "errorMessage": "Invalid CheckoutRequestID"})
+	case !completed:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"errorCode": "500.001.1001", "errorMessage": "The transaction is being processed"})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{
+			"ResponseCode": "0",
+			"ResultCode":   strconv.Itoa(code),
+			"ResultDesc":   resultDescription(code),
+		})
+	}
+}
+
+// Settle records the customer's response to a push without sending a
+// callback, as happens when Daraja fails to reach the callback URL.
+func (s *Server) Settle(checkoutID string, resultCode int) error {
+	_, err := s.settle(checkoutID, resultCode)
+	return err
+}
+
+// Complete settles a push and posts the callback to the URL it was registered with.
+func (s *Server) Complete(checkoutID string, resultCode int) error {
+	cb, err := s.settle(checkoutID, resultCode)
+	if err != nil {
+		return err
+	}
+	return s.deliver(cb.url, cb.body)
+}
+
+// Redeliver posts the callback of a settled push again, as Daraja sometimes does.
+func (s *Server) Redeliver(checkoutID string) error {
+	s.mu.Lock()
+	p, ok := s.pushes[checkoutID]
+	if !ok || !p.completed {
+		s.mu.Unlock()
+		return fmt.Errorf("no settled push %s", checkoutID)
+	}
+	cb := callbackFor(checkoutID, p)
+	s.mu.Unlock()
+	return s.deliver(cb.url, cb.body)
+}
+
+type callback struct {
+	url  string
+	body []byte
+}
+
+func (s *Server) settle(checkoutID string, resultCode int) (callback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pushes[checkoutID]
+	if !ok {
+		return callback{}, fmt.Errorf("unknown checkout request %s", checkoutID)
+	}
+	if p.completed {
+		return callback{}, fmt.Errorf("checkout request %s already settled", checkoutID)
+	}
+	p.completed = true
+	p.resultCode = resultCode
+	return callbackFor(checkoutID, p), nil
+}
+
+func callbackFor(checkoutID string, p *push) callback {
+	var cb payments.Callback
+	result := &cb.Body.STKCallback
+	result.MerchantRequestID = p.merchantRequestID
+	result.CheckoutRequestID = checkoutID
+	result.ResultCode = p.resultCode
+	result.ResultDesc = resultDescription(p.resultCode)
+	if p.resultCode == payments.ResultSuccess {
+		phone, _ := strconv.ParseInt(p.phone, 10, 64)
+		result.CallbackMetadata.Item = []payments.CallbackItem{
+			{Name: "Amount", Value: p.amount},
+			{Name: "MpesaReceiptNumber", Value: p.receipt},
+			{Name: "TransactionDate", Value: time.Now().Format("20060102150405")},
+			{Name: "PhoneNumber", Value: phone},
+		}
+	}
+	body, _ := json.Marshal(cb)
+	return callback{url: p.callbackURL, body: body}
+}
+
+func (s *Server) deliver(url string, body []byte) error {
+	resp, err := s.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error delivering callback: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"errorMessage": "Method not allowed"})
+		return false
+	}
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"errorCode": "404.001.03", "errorMessage": "Invalid Access Token"})
+		return false
+	}
+	return true
+}
+
+func resultDescription(code int) string {
+	switch code {
+	case payments.ResultSuccess:
+		return "The service request is processed successfully."
+	case payments.ResultCancelled:
+		return "Request cancelled by user"
+	case payments.ResultTimeout:
+		return "DS timeout user cannot be reached"
+	default:
+		return "The transaction failed"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
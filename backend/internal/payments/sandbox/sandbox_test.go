@@ -0,0 +1,126 @@
+package sandbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/handlers"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/payments"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// newFlow wires a payment service to the sandbox and serves its callback
+// endpoint. Payments are for pickups booked from quotes.
+func newFlow(t *testing.T) (*Server, *payments.Service, *quotes.Service) {
+	t.Helper()
+	server := NewServer()
+	daraja := httptest.NewServer(server.Handler())
+	t.Cleanup(daraja.Close)
+
+	var svc *payments.Service
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.NewPaymentsHandler(svc).Callback(w, r)
+	}))
+	t.Cleanup(app.Close)
+
+	provider := payments.NewDarajaProvider(payments.DarajaConfig{
+		BaseURL: daraja.URL, ConsumerKey: "key", ConsumerSecret: "secret", ShortCode: "174379", Passkey: "passkey",
+	})
+	db := store.NewMemory()
+	if err := items.NewService(db).Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	quoteService := quotes.NewService(db, pickups.NewService(db), quotes.DefaultPriceList, quotes.DefaultHubs, []byte("secret"))
+	svc = payments.NewService(db, provider, app.URL+"/api/payments/callback", []byte("callback-secret"))
+	return server, svc, quoteService
+}
+
+// initiate books a pickup for alice from a quote and starts paying for it.
+func initiate(t *testing.T, svc *payments.Service, quoteService *quotes.Service, key string) *payments.Payment {
+	t.Helper()
+	quote, err := quoteService.Issue("alice", quotes.Request{
+		Address: "Westlands", Location: geo.Point{Lat: -1.2676, Lng: 36.8108},
+		Items: []pickups.Item{{Category: "computers", Subcategory: "laptops", Quantity: 20}},
+	})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	_, p, err := quoteService.Accept("alice", quotes.AcceptRequest{QuoteID: quote.ID, Signature: quote.Signature, Date: "2026-06-15", TimeSlot: "morning"})
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	payment, err := svc.Initiate(context.Background(), "alice", payments.InitiateRequest{
+		Purpose: payments.PurposeBulkCollection, PickupID: p.ID, Phone: "0712345678", IdempotencyKey: key,
+	})
+	if err != nil {
+		t.Fatalf("Initiate() error = %v", err)
+	}
+	return payment
+}
+
+func TestCallbackFlow(t *testing.T) {
+	tests := []struct {
+		name       string
+		resultCode int
+		wantStatus string
+	}{
+		{name: "Customer pays", resultCode: payments.ResultSuccess, wantStatus: payments.StatusPaid},
+		{name: "Customer cancels", resultCode: payments.ResultCancelled, wantStatus: payments.StatusFailed},
+		{name: "Phone unreachable", resultCode: payments.ResultTimeout, wantStatus: payments.StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, svc, quoteService := newFlow(t)
+			payment := initiate(t, svc, quoteService, "k1")
+			if payment.Status != payments.StatusPending || payment.CheckoutRequestID == "" {
+				t.Fatalf("unexpected payment after push %+v", payment)
+			}
+
+			if err := server.Complete(payment.CheckoutRequestID, tt.resultCode); err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			if err := server.Redeliver(payment.CheckoutRequestID); err != nil {
+				t.Fatalf("duplicate callback was rejected: %v", err)
+			}
+
+			got, err := svc.Get(payment.ID)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == payments.StatusPaid && (got.ReceiptNumber == "" || got.PaidAmount != payment.Amount) {
+				t.Errorf("paid payment missing receipt or amount: %+v", got)
+			}
+		})
+	}
+}
+
+func TestReconcileMissedCallback(t *testing.T) {
+	server, svc, quoteService := newFlow(t)
+	missed := initiate(t, svc, quoteService, "k1")
+	waiting := initiate(t, svc, quoteService, "k2")
+
+	if err := server.Settle(missed.CheckoutRequestID, payments.ResultSuccess); err != nil {
+		t.Fatalf("Settle() error = %v", err)
+	}
+
+	report, err := svc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if report.Checked != 2 || len(report.Updated) != 1 || report.Updated[0].ID != missed.ID {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if got, _ := svc.Get(waiting.ID); got.Status != payments.StatusPending {
+		t.Errorf("payment still awaiting the customer became %s", got.Status)
+	}
+}
@@ -0,0 +1,60 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestDocumentStructure(t *testing.T) {
+	doc := New("Invoice (draft)")
+	doc.Text(50, 50, 12, true, "Hello (world) \\ KES")
+	doc.Line(50, 60, 545, 60)
+	doc.AddPage()
+	doc.TextRight(545, 80, 10, false, "1,234.00")
+	out := doc.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+	if !bytes.Contains(out, []byte(`(Hello \(world\) \\ KES)`)) {
+		t.Errorf("text was not escaped")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Errorf("expected two pages")
+	}
+
+	// Every xref entry must point at the start of its object.
+	match := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	if match == nil {
+		t.Fatalf("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, out[offset:offset+10])
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"a(b)c", `a\(b\)c`},
+		{"tab\there", "tab here"},
+		{"Nairobi – CBD", "Nairobi ? CBD"},
+		{"café", "caf\xe9"},
+	}
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
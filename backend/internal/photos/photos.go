@@ -0,0 +1,300 @@
+// Package photos stores photos of pickup items, stripped of metadata, and
+// serves them through signed, time-limited URLs.
+package photos
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// photosBucket holds photo records keyed by ID.
+const photosBucket = "photos"
+
+// Photo kinds. Residents document the condition of their devices; collectors
+// also take proof of collection.
+const (
+	KindCondition = "condition"
+	KindProof     = "proof"
+)
+
+// Sizes a photo can be fetched in.
+const (
+	SizeFull  = "full"
+	SizeThumb = "thumb"
+)
+
+const (
+	// MaxUploadBytes caps the size of an uploaded file.
+	MaxUploadBytes = 10 << 20
+	// DefaultURLTTL is how long signed URLs stay valid.
+	DefaultURLTTL = 15 * time.Minute
+	// FilePath is where signed URLs point.
+	FilePath = "/api/photos/file"
+	// maxCaption caps caption length.
+	maxCaption = 200
+)
+
+var (
+	// ErrNotFound is returned when a photo does not exist.
+	ErrNotFound = errors.New("photo not found")
+	// ErrInvalidImage is returned for uploads that are not a usable JPEG or PNG.
+	ErrInvalidImage = errors.New("invalid image")
+	// ErrTooLarge is returned for uploads over MaxUploadBytes.
+	ErrTooLarge = fmt.Errorf("photos are limited to %d MB", MaxUploadBytes>>20)
+	// ErrInvalidKind is returned for an unknown kind, or one the actor may not attach.
+	ErrInvalidKind = errors.New("invalid photo kind")
+	// ErrForbidden is returned when the actor may not attach photos to the pickup.
+	ErrForbidden = errors.New("not allowed to attach photos to this pickup")
+	// ErrInvalidSignature is returned when a file URL has been tampered with.
+	ErrInvalidSignature = errors.New("invalid photo link")
+	// ErrExpired is returned when a signed URL is past its expiry.
+	ErrExpired = errors.New("photo link has expired")
+)
+
+// Actor is the user uploading or viewing photos. What they may do follows
+// from their relationship to the pickup: its resident, its collector or an admin.
+type Actor struct {
+	UID   string
+	Admin bool
+}
+
+// Photo is a stored photo of a pickup's items.
+type Photo struct {
+	ID          string    `json:"id"`
+	PickupID    string    `json:"pickup_id"`
+	UploadedBy  string    `json:"uploaded_by"`
+	Kind        string    `json:"kind"`
+	Caption     string    `json:"caption,omitempty"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Signed is a photo with links to fetch it.
+type Signed struct {
+	*Photo
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Service stores and signs photos.
+type Service struct {
+	store   *store.Store
+	storage Storage
+	secret  []byte
+	now     func() time.Time
+}
+
+// NewService creates a photo service keeping files in storage and signing
+// URLs with secret.
+func NewService(s *store.Store, storage Storage, secret []byte) *Service {
+	return &Service{store: s, storage: storage, secret: secret, now: time.Now}
+}
+
+// Upload attaches a photo to a pickup on behalf of actor.
+func (s *Service) Upload(actor Actor, pickupID, kind, caption string, data []byte) (*Photo, error) {
+	err := s.store.View(func(tx *store.Tx) error {
+		return authorize(tx, actor, pickupID, kind)
+	})
+	if err != nil {
+		return nil, err
+	}
+	img, err := Process(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var photo *Photo
+	err = s.store.Update(func(tx *store.Tx) error {
+		// The pickup may have been reassigned while the image was processed.
+		if err := authorize(tx, actor, pickupID, kind); err != nil {
+			return err
+		}
+		photo, err = s.AddTx(tx, pickupID, actor.UID, kind, caption, img)
+		return err
+	})
+	return photo, err
+}
+
+// authorize checks that actor may attach a photo of kind to a pickup.
+func authorize(tx *store.Tx, actor Actor, pickupID, kind string) error {
+	if kind != KindCondition && kind != KindProof {
+		return fmt.Errorf("%w: %q", ErrInvalidKind, kind)
+	}
+	pickup, err := pickups.GetTx(tx, pickupID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case actor.Admin, pickup.CollectorID == actor.UID:
+	case pickup.UserID == actor.UID:
+		if kind != KindCondition {
+			return fmt.Errorf("%w: residents may only attach %s photos", ErrInvalidKind, KindCondition)
+		}
+	default:
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AddTx stores a photo prepared by Process inside tx without access checks,
+// for callers that have already authorised the uploader. Files are written
+// before the record commits; a rolled back transaction leaves them orphaned
+// but unreachable.
+func (s *Service) AddTx(tx *store.Tx, pickupID, uid, kind, caption string, img *Image) (*Photo, error) {
+	if kind != KindCondition && kind != KindProof {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKind, kind)
+	}
+	caption = strings.TrimSpace(caption)
+	if r := []rune(caption); len(r) > maxCaption {
+		caption = string(r[:maxCaption])
+	}
+
+	seq, err := tx.NextSequence(photosBucket)
+	if err != nil {
+		return nil, err
+	}
+	photo := &Photo{
+		ID:          fmt.Sprintf("ph_%d", seq),
+		PickupID:    pickupID,
+		UploadedBy:  uid,
+		Kind:        kind,
+		Caption:     caption,
+		ContentType: img.contentType,
+		Width:       img.width,
+		Height:      img.height,
+		Size:        len(img.full),
+		CreatedAt:   s.now().UTC(),
+	}
+	if err := s.storage.Put(objectKey(photo, SizeFull), img.full); err != nil {
+		return nil, err
+	}
+	if err := s.storage.Put(objectKey(photo, SizeThumb), img.thumb); err != nil {
+		return nil, err
+	}
+	if err := tx.Insert(photosBucket, photo.ID, photo); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// List returns the photos of a pickup, oldest first, if actor may see them.
+func (s *Service) List(actor Actor, pickupID string) ([]*Photo, error) {
+	list := []*Photo{}
+	err := s.store.View(func(tx *store.Tx) error {
+		pickup, err := pickups.GetTx(tx, pickupID)
+		if err != nil {
+			return err
+		}
+		if !actor.Admin && pickup.UserID != actor.UID && pickup.CollectorID != actor.UID {
+			return pickups.ErrNotFound
+		}
+		return tx.ForEach(photosBucket, func(key string, raw json.RawMessage) error {
+			var p Photo
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return fmt.Errorf("error decoding photo %s: %w", key, err)
+			}
+			if p.PickupID == pickupID {
+				list = append(list, &p)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Get returns a photo record.
+func (s *Service) Get(id string) (*Photo, error) {
+	var p Photo
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.Get(photosBucket, id, &p)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Sign returns p with links valid for ttl.
+func (s *Service) Sign(p *Photo, ttl time.Duration) Signed {
+	expires := s.now().Add(ttl).Truncate(time.Second)
+	return Signed{
+		Photo:        p,
+		URL:          s.url(p.ID, SizeFull, expires),
+		ThumbnailURL: s.url(p.ID, SizeThumb, expires),
+		ExpiresAt:    expires.UTC(),
+	}
+}
+
+func (s *Service) url(id, size string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q := url.Values{"id": {id}, "size": {size}, "expires": {exp}, "sig": {s.signature(id, size, exp)}}
+	return FilePath + "?" + q.Encode()
+}
+
+func (s *Service) signature(id, size, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id + "\n" + size + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Open verifies a signed link and returns the file it points to.
+func (s *Service) Open(id, size, expires, sig string) (io.ReadCloser, *Photo, error) {
+	if !hmac.Equal([]byte(sig), []byte(s.signature(id, size, expires))) {
+		return nil, nil, ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, nil, ErrInvalidSignature
+	}
+	if s.now().After(time.Unix(unix, 0)) {
+		return nil, nil, ErrExpired
+	}
+	if size != SizeFull && size != SizeThumb {
+		return nil, nil, ErrInvalidSignature
+	}
+	photo, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.storage.Open(objectKey(photo, size))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, photo, nil
+}
+
+// objectKey names the file holding one size of a photo.
+func objectKey(p *Photo, size string) string {
+	ext := ".jpg"
+	if p.ContentType == "image/png" {
+		ext = ".png"
+	}
+	return p.PickupID + "/" + p.ID + "_" + size + ext
+}
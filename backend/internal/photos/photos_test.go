@@ -0,0 +1,223 @@
+package photos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// testJPEG encodes a w x h image whose left half is red, with an EXIF block
+// holding orientation and a GPS marker when orientation is non-zero.
+func testJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x < w/2 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if orientation == 0 {
+		return buf.Bytes()
+	}
+
+	// Little-endian TIFF with one IFD entry for orientation, followed by a
+	// stand-in for GPS coordinates that must not survive re-encoding.
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), []byte("\x00\x00\x00\x00GPS-1.2921,36.7856")...)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(app1)+2))
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(append(out, segment...), app1...)
+	return append(out, data[2:]...)
+}
+
+func newTestService(t *testing.T) (*Service, *pickups.Pickup) {
+	t.Helper()
+	storage, err := NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+	db := store.NewMemory()
+	svc := NewService(db, storage, []byte("secret"))
+	svc.now = func() time.Time { return time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC) }
+
+	pickupService := pickups.NewService(db)
+	p, err := pickupService.Create("resident", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "computers", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if p, err = pickupService.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	return svc, p
+}
+
+func TestProcessStripsMetadataAndOrients(t *testing.T) {
+	data := testJPEG(t, 40, 20, 6)
+	if exifOrientation(data) != 6 {
+		t.Fatalf("test image orientation = %d", exifOrientation(data))
+	}
+	out, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if bytes.Contains(out.full, []byte("Exif")) || bytes.Contains(out.full, []byte("GPS")) {
+		t.Error("metadata survived re-encoding")
+	}
+	if out.width != 20 || out.height != 40 || out.contentType != "image/jpeg" {
+		t.Errorf("got %dx%d %s, want upright 20x40 jpeg", out.width, out.height, out.contentType)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out.full))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotating clockwise puts the red left half on top.
+	if r, _, b, _ := img.At(10, 5).RGBA(); r < b {
+		t.Errorf("top of rotated image is not red")
+	}
+}
+
+func TestProcessScalesAndThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 3000, 1000)))
+	out, err := Process(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if out.width != MaxDimension || out.height != 682 || out.contentType != "image/png" {
+		t.Errorf("got %dx%d %s", out.width, out.height, out.contentType)
+	}
+	thumb, err := png.DecodeConfig(bytes.NewReader(out.thumb))
+	if err != nil || thumb.Width != ThumbDimension {
+		t.Errorf("thumbnail = %+v, %v", thumb, err)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	var gifData bytes.Buffer
+	gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 2, 2), []color.Color{color.Black}), nil)
+	for name, data := range map[string][]byte{
+		"Text":      []byte("not an image"),
+		"GIF":       gifData.Bytes(),
+		"Truncated": testJPEG(t, 40, 20, 0)[:100],
+	} {
+		if _, err := Process(data); !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("%s: Process() error = %v, want ErrInvalidImage", name, err)
+		}
+	}
+}
+
+func TestUploadAccess(t *testing.T) {
+	svc, p := newTestService(t)
+	data := testJPEG(t, 40, 20, 0)
+	tests := []struct {
+		name  string
+		actor Actor
+		kind  string
+		want  error
+	}{
+		{"Resident condition", Actor{UID: "resident"}, KindCondition, nil},
+		{"Resident proof", Actor{UID: "resident"}, KindProof, ErrInvalidKind},
+		{"Collector proof", Actor{UID: "col1"}, KindProof, nil},
+		{"Admin", Actor{UID: "boss", Admin: true}, KindCondition, nil},
+		{"Stranger", Actor{UID: "mallory"}, KindCondition, ErrForbidden},
+		{"Unknown kind", Actor{UID: "col1"}, "selfie", ErrInvalidKind},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Upload(tt.actor, p.ID, tt.kind, "", data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Upload() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	list, err := svc.List(Actor{UID: "resident"}, p.ID)
+	if err != nil || len(list) != 3 {
+		t.Errorf("List() = %d photos, %v", len(list), err)
+	}
+	if _, err := svc.List(Actor{UID: "mallory"}, p.ID); !errors.Is(err, pickups.ErrNotFound) {
+		t.Errorf("List(stranger) error = %v, want ErrNotFound", err)
+	}
+	if _, err := svc.Upload(Actor{UID: "resident"}, p.ID, KindCondition, "", make([]byte, MaxUploadBytes+1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Upload(oversized) error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestSignedURLs(t *testing.T) {
+	svc, p := newTestService(t)
+	photo, err := svc.Upload(Actor{UID: "resident"}, p.ID, KindCondition, "Cracked screen", testJPEG(t, 40, 20, 0))
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	signed := svc.Sign(photo, DefaultURLTTL)
+	link, err := url.Parse(signed.ThumbnailURL)
+	if err != nil || link.Path != FilePath {
+		t.Fatalf("bad link %q", signed.ThumbnailURL)
+	}
+	q := link.Query()
+
+	rc, got, err := svc.Open(q.Get("id"), q.Get("size"), q.Get("expires"), q.Get("sig"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if got.ID != photo.ID || len(body) == 0 {
+		t.Errorf("Open() = %s, %d bytes", got.ID, len(body))
+	}
+
+	if _, _, err := svc.Open(q.Get("id"), SizeFull, q.Get("expires"), q.Get("sig")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Open(other size) error = %v, want ErrInvalidSignature", err)
+	}
+	svc.now = func() time.Time { return signed.ExpiresAt.Add(time.Second) }
+	if _, _, err := svc.Open(q.Get("id"), q.Get("size"), q.Get("expires"), q.Get("sig")); !errors.Is(err, ErrExpired) {
+		t.Errorf("Open(expired) error = %v, want ErrExpired", err)
+	}
+}
+
+func TestDiskStorageRejectsEscapes(t *testing.T) {
+	storage, err := NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../outside.jpg", "/etc/passwd", "a/../../b"} {
+		if err := storage.Put(key, []byte("x")); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+	if _, err := storage.Open("missing.jpg"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Open(missing) error = %v, want ErrObjectNotFound", err)
+	}
+}
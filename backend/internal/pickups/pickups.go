@@ -0,0 +1,405 @@
+package pickups
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// pickupsBucket holds every pickup keyed by ID.
+const pickupsBucket = "pickups"
+
+// Pickup lifecycle states.
+const (
+	StatusScheduled = "scheduled"
+	StatusAssigned  = "assigned"
+	StatusCollected = "collected"
+	StatusProcessed = "processed"
+	StatusCancelled = "cancelled"
+)
+
+// transitions lists the states each state may move to.
+var transitions = map[string][]string{
+	StatusScheduled: {StatusAssigned, StatusCancelled},
+	StatusAssigned:  {StatusScheduled, StatusCollected, StatusCancelled},
+	StatusCollected: {StatusProcessed, StatusCancelled},
+	StatusProcessed: {StatusCancelled},
+}
+
+// Time slots offered on the schedule form.
+var timeSlots = map[string]bool{"morning": true, "afternoon": true, "evening": true}
+
+var (
+	// ErrNotFound is returned when a pickup does not exist.
+	ErrNotFound = errors.New("pickup not found")
+	// ErrInvalidTransition is returned when a status change is not allowed from the current state.
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrNotAllowed is returned when the actor may not change a pickup.
+	ErrNotAllowed = errors.New("not allowed to change this pickup")
+	// ErrInvalidPickup is returned when a pickup request fails validation.
+	ErrInvalidPickup = errors.New("invalid pickup")
+	// ErrOutsideServiceArea is returned when a pickup location is not covered by any service area.
+	ErrOutsideServiceArea = errors.New("location is outside our service areas")
+)
+
+// Item is one kind of device handed over in a pickup. WeightKg is the weight
+// the resident declared and MeasuredWeightKg the one the collector weighed at
+// the door; neither overwrites the other.
+type Item struct {
+	Category         string  `json:"category"`
+	Subcategory      string  `json:"subcategory,omitempty"`
+	Condition        string  `json:"condition,omitempty"`
+	Quantity         int     `json:"quantity"`
+	WeightKg         float64 `json:"weight_kg,omitempty"`
+	MeasuredWeightKg float64 `json:"measured_weight_kg,omitempty"`
+	Manufacturer     string  `json:"manufacturer,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	Year             string  `json:"year,omitempty"`
+	SerialNumber     string  `json:"serial_number,omitempty"`
+}
+
+// EarningWeightKg is the weight points are earned and reported on: the
+// measured weight once the item has been weighed, the declared one until then.
+func (i Item) EarningWeightKg() float64 {
+	if i.MeasuredWeightKg > 0 {
+		return i.MeasuredWeightKg
+	}
+	return i.WeightKg
+}
+
+// StatusChange records a single lifecycle transition.
+type StatusChange struct {
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Actor string    `json:"actor"`
+	At    time.Time `json:"at"`
+}
+
+// Pickup is a request to collect e-waste from a user.
+type Pickup struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id"`
+	Address     string         `json:"address"`
+	Location    *geo.Point     `json:"location,omitempty"`
+	County      string         `json:"county,omitempty"`
+	SubCounty   string         `json:"sub_county,omitempty"`
+	ServiceArea string         `json:"service_area,omitempty"`
+	AreaWarning string         `json:"area_warning,omitempty"`
+	Date        string         `json:"date"`
+	TimeSlot    string         `json:"time_slot"`
+	Notes       string         `json:"notes,omitempty"`
+	Items       []Item         `json:"items"`
+	Status      string         `json:"status"`
+	CollectorID string         `json:"collector_id,omitempty"`
+	PartnerID   string         `json:"partner_id,omitempty"`
+	History     []StatusChange `json:"history"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// ChangedAt returns when the pickup last entered status, or the zero time.
+func (p *Pickup) ChangedAt(status string) time.Time {
+	for i := len(p.History) - 1; i >= 0; i-- {
+		if p.History[i].To == status {
+			return p.History[i].At
+		}
+	}
+	return time.Time{}
+}
+
+// CreateRequest holds the fields a user submits when scheduling a pickup.
+type CreateRequest struct {
+	Address  string     `json:"address"`
+	Location *geo.Point `json:"location,omitempty"`
+	Date     string     `json:"date"`
+	TimeSlot string     `json:"time_slot"`
+	Notes    string     `json:"notes"`
+	Items    []Item     `json:"items"`
+}
+
+// Listener is notified of every status change inside the transaction that
+// makes it, so side effects commit or roll back together with the change.
+type Listener func(tx *store.Tx, p *Pickup, from string) error
+
+// Screen inspects a new pickup before it is stored. It may fill in derived
+// fields such as the county, or return an error to refuse the booking.
+type Screen func(tx *store.Tx, p *Pickup) error
+
+// Service manages pickups and their lifecycle.
+type Service struct {
+	store     *store.Store
+	now       func() time.Time
+	screens   []Screen
+	listeners []Listener
+}
+
+// NewService creates a pickup service backed by s.
+func NewService(s *store.Store) *Service {
+	return &Service{store: s, now: time.Now}
+}
+
+// Subscribe registers l to be called on every status change, including creation.
+func (s *Service) Subscribe(l Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// AddScreen installs a check run on every new pickup. Screens run in the
+// order they were added.
+func (s *Service) AddScreen(screen Screen) {
+	s.screens = append(s.screens, screen)
+}
+
+// Create validates req and schedules a new pickup for uid.
+func (s *Service) Create(uid string, req CreateRequest) (*Pickup, error) {
+	var pickup *Pickup
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		pickup, err = s.CreateTx(tx, uid, req)
+		return err
+	})
+	return pickup, err
+}
+
+// CreateTx schedules a new pickup inside an existing transaction.
+func (s *Service) CreateTx(tx *store.Tx, uid string, req CreateRequest) (*Pickup, error) {
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	seq, err := tx.NextSequence(pickupsBucket)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	pickup := &Pickup{
+		ID:        fmt.Sprintf("pk_%d", seq),
+		UserID:    uid,
+		Address:   strings.TrimSpace(req.Address),
+		Location:  req.Location,
+		Date:      req.Date,
+		TimeSlot:  req.TimeSlot,
+		Notes:     req.Notes,
+		Items:     req.Items,
+		Status:    StatusScheduled,
+		History:   []StatusChange{{To: StatusScheduled, Actor: uid, At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, screen := range s.screens {
+		if err := screen(tx, pickup); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Insert(pickupsBucket, pickup.ID, pickup); err != nil {
+		return nil, err
+	}
+	if err := s.notify(tx, pickup, ""); err != nil {
+		return nil, err
+	}
+	return pickup, nil
+}
+
+func validate(req CreateRequest) error {
+	if strings.TrimSpace(req.Address) == "" {
+		return fmt.Errorf("%w: address is required", ErrInvalidPickup)
+	}
+	if req.Location != nil && (req.Location.IsZero() || !req.Location.Valid()) {
+		return fmt.Errorf("%w: location is not a valid coordinate", ErrInvalidPickup)
+	}
+	if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		return fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidPickup)
+	}
+	if !timeSlots[req.TimeSlot] {
+		return fmt.Errorf("%w: unknown time slot %q", ErrInvalidPickup, req.TimeSlot)
+	}
+	if len(req.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidPickup)
+	}
+	for _, item := range req.Items {
+		if item.Category == "" || item.Quantity <= 0 || item.WeightKg < 0 {
+			return fmt.Errorf("%w: every item needs a category and a positive quantity", ErrInvalidPickup)
+		}
+		if item.MeasuredWeightKg != 0 {
+			return fmt.Errorf("%w: measured weights are recorded by the collector", ErrInvalidPickup)
+		}
+	}
+	return nil
+}
+
+// Get returns the pickup with the given ID.
+func (s *Service) Get(id string) (*Pickup, error) {
+	var pickup *Pickup
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		pickup, err = GetTx(tx, id)
+		return err
+	})
+	return pickup, err
+}
+
+// GetTx loads a pickup inside an existing transaction.
+func GetTx(tx *store.Tx, id string) (*Pickup, error) {
+	var pickup Pickup
+	if err := tx.Get(pickupsBucket, id, &pickup); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &pickup, nil
+}
+
+// List returns the pickups accepted by match, oldest first. A nil match returns every pickup.
+func (s *Service) List(match func(*Pickup) bool) ([]*Pickup, error) {
+	var result []*Pickup
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		result, err = ListTx(tx, match)
+		return err
+	})
+	return result, err
+}
+
+// ListTx lists pickups inside an existing transaction.
+func ListTx(tx *store.Tx, match func(*Pickup) bool) ([]*Pickup, error) {
+	result := []*Pickup{}
+	err := tx.ForEach(pickupsBucket, func(key string, raw json.RawMessage) error {
+		var pickup Pickup
+		if err := json.Unmarshal(raw, &pickup); err != nil {
+			return fmt.Errorf("error decoding pickup %s: %w", key, err)
+		}
+		if match == nil || match(&pickup) {
+			result = append(result, &pickup)
+		}
+		return nil
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result, err
+}
+
+// ByUser matches the pickups belonging to uid.
+func ByUser(uid string) func(*Pickup) bool {
+	return func(p *Pickup) bool { return p.UserID == uid }
+}
+
+// Transition moves a pickup to a new status on behalf of actor.
+func (s *Service) Transition(id, to, actor string) (*Pickup, error) {
+	var pickup *Pickup
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		pickup, err = s.TransitionTx(tx, id, to, actor)
+		return err
+	})
+	return pickup, err
+}
+
+// TransitionIf moves a pickup to a new status on behalf of actor if allowed
+// reports that the actor may change it. The check and the change are made in
+// one transaction, so the pickup cannot be reassigned in between. It returns
+// the pickup as it was before and after the change.
+func (s *Service) TransitionIf(id, to, actor string, allowed func(*Pickup) bool) (*Pickup, *Pickup, error) {
+	var before, after *Pickup
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		if before, err = GetTx(tx, id); err != nil {
+			return err
+		}
+		if !allowed(before) {
+			return ErrNotAllowed
+		}
+		after, err = s.TransitionTx(tx, id, to, actor)
+		return err
+	})
+	return before, after, err
+}
+
+// TransitionTx moves a pickup to a new status inside an existing transaction.
+func (s *Service) TransitionTx(tx *store.Tx, id, to, actor string) (*Pickup, error) {
+	pickup, err := GetTx(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(pickup.Status, to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, pickup.Status, to)
+	}
+
+	from := pickup.Status
+	now := s.now().UTC()
+	pickup.Status = to
+	pickup.UpdatedAt = now
+	pickup.History = append(pickup.History, StatusChange{From: from, To: to, Actor: actor, At: now})
+	if err := tx.Put(pickupsBucket, pickup.ID, pickup); err != nil {
+		return nil, err
+	}
+	if err := s.notify(tx, pickup, from); err != nil {
+		return nil, err
+	}
+	return pickup, nil
+}
+
+// Assign sets the collector responsible for a pickup and the recycling
+// partner its items go to, which may be left empty, and marks it assigned.
+// Changing either on an assigned pickup is recorded in its history and
+// reported to listeners as a change from assigned to assigned.
+func (s *Service) Assign(id, collectorID, partnerID, actor string) (*Pickup, error) {
+	var pickup *Pickup
+	err := s.store.Update(func(tx *store.Tx) error {
+		current, err := GetTx(tx, id)
+		if err != nil {
+			return err
+		}
+		if current.Status != StatusAssigned {
+			current.CollectorID, current.PartnerID = collectorID, partnerID
+			if err := tx.Put(pickupsBucket, current.ID, current); err != nil {
+				return err
+			}
+			pickup, err = s.TransitionTx(tx, id, StatusAssigned, actor)
+			return err
+		}
+		pickup = current
+		if current.CollectorID == collectorID && current.PartnerID == partnerID {
+			return nil
+		}
+		now := s.now().UTC()
+		current.CollectorID, current.PartnerID = collectorID, partnerID
+		current.UpdatedAt = now
+		current.History = append(current.History, StatusChange{From: StatusAssigned, To: StatusAssigned, Actor: actor, At: now})
+		if err := tx.Put(pickupsBucket, current.ID, current); err != nil {
+			return err
+		}
+		return s.notify(tx, current, StatusAssigned)
+	})
+	return pickup, err
+}
+
+// SaveTx stores changes to a pickup's details without touching its status.
+func SaveTx(tx *store.Tx, p *Pickup) error {
+	return tx.Put(pickupsBucket, p.ID, p)
+}
+
+// CanTransition reports whether a pickup may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) notify(tx *store.Tx, p *Pickup, from string) error {
+	for _, listener := range s.listeners {
+		if err := listener(tx, p, from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
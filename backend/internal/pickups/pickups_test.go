@@ -0,0 +1,145 @@
+package pickups
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func validRequest() CreateRequest {
+	return CreateRequest{
+		Address:  "Kilimani, Nairobi",
+		Date:     "2026-11-02",
+		TimeSlot: "morning",
+		Items:    []Item{{Category: "phones", Condition: "working", Quantity: 2}},
+	}
+}
+
+func TestCreateValidatesRequest(t *testing.T) {
+	svc := NewService(store.NewMemory())
+	tests := []struct {
+		name   string
+		modify func(*CreateRequest)
+	}{
+		{"Missing address", func(r *CreateRequest) { r.Address = " " }},
+		{"Bad date", func(r *CreateRequest) { r.Date = "02/11/2026" }},
+		{"Unknown slot", func(r *CreateRequest) { r.TimeSlot = "midnight" }},
+		{"No items", func(r *CreateRequest) { r.Items = nil }},
+		{"Zero quantity", func(r *CreateRequest) { r.Items[0].Quantity = 0 }},
+		{"Measured weight", func(r *CreateRequest) { r.Items[0].MeasuredWeightKg = 3 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validRequest()
+			tt.modify(&req)
+			if _, err := svc.Create("u1", req); !errors.Is(err, ErrInvalidPickup) {
+				t.Errorf("Create() error = %v, want ErrInvalidPickup", err)
+			}
+		})
+	}
+}
+
+func TestTransitionLifecycle(t *testing.T) {
+	svc := NewService(store.NewMemory())
+	var seen []string
+	svc.Subscribe(func(tx *store.Tx, p *Pickup, from string) error {
+		seen = append(seen, from+">"+p.Status)
+		return nil
+	})
+
+	pickup, err := svc.Create("u1", validRequest())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, status := range []string{StatusAssigned, StatusCollected, StatusProcessed} {
+		if _, err := svc.Transition(pickup.ID, status, "collector"); err != nil {
+			t.Fatalf("Transition(%s) error = %v", status, err)
+		}
+	}
+	if _, err := svc.Transition(pickup.ID, StatusScheduled, "collector"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Transition(processed>scheduled) error = %v, want ErrInvalidTransition", err)
+	}
+
+	want := []string{">scheduled", "scheduled>assigned", "assigned>collected", "collected>processed"}
+	if len(seen) != len(want) {
+		t.Fatalf("listener saw %v, want %v", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("listener call %d = %s, want %s", i, seen[i], want[i])
+		}
+	}
+}
+
+func TestListenerErrorRollsBackTransition(t *testing.T) {
+	svc := NewService(store.NewMemory())
+	pickup, _ := svc.Create("u1", validRequest())
+
+	svc.Subscribe(func(tx *store.Tx, p *Pickup, from string) error {
+		return errors.New("side effect failed")
+	})
+	if _, err := svc.Transition(pickup.ID, StatusCancelled, "u1"); err == nil {
+		t.Fatal("expected listener error")
+	}
+
+	got, _ := svc.Get(pickup.ID)
+	if got.Status != StatusScheduled {
+		t.Errorf("status after failed transition = %s, want %s", got.Status, StatusScheduled)
+	}
+}
+
+func TestTransitionIfChecksTheStoredPickup(t *testing.T) {
+	svc := NewService(store.NewMemory())
+	pickup, _ := svc.Create("u1", validRequest())
+	if _, err := svc.Assign(pickup.ID, "c1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	assigned := func(uid string) func(*Pickup) bool {
+		return func(p *Pickup) bool { return p.CollectorID == uid }
+	}
+
+	if _, _, err := svc.TransitionIf(pickup.ID, StatusCollected, "c2", assigned("c2")); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("TransitionIf() by another collector error = %v, want ErrNotAllowed", err)
+	}
+	if got, _ := svc.Get(pickup.ID); got.Status != StatusAssigned {
+		t.Errorf("status after refused transition = %s, want %s", got.Status, StatusAssigned)
+	}
+
+	before, after, err := svc.TransitionIf(pickup.ID, StatusCollected, "c1", assigned("c1"))
+	if err != nil {
+		t.Fatalf("TransitionIf() error = %v", err)
+	}
+	if before.Status != StatusAssigned || after.Status != StatusCollected {
+		t.Errorf("TransitionIf() = %s > %s, want %s > %s", before.Status, after.Status, StatusAssigned, StatusCollected)
+	}
+}
+
+func TestReassignNotifiesListeners(t *testing.T) {
+	svc := NewService(store.NewMemory())
+	var changes []string
+	svc.Subscribe(func(tx *store.Tx, p *Pickup, from string) error {
+		changes = append(changes, from+">"+p.Status+":"+p.CollectorID+"/"+p.PartnerID)
+		return nil
+	})
+	pickup, _ := svc.Create("u1", validRequest())
+	for _, to := range [][2]string{{"c1", ""}, {"c1", ""}, {"c2", ""}, {"c2", "weee"}} {
+		if _, err := svc.Assign(pickup.ID, to[0], to[1], "admin"); err != nil {
+			t.Fatalf("Assign(%s, %s) error = %v", to[0], to[1], err)
+		}
+	}
+
+	want := []string{">scheduled:/", "scheduled>assigned:c1/", "assigned>assigned:c2/", "assigned>assigned:c2/weee"}
+	if len(changes) != len(want) {
+		t.Fatalf("listener saw %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %s, want %s", i, changes[i], want[i])
+		}
+	}
+	got, _ := svc.Get(pickup.ID)
+	if last := got.History[len(got.History)-1]; last.To != StatusAssigned || last.Actor != "admin" || len(got.History) != 4 {
+		t.Errorf("history = %+v, want the reassignment recorded", got.History)
+	}
+}
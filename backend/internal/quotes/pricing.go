@@ -0,0 +1,129 @@
+package quotes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+)
+
+// Hub is a depot that collection trucks leave from.
+type Hub struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Location geo.Point `json:"location"`
+}
+
+// DefaultHubs are the depots in operation.
+var DefaultHubs = []Hub{
+	{ID: "nairobi", Name: "Nairobi Industrial Area", Location: geo.Point{Lat: -1.3087, Lng: 36.8510}},
+	{ID: "mombasa", Name: "Mombasa Changamwe", Location: geo.Point{Lat: -4.0266, Lng: 39.6227}},
+	{ID: "kisumu", Name: "Kisumu Kibos", Location: geo.Point{Lat: -0.0700, Lng: 34.7900}},
+}
+
+// PriceList holds the tariff used to price commercial pickups. All amounts are in KES.
+// Items are charged per unit and per kilogram; items the catalogue lists
+// hazardous components for also carry a per-kilogram surcharge for
+// specialised handling.
+type PriceList struct {
+	BaseFee        int64   `json:"base_fee"`
+	PerUnit        int64   `json:"per_unit"`
+	PerKg          int64   `json:"per_kg"`
+	HazardousPerKg int64   `json:"hazardous_per_kg"`
+	FreeKm         float64 `json:"free_km"`
+	PerKm          int64   `json:"per_km"`
+	MaxDistanceKm  float64 `json:"max_distance_km"`
+	MinimumCharge  int64   `json:"minimum_charge"`
+}
+
+// DefaultPriceList is used in production.
+var DefaultPriceList = PriceList{
+	BaseFee:        1500,
+	PerUnit:        50,
+	PerKg:          10,
+	HazardousPerKg: 30,
+	FreeKm:         10,
+	PerKm:          60,
+	MaxDistanceKm:  150,
+	MinimumCharge:  2500,
+}
+
+// Lookup returns the catalogue entry of a category and subcategory.
+type Lookup func(category, subcategory string) (*items.Spec, error)
+
+// Line is one priced component of a quote.
+type Line struct {
+	Description string `json:"description"`
+	Amount      int64  `json:"amount"`
+}
+
+// Breakdown is the priced result of a quote request.
+type Breakdown struct {
+	Hub        Hub     `json:"hub"`
+	DistanceKm float64 `json:"distance_km"`
+	Lines      []Line  `json:"lines"`
+	Total      int64   `json:"total"`
+}
+
+// NearestHub returns the hub closest to p and its distance in kilometres.
+func NearestHub(hubs []Hub, p geo.Point) (Hub, float64) {
+	var nearest Hub
+	best := math.Inf(1)
+	for _, hub := range hubs {
+		if d := geo.Haversine(hub.Location, p); d < best {
+			nearest, best = hub, d
+		}
+	}
+	return nearest, best
+}
+
+// Price computes the charge for collecting list from location. Items are
+// weighed by their declared weight, or else by the catalogue's typical weight.
+func (pl *PriceList) Price(hubs []Hub, list []pickups.Item, location geo.Point, lookup Lookup) (*Breakdown, error) {
+	if len(hubs) == 0 {
+		return nil, fmt.Errorf("no hubs configured")
+	}
+	hub, distance := NearestHub(hubs, location)
+	if pl.MaxDistanceKm > 0 && distance > pl.MaxDistanceKm {
+		return nil, fmt.Errorf("%w: %.0f km from the nearest hub", ErrOutOfRange, distance)
+	}
+
+	b := &Breakdown{Hub: hub, DistanceKm: math.Round(distance*10) / 10}
+	b.add("Base collection fee", pl.BaseFee)
+	for _, item := range list {
+		spec, err := lookup(item.Category, item.Subcategory)
+		if err != nil {
+			if errors.Is(err, items.ErrNotFound) {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidQuote, err)
+			}
+			return nil, err
+		}
+		weight := item.WeightKg
+		if weight == 0 {
+			weight = spec.TypicalWeightKg * float64(item.Quantity)
+		}
+		handling := pl.PerUnit*int64(item.Quantity) + int64(math.Ceil(weight*float64(pl.PerKg)))
+		b.add(fmt.Sprintf("%d x %s", item.Quantity, spec.Name), handling)
+		if spec.Hazardous() {
+			b.add(fmt.Sprintf("Hazardous handling: %s", spec.Name), int64(math.Ceil(weight*float64(pl.HazardousPerKg))))
+		}
+	}
+	if extra := b.DistanceKm - pl.FreeKm; extra > 0 {
+		b.add(fmt.Sprintf("Transport: %.1f km beyond %.0f km from %s", extra, pl.FreeKm, hub.Name), int64(math.Ceil(extra*float64(pl.PerKm))))
+	}
+	if b.Total < pl.MinimumCharge {
+		b.add("Minimum charge adjustment", pl.MinimumCharge-b.Total)
+	}
+	return b, nil
+}
+
+func (b *Breakdown) add(description string, amount int64) {
+	if amount == 0 {
+		return
+	}
+	b.Lines = append(b.Lines, Line{Description: description, Amount: amount})
+	b.Total += amount
+}
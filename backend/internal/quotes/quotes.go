@@ -0,0 +1,303 @@
+package quotes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// quotesBucket holds every issued quote keyed by ID.
+const quotesBucket = "quotes"
+
+// Quote states.
+const (
+	StatusIssued   = "issued"
+	StatusAccepted = "accepted"
+)
+
+// DefaultValidity is how long a quote can be accepted for.
+const DefaultValidity = 72 * time.Hour
+
+var (
+	// ErrNotFound is returned when a quote does not exist.
+	ErrNotFound = errors.New("quote not found")
+	// ErrInvalidQuote is returned when a quote request fails validation.
+	ErrInvalidQuote = errors.New("invalid quote request")
+	// ErrOutOfRange is returned when the pickup location is too far from every hub.
+	ErrOutOfRange = errors.New("location is outside the collection area")
+	// ErrInvalidSignature is returned when a quote's signature does not match its contents.
+	ErrInvalidSignature = errors.New("quote signature is invalid")
+	// ErrExpired is returned when accepting a quote after it has expired.
+	ErrExpired = errors.New("quote has expired")
+	// ErrAlreadyAccepted is returned when accepting a quote twice.
+	ErrAlreadyAccepted = errors.New("quote has already been accepted")
+)
+
+// Request holds the details a customer submits to be quoted.
+type Request struct {
+	Address  string         `json:"address"`
+	Location geo.Point      `json:"location"`
+	Items    []pickups.Item `json:"items"`
+}
+
+// Quote is a signed, time-limited price for a commercial pickup.
+type Quote struct {
+	ID         string         `json:"id"`
+	UserID     string         `json:"user_id"`
+	Address    string         `json:"address"`
+	Location   geo.Point      `json:"location"`
+	Items      []pickups.Item `json:"items"`
+	HubID      string         `json:"hub_id"`
+	DistanceKm float64        `json:"distance_km"`
+	Lines      []Line         `json:"lines"`
+	Total      int64          `json:"total"`
+	Currency   string         `json:"currency"`
+	IssuedAt   time.Time      `json:"issued_at"`
+	ExpiresAt  time.Time      `json:"expires_at"`
+	Signature  string         `json:"signature"`
+	Status     string         `json:"status"`
+	PickupID   string         `json:"pickup_id,omitempty"`
+	AcceptedAt time.Time      `json:"accepted_at,omitempty"`
+}
+
+// AcceptRequest converts a quote into a scheduled pickup.
+type AcceptRequest struct {
+	QuoteID   string `json:"quote_id"`
+	Signature string `json:"signature"`
+	Date      string `json:"date"`
+	TimeSlot  string `json:"time_slot"`
+	Notes     string `json:"notes"`
+}
+
+// Service prices commercial pickups and books accepted quotes.
+type Service struct {
+	store    *store.Store
+	pickups  *pickups.Service
+	prices   PriceList
+	hubs     []Hub
+	secret   []byte
+	validity time.Duration
+	now      func() time.Time
+}
+
+// NewService creates a quoting service. secret signs issued quotes.
+func NewService(s *store.Store, pickupService *pickups.Service, prices PriceList, hubs []Hub, secret []byte) *Service {
+	return &Service{
+		store:    s,
+		pickups:  pickupService,
+		prices:   prices,
+		hubs:     hubs,
+		secret:   secret,
+		validity: DefaultValidity,
+		now:      time.Now,
+	}
+}
+
+// Hubs returns the depots quotes are priced from.
+func (s *Service) Hubs() []Hub {
+	return s.hubs
+}
+
+// Issue prices req for uid and stores the signed quote.
+func (s *Service) Issue(uid string, req Request) (*Quote, error) {
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+	var quote *Quote
+	err := s.store.Update(func(tx *store.Tx) error {
+		breakdown, err := s.prices.Price(s.hubs, req.Items, req.Location, func(category, subcategory string) (*items.Spec, error) {
+			return items.LookupTx(tx, category, subcategory)
+		})
+		if err != nil {
+			return err
+		}
+		seq, err := tx.NextSequence(quotesBucket)
+		if err != nil {
+			return err
+		}
+		now := s.now().UTC().Truncate(time.Second)
+		quote = &Quote{
+			ID:         fmt.Sprintf("qt_%d", seq),
+			UserID:     uid,
+			Address:    strings.TrimSpace(req.Address),
+			Location:   req.Location,
+			Items:      req.Items,
+			HubID:      breakdown.Hub.ID,
+			DistanceKm: breakdown.DistanceKm,
+			Lines:      breakdown.Lines,
+			Total:      breakdown.Total,
+			Currency:   "KES",
+			IssuedAt:   now,
+			ExpiresAt:  now.Add(s.validity),
+			Status:     StatusIssued,
+		}
+		quote.Signature, err = s.sign(quote)
+		if err != nil {
+			return err
+		}
+		return tx.Insert(quotesBucket, quote.ID, quote)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func validate(req Request) error {
+	if strings.TrimSpace(req.Address) == "" {
+		return fmt.Errorf("%w: address is required", ErrInvalidQuote)
+	}
+	if req.Location.IsZero() || !req.Location.Valid() {
+		return fmt.Errorf("%w: a valid location is required", ErrInvalidQuote)
+	}
+	if len(req.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidQuote)
+	}
+	for _, item := range req.Items {
+		if item.Category == "" || item.Quantity <= 0 || item.WeightKg < 0 {
+			return fmt.Errorf("%w: every item needs a category and a positive quantity", ErrInvalidQuote)
+		}
+		if item.MeasuredWeightKg != 0 {
+			return fmt.Errorf("%w: measured weights are recorded by the collector", ErrInvalidQuote)
+		}
+	}
+	return nil
+}
+
+// sign returns the HMAC of every priced field of q, so any change to the
+// items, location, price or expiry invalidates the quote.
+func (s *Service) sign(q *Quote) (string, error) {
+	payload, err := json.Marshal(struct {
+		ID        string         `json:"id"`
+		UserID    string         `json:"user_id"`
+		Address   string         `json:"address"`
+		Location  geo.Point      `json:"location"`
+		Items     []pickups.Item `json:"items"`
+		Total     int64          `json:"total"`
+		Currency  string         `json:"currency"`
+		ExpiresAt int64          `json:"expires_at"`
+	}{q.ID, q.UserID, q.Address, q.Location, q.Items, q.Total, q.Currency, q.ExpiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Verify checks q's signature and expiry.
+func (s *Service) Verify(q *Quote) error {
+	want, err := s.sign(q)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(want), []byte(q.Signature)) {
+		return ErrInvalidSignature
+	}
+	if !s.now().Before(q.ExpiresAt) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Get returns the quote with the given ID.
+func (s *Service) Get(id string) (*Quote, error) {
+	var quote *Quote
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		quote, err = getTx(tx, id)
+		return err
+	})
+	return quote, err
+}
+
+func getTx(tx *store.Tx, id string) (*Quote, error) {
+	var quote Quote
+	if err := tx.Get(quotesBucket, id, &quote); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// ByPickupTx returns the accepted quote that booked pickupID, or ErrNotFound.
+func ByPickupTx(tx *store.Tx, pickupID string) (*Quote, error) {
+	var found *Quote
+	err := tx.ForEach(quotesBucket, func(key string, raw json.RawMessage) error {
+		if found != nil {
+			return nil
+		}
+		var quote Quote
+		if err := json.Unmarshal(raw, &quote); err != nil {
+			return fmt.Errorf("error decoding quote %s: %w", key, err)
+		}
+		if quote.Status == StatusAccepted && quote.PickupID == pickupID {
+			found = &quote
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// Accept verifies a quote presented by uid and books it as a scheduled pickup.
+func (s *Service) Accept(uid string, req AcceptRequest) (*Quote, *pickups.Pickup, error) {
+	var quote *Quote
+	var pickup *pickups.Pickup
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		quote, err = getTx(tx, req.QuoteID)
+		if err != nil {
+			return err
+		}
+		if quote.UserID != uid {
+			return ErrNotFound
+		}
+		if !hmac.Equal([]byte(quote.Signature), []byte(req.Signature)) {
+			return ErrInvalidSignature
+		}
+		if quote.Status == StatusAccepted {
+			return ErrAlreadyAccepted
+		}
+		if err := s.Verify(quote); err != nil {
+			return err
+		}
+
+		pickup, err = s.pickups.CreateTx(tx, uid, pickups.CreateRequest{
+			Address:  quote.Address,
+			Location: &quote.Location,
+			Date:     req.Date,
+			TimeSlot: req.TimeSlot,
+			Notes:    strings.TrimSpace(fmt.Sprintf("Quote %s. %s", quote.ID, req.Notes)),
+			Items:    quote.Items,
+		})
+		if err != nil {
+			return err
+		}
+		quote.Status = StatusAccepted
+		quote.PickupID = pickup.ID
+		quote.AcceptedAt = s.now().UTC()
+		return tx.Put(quotesBucket, quote.ID, quote)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return quote, pickup, nil
+}
@@ -0,0 +1,183 @@
+package quotes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var westlands = geo.Point{Lat: -1.2676, Lng: 36.8108}
+
+func newTestService(t *testing.T) (*Service, *pickups.Service) {
+	db := store.NewMemory()
+	if err := items.NewService(db).Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	pickupService := pickups.NewService(db)
+	return NewService(db, pickupService, DefaultPriceList, DefaultHubs, []byte("secret")), pickupService
+}
+
+func TestPrice(t *testing.T) {
+	prices := PriceList{
+		BaseFee:        1000,
+		PerUnit:        50,
+		PerKg:          10,
+		HazardousPerKg: 20,
+		FreeKm:         10,
+		PerKm:          50,
+		MaxDistanceKm:  100,
+		MinimumCharge:  2000,
+	}
+	catalogue := items.DefaultCatalogue()
+	lookup := func(category, subcategory string) (*items.Spec, error) {
+		for _, c := range catalogue {
+			if c.ID == category {
+				return c.Spec(subcategory)
+			}
+		}
+		return nil, items.ErrNotFound
+	}
+	hubs := []Hub{{ID: "nairobi", Location: geo.Point{Lat: -1.3087, Lng: 36.8510}}}
+
+	tests := []struct {
+		name      string
+		items     []pickups.Item
+		location  geo.Point
+		wantTotal int64
+		wantErr   error
+	}{
+		{
+			name:      "Minimum charge applies near the hub",
+			items:     []pickups.Item{{Category: "phones", Quantity: 2}},
+			location:  hubs[0].Location,
+			wantTotal: 2000,
+		},
+		{
+			name: "Typical weights and hazardous surcharge",
+			items: []pickups.Item{
+				{Category: "appliances", Subcategory: "washing_machines", Quantity: 2},
+				{Category: "crt_monitors", Quantity: 2},
+			},
+			location:  hubs[0].Location,
+			wantTotal: 1000 + 100 + 1300 + 100 + 300 + 600,
+		},
+		{
+			name:      "Declared weight overrides the typical one",
+			items:     []pickups.Item{{Category: "batteries", Quantity: 1, WeightKg: 50}},
+			location:  hubs[0].Location,
+			wantTotal: 1000 + 50 + 500 + 1000,
+		},
+		{
+			name:      "Distance beyond the free radius",
+			items:     []pickups.Item{{Category: "other", Quantity: 20}},
+			location:  geo.Point{Lat: -1.0333, Lng: 37.0693}, // Thika, about 39 km away
+			wantTotal: 1000 + 1000 + 1000 + 1450,
+		},
+		{
+			name:     "Too far from every hub",
+			items:    []pickups.Item{{Category: "computers", Quantity: 1}},
+			location: geo.Point{Lat: -4.0435, Lng: 39.6682},
+			wantErr:  ErrOutOfRange,
+		},
+		{
+			name:     "Category not in the catalogue",
+			items:    []pickups.Item{{Category: "fax_machines", Quantity: 1}},
+			location: hubs[0].Location,
+			wantErr:  ErrInvalidQuote,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := prices.Price(hubs, tt.items, tt.location, lookup)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Price() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// Distance lines depend on rounding, so allow one kilometre of slack.
+			if diff := b.Total - tt.wantTotal; diff < -prices.PerKm || diff > prices.PerKm {
+				t.Errorf("Price() total = %d, want %d (lines %+v)", b.Total, tt.wantTotal, b.Lines)
+			}
+		})
+	}
+}
+
+func TestNearestHub(t *testing.T) {
+	hub, _ := NearestHub(DefaultHubs, geo.Point{Lat: -4.05, Lng: 39.7})
+	if hub.ID != "mombasa" {
+		t.Errorf("NearestHub() = %s, want mombasa", hub.ID)
+	}
+}
+
+func TestIssueAndAccept(t *testing.T) {
+	svc, pickupService := newTestService(t)
+	quote, err := svc.Issue("school", Request{
+		Address:  "Westlands Primary",
+		Location: westlands,
+		Items:    []pickups.Item{{Category: "computers", Quantity: 30, WeightKg: 300}},
+	})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if quote.HubID != "nairobi" || quote.Total <= 0 || quote.Signature == "" {
+		t.Fatalf("unexpected quote %+v", quote)
+	}
+
+	accept := AcceptRequest{QuoteID: quote.ID, Signature: quote.Signature, Date: "2026-11-02", TimeSlot: "morning"}
+	if _, _, err := svc.Accept("someone-else", accept); !errors.Is(err, ErrNotFound) {
+		t.Errorf("accepting another user's quote: error = %v, want ErrNotFound", err)
+	}
+	forged := accept
+	forged.Signature = "00"
+	if _, _, err := svc.Accept("school", forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("forged signature: error = %v, want ErrInvalidSignature", err)
+	}
+
+	accepted, pickup, err := svc.Accept("school", accept)
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	if accepted.Status != StatusAccepted || accepted.PickupID != pickup.ID {
+		t.Errorf("quote not linked to pickup: %+v", accepted)
+	}
+	stored, err := pickupService.Get(pickup.ID)
+	if err != nil || stored.Status != pickups.StatusScheduled || stored.Items[0].Quantity != 30 {
+		t.Errorf("unexpected pickup %+v, %v", stored, err)
+	}
+	if _, _, err := svc.Accept("school", accept); !errors.Is(err, ErrAlreadyAccepted) {
+		t.Errorf("second accept: error = %v, want ErrAlreadyAccepted", err)
+	}
+}
+
+func TestAcceptRejectsExpiredAndTampered(t *testing.T) {
+	svc, _ := newTestService(t)
+	issued := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return issued }
+	quote, err := svc.Issue("school", Request{
+		Address:  "Westlands Primary",
+		Location: westlands,
+		Items:    []pickups.Item{{Category: "batteries", Quantity: 1, WeightKg: 50}},
+	})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	tampered := *quote
+	tampered.Total = 1
+	if err := svc.Verify(&tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify(tampered) error = %v, want ErrInvalidSignature", err)
+	}
+
+	svc.now = func() time.Time { return issued.Add(DefaultValidity) }
+	_, _, err = svc.Accept("school", AcceptRequest{QuoteID: quote.ID, Signature: quote.Signature, Date: "2026-10-05", TimeSlot: "morning"})
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("Accept() after expiry error = %v, want ErrExpired", err)
+	}
+}
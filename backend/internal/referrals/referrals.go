@@ -0,0 +1,362 @@
+package referrals
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/fraud"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the referral programme.
+const (
+	codesBucket     = "referral_codes"
+	userCodesBucket = "referral_user_codes"
+	referralsBucket = "referrals"
+)
+
+// Referral states. A referral is held while the referee's first pickup is
+// under fraud review.
+const (
+	StatusPending  = "pending"
+	StatusHeld     = "held"
+	StatusRewarded = "rewarded"
+	StatusRejected = "rejected"
+)
+
+// ReasonReferral is the ledger reason of referral bonuses.
+const ReasonReferral = "referral_bonus"
+
+// codeAlphabet avoids characters that are easy to confuse when read aloud.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// codePattern is the shape accepted from users; it is also safe to echo back into HTML.
+var codePattern = regexp.MustCompile(`^[A-Z0-9]{4,12}$`)
+
+var (
+	// ErrInvalidCode is returned for malformed or unknown referral codes.
+	ErrInvalidCode = errors.New("invalid referral code")
+	// ErrSelfReferral is returned when a user tries to use their own code.
+	ErrSelfReferral = errors.New("you cannot use your own referral code")
+	// ErrAlreadyReferred is returned when the user has already been attributed to a referrer.
+	ErrAlreadyReferred = errors.New("referral already recorded for this account")
+	// ErrNotNewUser is returned when an account that has already booked pickups tries to use a code.
+	ErrNotNewUser = errors.New("referral codes can only be used by new accounts")
+)
+
+// Bonuses are the points credited once the referee completes their first pickup.
+type Bonuses struct {
+	Referrer int64
+	Referee  int64
+}
+
+// DefaultBonuses are used in production.
+var DefaultBonuses = Bonuses{Referrer: 200, Referee: 100}
+
+// Referral links a new user to the resident who invited them.
+type Referral struct {
+	RefereeID  string    `json:"referee_id"`
+	ReferrerID string    `json:"referrer_id"`
+	Code       string    `json:"code"`
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason,omitempty"`
+	PickupID   string    `json:"pickup_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	RewardedAt time.Time `json:"rewarded_at,omitempty"`
+}
+
+// Service issues referral codes, attributes signups and pays bonuses.
+type Service struct {
+	store   *store.Store
+	ledger  *rewards.Ledger
+	bonuses Bonuses
+	now     func() time.Time
+}
+
+// NewService creates a referral service.
+func NewService(s *store.Store, ledger *rewards.Ledger, bonuses Bonuses) *Service {
+	return &Service{store: s, ledger: ledger, bonuses: bonuses, now: time.Now}
+}
+
+// NormalizeCode upper-cases a code and reports whether it has a valid shape.
+func NormalizeCode(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, codePattern.MatchString(code)
+}
+
+// CodeFor returns the referral code of uid, creating one on first use.
+func (s *Service) CodeFor(uid string) (string, error) {
+	var code string
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.Get(userCodesBucket, uid, &code)
+	})
+	if err == nil {
+		return code, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return "", err
+	}
+
+	err = s.store.Update(func(tx *store.Tx) error {
+		// Another request may have created the code in the meantime.
+		if err := tx.Get(userCodesBucket, uid, &code); err == nil {
+			return nil
+		}
+		for {
+			candidate, err := generateCode()
+			if err != nil {
+				return err
+			}
+			if !tx.Exists(codesBucket, candidate) {
+				code = candidate
+				break
+			}
+		}
+		if err := tx.Insert(codesBucket, code, uid); err != nil {
+			return err
+		}
+		return tx.Put(userCodesBucket, uid, code)
+	})
+	return code, err
+}
+
+// Attribute records that refereeID signed up with code.
+func (s *Service) Attribute(refereeID, code string) (*Referral, error) {
+	code, ok := NormalizeCode(code)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var referral *Referral
+	err := s.store.Update(func(tx *store.Tx) error {
+		var referrerID string
+		if err := tx.Get(codesBucket, code, &referrerID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return ErrInvalidCode
+			}
+			return err
+		}
+		if referrerID == refereeID {
+			return ErrSelfReferral
+		}
+		if tx.Exists(referralsBucket, refereeID) {
+			return ErrAlreadyReferred
+		}
+		existing, err := pickups.ListTx(tx, pickups.ByUser(refereeID))
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return ErrNotNewUser
+		}
+
+		referral = &Referral{
+			RefereeID:  refereeID,
+			ReferrerID: referrerID,
+			Code:       code,
+			Status:     StatusPending,
+			CreatedAt:  s.now().UTC(),
+		}
+		return tx.Insert(referralsBucket, refereeID, referral)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// OnPickupTransition is a pickups.Listener that pays both bonuses when a
+// referee's first pickup is processed, and takes them back if that pickup is
+// later cancelled. It must be subscribed after the fraud detector so that a
+// pickup flagged as it is processed holds the bonuses until it is reviewed.
+func (s *Service) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	if p.Status != pickups.StatusProcessed && !(p.Status == pickups.StatusCancelled && from == pickups.StatusProcessed) {
+		return nil
+	}
+
+	var referral Referral
+	if err := tx.Get(referralsBucket, p.UserID, &referral); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if p.Status == pickups.StatusCancelled {
+		if referral.PickupID != p.ID || referral.Status == StatusRejected {
+			return nil
+		}
+		return s.reverse(tx, &referral)
+	}
+	if referral.Status != StatusPending {
+		return nil
+	}
+
+	referral.PickupID = p.ID
+	selfReferral, err := sharesAddress(tx, referral.ReferrerID, p.Address)
+	if err != nil {
+		return err
+	}
+	if selfReferral {
+		referral.Status = StatusRejected
+		referral.Reason = "referee pickup address matches the referrer's"
+		return tx.Put(referralsBucket, referral.RefereeID, referral)
+	}
+	return s.settle(tx, &referral)
+}
+
+// OnCaseResolved is a fraud.Listener that settles referrals held on the
+// reviewed pickup.
+func (s *Service) OnCaseResolved(tx *store.Tx, c *fraud.Case) error {
+	var held []Referral
+	err := tx.ForEach(referralsBucket, func(key string, raw json.RawMessage) error {
+		var referral Referral
+		if err := json.Unmarshal(raw, &referral); err != nil {
+			return fmt.Errorf("error decoding referral %s: %w", key, err)
+		}
+		if referral.Status == StatusHeld && referral.PickupID == c.Subject {
+			held = append(held, referral)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range held {
+		if err := s.settle(tx, &held[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle pays the bonuses of a referral whose pickup has been processed,
+// unless a fraud case on the pickup is still open or was confirmed.
+func (s *Service) settle(tx *store.Tx, referral *Referral) error {
+	cases, err := fraud.PickupCasesTx(tx, referral.PickupID)
+	if err != nil {
+		return err
+	}
+	referral.Status = StatusPending
+	for _, c := range cases {
+		switch c.Status {
+		case fraud.StatusConfirmed:
+			referral.Status = StatusRejected
+			referral.Reason = "referee pickup failed fraud review"
+			return tx.Put(referralsBucket, referral.RefereeID, referral)
+		case fraud.StatusOpen:
+			referral.Status = StatusHeld
+		}
+	}
+	if referral.Status == StatusHeld {
+		return tx.Put(referralsBucket, referral.RefereeID, referral)
+	}
+
+	for _, payout := range s.payouts(referral) {
+		key := fmt.Sprintf("referral:%s:%s", referral.RefereeID, payout.uid)
+		if _, err := s.ledger.AwardTx(tx, payout.uid, payout.points, key, ReasonReferral, referral.RefereeID, nil); err != nil {
+			return err
+		}
+	}
+
+	referral.Status = StatusRewarded
+	referral.RewardedAt = s.now().UTC()
+	return tx.Put(referralsBucket, referral.RefereeID, referral)
+}
+
+// reverse rejects a referral whose pickup was cancelled after processing,
+// taking back whatever part of each paid bonus has not yet been spent.
+func (s *Service) reverse(tx *store.Tx, referral *Referral) error {
+	if referral.Status == StatusRewarded {
+		for _, payout := range s.payouts(referral) {
+			balance, err := s.ledger.BalanceTx(tx, rewards.UserAccount(payout.uid))
+			if err != nil {
+				return err
+			}
+			points := min(payout.points, balance)
+			if points <= 0 {
+				continue
+			}
+			if _, err := s.ledger.PostTx(tx, rewards.PostingRequest{
+				IdempotencyKey: fmt.Sprintf("referral-reversal:%s:%s", referral.RefereeID, payout.uid),
+				Reason:         ReasonReferral,
+				Reference:      referral.RefereeID,
+				Lines:          rewards.Transfer(rewards.UserAccount(payout.uid), rewards.AccountIssued, points),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	referral.Status = StatusRejected
+	referral.Reason = "referee pickup cancelled after processing"
+	return tx.Put(referralsBucket, referral.RefereeID, referral)
+}
+
+type payout struct {
+	uid    string
+	points int64
+}
+
+// payouts lists the bonuses a referral pays, skipping any set to zero.
+func (s *Service) payouts(referral *Referral) []payout {
+	var list []payout
+	for _, p := range []payout{
+		{referral.ReferrerID, s.bonuses.Referrer},
+		{referral.RefereeID, s.bonuses.Referee},
+	} {
+		if p.points > 0 {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// sharesAddress reports whether uid has booked a pickup at address.
+func sharesAddress(tx *store.Tx, uid, address string) (bool, error) {
+	normalized := fraud.NormalizeAddress(address)
+	list, err := pickups.ListTx(tx, pickups.ByUser(uid))
+	if err != nil {
+		return false, err
+	}
+	for _, p := range list {
+		if fraud.NormalizeAddress(p.Address) == normalized {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReferralsBy returns the referrals attributed to referrerID.
+func (s *Service) ReferralsBy(referrerID string) ([]Referral, error) {
+	list := []Referral{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(referralsBucket, func(key string, raw json.RawMessage) error {
+			var referral Referral
+			if err := json.Unmarshal(raw, &referral); err != nil {
+				return fmt.Errorf("error decoding referral %s: %w", key, err)
+			}
+			if referral.ReferrerID == referrerID {
+				list = append(list, referral)
+			}
+			return nil
+		})
+	})
+	return list, err
+}
+
+func generateCode() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating referral code: %w", err)
+	}
+	for i := range buf {
+		buf[i] = codeAlphabet[int(buf[i])%len(codeAlphabet)]
+	}
+	return "ZT" + string(buf), nil
+}
@@ -0,0 +1,217 @@
+package referrals
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/fraud"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/rewards"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func newTestService() (*Service, *pickups.Service, *rewards.Ledger) {
+	db := store.NewMemory()
+	ledger := rewards.NewLedger(db)
+	svc := NewService(db, ledger, Bonuses{Referrer: 200, Referee: 100})
+	pickupService := pickups.NewService(db)
+	pickupService.Subscribe(svc.OnPickupTransition)
+	return svc, pickupService, ledger
+}
+
+// newReviewedService wires the referral service behind a fraud detector, as in production.
+func newReviewedService() (*Service, *pickups.Service, *rewards.Ledger, *fraud.Detector) {
+	db := store.NewMemory()
+	ledger := rewards.NewLedger(db)
+	detector := fraud.NewDetector(db, ledger, rewards.NewCatalogue(db, ledger), fraud.DefaultThresholds)
+	svc := NewService(db, ledger, Bonuses{Referrer: 200, Referee: 100})
+	detector.Subscribe(svc.OnCaseResolved)
+	pickupService := pickups.NewService(db)
+	pickupService.Subscribe(detector.OnPickupTransition)
+	pickupService.Subscribe(svc.OnPickupTransition)
+	return svc, pickupService, ledger, detector
+}
+
+func completePickup(t *testing.T, svc *pickups.Service, uid, address string) *pickups.Pickup {
+	t.Helper()
+	return completePickupOf(t, svc, uid, address, "")
+}
+
+func completePickupOf(t *testing.T, svc *pickups.Service, uid, address, serial string) *pickups.Pickup {
+	t.Helper()
+	p, err := svc.Create(uid, pickups.CreateRequest{
+		Address: address, Date: "2026-06-15", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "phones", Quantity: 1, SerialNumber: serial}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected, pickups.StatusProcessed} {
+		if _, err := svc.Transition(p.ID, status, "collector"); err != nil {
+			t.Fatalf("Transition(%s) error = %v", status, err)
+		}
+	}
+	return p
+}
+
+func TestReferralBonusAfterFirstPickup(t *testing.T) {
+	svc, pickupService, ledger := newTestService()
+	code, err := svc.CodeFor("alice")
+	if err != nil {
+		t.Fatalf("CodeFor() error = %v", err)
+	}
+	if again, _ := svc.CodeFor("alice"); again != code {
+		t.Errorf("CodeFor() is not stable: %s then %s", code, again)
+	}
+
+	if _, err := svc.Attribute("bob", " "+code+" "); err != nil {
+		t.Fatalf("Attribute() error = %v", err)
+	}
+	if balance, _ := ledger.Balance(rewards.UserAccount("alice")); balance != 0 {
+		t.Errorf("referrer paid before referee pickup: %d", balance)
+	}
+
+	completePickup(t, pickupService, "bob", "Kileleshwa")
+	completePickup(t, pickupService, "bob", "Kileleshwa")
+
+	if balance, _ := ledger.Balance(rewards.UserAccount("alice")); balance != 200 {
+		t.Errorf("referrer balance = %d, want 200", balance)
+	}
+	if balance, _ := ledger.Balance(rewards.UserAccount("bob")); balance != 100 {
+		t.Errorf("referee balance = %d, want 100", balance)
+	}
+	list, _ := svc.ReferralsBy("alice")
+	if len(list) != 1 || list[0].Status != StatusRewarded {
+		t.Errorf("ReferralsBy() = %+v", list)
+	}
+}
+
+func TestAttributeChecks(t *testing.T) {
+	svc, pickupService, _ := newTestService()
+	code, _ := svc.CodeFor("alice")
+	completePickup(t, pickupService, "carol", "Ngong Road")
+
+	tests := []struct {
+		name    string
+		uid     string
+		code    string
+		wantErr error
+	}{
+		{"Malformed code", "bob", "<script>", ErrInvalidCode},
+		{"Unknown code", "bob", "ZTNOPE1", ErrInvalidCode},
+		{"Own code", "alice", code, ErrSelfReferral},
+		{"Existing user", "carol", code, ErrNotNewUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Attribute(tt.uid, tt.code); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Attribute() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := svc.Attribute("bob", code); err != nil {
+		t.Fatalf("Attribute() error = %v", err)
+	}
+	if _, err := svc.Attribute("bob", code); !errors.Is(err, ErrAlreadyReferred) {
+		t.Errorf("second Attribute() error = %v, want ErrAlreadyReferred", err)
+	}
+}
+
+func TestSharedAddressRejectsReferral(t *testing.T) {
+	svc, pickupService, ledger := newTestService()
+	code, _ := svc.CodeFor("alice")
+	completePickup(t, pickupService, "alice", "Hse 12, Pipeline Estate")
+	if _, err := svc.Attribute("alias", code); err != nil {
+		t.Fatalf("Attribute() error = %v", err)
+	}
+
+	completePickup(t, pickupService, "alias", "hse 12 pipeline estate")
+
+	if balance, _ := ledger.Balance(rewards.UserAccount("alias")); balance != 0 {
+		t.Errorf("self-referral paid a bonus of %d", balance)
+	}
+	list, _ := svc.ReferralsBy("alice")
+	if len(list) != 1 || list[0].Status != StatusRejected {
+		t.Errorf("ReferralsBy() = %+v", list)
+	}
+}
+
+func TestFlaggedPickupHoldsReferralBonus(t *testing.T) {
+	svc, pickupService, ledger, detector := newReviewedService()
+	code, _ := svc.CodeFor("alice")
+	if _, err := svc.Attribute("bob", code); err != nil {
+		t.Fatalf("Attribute() error = %v", err)
+	}
+	completePickupOf(t, pickupService, "carol", "Ngong Road", "SN-1")
+	completePickupOf(t, pickupService, "bob", "Kileleshwa", "SN-1")
+
+	if balance, _ := ledger.Balance(rewards.UserAccount("alice")); balance != 0 {
+		t.Errorf("referrer paid %d while the pickup is under review", balance)
+	}
+	list, _ := svc.ReferralsBy("alice")
+	if len(list) != 1 || list[0].Status != StatusHeld {
+		t.Fatalf("ReferralsBy() = %+v", list)
+	}
+
+	cases, _ := detector.Cases(fraud.StatusOpen)
+	if len(cases) != 1 {
+		t.Fatalf("open cases = %+v", cases)
+	}
+	if _, err := detector.Resolve(cases[0].ID, true, "admin", "legitimate resale"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if balance, _ := ledger.Balance(rewards.UserAccount("alice")); balance != 200 {
+		t.Errorf("referrer balance after release = %d, want 200", balance)
+	}
+	if balance, _ := ledger.Balance(rewards.UserAccount("bob")); balance != 100 {
+		t.Errorf("referee balance after release = %d, want 100", balance)
+	}
+}
+
+func TestConfirmedCaseRejectsReferral(t *testing.T) {
+	svc, pickupService, ledger, detector := newReviewedService()
+	code, _ := svc.CodeFor("alice")
+	if _, err := svc.Attribute("bob", code); err != nil {
+		t.Fatalf("Attribute() error = %v", err)
+	}
+	completePickupOf(t, pickupService, "carol", "Ngong Road", "SN-1")
+	completePickupOf(t, pickupService, "bob", "Kileleshwa", "SN-1")
+
+	cases, _ := detector.Cases(fraud.StatusOpen)
+	if _, err := detector.Resolve(cases[0].ID, false, "admin", "stolen device"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if balance, _ := ledger.Balance(rewards.UserAccount("alice")); balance != 0 {
+		t.Errorf("referrer paid %d after a confirmed case", balance)
+	}
+	list, _ := svc.ReferralsBy("alice")
+	if len(list) != 1 || list[0].Status != StatusRejected {
+		t.Errorf("ReferralsBy() = %+v", list)
+	}
+}
+
+func TestCancellationReversesReferralBonus(t *testing.T) {
+	svc, pickupService, ledger, _ := newReviewedService()
+	code, _ := svc.CodeFor("alice")
+	if _, err := svc.Attribute("bob", code); err != nil {
+		t.Fatalf("Attribute() error = %v", err)
+	}
+	p := completePickup(t, pickupService, "bob", "Kileleshwa")
+	if balance, _ := ledger.Balance(rewards.UserAccount("alice")); balance != 200 {
+		t.Fatalf("referrer balance = %d, want 200", balance)
+	}
+
+	if _, err := pickupService.Transition(p.ID, pickups.StatusCancelled, "admin"); err != nil {
+		t.Fatalf("Transition(cancelled) error = %v", err)
+	}
+	for _, uid := range []string{"alice", "bob"} {
+		if balance, _ := ledger.Balance(rewards.UserAccount(uid)); balance != 0 {
+			t.Errorf("%s balance after cancellation = %d, want 0", uid, balance)
+		}
+	}
+	list, _ := svc.ReferralsBy("alice")
+	if len(list) != 1 || list[0].Status != StatusRejected {
+		t.Errorf("ReferralsBy() = %+v", list)
+	}
+}
@@ -0,0 +1,358 @@
+// Package reminders schedules the messages that follow a pickup through its
+// lifecycle: reminders the day and the hour before, nags to the collector
+// when an assigned pickup is overdue, and a request to rate the service once
+// it has been collected.
+//
+// Follow-ups are queued as jobs in the transaction that changes the pickup,
+// with unique keys derived from the pickup and its slot, so planning twice
+// finds the same job. A job checks the pickup and queues its notification in
+// a single transaction, so a retried job cannot send it twice.
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/notifications"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/routing"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// ratingsBucket holds one Rating per pickup, keyed by pickup ID.
+const ratingsBucket = "pickup_ratings"
+
+// SendKind is the job kind that sends a follow-up.
+const SendKind = "reminders.send"
+
+// SendOptions is the retry schedule of follow-ups.
+var SendOptions = jobs.Options{
+	Concurrency: 2,
+	MaxAttempts: 5,
+	Backoff:     time.Minute,
+	MaxBackoff:  time.Hour,
+	Timeout:     time.Minute,
+}
+
+// Follow-up kinds.
+const (
+	KindDayBefore  = "day_before"
+	KindHourBefore = "hour_before"
+	KindOverdue    = "overdue"
+	KindRating     = "rating"
+)
+
+// Timing of the follow-ups. Reminders are relative to the start of the
+// pickup's slot, overdue nags to its end and the rating request to the
+// collection.
+var (
+	DayBefore   = 24 * time.Hour
+	HourBefore  = time.Hour
+	OverdueNags = []time.Duration{time.Hour, 4 * time.Hour, 24 * time.Hour}
+	RatingDelay = 2 * time.Hour
+)
+
+// eat is the time zone pickup slots are given in.
+var eat = time.FixedZone("EAT", 3*60*60)
+
+var (
+	// ErrInvalidRating is returned when a rating fails validation.
+	ErrInvalidRating = errors.New("invalid rating")
+	// ErrAlreadyRated is returned when a pickup has already been rated.
+	ErrAlreadyRated = errors.New("pickup already rated")
+)
+
+// Reminder is the payload of a SendKind job. Date and TimeSlot are the slot
+// it was planned for, so reminders left behind by a rescheduled pickup are
+// skipped.
+type Reminder struct {
+	Kind     string `json:"kind"`
+	PickupID string `json:"pickup_id"`
+	Date     string `json:"date"`
+	TimeSlot string `json:"time_slot"`
+}
+
+// Rating is a resident's verdict on a collected pickup, from 1 to 5.
+type Rating struct {
+	PickupID    string    `json:"pickup_id"`
+	UserID      string    `json:"user_id"`
+	CollectorID string    `json:"collector_id,omitempty"`
+	Score       int       `json:"score"`
+	Comment     string    `json:"comment,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Scheduler plans and runs pickup follow-ups.
+type Scheduler struct {
+	store         *store.Store
+	queue         *jobs.Queue
+	notifications *notifications.Service
+	publicURL     string
+	now           func() time.Time
+}
+
+// NewScheduler creates a scheduler that runs follow-ups on queue and sends
+// them through notificationService. Rating requests link to publicURL.
+func NewScheduler(s *store.Store, queue *jobs.Queue, notificationService *notifications.Service, publicURL string) *Scheduler {
+	scheduler := &Scheduler{
+		store:         s,
+		queue:         queue,
+		notifications: notificationService,
+		publicURL:     strings.TrimRight(publicURL, "/"),
+		now:           time.Now,
+	}
+	queue.Register(SendKind, scheduler.send, SendOptions)
+	return scheduler
+}
+
+// slotWindow returns when p's slot starts and ends.
+func slotWindow(p *pickups.Pickup) (time.Time, time.Time, bool) {
+	day, err := time.ParseInLocation("2006-01-02", p.Date, eat)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	for _, slot := range routing.TimeSlots {
+		if slot.Name == p.TimeSlot {
+			return day.Add(time.Duration(slot.Start) * time.Minute), day.Add(time.Duration(slot.End) * time.Minute), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// OnPickupTransition is a pickups.Listener that plans the follow-ups of a
+// pickup as it is booked, assigned and collected.
+func (s *Scheduler) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	switch p.Status {
+	case pickups.StatusScheduled, pickups.StatusAssigned:
+		return s.planVisit(tx, p)
+	case pickups.StatusCollected:
+		// Backfill passes no previous status; the request is then timed
+		// from the recorded collection so old pickups are not asked again.
+		collected := s.now()
+		if from == "" {
+			collected = p.ChangedAt(pickups.StatusCollected)
+		}
+		return s.plan(tx, p, KindRating, p.ID, collected.Add(RatingDelay))
+	}
+	return nil
+}
+
+// planVisit plans the reminders and overdue nags for p's slot.
+func (s *Scheduler) planVisit(tx *store.Tx, p *pickups.Pickup) error {
+	start, end, ok := slotWindow(p)
+	if !ok {
+		return nil
+	}
+	slot := p.ID + ":" + p.Date + ":" + p.TimeSlot
+	if err := s.plan(tx, p, KindDayBefore, slot, start.Add(-DayBefore)); err != nil {
+		return err
+	}
+	if err := s.plan(tx, p, KindHourBefore, slot, start.Add(-HourBefore)); err != nil {
+		return err
+	}
+	for i, after := range OverdueNags {
+		if err := s.plan(tx, p, KindOverdue, fmt.Sprintf("%s:%d", slot, i+1), end.Add(after)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan queues a follow-up of kind for p unless one with the same key is
+// already queued or it would already be overdue.
+func (s *Scheduler) plan(tx *store.Tx, p *pickups.Pickup, kind, key string, due time.Time) error {
+	if due.Before(s.now()) {
+		return nil
+	}
+	reminder := Reminder{Kind: kind, PickupID: p.ID, Date: p.Date, TimeSlot: p.TimeSlot}
+	_, err := s.queue.EnqueueTx(tx, SendKind, reminder, jobs.EnqueueOptions{UniqueKey: kind + ":" + key, RunAt: due})
+	return err
+}
+
+// Backfill plans the follow-ups of pickups that changed before the
+// scheduler was installed, and returns how many jobs it planned.
+func (s *Scheduler) Backfill() (int, error) {
+	before, err := s.queue.List(jobs.Filter{Kind: SendKind})
+	if err != nil {
+		return 0, err
+	}
+	err = s.store.Update(func(tx *store.Tx) error {
+		list, err := pickups.ListTx(tx, func(p *pickups.Pickup) bool {
+			return p.Status == pickups.StatusScheduled || p.Status == pickups.StatusAssigned || p.Status == pickups.StatusCollected
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range list {
+			if err := s.OnPickupTransition(tx, p, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	after, err := s.queue.List(jobs.Filter{Kind: SendKind})
+	return len(after) - len(before), err
+}
+
+// send runs a SendKind job. A follow-up that no longer applies when it falls
+// due, e.g. a reminder for a cancelled pickup, is skipped.
+func (s *Scheduler) send(ctx context.Context, job *jobs.Job) error {
+	var reminder Reminder
+	if err := job.Decode(&reminder); err != nil {
+		return err
+	}
+	return s.store.Update(func(tx *store.Tx) error {
+		reason, err := s.execute(tx, job.UniqueKey, &reminder, s.now())
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			log.Printf("Reminder %s skipped: %s.", job.UniqueKey, reason)
+		}
+		return nil
+	})
+}
+
+// execute queues the notification reminder stands for, keyed by the job's
+// unique key. It returns why the reminder was skipped instead, or "" when a
+// notification was queued.
+func (s *Scheduler) execute(tx *store.Tx, key string, reminder *Reminder, now time.Time) (string, error) {
+	p, err := pickups.GetTx(tx, reminder.PickupID)
+	if errors.Is(err, pickups.ErrNotFound) {
+		return "pickup no longer exists", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	data := notifications.PickupData(p)
+	key = "reminder:" + key
+
+	if reminder.Kind == KindRating {
+		if p.Status != pickups.StatusCollected && p.Status != pickups.StatusProcessed {
+			return "pickup is " + p.Status, nil
+		}
+		if tx.Exists(ratingsBucket, p.ID) {
+			return "already rated", nil
+		}
+		data["rating_url"] = s.publicURL + "/dashboard?rate=" + p.ID
+		_, err := s.notifications.NotifyTx(tx, p.UserID, notifications.TemplateRatingRequest, key, data)
+		return "", err
+	}
+
+	if p.Date != reminder.Date || p.TimeSlot != reminder.TimeSlot {
+		return "pickup was rescheduled", nil
+	}
+	start, _, _ := slotWindow(p)
+	switch reminder.Kind {
+	case KindDayBefore, KindHourBefore:
+		if p.Status != pickups.StatusScheduled && p.Status != pickups.StatusAssigned {
+			return "pickup is " + p.Status, nil
+		}
+		// A reminder held up past the start of the slot, e.g. while the
+		// server was down, would only confuse.
+		if !now.Before(start) {
+			return "slot has started", nil
+		}
+		template := notifications.TemplateReminderDay
+		if reminder.Kind == KindHourBefore {
+			template = notifications.TemplateReminderHour
+		}
+		_, err := s.notifications.NotifyTx(tx, p.UserID, template, key, data)
+		return "", err
+	case KindOverdue:
+		if p.Status != pickups.StatusAssigned {
+			return "pickup is " + p.Status, nil
+		}
+		if p.CollectorID == "" {
+			return "no collector assigned", nil
+		}
+		_, err := s.notifications.NotifyTx(tx, p.CollectorID, notifications.TemplateCollectorOverdue, key, data)
+		return "", err
+	}
+	return "unknown follow-up kind " + reminder.Kind, nil
+}
+
+// Jobs returns the follow-ups planned for pickupID, or for every pickup when
+// it is empty, soonest first.
+func (s *Scheduler) Jobs(pickupID string) ([]jobs.Job, error) {
+	all, err := s.queue.List(jobs.Filter{Kind: SendKind})
+	if err != nil {
+		return nil, err
+	}
+	list := []jobs.Job{}
+	for _, job := range all {
+		var reminder Reminder
+		if err := job.Decode(&reminder); err != nil {
+			return nil, err
+		}
+		if pickupID == "" || reminder.PickupID == pickupID {
+			list = append(list, job)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].RunAt.Before(list[j].RunAt) })
+	return list, nil
+}
+
+// Rate records uid's rating of one of their collected pickups.
+func (s *Scheduler) Rate(uid, pickupID string, score int, comment string) (*Rating, error) {
+	comment = strings.TrimSpace(comment)
+	if score < 1 || score > 5 {
+		return nil, fmt.Errorf("%w: score must be between 1 and 5", ErrInvalidRating)
+	}
+	if len(comment) > 1000 {
+		return nil, fmt.Errorf("%w: comment is too long", ErrInvalidRating)
+	}
+	var rating *Rating
+	err := s.store.Update(func(tx *store.Tx) error {
+		p, err := pickups.GetTx(tx, pickupID)
+		if err == nil && p.UserID != uid {
+			err = pickups.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if p.Status != pickups.StatusCollected && p.Status != pickups.StatusProcessed {
+			return fmt.Errorf("%w: pickup %s has not been collected", ErrInvalidRating, p.ID)
+		}
+		if tx.Exists(ratingsBucket, p.ID) {
+			return ErrAlreadyRated
+		}
+		rating = &Rating{
+			PickupID:    p.ID,
+			UserID:      uid,
+			CollectorID: p.CollectorID,
+			Score:       score,
+			Comment:     comment,
+			CreatedAt:   s.now().UTC(),
+		}
+		return tx.Insert(ratingsBucket, p.ID, rating)
+	})
+	return rating, err
+}
+
+// Ratings returns every rating, newest first.
+func (s *Scheduler) Ratings() ([]Rating, error) {
+	list := []Rating{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(ratingsBucket, func(key string, raw json.RawMessage) error {
+			var r Rating
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return fmt.Errorf("error decoding rating %s: %w", key, err)
+			}
+			list = append(list, r)
+			return nil
+		})
+	})
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, err
+}
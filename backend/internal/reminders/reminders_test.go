@@ -0,0 +1,358 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/notifications"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// silentProvider accepts every message.
+type silentProvider struct{}
+
+func (silentProvider) Channel() string { return notifications.ChannelEmail }
+
+func (silentProvider) Send(context.Context, notifications.Message) error { return nil }
+
+// clock is a settable time shared by the scheduler and its queue.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) set(t time.Time) {
+	c.mu.Lock()
+	c.t = t
+	c.mu.Unlock()
+}
+
+type fixture struct {
+	scheduler     *Scheduler
+	queue         *jobs.Queue
+	pickups       *pickups.Service
+	notifications *notifications.Service
+	clock         *clock
+}
+
+func newFixture(t *testing.T, db *store.Store) *fixture {
+	t.Helper()
+	f := &fixture{
+		queue:   jobs.NewQueue(db, 4),
+		pickups: pickups.NewService(db),
+		// A few days before the pickups below.
+		clock: &clock{t: time.Date(2026, 10, 30, 9, 0, 0, 0, time.UTC)},
+	}
+	f.queue.SetClock(f.clock.now)
+	notificationService, err := notifications.NewService(db, f.queue, nil, silentProvider{})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	f.notifications = notificationService
+	f.scheduler = NewScheduler(db, f.queue, notificationService, "https://zingiratech.example/")
+	f.scheduler.now = f.clock.now
+	f.pickups.Subscribe(f.scheduler.OnPickupTransition)
+	return f
+}
+
+// book schedules a morning pickup on 2 November, which runs from 05:00 to
+// 09:00 UTC.
+func (f *fixture) book(t *testing.T, uid string) *pickups.Pickup {
+	t.Helper()
+	p, err := f.pickups.Create(uid, pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "morning",
+		Items: []pickups.Item{{Category: "phones", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return p
+}
+
+// runAt moves the clock to at, runs the queue until no job is due and
+// returns how many follow-ups it ran.
+func (f *fixture) runAt(t *testing.T, at time.Time) int {
+	t.Helper()
+	f.clock.set(at)
+	before := f.finished(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		f.queue.Run(ctx, time.Millisecond)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !f.idle(t) {
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs still due at %s", at)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return f.finished(t) - before
+}
+
+// idle reports whether no job is running or due.
+func (f *fixture) idle(t *testing.T) bool {
+	t.Helper()
+	list, err := f.queue.List(jobs.Filter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	for _, job := range list {
+		if job.Status == jobs.StatusRunning || job.Status == jobs.StatusQueued && !job.RunAt.After(f.clock.now()) {
+			return false
+		}
+	}
+	return true
+}
+
+// finished returns how many follow-ups have run to completion.
+func (f *fixture) finished(t *testing.T) int {
+	t.Helper()
+	list, err := f.queue.List(jobs.Filter{Kind: SendKind, Status: jobs.StatusSucceeded})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	return len(list)
+}
+
+func (f *fixture) templates(t *testing.T, uid string) []string {
+	t.Helper()
+	list, err := f.notifications.List(notifications.Filter{UserID: uid})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var names []string
+	for i := len(list) - 1; i >= 0; i-- {
+		names = append(names, list[i].Template)
+	}
+	return names
+}
+
+func (f *fixture) job(t *testing.T, key string) jobs.Job {
+	t.Helper()
+	list, err := f.scheduler.Jobs("")
+	if err != nil {
+		t.Fatalf("Jobs() error = %v", err)
+	}
+	for _, job := range list {
+		if job.UniqueKey == key {
+			return job
+		}
+	}
+	t.Fatalf("no job %s in %+v", key, list)
+	return jobs.Job{}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFollowUpsAcrossThePickupLifecycle(t *testing.T) {
+	f := newFixture(t, store.NewMemory())
+	p := f.book(t, "amina")
+	if _, err := f.pickups.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	planned, _ := f.scheduler.Jobs(p.ID)
+	if len(planned) != 2+len(OverdueNags) {
+		t.Fatalf("planned %d jobs, want %d: %+v", len(planned), 2+len(OverdueNags), planned)
+	}
+
+	if n := f.runAt(t, time.Date(2026, 11, 1, 4, 59, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("ran %d jobs before any was due", n)
+	}
+	f.runAt(t, time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC))
+	f.runAt(t, time.Date(2026, 11, 2, 4, 0, 0, 0, time.UTC))
+	f.runAt(t, time.Date(2026, 11, 2, 10, 0, 0, 0, time.UTC))
+	if got := f.templates(t, "amina"); !equal(got, []string{
+		notifications.TemplateReminderDay, notifications.TemplateReminderHour,
+	}) {
+		t.Errorf("resident was sent %v", got)
+	}
+	if got := f.templates(t, "col1"); !equal(got, []string{notifications.TemplateCollectorOverdue}) {
+		t.Errorf("collector was sent %v", got)
+	}
+
+	if _, err := f.pickups.Transition(p.ID, pickups.StatusCollected, "col1"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	// The rating request falls due at noon and the second nag at 13:00.
+	f.runAt(t, time.Date(2026, 11, 2, 13, 0, 0, 0, time.UTC))
+	if got := f.job(t, KindOverdue+":"+p.ID+":2026-11-02:morning:2"); got.Status != jobs.StatusSucceeded {
+		t.Errorf("second nag after collection = %+v", got)
+	}
+	if got := f.templates(t, "col1"); len(got) != 1 {
+		t.Errorf("collector was nagged after collection: %v", got)
+	}
+	list, _ := f.notifications.List(notifications.Filter{UserID: "amina"})
+	if list[0].Template != notifications.TemplateRatingRequest || list[0].Data["rating_url"] != "https://zingiratech.example/dashboard?rate="+p.ID {
+		t.Errorf("latest notification = %+v, want a rating request", list[0])
+	}
+}
+
+func TestStaleJobsAreSkipped(t *testing.T) {
+	f := newFixture(t, store.NewMemory())
+	cancelled := f.book(t, "amina")
+	if _, err := f.pickups.Transition(cancelled.ID, pickups.StatusCancelled, "amina"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	moved := f.book(t, "otieno")
+	err := f.scheduler.store.Update(func(tx *store.Tx) error {
+		p, err := pickups.GetTx(tx, moved.ID)
+		if err != nil {
+			return err
+		}
+		p.Date = "2026-11-05"
+		return pickups.SaveTx(tx, p)
+	})
+	if err != nil {
+		t.Fatalf("rescheduling error = %v", err)
+	}
+
+	f.runAt(t, time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC))
+	if got := f.job(t, KindDayBefore+":"+cancelled.ID+":2026-11-02:morning"); got.Status != jobs.StatusSucceeded {
+		t.Errorf("reminder for cancelled pickup = %+v", got)
+	}
+	if got := f.templates(t, "amina"); len(got) != 0 {
+		t.Errorf("cancelled pickup was sent %v", got)
+	}
+	if got := f.job(t, KindDayBefore+":"+moved.ID+":2026-11-02:morning"); got.Status != jobs.StatusSucceeded {
+		t.Errorf("reminder for rescheduled pickup = %+v", got)
+	}
+	if got := f.templates(t, "otieno"); len(got) != 0 {
+		t.Errorf("rescheduled pickup was sent %v", got)
+	}
+
+	// A reminder held up until its slot has started is dropped.
+	late := f.book(t, "wanjiru")
+	f.runAt(t, time.Date(2026, 11, 2, 6, 0, 0, 0, time.UTC))
+	if got := f.job(t, KindHourBefore+":"+late.ID+":2026-11-02:morning"); got.Status != jobs.StatusSucceeded {
+		t.Errorf("late reminder = %+v", got)
+	}
+	if got := f.templates(t, "wanjiru"); len(got) != 0 {
+		t.Errorf("late booking was sent %v", got)
+	}
+}
+
+func TestJobsSurviveRestartsWithoutDuplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	open := func() *fixture {
+		db, err := store.Open(path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		return newFixture(t, db)
+	}
+
+	first := open()
+	p := first.book(t, "amina")
+
+	// The server is down when the reminder falls due and comes back later.
+	second := open()
+	if n, err := second.scheduler.Backfill(); err != nil || n != 0 {
+		t.Fatalf("Backfill() after restart = %d, %v; want no new jobs", n, err)
+	}
+	if n := second.runAt(t, time.Date(2026, 11, 1, 8, 0, 0, 0, time.UTC)); n != 1 {
+		t.Fatalf("ran %d jobs after restart, want 1", n)
+	}
+
+	third := open()
+	if n := third.runAt(t, time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("ran %d jobs again after a second restart", n)
+	}
+	if got := third.templates(t, "amina"); !equal(got, []string{notifications.TemplateReminderDay}) {
+		t.Errorf("notifications after restarts = %v", got)
+	}
+	if got := third.job(t, KindDayBefore+":"+p.ID+":2026-11-02:morning"); got.Status != jobs.StatusSucceeded || got.Attempts != 1 {
+		t.Errorf("day-before job = %+v", got)
+	}
+}
+
+func TestBackfillPlansEarlierPickups(t *testing.T) {
+	db := store.NewMemory()
+	p, err := pickups.NewService(db).Create("amina", pickups.CreateRequest{
+		Address: "Kilimani, Nairobi", Date: "2026-11-02", TimeSlot: "evening",
+		Items: []pickups.Item{{Category: "phones", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	f := newFixture(t, db)
+	if n, err := f.scheduler.Backfill(); err != nil || n != 2+len(OverdueNags) {
+		t.Fatalf("Backfill() = %d, %v; want %d", n, err, 2+len(OverdueNags))
+	}
+	if n, _ := f.scheduler.Backfill(); n != 0 {
+		t.Errorf("second Backfill() planned %d jobs", n)
+	}
+	if planned, _ := f.scheduler.Jobs(p.ID); len(planned) != 2+len(OverdueNags) {
+		t.Errorf("Jobs() returned %d jobs", len(planned))
+	}
+}
+
+func TestRate(t *testing.T) {
+	f := newFixture(t, store.NewMemory())
+	p := f.book(t, "amina")
+
+	if _, err := f.scheduler.Rate("amina", p.ID, 5, ""); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("Rate() before collection error = %v, want ErrInvalidRating", err)
+	}
+	if _, err := f.pickups.Assign(p.ID, "col1", "", "admin"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if _, err := f.pickups.Transition(p.ID, pickups.StatusCollected, "col1"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+
+	if _, err := f.scheduler.Rate("amina", p.ID, 6, ""); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("Rate(6) error = %v, want ErrInvalidRating", err)
+	}
+	if _, err := f.scheduler.Rate("otieno", p.ID, 4, ""); !errors.Is(err, pickups.ErrNotFound) {
+		t.Errorf("Rate() by another user error = %v, want ErrNotFound", err)
+	}
+	rating, err := f.scheduler.Rate("amina", p.ID, 4, "  Friendly and on time  ")
+	if err != nil || rating.CollectorID != "col1" || rating.Comment != "Friendly and on time" {
+		t.Fatalf("Rate() = %+v, %v", rating, err)
+	}
+	if _, err := f.scheduler.Rate("amina", p.ID, 5, ""); !errors.Is(err, ErrAlreadyRated) {
+		t.Errorf("second Rate() error = %v, want ErrAlreadyRated", err)
+	}
+
+	// Having rated already, the resident is not asked to.
+	f.runAt(t, f.clock.now().Add(RatingDelay))
+	if got := f.job(t, KindRating+":"+p.ID); got.Status != jobs.StatusSucceeded {
+		t.Errorf("rating request = %+v", got)
+	}
+	if got := f.templates(t, "amina"); len(got) != 0 {
+		t.Errorf("resident who rated was sent %v", got)
+	}
+	if ratings, _ := f.scheduler.Ratings(); len(ratings) != 1 || ratings[0].Score != 4 {
+		t.Errorf("Ratings() = %+v", ratings)
+	}
+}
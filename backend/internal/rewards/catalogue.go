@@ -0,0 +1,448 @@
+package rewards
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the catalogue.
+const (
+	catalogueBucket      = "reward_catalogue"
+	redemptionsBucket    = "reward_redemptions"
+	redemptionKeysBucket = "reward_redemption_keys"
+)
+
+// ReasonRedemption is the ledger reason of points spent on a reward.
+const ReasonRedemption = "redemption"
+
+// Reward categories, matching the filter buttons on the rewards page.
+const (
+	CategoryVouchers = "vouchers"
+	CategoryProducts = "products"
+	CategoryServices = "services"
+)
+
+// Redemption states.
+const (
+	RedemptionHeld      = "held"
+	RedemptionReserved  = "reserved"
+	RedemptionFulfilled = "fulfilled"
+	RedemptionCancelled = "cancelled"
+)
+
+var (
+	// ErrRewardNotFound is returned when a reward does not exist or is inactive.
+	ErrRewardNotFound = errors.New("reward not found")
+	// ErrOutOfStock is returned when a reward has no units left.
+	ErrOutOfStock = errors.New("reward out of stock")
+	// ErrInvalidReward is returned when a catalogue entry fails validation.
+	ErrInvalidReward = errors.New("invalid reward")
+	// ErrRedemptionNotFound is returned when a redemption does not exist.
+	ErrRedemptionNotFound = errors.New("redemption not found")
+	// ErrRedemptionClosed is returned when a redemption is not in the state an operation needs.
+	ErrRedemptionClosed = errors.New("redemption is not open for this operation")
+)
+
+var validCategories = map[string]bool{CategoryVouchers: true, CategoryProducts: true, CategoryServices: true}
+
+// Reward is an item in the rewards catalogue. Stock counts the units still
+// available; Reserved counts units redeemed but not yet fulfilled.
+type Reward struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	PointsCost  int64  `json:"points_cost"`
+	Stock       int    `json:"stock"`
+	Reserved    int    `json:"reserved"`
+	Image       string `json:"image,omitempty"`
+	Active      bool   `json:"active"`
+}
+
+// Redemption records a user exchanging points for a reward.
+type Redemption struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	RewardID    string    `json:"reward_id"`
+	RewardName  string    `json:"reward_name"`
+	Points      int64     `json:"points"`
+	VoucherCode string    `json:"voucher_code"`
+	Status      string    `json:"status"`
+	PostingID   string    `json:"posting_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultCatalogue is the catalogue seeded into an empty store.
+func DefaultCatalogue() []Reward {
+	return []Reward{
+		{ID: "shopping-voucher", Name: "Shopping Voucher", Description: "KES 5,000 shopping voucher at eco-friendly stores", Category: CategoryVouchers, PointsCost: 500, Stock: 100, Image: "images/rewards/shopping-voucher.png", Active: true},
+		{ID: "eco-bag-set", Name: "Reusable Eco Bag Set", Description: "Premium quality reusable shopping bags", Category: CategoryProducts, PointsCost: 200, Stock: 250, Image: "images/rewards/eco-bag.png", Active: true},
+		{ID: "solar-power-bank", Name: "Solar Power Bank", Description: "10,000mAh solar charging power bank", Category: CategoryProducts, PointsCost: 800, Stock: 40, Image: "images/rewards/laptop.jpg", Active: true},
+		{ID: "tree-planting", Name: "Tree Planting Initiative", Description: "A tree planted in Karura Forest in your name", Category: CategoryServices, PointsCost: 300, Stock: 1000, Image: "images/features/rewards.png", Active: true},
+		{ID: "premium-pickup", Name: "Premium Pickup Service", Description: "1 month of premium pickup service", Category: CategoryServices, PointsCost: 1000, Stock: 50, Image: "images/features/convenience.png", Active: true},
+	}
+}
+
+// RedemptionScreen inspects a redemption before it is committed. Returning
+// true holds the redemption for review: its points move to the user's pending
+// account and no voucher code is issued until the hold is released.
+type RedemptionScreen func(tx *store.Tx, uid string, reward Reward, redemptionID string) (bool, error)
+
+// Catalogue manages rewards, their inventory and redemptions.
+type Catalogue struct {
+	store  *store.Store
+	ledger *Ledger
+	screen RedemptionScreen
+	now    func() time.Time
+}
+
+// NewCatalogue creates a catalogue that debits points from ledger.
+func NewCatalogue(s *store.Store, ledger *Ledger) *Catalogue {
+	return &Catalogue{store: s, ledger: ledger, now: time.Now}
+}
+
+// SetScreen installs the check run on every new redemption.
+func (c *Catalogue) SetScreen(screen RedemptionScreen) {
+	c.screen = screen
+}
+
+// Seed stores the default catalogue if the catalogue is empty.
+func (c *Catalogue) Seed() error {
+	return c.store.Update(func(tx *store.Tx) error {
+		empty := true
+		if err := tx.ForEach(catalogueBucket, func(string, json.RawMessage) error {
+			empty = false
+			return nil
+		}); err != nil {
+			return err
+		}
+		if !empty {
+			return nil
+		}
+		for _, reward := range DefaultCatalogue() {
+			if err := tx.Put(catalogueBucket, reward.ID, reward); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns the active rewards in category, or all of them if category is empty.
+func (c *Catalogue) List(category string, includeInactive bool) ([]Reward, error) {
+	rewards := []Reward{}
+	err := c.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(catalogueBucket, func(key string, raw json.RawMessage) error {
+			var reward Reward
+			if err := json.Unmarshal(raw, &reward); err != nil {
+				return fmt.Errorf("error decoding reward %s: %w", key, err)
+			}
+			if (category == "" || reward.Category == category) && (reward.Active || includeInactive) {
+				rewards = append(rewards, reward)
+			}
+			return nil
+		})
+	})
+	return rewards, err
+}
+
+// Get returns a single reward.
+func (c *Catalogue) Get(id string) (*Reward, error) {
+	var reward Reward
+	err := c.store.View(func(tx *store.Tx) error {
+		return tx.Get(catalogueBucket, id, &reward)
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrRewardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// Save creates or replaces a catalogue entry. The reserved count is kept from
+// the stored entry, since it is owned by the redemption flow.
+func (c *Catalogue) Save(reward Reward) (*Reward, error) {
+	reward.ID = strings.TrimSpace(reward.ID)
+	if reward.ID == "" || reward.Name == "" || !validCategories[reward.Category] || reward.PointsCost <= 0 || reward.Stock < 0 {
+		return nil, fmt.Errorf("%w: id, name, a known category, a positive cost and non-negative stock are required", ErrInvalidReward)
+	}
+	err := c.store.Update(func(tx *store.Tx) error {
+		var existing Reward
+		if err := tx.Get(catalogueBucket, reward.ID, &existing); err == nil {
+			reward.Reserved = existing.Reserved
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		} else {
+			reward.Reserved = 0
+		}
+		return tx.Put(catalogueBucket, reward.ID, reward)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// Redeem exchanges points for a reward. Balance and stock are checked, the
+// ledger debited, a unit reserved and a voucher code issued in one
+// transaction, so either all of it happens or none of it does. Retrying with
+// the same idempotency key returns the original redemption.
+func (c *Catalogue) Redeem(uid, rewardID, idempotencyKey string) (*Redemption, error) {
+	if idempotencyKey == "" {
+		return nil, fmt.Errorf("%w: idempotency key is required", ErrInvalidPosting)
+	}
+	key := uid + ":" + idempotencyKey
+
+	var redemption *Redemption
+	err := c.store.Update(func(tx *store.Tx) error {
+		var existingID string
+		if err := tx.Get(redemptionKeysBucket, key, &existingID); err == nil {
+			var existing Redemption
+			if err := tx.Get(redemptionsBucket, existingID, &existing); err != nil {
+				return err
+			}
+			if existing.RewardID != rewardID {
+				return ErrIdempotencyConflict
+			}
+			redemption = &existing
+			return nil
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		var reward Reward
+		if err := tx.Get(catalogueBucket, rewardID, &reward); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return ErrRewardNotFound
+			}
+			return err
+		}
+		if !reward.Active {
+			return ErrRewardNotFound
+		}
+		if reward.Stock <= 0 {
+			return ErrOutOfStock
+		}
+
+		seq, err := tx.NextSequence(redemptionsBucket)
+		if err != nil {
+			return err
+		}
+		id := fmt.Sprintf("rdm_%d", seq)
+
+		held := false
+		if c.screen != nil {
+			if held, err = c.screen(tx, uid, reward, id); err != nil {
+				return err
+			}
+		}
+
+		destination, status, code := AccountRedeemed, RedemptionReserved, ""
+		if held {
+			destination, status = PendingAccount(uid), RedemptionHeld
+		} else if code, err = voucherCode(); err != nil {
+			return err
+		}
+
+		posting, err := c.ledger.PostTx(tx, PostingRequest{
+			IdempotencyKey: "redeem:" + key,
+			Reason:         ReasonRedemption,
+			Reference:      id,
+			Metadata:       map[string]string{"reward_id": reward.ID},
+			Lines:          Transfer(UserAccount(uid), destination, reward.PointsCost),
+		})
+		if err != nil {
+			return err
+		}
+
+		reward.Stock--
+		reward.Reserved++
+		if err := tx.Put(catalogueBucket, reward.ID, reward); err != nil {
+			return err
+		}
+
+		now := c.now().UTC()
+		redemption = &Redemption{
+			ID:          id,
+			UserID:      uid,
+			RewardID:    reward.ID,
+			RewardName:  reward.Name,
+			Points:      reward.PointsCost,
+			VoucherCode: code,
+			Status:      status,
+			PostingID:   posting.ID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := tx.Insert(redemptionsBucket, id, redemption); err != nil {
+			return err
+		}
+		return tx.Insert(redemptionKeysBucket, key, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// Redemptions returns the redemptions of uid, newest first. An empty uid returns every redemption.
+func (c *Catalogue) Redemptions(uid string) ([]Redemption, error) {
+	var result []Redemption
+	err := c.store.View(func(tx *store.Tx) error {
+		var err error
+		result, err = RedemptionsTx(tx, uid)
+		return err
+	})
+	return result, err
+}
+
+// RedemptionsTx lists redemptions inside an existing transaction, newest first.
+func RedemptionsTx(tx *store.Tx, uid string) ([]Redemption, error) {
+	result := []Redemption{}
+	err := tx.ForEach(redemptionsBucket, func(key string, raw json.RawMessage) error {
+		var redemption Redemption
+		if err := json.Unmarshal(raw, &redemption); err != nil {
+			return fmt.Errorf("error decoding redemption %s: %w", key, err)
+		}
+		if uid == "" || redemption.UserID == uid {
+			result = append(result, redemption)
+		}
+		return nil
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, err
+}
+
+// ResolveHeldTx settles a held redemption. Releasing it completes the
+// redemption and issues its voucher code; otherwise the redemption is
+// cancelled, its unit returned to stock and the held points forfeited.
+func (c *Catalogue) ResolveHeldTx(tx *store.Tx, redemptionID string, release bool) (*Redemption, error) {
+	var redemption Redemption
+	if err := tx.Get(redemptionsBucket, redemptionID, &redemption); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrRedemptionNotFound
+		}
+		return nil, err
+	}
+	if redemption.Status != RedemptionHeld {
+		return nil, ErrRedemptionClosed
+	}
+
+	destination := AccountIssued
+	if release {
+		destination = AccountRedeemed
+	}
+	if _, err := c.ledger.PostTx(tx, PostingRequest{
+		IdempotencyKey: "redemption-hold:" + redemption.ID,
+		Reason:         "redemption_review",
+		Reference:      redemption.ID,
+		Lines:          Transfer(PendingAccount(redemption.UserID), destination, redemption.Points),
+	}); err != nil {
+		return nil, err
+	}
+
+	if release {
+		code, err := voucherCode()
+		if err != nil {
+			return nil, err
+		}
+		redemption.VoucherCode = code
+		redemption.Status = RedemptionReserved
+	} else {
+		var reward Reward
+		if err := tx.Get(catalogueBucket, redemption.RewardID, &reward); err != nil {
+			return nil, err
+		}
+		reward.Stock++
+		reward.Reserved--
+		if err := tx.Put(catalogueBucket, reward.ID, reward); err != nil {
+			return nil, err
+		}
+		redemption.Status = RedemptionCancelled
+	}
+	redemption.UpdatedAt = c.now().UTC()
+	if err := tx.Put(redemptionsBucket, redemption.ID, redemption); err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// Fulfil marks a reserved redemption as delivered, releasing its reservation.
+func (c *Catalogue) Fulfil(redemptionID string) (*Redemption, error) {
+	return c.close(redemptionID, RedemptionFulfilled)
+}
+
+// Cancel releases a reserved redemption back into stock and refunds its points.
+func (c *Catalogue) Cancel(redemptionID string) (*Redemption, error) {
+	return c.close(redemptionID, RedemptionCancelled)
+}
+
+func (c *Catalogue) close(redemptionID, status string) (*Redemption, error) {
+	var redemption Redemption
+	err := c.store.Update(func(tx *store.Tx) error {
+		if err := tx.Get(redemptionsBucket, redemptionID, &redemption); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return ErrRedemptionNotFound
+			}
+			return err
+		}
+		if redemption.Status != RedemptionReserved {
+			return ErrRedemptionClosed
+		}
+
+		var reward Reward
+		if err := tx.Get(catalogueBucket, redemption.RewardID, &reward); err != nil {
+			return err
+		}
+		reward.Reserved--
+		if status == RedemptionCancelled {
+			reward.Stock++
+			if _, err := c.ledger.PostTx(tx, PostingRequest{
+				IdempotencyKey: "redemption-refund:" + redemption.ID,
+				Reason:         "redemption_refund",
+				Reference:      redemption.ID,
+				Lines:          Transfer(AccountRedeemed, UserAccount(redemption.UserID), redemption.Points),
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Put(catalogueBucket, reward.ID, reward); err != nil {
+			return err
+		}
+
+		redemption.Status = status
+		redemption.UpdatedAt = c.now().UTC()
+		return tx.Put(redemptionsBucket, redemption.ID, redemption)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// voucherAlphabet avoids characters that are easy to confuse when read aloud.
+const voucherAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// voucherCode returns a random code such as ZT-7KQ4-M9XP.
+func voucherCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating voucher code: %w", err)
+	}
+	for i := range buf {
+		buf[i] = voucherAlphabet[int(buf[i])%len(voucherAlphabet)]
+	}
+	return fmt.Sprintf("ZT-%s-%s", buf[:4], buf[4:]), nil
+}
@@ -0,0 +1,84 @@
+package rewards
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func newTestCatalogue(t *testing.T, points int64) (*Catalogue, *Ledger) {
+	t.Helper()
+	db := store.NewMemory()
+	ledger := NewLedger(db)
+	catalogue := NewCatalogue(db, ledger)
+	if _, err := catalogue.Save(Reward{ID: "bag", Name: "Bag", Category: CategoryProducts, PointsCost: 200, Stock: 1, Active: true}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if points > 0 {
+		if _, err := ledger.Post(PostingRequest{IdempotencyKey: "seed", Reason: "pickup", Lines: Transfer(AccountIssued, UserAccount("u1"), points)}); err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+	}
+	return catalogue, ledger
+}
+
+func TestRedeemReservesStockAndDebitsLedger(t *testing.T) {
+	catalogue, ledger := newTestCatalogue(t, 500)
+
+	redemption, err := catalogue.Redeem("u1", "bag", "k1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if !strings.HasPrefix(redemption.VoucherCode, "ZT-") || redemption.Status != RedemptionReserved {
+		t.Errorf("redemption = %+v", redemption)
+	}
+
+	reward, _ := catalogue.Get("bag")
+	if reward.Stock != 0 || reward.Reserved != 1 {
+		t.Errorf("stock = %d reserved = %d, want 0 and 1", reward.Stock, reward.Reserved)
+	}
+	if balance, _ := ledger.Balance(UserAccount("u1")); balance != 300 {
+		t.Errorf("balance = %d, want 300", balance)
+	}
+
+	if _, err := catalogue.Redeem("u1", "bag", "k2"); !errors.Is(err, ErrOutOfStock) {
+		t.Errorf("second Redeem() error = %v, want ErrOutOfStock", err)
+	}
+}
+
+func TestRedeemIsAtomic(t *testing.T) {
+	catalogue, _ := newTestCatalogue(t, 100)
+
+	if _, err := catalogue.Redeem("u1", "bag", "k1"); !errors.Is(err, ErrInsufficientPoints) {
+		t.Fatalf("Redeem() error = %v, want ErrInsufficientPoints", err)
+	}
+	reward, _ := catalogue.Get("bag")
+	if reward.Stock != 1 || reward.Reserved != 0 {
+		t.Errorf("failed redemption changed inventory: %+v", reward)
+	}
+}
+
+func TestCancelRedemptionRefunds(t *testing.T) {
+	catalogue, ledger := newTestCatalogue(t, 200)
+	redemption, err := catalogue.Redeem("u1", "bag", "k1")
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+
+	if _, err := catalogue.Cancel(redemption.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if _, err := catalogue.Fulfil(redemption.ID); !errors.Is(err, ErrRedemptionClosed) {
+		t.Errorf("Fulfil() after cancel error = %v, want ErrRedemptionClosed", err)
+	}
+
+	reward, _ := catalogue.Get("bag")
+	if reward.Stock != 1 || reward.Reserved != 0 {
+		t.Errorf("inventory after cancel = %+v", reward)
+	}
+	if balance, _ := ledger.Balance(UserAccount("u1")); balance != 200 {
+		t.Errorf("balance after refund = %d, want 200", balance)
+	}
+}
@@ -0,0 +1,371 @@
+package rewards
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the ledger.
+const (
+	postingsBucket    = "ledger_postings"
+	entriesBucket     = "ledger_entries"
+	idempotencyBucket = "ledger_idempotency"
+)
+
+// System accounts that balance user accounts. Points are issued out of
+// AccountIssued and flow into AccountRedeemed when spent. System accounts
+// are allowed to go negative; every other account is not.
+const (
+	AccountIssued   = "system:issued"
+	AccountRedeemed = "system:redeemed"
+)
+
+// Entry directions.
+const (
+	Credit = "credit"
+	Debit  = "debit"
+)
+
+var (
+	// ErrInsufficientPoints is returned when a debit would take an account below zero.
+	ErrInsufficientPoints = errors.New("insufficient points")
+	// ErrIdempotencyConflict is returned when an idempotency key is reused for a different posting.
+	ErrIdempotencyConflict = errors.New("idempotency key already used for a different posting")
+	// ErrInvalidPosting is returned when a posting request is malformed or unbalanced.
+	ErrInvalidPosting = errors.New("invalid posting")
+)
+
+// UserAccount returns the ledger account holding a user's spendable points.
+func UserAccount(uid string) string {
+	return "user:" + uid
+}
+
+// PendingAccount returns the ledger account holding a user's points while they are under review.
+func PendingAccount(uid string) string {
+	return "pending:" + uid
+}
+
+func isSystemAccount(account string) bool {
+	return strings.HasPrefix(account, "system:")
+}
+
+// Line is one leg of a posting.
+type Line struct {
+	Account   string `json:"account"`
+	Direction string `json:"direction"`
+	Points    int64  `json:"points"`
+}
+
+// Posting is an immutable, balanced set of ledger lines.
+type Posting struct {
+	ID             string            `json:"id"`
+	IdempotencyKey string            `json:"idempotency_key"`
+	Reason         string            `json:"reason"`
+	Reference      string            `json:"reference,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Lines          []Line            `json:"lines"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// Entry is a single ledger line as stored and reported in account history.
+type Entry struct {
+	ID        string            `json:"id"`
+	PostingID string            `json:"posting_id"`
+	Account   string            `json:"account"`
+	Direction string            `json:"direction"`
+	Points    int64             `json:"points"`
+	Reason    string            `json:"reason"`
+	Reference string            `json:"reference,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Signed returns the effect of the entry on its account balance.
+func (e Entry) Signed() int64 {
+	if e.Direction == Debit {
+		return -e.Points
+	}
+	return e.Points
+}
+
+// PostingRequest describes a posting to be recorded.
+type PostingRequest struct {
+	IdempotencyKey string
+	Reason         string
+	Reference      string
+	Metadata       map[string]string
+	Lines          []Line
+}
+
+// Listener is notified of every new posting, inside the transaction that
+// records it. Replays of an earlier posting are not reported again.
+type Listener func(tx *store.Tx, p *Posting) error
+
+// Ledger records points movements as double-entry postings. Balances are
+// never stored; they are always derived from the entries.
+type Ledger struct {
+	store     *store.Store
+	now       func() time.Time
+	listeners []Listener
+}
+
+// NewLedger creates a ledger backed by s.
+func NewLedger(s *store.Store) *Ledger {
+	return &Ledger{store: s, now: time.Now}
+}
+
+// Subscribe registers l to be called for every new posting.
+func (l *Ledger) Subscribe(listener Listener) {
+	l.listeners = append(l.listeners, listener)
+}
+
+// Post records req in its own transaction.
+func (l *Ledger) Post(req PostingRequest) (*Posting, error) {
+	var posting *Posting
+	err := l.store.Update(func(tx *store.Tx) error {
+		var err error
+		posting, err = l.PostTx(tx, req)
+		return err
+	})
+	return posting, err
+}
+
+// PostTx records req inside an existing transaction, so that callers can
+// combine a points movement with other state changes atomically. Replaying
+// a request with the same idempotency key returns the original posting.
+func (l *Ledger) PostTx(tx *store.Tx, req PostingRequest) (*Posting, error) {
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	var existingID string
+	if err := tx.Get(idempotencyBucket, req.IdempotencyKey, &existingID); err == nil {
+		var existing Posting
+		if err := tx.Get(postingsBucket, existingID, &existing); err != nil {
+			return nil, fmt.Errorf("error loading posting %s: %w", existingID, err)
+		}
+		if existing.Reason != req.Reason || existing.Reference != req.Reference || !reflect.DeepEqual(existing.Lines, req.Lines) {
+			return nil, ErrIdempotencyConflict
+		}
+		return &existing, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// Non-system accounts may never go negative.
+	debits := make(map[string]int64)
+	for _, line := range req.Lines {
+		if line.Direction == Debit && !isSystemAccount(line.Account) {
+			debits[line.Account] += line.Points
+		}
+	}
+	for account, amount := range debits {
+		balance, err := l.BalanceTx(tx, account)
+		if err != nil {
+			return nil, err
+		}
+		if balance < amount {
+			return nil, ErrInsufficientPoints
+		}
+	}
+
+	seq, err := tx.NextSequence(postingsBucket)
+	if err != nil {
+		return nil, err
+	}
+	posting := &Posting{
+		ID:             fmt.Sprintf("pst_%d", seq),
+		IdempotencyKey: req.IdempotencyKey,
+		Reason:         req.Reason,
+		Reference:      req.Reference,
+		Metadata:       req.Metadata,
+		Lines:          req.Lines,
+		CreatedAt:      l.now().UTC(),
+	}
+
+	for _, line := range req.Lines {
+		entrySeq, err := tx.NextSequence(entriesBucket)
+		if err != nil {
+			return nil, err
+		}
+		entry := Entry{
+			ID:        fmt.Sprintf("ent_%d", entrySeq),
+			PostingID: posting.ID,
+			Account:   line.Account,
+			Direction: line.Direction,
+			Points:    line.Points,
+			Reason:    req.Reason,
+			Reference: req.Reference,
+			Metadata:  req.Metadata,
+			CreatedAt: posting.CreatedAt,
+		}
+		if err := tx.Insert(entriesBucket, store.SequenceKey(entrySeq), entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Insert(postingsBucket, posting.ID, posting); err != nil {
+		return nil, err
+	}
+	if err := tx.Insert(idempotencyBucket, req.IdempotencyKey, posting.ID); err != nil {
+		return nil, err
+	}
+	for _, listener := range l.listeners {
+		if err := listener(tx, posting); err != nil {
+			return nil, err
+		}
+	}
+	return posting, nil
+}
+
+// PostingByKeyTx returns the posting recorded under an idempotency key, or store.ErrNotFound.
+func (l *Ledger) PostingByKeyTx(tx *store.Tx, idempotencyKey string) (*Posting, error) {
+	var id string
+	if err := tx.Get(idempotencyBucket, idempotencyKey, &id); err != nil {
+		return nil, err
+	}
+	var posting Posting
+	if err := tx.Get(postingsBucket, id, &posting); err != nil {
+		return nil, err
+	}
+	return &posting, nil
+}
+
+// validate checks that a posting request is well formed and balanced.
+func validate(req PostingRequest) error {
+	if req.IdempotencyKey == "" {
+		return fmt.Errorf("%w: idempotency key is required", ErrInvalidPosting)
+	}
+	if req.Reason == "" {
+		return fmt.Errorf("%w: reason is required", ErrInvalidPosting)
+	}
+	if len(req.Lines) < 2 {
+		return fmt.Errorf("%w: at least two lines are required", ErrInvalidPosting)
+	}
+
+	var debits, credits int64
+	for _, line := range req.Lines {
+		if line.Account == "" || line.Points <= 0 {
+			return fmt.Errorf("%w: every line needs an account and positive points", ErrInvalidPosting)
+		}
+		switch line.Direction {
+		case Debit:
+			debits += line.Points
+		case Credit:
+			credits += line.Points
+		default:
+			return fmt.Errorf("%w: unknown direction %q", ErrInvalidPosting, line.Direction)
+		}
+	}
+	if debits != credits {
+		return fmt.Errorf("%w: debits %d do not equal credits %d", ErrInvalidPosting, debits, credits)
+	}
+	return nil
+}
+
+// Transfer builds the two lines that move points from one account to another.
+func Transfer(from, to string, points int64) []Line {
+	return []Line{
+		{Account: from, Direction: Debit, Points: points},
+		{Account: to, Direction: Credit, Points: points},
+	}
+}
+
+// AwardTx issues points to a user.
+func (l *Ledger) AwardTx(tx *store.Tx, uid string, points int64, idempotencyKey, reason, reference string, metadata map[string]string) (*Posting, error) {
+	return l.PostTx(tx, PostingRequest{
+		IdempotencyKey: idempotencyKey,
+		Reason:         reason,
+		Reference:      reference,
+		Metadata:       metadata,
+		Lines:          Transfer(AccountIssued, UserAccount(uid), points),
+	})
+}
+
+// SpendTx takes points from a user, failing with ErrInsufficientPoints if the balance is too low.
+func (l *Ledger) SpendTx(tx *store.Tx, uid string, points int64, idempotencyKey, reason, reference string, metadata map[string]string) (*Posting, error) {
+	return l.PostTx(tx, PostingRequest{
+		IdempotencyKey: idempotencyKey,
+		Reason:         reason,
+		Reference:      reference,
+		Metadata:       metadata,
+		Lines:          Transfer(UserAccount(uid), AccountRedeemed, points),
+	})
+}
+
+// Balance returns the current balance of account.
+func (l *Ledger) Balance(account string) (int64, error) {
+	var balance int64
+	err := l.store.View(func(tx *store.Tx) error {
+		var err error
+		balance, err = l.BalanceTx(tx, account)
+		return err
+	})
+	return balance, err
+}
+
+// BalanceTx sums the entries of account inside an existing transaction.
+func (l *Ledger) BalanceTx(tx *store.Tx, account string) (int64, error) {
+	var balance int64
+	err := forEachEntry(tx, func(entry Entry) error {
+		if entry.Account == account {
+			balance += entry.Signed()
+		}
+		return nil
+	})
+	return balance, err
+}
+
+// History returns one page of the entries of account, newest first, along with the total number of entries.
+func (l *Ledger) History(account string, page, pageSize int) ([]Entry, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+
+	var all []Entry
+	err := l.store.View(func(tx *store.Tx) error {
+		return forEachEntry(tx, func(entry Entry) error {
+			if entry.Account == account {
+				all = append(all, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Entries are stored oldest first.
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+
+	start := (page - 1) * pageSize
+	if start >= len(all) {
+		return []Entry{}, len(all), nil
+	}
+	end := start + pageSize
+	if end > len(all) {
+		end = len(all)
+	}
+	return all[start:end], len(all), nil
+}
+
+func forEachEntry(tx *store.Tx, fn func(Entry) error) error {
+	return tx.ForEach(entriesBucket, func(key string, raw json.RawMessage) error {
+		var entry Entry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return fmt.Errorf("error decoding ledger entry %s: %w", key, err)
+		}
+		return fn(entry)
+	})
+}
@@ -0,0 +1,125 @@
+package rewards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+func TestLedgerBalanceIsDerivedFromEntries(t *testing.T) {
+	ledger := NewLedger(store.NewMemory())
+
+	err := ledger.store.Update(func(tx *store.Tx) error {
+		if _, err := ledger.AwardTx(tx, "u1", 500, "award-1", "pickup", "pk_1", nil); err != nil {
+			return err
+		}
+		_, err := ledger.SpendTx(tx, "u1", 200, "spend-1", "redemption", "rd_1", nil)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("posting failed: %v", err)
+	}
+
+	tests := []struct {
+		account string
+		want    int64
+	}{
+		{UserAccount("u1"), 300},
+		{AccountIssued, -500},
+		{AccountRedeemed, 200},
+	}
+	for _, tt := range tests {
+		got, err := ledger.Balance(tt.account)
+		if err != nil || got != tt.want {
+			t.Errorf("Balance(%s) = %d, %v; want %d", tt.account, got, err, tt.want)
+		}
+	}
+}
+
+func TestLedgerIdempotency(t *testing.T) {
+	ledger := NewLedger(store.NewMemory())
+	req := PostingRequest{
+		IdempotencyKey: "key-1",
+		Reason:         "pickup",
+		Lines:          Transfer(AccountIssued, UserAccount("u1"), 100),
+	}
+
+	first, err := ledger.Post(req)
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	second, err := ledger.Post(req)
+	if err != nil {
+		t.Fatalf("replayed Post() error = %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("replay created a new posting: %s != %s", first.ID, second.ID)
+	}
+	if balance, _ := ledger.Balance(UserAccount("u1")); balance != 100 {
+		t.Errorf("balance after replay = %d, want 100", balance)
+	}
+
+	req.Lines = Transfer(AccountIssued, UserAccount("u1"), 999)
+	if _, err := ledger.Post(req); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Post() with reused key = %v, want ErrIdempotencyConflict", err)
+	}
+}
+
+func TestLedgerRejectsInvalidPostings(t *testing.T) {
+	ledger := NewLedger(store.NewMemory())
+	tests := []struct {
+		name    string
+		req     PostingRequest
+		wantErr error
+	}{
+		{
+			name:    "Missing idempotency key",
+			req:     PostingRequest{Reason: "x", Lines: Transfer(AccountIssued, UserAccount("u1"), 1)},
+			wantErr: ErrInvalidPosting,
+		},
+		{
+			name: "Unbalanced",
+			req: PostingRequest{IdempotencyKey: "k", Reason: "x", Lines: []Line{
+				{Account: AccountIssued, Direction: Debit, Points: 10},
+				{Account: UserAccount("u1"), Direction: Credit, Points: 5},
+			}},
+			wantErr: ErrInvalidPosting,
+		},
+		{
+			name:    "Overdraft",
+			req:     PostingRequest{IdempotencyKey: "k2", Reason: "x", Lines: Transfer(UserAccount("u1"), AccountRedeemed, 1)},
+			wantErr: ErrInsufficientPoints,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ledger.Post(tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Post() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLedgerHistoryPagination(t *testing.T) {
+	ledger := NewLedger(store.NewMemory())
+	for i, key := range []string{"a", "b", "c"} {
+		req := PostingRequest{IdempotencyKey: key, Reason: "pickup", Lines: Transfer(AccountIssued, UserAccount("u1"), int64(i+1))}
+		if _, err := ledger.Post(req); err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+	}
+
+	entries, total, err := ledger.History(UserAccount("u1"), 1, 2)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if total != 3 || len(entries) != 2 || entries[0].Points != 3 {
+		t.Errorf("History() = %+v, total %d", entries, total)
+	}
+
+	entries, _, _ = ledger.History(UserAccount("u1"), 2, 2)
+	if len(entries) != 1 || entries[0].Points != 1 {
+		t.Errorf("History() page 2 = %+v", entries)
+	}
+}
@@ -0,0 +1,399 @@
+package rewards
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets used by the earning rules engine.
+const (
+	ruleSetsBucket = "earning_rule_sets"
+	ruleSetCurrent = "current"
+)
+
+// ReasonPickupProcessed is the ledger reason of points earned for a processed pickup.
+const ReasonPickupProcessed = "pickup_processed"
+
+// PickupAwardKey returns the idempotency key of the posting that awards points for a pickup.
+func PickupAwardKey(pickupID string) string {
+	return "pickup-processed:" + pickupID
+}
+
+// Bases on which a rule awards points.
+const (
+	BasisQuantity = "quantity"
+	BasisWeight   = "weight"
+)
+
+// ErrInvalidRules is returned when a rule set fails validation.
+var ErrInvalidRules = errors.New("invalid earning rules")
+
+// Rule awards points for recycled items. Empty Category, Subcategory or
+// Condition match anything; when several rules match an item the most specific
+// one wins.
+type Rule struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Category      string  `json:"category,omitempty"`
+	Subcategory   string  `json:"subcategory,omitempty"`
+	Condition     string  `json:"condition,omitempty"`
+	Basis         string  `json:"basis"`
+	PointsPerUnit float64 `json:"points_per_unit"`
+}
+
+// Promotion multiplies the points of matching items between StartsAt and EndsAt.
+type Promotion struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Category   string    `json:"category,omitempty"`
+	Multiplier float64   `json:"multiplier"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+}
+
+// Caps limits how many pickup points a user can earn per period. Zero means no limit.
+type Caps struct {
+	DailyPoints   int64 `json:"daily_points"`
+	MonthlyPoints int64 `json:"monthly_points"`
+}
+
+// RuleSet is an immutable, versioned set of earning rules.
+type RuleSet struct {
+	Version    int         `json:"version"`
+	Rules      []Rule      `json:"rules"`
+	Promotions []Promotion `json:"promotions"`
+	Caps       Caps        `json:"caps"`
+	UpdatedBy  string      `json:"updated_by"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// CatalogueRuleSet awards the catalogue's points per unit: one rule per
+// category, and one per subcategory with points of its own. It is used until
+// an admin publishes the first rule set and is reported as version 0.
+// Retired categories keep their rules so late pickups still earn.
+func CatalogueRuleSet(categories []items.Category) *RuleSet {
+	rules := []Rule{}
+	for _, c := range categories {
+		rules = append(rules, Rule{ID: c.ID, Name: c.Name, Category: c.ID, Basis: BasisQuantity, PointsPerUnit: float64(c.Points)})
+		for _, sub := range c.Subcategories {
+			if sub.Points > 0 {
+				rules = append(rules, Rule{
+					ID: c.ID + "." + sub.ID, Name: sub.Name, Category: c.ID, Subcategory: sub.ID,
+					Basis: BasisQuantity, PointsPerUnit: float64(sub.Points),
+				})
+			}
+		}
+	}
+	return &RuleSet{
+		Version:    0,
+		Rules:      rules,
+		Promotions: []Promotion{},
+		Caps:       Caps{DailyPoints: 2000, MonthlyPoints: 10000},
+		UpdatedBy:  "system",
+	}
+}
+
+// catalogueRuleSet builds the version 0 rule set from the stored catalogue,
+// or from the default one before it has been seeded.
+func catalogueRuleSet(tx *store.Tx) (*RuleSet, error) {
+	categories, err := items.ListTx(tx, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		categories = items.DefaultCatalogue()
+	}
+	return CatalogueRuleSet(categories), nil
+}
+
+// Validate checks that a rule set can be evaluated.
+func (rs *RuleSet) Validate() error {
+	seen := make(map[string]bool)
+	for _, rule := range rs.Rules {
+		if rule.ID == "" || seen[rule.ID] {
+			return fmt.Errorf("%w: rule IDs must be present and unique", ErrInvalidRules)
+		}
+		seen[rule.ID] = true
+		if rule.Basis != BasisQuantity && rule.Basis != BasisWeight {
+			return fmt.Errorf("%w: rule %s has unknown basis %q", ErrInvalidRules, rule.ID, rule.Basis)
+		}
+		if rule.PointsPerUnit < 0 {
+			return fmt.Errorf("%w: rule %s has negative points", ErrInvalidRules, rule.ID)
+		}
+	}
+	for _, promo := range rs.Promotions {
+		if promo.ID == "" || promo.Multiplier <= 0 {
+			return fmt.Errorf("%w: promotions need an ID and a positive multiplier", ErrInvalidRules)
+		}
+		if !promo.EndsAt.After(promo.StartsAt) {
+			return fmt.Errorf("%w: promotion %s ends before it starts", ErrInvalidRules, promo.ID)
+		}
+	}
+	if rs.Caps.DailyPoints < 0 || rs.Caps.MonthlyPoints < 0 {
+		return fmt.Errorf("%w: caps cannot be negative", ErrInvalidRules)
+	}
+	return nil
+}
+
+// match returns the most specific rule for item, or nil.
+func (rs *RuleSet) match(item pickups.Item) *Rule {
+	var best *Rule
+	bestScore := -1
+	for i := range rs.Rules {
+		rule := &rs.Rules[i]
+		if rule.Category != "" && rule.Category != item.Category {
+			continue
+		}
+		if rule.Subcategory != "" && rule.Subcategory != item.Subcategory {
+			continue
+		}
+		if rule.Condition != "" && rule.Condition != item.Condition {
+			continue
+		}
+		score := 0
+		if rule.Category != "" {
+			score += 2
+		}
+		if rule.Subcategory != "" {
+			score += 2
+		}
+		if rule.Condition != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best
+}
+
+// multiplier returns the largest promotional multiplier active for category at t.
+func (rs *RuleSet) multiplier(category string, t time.Time) (float64, string) {
+	best, promoID := 1.0, ""
+	for _, promo := range rs.Promotions {
+		if promo.Category != "" && promo.Category != category {
+			continue
+		}
+		if t.Before(promo.StartsAt) || !t.Before(promo.EndsAt) {
+			continue
+		}
+		if promo.Multiplier > best {
+			best, promoID = promo.Multiplier, promo.ID
+		}
+	}
+	return best, promoID
+}
+
+// AwardLine explains the points earned for one pickup item.
+type AwardLine struct {
+	Category    string  `json:"category"`
+	RuleID      string  `json:"rule_id"`
+	PromotionID string  `json:"promotion_id,omitempty"`
+	Units       float64 `json:"units"`
+	Points      int64   `json:"points"`
+}
+
+// Award is the result of evaluating a rule set against a pickup.
+type Award struct {
+	RuleSetVersion int         `json:"rule_set_version"`
+	Lines          []AwardLine `json:"lines"`
+	Points         int64       `json:"points"`
+}
+
+// Evaluate computes the uncapped points a pickup earns under rs at time t.
+func (rs *RuleSet) Evaluate(p *pickups.Pickup, t time.Time) Award {
+	award := Award{RuleSetVersion: rs.Version, Lines: []AwardLine{}}
+	for _, item := range p.Items {
+		rule := rs.match(item)
+		if rule == nil {
+			continue
+		}
+		units := float64(item.Quantity)
+		if rule.Basis == BasisWeight {
+			units = item.EarningWeightKg()
+		}
+		multiplier, promoID := rs.multiplier(item.Category, t)
+		points := int64(math.Floor(rule.PointsPerUnit * units * multiplier))
+		award.Lines = append(award.Lines, AwardLine{
+			Category:    item.Category,
+			RuleID:      rule.ID,
+			PromotionID: promoID,
+			Units:       units,
+			Points:      points,
+		})
+		award.Points += points
+	}
+	return award
+}
+
+// Engine awards points for processed pickups according to the current rule set.
+type Engine struct {
+	store  *store.Store
+	ledger *Ledger
+	now    func() time.Time
+}
+
+// NewEngine creates an earning rules engine that posts to ledger.
+func NewEngine(s *store.Store, ledger *Ledger) *Engine {
+	return &Engine{store: s, ledger: ledger, now: time.Now}
+}
+
+// Current returns the rule set in force.
+func (e *Engine) Current() (*RuleSet, error) {
+	var rs *RuleSet
+	err := e.store.View(func(tx *store.Tx) error {
+		var err error
+		rs, err = currentRuleSet(tx)
+		return err
+	})
+	return rs, err
+}
+
+// Version returns a previously published rule set.
+func (e *Engine) Version(version int) (*RuleSet, error) {
+	var rs *RuleSet
+	err := e.store.View(func(tx *store.Tx) error {
+		if version == 0 {
+			var err error
+			rs, err = catalogueRuleSet(tx)
+			return err
+		}
+		rs = &RuleSet{}
+		return tx.Get(ruleSetsBucket, strconv.Itoa(version), rs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func currentRuleSet(tx *store.Tx) (*RuleSet, error) {
+	var version int
+	if err := tx.Get(ruleSetsBucket, ruleSetCurrent, &version); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return catalogueRuleSet(tx)
+		}
+		return nil, err
+	}
+	var rs RuleSet
+	if err := tx.Get(ruleSetsBucket, strconv.Itoa(version), &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// Publish validates rs and stores it as the next version. Earlier versions are kept
+// so that past awards can always be traced to the rules that produced them.
+func (e *Engine) Publish(rs RuleSet, actor string) (*RuleSet, error) {
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	err := e.store.Update(func(tx *store.Tx) error {
+		current, err := currentRuleSet(tx)
+		if err != nil {
+			return err
+		}
+		rs.Version = current.Version + 1
+		rs.UpdatedBy = actor
+		rs.UpdatedAt = e.now().UTC()
+		if rs.Promotions == nil {
+			rs.Promotions = []Promotion{}
+		}
+		if err := tx.Insert(ruleSetsBucket, strconv.Itoa(rs.Version), rs); err != nil {
+			return err
+		}
+		return tx.Put(ruleSetsBucket, ruleSetCurrent, rs.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// OnPickupTransition is a pickups.Listener that awards points when a pickup is processed.
+func (e *Engine) OnPickupTransition(tx *store.Tx, p *pickups.Pickup, from string) error {
+	if p.Status != pickups.StatusProcessed {
+		return nil
+	}
+	_, err := e.AwardTx(tx, p)
+	return err
+}
+
+// AwardTx evaluates the current rules against p, applies the user's caps and
+// credits the result. Each pickup is awarded at most once.
+func (e *Engine) AwardTx(tx *store.Tx, p *pickups.Pickup) (*Award, error) {
+	rs, err := currentRuleSet(tx)
+	if err != nil {
+		return nil, err
+	}
+	now := e.now().UTC()
+	award := rs.Evaluate(p, now)
+
+	capped, err := e.applyCaps(tx, rs.Caps, p.UserID, award.Points, now)
+	if err != nil {
+		return nil, err
+	}
+	award.Points = capped
+	if award.Points <= 0 {
+		return &award, nil
+	}
+
+	ruleIDs := make([]string, 0, len(award.Lines))
+	for _, line := range award.Lines {
+		ruleIDs = append(ruleIDs, line.RuleID)
+	}
+	metadata := map[string]string{
+		"rule_set_version": strconv.Itoa(award.RuleSetVersion),
+		"rules":            strings.Join(ruleIDs, ","),
+	}
+	if _, err := e.ledger.AwardTx(tx, p.UserID, award.Points, PickupAwardKey(p.ID), ReasonPickupProcessed, p.ID, metadata); err != nil {
+		return nil, err
+	}
+	return &award, nil
+}
+
+// applyCaps reduces points so that the user's earnings stay within the daily and monthly caps.
+func (e *Engine) applyCaps(tx *store.Tx, caps Caps, uid string, points int64, now time.Time) (int64, error) {
+	if caps.DailyPoints == 0 && caps.MonthlyPoints == 0 {
+		return points, nil
+	}
+
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var today, month int64
+	account := UserAccount(uid)
+	err := forEachEntry(tx, func(entry Entry) error {
+		if entry.Account != account || entry.Reason != ReasonPickupProcessed || entry.Direction != Credit {
+			return nil
+		}
+		if !entry.CreatedAt.Before(monthStart) {
+			month += entry.Points
+		}
+		if !entry.CreatedAt.Before(dayStart) {
+			today += entry.Points
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if caps.DailyPoints > 0 && today+points > caps.DailyPoints {
+		points = caps.DailyPoints - today
+	}
+	if caps.MonthlyPoints > 0 && month+points > caps.MonthlyPoints {
+		points = caps.MonthlyPoints - month
+	}
+	if points < 0 {
+		points = 0
+	}
+	return points, nil
+}
@@ -0,0 +1,154 @@
+package rewards
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var testNow = time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC)
+
+func TestRuleSetEvaluate(t *testing.T) {
+	rs := &RuleSet{
+		Version: 3,
+		Rules: []Rule{
+			{ID: "any", Basis: BasisQuantity, PointsPerUnit: 10},
+			{ID: "phones", Category: "phones", Basis: BasisQuantity, PointsPerUnit: 40},
+			{ID: "phones-working", Category: "phones", Condition: "working", Basis: BasisQuantity, PointsPerUnit: 60},
+			{ID: "batteries", Category: "batteries", Basis: BasisWeight, PointsPerUnit: 30},
+		},
+		Promotions: []Promotion{
+			{ID: "june-batteries", Category: "batteries", Multiplier: 2, StartsAt: testNow.AddDate(0, 0, -1), EndsAt: testNow.AddDate(0, 0, 1)},
+			{ID: "expired", Multiplier: 5, StartsAt: testNow.AddDate(0, -2, 0), EndsAt: testNow.AddDate(0, -1, 0)},
+		},
+	}
+	p := &pickups.Pickup{Items: []pickups.Item{
+		{Category: "phones", Condition: "working", Quantity: 2},
+		{Category: "phones", Condition: "damaged", Quantity: 1},
+		{Category: "batteries", Quantity: 1, WeightKg: 4, MeasuredWeightKg: 1.5},
+		{Category: "other", Quantity: 3},
+	}}
+
+	award := rs.Evaluate(p, testNow)
+	wantRules := []string{"phones-working", "phones", "batteries", "any"}
+	wantPoints := []int64{120, 40, 90, 30}
+	for i, line := range award.Lines {
+		if line.RuleID != wantRules[i] || line.Points != wantPoints[i] {
+			t.Errorf("line %d = %+v, want rule %s for %d points", i, line, wantRules[i], wantPoints[i])
+		}
+	}
+	if award.Points != 280 || award.RuleSetVersion != 3 {
+		t.Errorf("award = %d points from v%d, want 280 from v3", award.Points, award.RuleSetVersion)
+	}
+	if award.Lines[2].PromotionID != "june-batteries" {
+		t.Errorf("battery line promotion = %q", award.Lines[2].PromotionID)
+	}
+}
+
+func TestCatalogueRuleSetFollowsTheCatalogue(t *testing.T) {
+	db := store.NewMemory()
+	catalogue := items.NewService(db)
+	if err := catalogue.Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	phones, _ := catalogue.Get("phones")
+	phones.Points = 50
+	if _, err := catalogue.Save(*phones, "admin"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	rs, err := NewEngine(db, nil).Current()
+	if err != nil || rs.Version != 0 {
+		t.Fatalf("Current() = %+v, %v; want version 0", rs, err)
+	}
+	p := &pickups.Pickup{Items: []pickups.Item{
+		{Category: "phones", Subcategory: "smartphones", Quantity: 2},
+		{Category: "phones", Subcategory: "tablets", Quantity: 1},
+		{Category: "batteries", Quantity: 3, WeightKg: 40},
+	}}
+	award := rs.Evaluate(p, testNow)
+	wantRules := []string{"phones", "phones.tablets", "batteries"}
+	wantPoints := []int64{100, 60, 90}
+	for i, line := range award.Lines {
+		if line.RuleID != wantRules[i] || line.Points != wantPoints[i] {
+			t.Errorf("line %d = %+v, want rule %s for %d points", i, line, wantRules[i], wantPoints[i])
+		}
+	}
+}
+
+func TestEngineAwardsProcessedPickupOnce(t *testing.T) {
+	db := store.NewMemory()
+	ledger := NewLedger(db)
+	engine := NewEngine(db, ledger)
+	engine.now = func() time.Time { return testNow }
+
+	rs := *CatalogueRuleSet(items.DefaultCatalogue())
+	rs.Caps = Caps{DailyPoints: 100}
+	if _, err := engine.Publish(rs, "admin"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	svc := pickups.NewService(db)
+	svc.Subscribe(engine.OnPickupTransition)
+
+	schedule := func() *pickups.Pickup {
+		p, err := svc.Create("u1", pickups.CreateRequest{
+			Address: "Westlands", Date: "2026-06-15", TimeSlot: "morning",
+			Items: []pickups.Item{{Category: "phones", Quantity: 2}},
+		})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		for _, status := range []string{pickups.StatusAssigned, pickups.StatusCollected, pickups.StatusProcessed} {
+			if _, err := svc.Transition(p.ID, status, "collector"); err != nil {
+				t.Fatalf("Transition(%s) error = %v", status, err)
+			}
+		}
+		return p
+	}
+
+	first := schedule()
+	if balance, _ := ledger.Balance(UserAccount("u1")); balance != 80 {
+		t.Errorf("balance after first pickup = %d, want 80", balance)
+	}
+
+	// The daily cap of 100 leaves room for only 20 more points.
+	schedule()
+	if balance, _ := ledger.Balance(UserAccount("u1")); balance != 100 {
+		t.Errorf("balance after capped pickup = %d, want 100", balance)
+	}
+
+	entries, _, _ := ledger.History(UserAccount("u1"), 1, 10)
+	last := entries[len(entries)-1]
+	if last.Reference != first.ID || last.Metadata["rule_set_version"] != "1" || last.Metadata["rules"] != "phones" {
+		t.Errorf("award entry = %+v, want reference %s from rule set 1", last, first.ID)
+	}
+}
+
+func TestEnginePublishVersions(t *testing.T) {
+	engine := NewEngine(store.NewMemory(), nil)
+
+	current, _ := engine.Current()
+	if current.Version != 0 {
+		t.Fatalf("initial version = %d, want 0", current.Version)
+	}
+
+	bad := RuleSet{Rules: []Rule{{ID: "x", Basis: "volume"}}}
+	if _, err := engine.Publish(bad, "admin"); !errors.Is(err, ErrInvalidRules) {
+		t.Errorf("Publish(bad) error = %v, want ErrInvalidRules", err)
+	}
+
+	for want := 1; want <= 2; want++ {
+		rs, err := engine.Publish(*CatalogueRuleSet(items.DefaultCatalogue()), "admin")
+		if err != nil || rs.Version != want {
+			t.Fatalf("Publish() = v%d, %v; want v%d", rs.Version, err, want)
+		}
+	}
+	if old, err := engine.Version(1); err != nil || old.Version != 1 {
+		t.Errorf("Version(1) = %+v, %v", old, err)
+	}
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/handlers"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/middlewares"
+)
+
+// InitAdminRoutes registers the server-rendered admin console. Its pages
+// authenticate with the session cookie and are only served to admins.
+func InitAdminRoutes(mux *http.ServeMux, console *handlers.AdminConsole, verifier middlewares.TokenVerifier) {
+	page := func(h http.HandlerFunc) http.Handler {
+		return middlewares.AdminPages(verifier)(h)
+	}
+	mux.Handle("/admin", page(console.Overview))
+	mux.Handle("/admin/users", page(console.Users))
+	mux.Handle("/admin/pickups", page(console.PickupsPage))
+	mux.Handle("/admin/partners", page(console.Partners))
+	mux.Handle("/admin/catalogue", page(console.Catalogue))
+	mux.Handle("/admin/audit", page(console.AuditLog))
+	mux.Handle("/admin/audit/export", page(console.AuditExport))
+	mux.Handle("/admin/compliance", page(console.CompliancePage))
+
+	log.Println("Admin routes registered successfully")
+}
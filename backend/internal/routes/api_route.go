@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/apikeys"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/auth"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/handlers"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/middlewares"
+)
+
+// openDataRequestsPerMinute is how many open data requests each client may make.
+const openDataRequestsPerMinute = 30
+
+// API groups the handlers that serve the JSON API.
+type API struct {
+	Rewards       *handlers.RewardsHandler
+	EarningRules  *handlers.EarningRulesHandler
+	Pickups       *handlers.PickupsHandler
+	Fraud         *handlers.FraudHandler
+	Referrals     *handlers.ReferralsHandler
+	Payments      *handlers.PaymentsHandler
+	Quotes        *handlers.QuotesHandler
+	Invoices      *handlers.InvoicesHandler
+	ServiceAreas  *handlers.ServiceAreasHandler
+	Geocode       *handlers.GeocodeHandler
+	Routes        *handlers.RoutesHandler
+	Collector     *handlers.CollectorHandler
+	Photos        *handlers.PhotosHandler
+	Items         *handlers.ItemsHandler
+	Impact        *handlers.ImpactHandler
+	Compliance    *handlers.ComplianceHandler
+	OpenData      *handlers.OpenDataHandler
+	Notifications *handlers.NotificationsHandler
+	Reminders     *handlers.RemindersHandler
+	Jobs          *handlers.JobsHandler
+	Events        *handlers.EventsHandler
+	Webhooks      *handlers.WebhooksHandler
+	APIKeys       *handlers.APIKeysHandler
+
+	// Sessions verifies the tokens of collectors and admins, checking that
+	// they have not been revoked.
+	Sessions middlewares.TokenVerifier
+
+	// PartnerKeys lets partner systems call the partner API with an API key
+	// instead of a user token.
+	PartnerKeys *middlewares.PartnerKeys
+
+	// Audit serves the audit log, in which every successful state-changing
+	// call is recorded.
+	Audit *handlers.AuditHandler
+}
+
+// InitAPIRoutes registers the JSON API endpoints. They are more specific than
+// the catch-all "/api/" pattern and so take precedence over it.
+func InitAPIRoutes(mux *http.ServeMux, api *API) {
+	// Authenticated user endpoints
+	mux.Handle("/api/rewards/balance", api.protect(api.Rewards.Balance))
+	mux.Handle("/api/rewards/history", api.protect(api.Rewards.History))
+	mux.Handle("/api/rewards/catalogue", api.protect(api.Rewards.ListCatalogue))
+	mux.Handle("/api/rewards/redeem", api.protect(api.Rewards.Redeem))
+	mux.Handle("/api/rewards/redemptions", api.protect(api.Rewards.Redemptions))
+	mux.Handle("/api/referrals", api.protect(api.Referrals.Summary))
+	mux.Handle("/api/referrals/attribute", api.protect(api.Referrals.Attribute))
+	mux.Handle("/api/pickups", api.protect(api.Pickups.Collection))
+	mux.Handle("/api/pickups/status", api.protect(api.Pickups.Status))
+	mux.Handle("/api/pickups/rating", api.protect(api.Reminders.Rate))
+	mux.Handle("/api/payments", api.protect(api.Payments.Collection))
+	mux.Handle("/api/quotes", api.protect(api.Quotes.Collection))
+	mux.Handle("/api/quotes/accept", api.protect(api.Quotes.Accept))
+	mux.Handle("/api/invoices", api.protect(api.Invoices.List))
+	mux.Handle("/api/invoices/document", api.protect(api.Invoices.Document))
+	mux.Handle("/api/invoices/billing", api.protect(api.Invoices.Billing))
+	mux.Handle("/api/service-areas", api.protect(api.ServiceAreas.List))
+	mux.Handle("/api/service-areas/locate", api.protect(api.ServiceAreas.Locate))
+	mux.Handle("/api/service-areas/waitlist", api.protect(api.ServiceAreas.JoinWaitlist))
+	mux.Handle("/api/geocode/autocomplete", api.protect(api.Geocode.Autocomplete))
+	mux.Handle("/api/routes/manifest", api.protect(api.Routes.Manifest))
+	mux.Handle("/api/photos", api.protect(api.Photos.Collection))
+	mux.Handle("/api/items/categories", api.protect(api.Items.Categories))
+	mux.Handle("/api/impact", api.protect(api.Impact.Summary))
+	mux.Handle("/api/impact/pickup", api.protect(api.Impact.Pickup))
+	mux.Handle("/api/notifications", api.protect(api.Notifications.List))
+	mux.Handle("/api/notifications/preferences", api.protect(api.Notifications.Preferences))
+	mux.Handle("/api/notifications/preferences/verify", api.protect(api.Notifications.Verify))
+
+	// Collector app endpoints
+	mux.Handle("/api/collector/manifest", api.collector(api.Collector.Manifest))
+	mux.Handle("/api/collector/sync", api.collector(api.Collector.Sync))
+	mux.Handle("/api/collector/collection", api.staff(api.Collector.Collection))
+
+	// Partner portal endpoints; those partner systems may call take an API key too
+	mux.Handle("/api/partner/webhooks", api.partnerOrKey(api.Webhooks.Endpoints, apikeys.ScopeWebhooksRead, apikeys.ScopeWebhooksWrite))
+	mux.Handle("/api/partner/webhooks/secret", api.partnerOrKey(api.Webhooks.RotateSecret, apikeys.ScopeWebhooksRead, apikeys.ScopeWebhooksWrite))
+	mux.Handle("/api/partner/webhooks/deliveries", api.partnerOrKey(api.Webhooks.Deliveries, apikeys.ScopeWebhooksRead, apikeys.ScopeWebhooksWrite))
+	mux.Handle("/api/partner/webhooks/replay", api.partnerOrKey(api.Webhooks.Replay, apikeys.ScopeWebhooksRead, apikeys.ScopeWebhooksWrite))
+	mux.Handle("/api/partner/keys", api.partner(api.APIKeys.Keys))
+	mux.Handle("/api/partner/keys/rotate", api.partner(api.APIKeys.Rotate))
+
+	// Provider callbacks authenticate with a signed URL rather than a user token
+	mux.Handle("/api/payments/callback", api.audited(api.Payments.Callback))
+	mux.HandleFunc("/api/photos/file", api.Photos.File)
+
+	// Open data needs no sign-in; each client shares one allowance across it
+	openData := middlewares.NewRateLimiter(openDataRequestsPerMinute, time.Minute)
+	mux.Handle("/api/open/datasets", openData.Middleware(http.HandlerFunc(api.OpenData.Datasets)))
+	mux.Handle("/api/open/data", openData.Middleware(http.HandlerFunc(api.OpenData.Data)))
+	mux.Handle("/api/open/export", openData.Middleware(http.HandlerFunc(api.OpenData.Export)))
+
+	// Admin endpoints
+	mux.Handle("/api/admin/rewards/rules", api.admin(api.EarningRules.Rules))
+	mux.Handle("/api/admin/rewards/catalogue", api.admin(api.Rewards.AdminCatalogue))
+	mux.Handle("/api/admin/rewards/redemptions", api.admin(api.Rewards.AdminRedemption))
+	mux.Handle("/api/admin/fraud/cases", api.admin(api.Fraud.Cases))
+	mux.Handle("/api/admin/fraud/cases/resolve", api.admin(api.Fraud.Resolve))
+	mux.Handle("/api/admin/payments/reconcile", api.admin(api.Payments.Reconcile))
+	mux.Handle("/api/admin/invoices/credit", api.admin(api.Invoices.Credit))
+	mux.Handle("/api/admin/service-areas/waitlist", api.admin(api.ServiceAreas.Waitlist))
+	mux.Handle("/api/admin/routes", api.admin(api.Routes.Day))
+	mux.Handle("/api/admin/routes/vehicles", api.admin(api.Routes.Vehicles))
+	mux.Handle("/api/admin/items/categories", api.admin(api.Items.AdminCategories))
+	mux.Handle("/api/admin/impact", api.admin(api.Impact.Report))
+	mux.Handle("/api/admin/impact/factors", api.admin(api.Impact.Factors))
+	mux.Handle("/api/admin/compliance/reports", api.admin(api.Compliance.Reports))
+	mux.Handle("/api/admin/compliance/reports/document", api.admin(api.Compliance.Document))
+	mux.Handle("/api/admin/compliance/partners", api.admin(api.Compliance.Partners))
+	mux.Handle("/api/admin/compliance/handovers", api.admin(api.Compliance.Handovers))
+	mux.Handle("/api/admin/notifications", api.admin(api.Notifications.Admin))
+	mux.Handle("/api/admin/reminders", api.admin(api.Reminders.Jobs))
+	mux.Handle("/api/admin/ratings", api.admin(api.Reminders.Ratings))
+	mux.Handle("/api/admin/audit", api.admin(api.Audit.Entries))
+	mux.Handle("/api/admin/audit/export", api.admin(api.Audit.Export))
+	mux.Handle("/api/admin/audit/verify", api.admin(api.Audit.Verify))
+	mux.Handle("/api/admin/jobs", api.admin(api.Jobs.List))
+	mux.Handle("/api/admin/jobs/retry", api.admin(api.Jobs.Retry))
+	mux.Handle("/api/admin/events", api.admin(api.Events.List))
+	mux.Handle("/api/admin/webhooks", api.admin(api.Webhooks.Admin))
+	mux.Handle("/api/admin/keys", api.admin(api.APIKeys.Admin))
+
+	log.Println("API routes registered successfully")
+}
+
+// audited records the successful state-changing calls h serves in the audit
+// log. It must run inside AuthMiddleware to know who made them.
+func (api *API) audited(h http.HandlerFunc) http.Handler {
+	return middlewares.AuditMutations(api.Audit.Audit)(h)
+}
+
+// protect wraps a handler function with the Firebase auth middleware and
+// audits the changes made through it, as the wrappers below also do. Tokens
+// with a staff or partner role are also checked for revocation, since
+// handlers here grant those roles more than residents get.
+func (api *API) protect(h http.HandlerFunc) http.Handler {
+	return middlewares.ChainMiddlewares(api.audited(h), middlewares.CheckStaffRevoked(api.Sessions), middlewares.AuthMiddleware)
+}
+
+// collector wraps a handler function so that only signed-in collectors can reach it.
+func (api *API) collector(h http.HandlerFunc) http.Handler {
+	return middlewares.ChainMiddlewares(api.audited(h), middlewares.RequireRole(auth.RoleCollector), middlewares.StaffAuth(api.Sessions))
+}
+
+// staff wraps a handler function so that only signed-in collectors and admins can reach it.
+func (api *API) staff(h http.HandlerFunc) http.Handler {
+	return middlewares.ChainMiddlewares(api.audited(h), middlewares.RequireRole(auth.RoleCollector, auth.RoleAdmin), middlewares.StaffAuth(api.Sessions))
+}
+
+// partner wraps a handler function so that only signed-in partner accounts can reach it.
+func (api *API) partner(h http.HandlerFunc) http.Handler {
+	return middlewares.ChainMiddlewares(api.audited(h), middlewares.RequireRole(auth.RolePartner), middlewares.StaffAuth(api.Sessions))
+}
+
+// partnerOrKey wraps a handler function so that signed-in partner accounts,
+// and partner systems whose API key has the read or write scope the request
+// needs, can reach it.
+func (api *API) partnerOrKey(h http.HandlerFunc, read, write string) http.Handler {
+	return middlewares.ChainMiddlewares(api.audited(h), middlewares.RequireScope(read, write), middlewares.RequireRole(auth.RolePartner), api.PartnerKeys.UserOrKey)
+}
+
+// admin wraps a handler function so that only signed-in admins can reach it.
+func (api *API) admin(h http.HandlerFunc) http.Handler {
+	return middlewares.ChainMiddlewares(api.audited(h), middlewares.RequireRole(auth.RoleAdmin), middlewares.StaffAuth(api.Sessions))
+}
@@ -39,6 +39,7 @@ func registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/about", handlers.AboutHandler)
 	mux.HandleFunc("/login", handlers.LoginHandler)
 	mux.HandleFunc("/signup", handlers.SignupHandler)
+	mux.HandleFunc("/partner", handlers.PartnerPortalHandler)
 
 	// Protected routes with middleware
 	protectedRoutes := http.NewServeMux()
@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+)
+
+// manifestTemplate lays a manifest out for printing on A4.
+var manifestTemplate = template.Must(template.New("manifest").Funcs(template.FuncMap{
+	"items": describeItems,
+	"kg":    func(v float64) string { return fmt.Sprintf("%.1f kg", v) },
+	"km":    func(v float64) string { return fmt.Sprintf("%.1f km", v) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Manifest {{.Date}} - {{.CollectorID}}</title>
+<style>
+    body { font-family: Arial, sans-serif; font-size: 12px; color: #222; margin: 24px; }
+    h1 { font-size: 18px; margin: 0 0 4px; }
+    h2 { font-size: 14px; margin: 20px 0 6px; }
+    .summary { color: #555; margin-bottom: 12px; }
+    table { width: 100%; border-collapse: collapse; }
+    th, td { border: 1px solid #ccc; padding: 4px 6px; text-align: left; vertical-align: top; }
+    th { background: #f2f2f2; }
+    .late { color: #c0392b; font-weight: bold; }
+    .warnings { border: 1px solid #e67e22; padding: 6px 10px; }
+    .check { width: 40px; }
+    @media print { body { margin: 0; } h2 { page-break-after: avoid; } tr { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>Collection manifest &middot; {{.Date}}</h1>
+<div class="summary">
+    Collector {{.CollectorID}} &middot; {{.Vehicle.Name}} ({{kg .Vehicle.CapacityKg}} capacity) &middot;
+    depot {{.Depot.Name}} &middot; {{.Stops}} stops &middot; {{kg .LoadKg}} &middot; {{km .DistanceKm}}
+</div>
+{{if .Warnings}}<div class="warnings"><strong>Check before leaving:</strong><ul>{{range .Warnings}}<li>{{.}}</li>{{end}}</ul></div>{{end}}
+{{range .Trips}}
+<h2>Trip {{.Number}} &middot; {{.TimeSlot}} &middot; depart {{.Depart}}, back {{.Return}} &middot; {{kg .LoadKg}} &middot; {{km .DistanceKm}}</h2>
+<table>
+    <tr><th>#</th><th>ETA</th><th>Pickup</th><th>Address</th><th>Items</th><th>Load</th><th>Notes</th><th class="check">Done</th></tr>
+    {{range .Stops}}
+    <tr>
+        <td>{{.Sequence}}</td>
+        <td{{if .Late}} class="late"{{end}}>{{.Arrival}}</td>
+        <td>{{.PickupID}}</td>
+        <td>{{.Address}}</td>
+        <td>{{items .Items}}</td>
+        <td>{{kg .LoadKg}}</td>
+        <td>{{.Notes}}</td>
+        <td class="check">{{if eq .Status "collected"}}&#10003;{{end}}</td>
+    </tr>
+    {{end}}
+</table>
+{{end}}
+{{if .Unrouted}}
+<h2>Not routed (no location)</h2>
+<table>
+    <tr><th>#</th><th>Slot</th><th>Pickup</th><th>Address</th><th>Items</th><th>Load</th><th>Notes</th></tr>
+    {{range .Unrouted}}
+    <tr><td>{{.Sequence}}</td><td>{{.TimeSlot}}</td><td>{{.PickupID}}</td><td>{{.Address}}</td><td>{{items .Items}}</td><td>{{kg .LoadKg}}</td><td>{{.Notes}}</td></tr>
+    {{end}}
+</table>
+{{end}}
+{{if not .Stops}}<p>No pickups assigned for this day.</p>{{end}}
+</body>
+</html>
+`))
+
+// HTML renders m as a printable page.
+func HTML(m *Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := manifestTemplate.Execute(&buf, m); err != nil {
+		return nil, fmt.Errorf("error rendering manifest: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// describeItems renders items as "2 x computers, 1 x phones".
+func describeItems(items []pickups.Item) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprintf("%d x %s", item.Quantity, strings.ReplaceAll(item.Category, "_", " "))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,406 @@
+// Package routing plans collectors' daily runs and produces their manifests.
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// vehiclesBucket holds vehicles keyed by ID.
+const vehiclesBucket = "vehicles"
+
+// Planning assumptions for timing a run.
+const (
+	// DefaultCapacityKg is used for collectors without a registered vehicle.
+	DefaultCapacityKg = 800.0
+	// AverageSpeedKmh is the assumed speed over straight-line distance in town traffic.
+	AverageSpeedKmh = 25.0
+	// ServiceMinutes is the time spent loading at each stop.
+	ServiceMinutes = 10
+	// UnloadMinutes is the time spent unloading at the depot between trips.
+	UnloadMinutes = 20
+)
+
+// TimeSlot is a window pickups are promised in, in minutes after midnight.
+type TimeSlot struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// TimeSlots are the pickup windows in the order a day runs through them.
+var TimeSlots = []TimeSlot{
+	{Name: "morning", Start: 8 * 60, End: 12 * 60},
+	{Name: "afternoon", Start: 12 * 60, End: 16 * 60},
+	{Name: "evening", Start: 16 * 60, End: 19 * 60},
+}
+
+var (
+	// ErrInvalidVehicle is returned when a vehicle fails validation.
+	ErrInvalidVehicle = errors.New("invalid vehicle")
+	// ErrInvalidDate is returned when a plan is requested for a malformed date.
+	ErrInvalidDate = errors.New("date must be formatted YYYY-MM-DD")
+)
+
+// Vehicle is a truck or van a collector drives.
+type Vehicle struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	CollectorID string  `json:"collector_id"`
+	CapacityKg  float64 `json:"capacity_kg"`
+	HubID       string  `json:"hub_id,omitempty"`
+}
+
+// Stop is one pickup on a manifest.
+type Stop struct {
+	Sequence int            `json:"sequence"`
+	PickupID string         `json:"pickup_id"`
+	Address  string         `json:"address"`
+	Location geo.Point      `json:"location"`
+	TimeSlot string         `json:"time_slot"`
+	Status   string         `json:"status"`
+	Notes    string         `json:"notes,omitempty"`
+	Items    []pickups.Item `json:"items"`
+	LoadKg   float64        `json:"load_kg"`
+	LegKm    float64        `json:"leg_km"`
+	Arrival  string         `json:"arrival,omitempty"`
+	Late     bool           `json:"late,omitempty"`
+}
+
+// Trip is one loop from the depot and back.
+type Trip struct {
+	Number     int     `json:"number"`
+	TimeSlot   string  `json:"time_slot"`
+	Depart     string  `json:"depart"`
+	Return     string  `json:"return"`
+	LoadKg     float64 `json:"load_kg"`
+	DistanceKm float64 `json:"distance_km"`
+	Stops      []Stop  `json:"stops"`
+}
+
+// Manifest is a collector's ordered run for one day.
+type Manifest struct {
+	Date        string     `json:"date"`
+	CollectorID string     `json:"collector_id"`
+	Vehicle     Vehicle    `json:"vehicle"`
+	Depot       quotes.Hub `json:"depot"`
+	Trips       []Trip     `json:"trips"`
+	Unrouted    []Stop     `json:"unrouted,omitempty"`
+	Warnings    []string   `json:"warnings,omitempty"`
+	Stops       int        `json:"stops"`
+	LoadKg      float64    `json:"load_kg"`
+	DistanceKm  float64    `json:"distance_km"`
+	GeneratedAt time.Time  `json:"generated_at"`
+}
+
+// UnitWeight returns the typical weight of one unit of an item, or 0 when it
+// has no estimate for it.
+type UnitWeight func(item pickups.Item) float64
+
+// Service plans routes over the pickups assigned to collectors.
+type Service struct {
+	store      *store.Store
+	hubs       []quotes.Hub
+	unitWeight UnitWeight
+	now        func() time.Time
+}
+
+// NewService creates a route planner whose trips start and end at hubs.
+func NewService(s *store.Store, hubs []quotes.Hub) *Service {
+	return &Service{store: s, hubs: hubs, now: time.Now}
+}
+
+// SetUnitWeight installs the weight estimates used for items nobody has
+// weighed. Without them such items add nothing to a vehicle's load.
+func (s *Service) SetUnitWeight(fn UnitWeight) {
+	s.unitWeight = fn
+}
+
+// SaveVehicle registers or updates a vehicle.
+func (s *Service) SaveVehicle(v Vehicle) (*Vehicle, error) {
+	v.ID = strings.TrimSpace(v.ID)
+	v.Name = strings.TrimSpace(v.Name)
+	v.CollectorID = strings.TrimSpace(v.CollectorID)
+	if v.ID == "" || v.CollectorID == "" {
+		return nil, fmt.Errorf("%w: id and collector_id are required", ErrInvalidVehicle)
+	}
+	if v.CapacityKg <= 0 {
+		return nil, fmt.Errorf("%w: capacity_kg must be positive", ErrInvalidVehicle)
+	}
+	if v.HubID != "" {
+		if _, ok := s.hub(v.HubID); !ok {
+			return nil, fmt.Errorf("%w: unknown hub %q", ErrInvalidVehicle, v.HubID)
+		}
+	}
+	err := s.store.Update(func(tx *store.Tx) error {
+		return tx.Put(vehiclesBucket, v.ID, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Vehicles returns every registered vehicle ordered by ID.
+func (s *Service) Vehicles() ([]Vehicle, error) {
+	var vehicles []Vehicle
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		vehicles, err = vehiclesTx(tx)
+		return err
+	})
+	return vehicles, err
+}
+
+func vehiclesTx(tx *store.Tx) ([]Vehicle, error) {
+	vehicles := []Vehicle{}
+	err := tx.ForEach(vehiclesBucket, func(key string, raw json.RawMessage) error {
+		var v Vehicle
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("error decoding vehicle %s: %w", key, err)
+		}
+		vehicles = append(vehicles, v)
+		return nil
+	})
+	return vehicles, err
+}
+
+// PlanDay returns a manifest for every collector with pickups on date,
+// ordered by collector.
+func (s *Service) PlanDay(date string) ([]*Manifest, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, ErrInvalidDate
+	}
+	list, vehicles, err := s.load(date, "")
+	if err != nil {
+		return nil, err
+	}
+	byCollector := map[string][]*pickups.Pickup{}
+	var collectors []string
+	for _, p := range list {
+		if _, ok := byCollector[p.CollectorID]; !ok {
+			collectors = append(collectors, p.CollectorID)
+		}
+		byCollector[p.CollectorID] = append(byCollector[p.CollectorID], p)
+	}
+	sort.Strings(collectors)
+
+	manifests := []*Manifest{}
+	for _, collectorID := range collectors {
+		manifests = append(manifests, s.plan(date, collectorID, vehicleFor(vehicles, collectorID), byCollector[collectorID]))
+	}
+	return manifests, nil
+}
+
+// Plan returns the manifest of one collector for date. A collector with
+// nothing to collect gets an empty manifest.
+func (s *Service) Plan(date, collectorID string) (*Manifest, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, ErrInvalidDate
+	}
+	list, vehicles, err := s.load(date, collectorID)
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(date, collectorID, vehicleFor(vehicles, collectorID), list), nil
+}
+
+// load reads the pickups on the run and the registered vehicles in one transaction.
+func (s *Service) load(date, collectorID string) ([]*pickups.Pickup, []Vehicle, error) {
+	var list []*pickups.Pickup
+	var vehicles []Vehicle
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		if list, err = pickups.ListTx(tx, onRun(date, collectorID)); err != nil {
+			return err
+		}
+		vehicles, err = vehiclesTx(tx)
+		return err
+	})
+	return list, vehicles, err
+}
+
+// onRun matches pickups assigned to collectorID, or to any collector when it
+// is empty, on date. Collected pickups stay on the run so the manifest does
+// not reshuffle as the day goes on.
+func onRun(date, collectorID string) func(*pickups.Pickup) bool {
+	return func(p *pickups.Pickup) bool {
+		if p.Date != date || p.CollectorID == "" || (collectorID != "" && p.CollectorID != collectorID) {
+			return false
+		}
+		return p.Status == pickups.StatusAssigned || p.Status == pickups.StatusCollected
+	}
+}
+
+// vehicleFor returns the collector's vehicle, or a default one.
+func vehicleFor(vehicles []Vehicle, collectorID string) Vehicle {
+	for _, v := range vehicles {
+		if v.CollectorID == collectorID {
+			return v
+		}
+	}
+	return Vehicle{ID: "default", Name: "Pickup van", CollectorID: collectorID, CapacityKg: DefaultCapacityKg}
+}
+
+func (s *Service) hub(id string) (quotes.Hub, bool) {
+	for _, hub := range s.hubs {
+		if hub.ID == id {
+			return hub, true
+		}
+	}
+	return quotes.Hub{}, false
+}
+
+// plan orders list into trips for one vehicle.
+func (s *Service) plan(date, collectorID string, vehicle Vehicle, list []*pickups.Pickup) *Manifest {
+	m := &Manifest{
+		Date:        date,
+		CollectorID: collectorID,
+		Vehicle:     vehicle,
+		Trips:       []Trip{},
+		GeneratedAt: s.now().UTC(),
+	}
+
+	bySlot := map[string][]Stop{}
+	for _, p := range list {
+		stop := Stop{
+			PickupID: p.ID,
+			Address:  p.Address,
+			TimeSlot: p.TimeSlot,
+			Status:   p.Status,
+			Notes:    p.Notes,
+			Items:    p.Items,
+			LoadKg:   round(loadKg(p.Items, s.unitWeight)),
+		}
+		m.LoadKg += stop.LoadKg
+		if p.Location == nil {
+			m.Unrouted = append(m.Unrouted, stop)
+			continue
+		}
+		stop.Location = *p.Location
+		bySlot[p.TimeSlot] = append(bySlot[p.TimeSlot], stop)
+	}
+
+	if depot, ok := s.hub(vehicle.HubID); ok {
+		m.Depot = depot
+	} else if first := firstLocated(bySlot); first != nil {
+		m.Depot, _ = quotes.NearestHub(s.hubs, *first)
+	}
+
+	clock := 0
+	for _, slot := range TimeSlots {
+		stops := bySlot[slot.Name]
+		if len(stops) == 0 {
+			continue
+		}
+		points := make([]geo.Point, len(stops))
+		loads := make([]float64, len(stops))
+		for i, stop := range stops {
+			points[i], loads[i] = stop.Location, stop.LoadKg
+			if stop.LoadKg > vehicle.CapacityKg {
+				m.Warnings = append(m.Warnings, fmt.Sprintf("%s weighs %.1f kg, more than the vehicle carries", stop.PickupID, stop.LoadKg))
+			}
+		}
+		for _, route := range solve(m.Depot.Location, vehicle.CapacityKg, points, loads) {
+			trip := Trip{Number: len(m.Trips) + 1, TimeSlot: slot.Name}
+			for _, i := range route {
+				trip.Stops = append(trip.Stops, stops[i])
+			}
+			clock = m.time(&trip, slot, clock)
+			m.Trips = append(m.Trips, trip)
+		}
+	}
+
+	sequence := 0
+	for t := range m.Trips {
+		for i := range m.Trips[t].Stops {
+			sequence++
+			m.Trips[t].Stops[i].Sequence = sequence
+		}
+		m.DistanceKm += m.Trips[t].DistanceKm
+	}
+	for i := range m.Unrouted {
+		m.Unrouted[i].Sequence = sequence + i + 1
+		m.Warnings = append(m.Warnings, fmt.Sprintf("%s has no location and is not routed", m.Unrouted[i].PickupID))
+	}
+	m.Stops = sequence + len(m.Unrouted)
+	m.LoadKg, m.DistanceKm = round(m.LoadKg), round(m.DistanceKm)
+	return m
+}
+
+// time fills in leg distances and arrival times for trip, leaving the depot
+// no earlier than clock and so as to reach the first stop as the slot opens.
+// It returns when the vehicle is back and unloaded.
+func (m *Manifest) time(trip *Trip, slot TimeSlot, clock int) int {
+	from := m.Depot.Location
+	depart := max(clock, slot.Start-travelMinutes(geo.Haversine(from, trip.Stops[0].Location)))
+	trip.Depart = clockTime(depart)
+
+	now := depart
+	for i := range trip.Stops {
+		stop := &trip.Stops[i]
+		leg := geo.Haversine(from, stop.Location)
+		stop.LegKm = round(leg)
+		now += travelMinutes(leg)
+		stop.Arrival = clockTime(now)
+		if now > slot.End {
+			stop.Late = true
+			m.Warnings = append(m.Warnings, fmt.Sprintf("%s is expected after the %s slot closes", stop.PickupID, slot.Name))
+		}
+		now += ServiceMinutes
+		trip.LoadKg += stop.LoadKg
+		trip.DistanceKm += leg
+		from = stop.Location
+	}
+	back := geo.Haversine(from, m.Depot.Location)
+	now += travelMinutes(back)
+	trip.Return = clockTime(now)
+	trip.LoadKg, trip.DistanceKm = round(trip.LoadKg), round(trip.DistanceKm+back)
+	return now + UnloadMinutes
+}
+
+// loadKg returns the weight of items, estimating any that nobody has weighed
+// with unitWeight.
+func loadKg(items []pickups.Item, unitWeight UnitWeight) float64 {
+	total := 0.0
+	for _, item := range items {
+		if weight := item.EarningWeightKg(); weight > 0 {
+			total += weight
+		} else if unitWeight != nil {
+			total += unitWeight(item) * float64(item.Quantity)
+		}
+	}
+	return total
+}
+
+func firstLocated(bySlot map[string][]Stop) *geo.Point {
+	for _, slot := range TimeSlots {
+		if stops := bySlot[slot.Name]; len(stops) > 0 {
+			return &stops[0].Location
+		}
+	}
+	return nil
+}
+
+func travelMinutes(km float64) int {
+	return int(math.Ceil(km / AverageSpeedKmh * 60))
+}
+
+// clockTime formats minutes after midnight as "15:04".
+func clockTime(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
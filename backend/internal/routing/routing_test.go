@@ -0,0 +1,222 @@
+package routing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/items"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/quotes"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var (
+	westlands = geo.Point{Lat: -1.2676, Lng: 36.8108}
+	parklands = geo.Point{Lat: -1.2615, Lng: 36.8180}
+	kilimani  = geo.Point{Lat: -1.2921, Lng: 36.7856}
+	embakasi  = geo.Point{Lat: -1.3200, Lng: 36.9000}
+	donholm   = geo.Point{Lat: -1.2960, Lng: 36.8900}
+)
+
+func TestSolveRespectsCapacity(t *testing.T) {
+	depot := quotes.DefaultHubs[0].Location
+	points := []geo.Point{westlands, parklands, kilimani, embakasi, donholm}
+	loads := []float64{300, 300, 300, 300, 900}
+
+	trips := solve(depot, 800, points, loads)
+	seen := map[int]bool{}
+	for _, trip := range trips {
+		load := 0.0
+		for _, i := range trip {
+			if seen[i] {
+				t.Fatalf("point %d visited twice", i)
+			}
+			seen[i] = true
+			load += loads[i]
+		}
+		if load > 800 && len(trip) > 1 {
+			t.Errorf("trip %v carries %.0f kg", trip, load)
+		}
+	}
+	if len(seen) != len(points) {
+		t.Errorf("visited %d of %d points", len(seen), len(points))
+	}
+	if len(trips) != 3 {
+		t.Errorf("expected 3 trips, got %v", trips)
+	}
+}
+
+func TestSolveOrdersStops(t *testing.T) {
+	depot := quotes.DefaultHubs[0].Location
+	points := []geo.Point{westlands, embakasi, parklands, donholm}
+	trips := solve(depot, 1000, points, []float64{1, 1, 1, 1})
+	if len(trips) != 1 {
+		t.Fatalf("expected one trip, got %v", trips)
+	}
+	// Neighbouring estates should be visited back to back.
+	trip := trips[0]
+	pos := map[int]int{}
+	for i, p := range trip {
+		pos[p] = i
+	}
+	if d := pos[0] - pos[2]; d != 1 && d != -1 {
+		t.Errorf("Westlands and Parklands not adjacent in %v", trip)
+	}
+	if d := pos[1] - pos[3]; d != 1 && d != -1 {
+		t.Errorf("Embakasi and Donholm not adjacent in %v", trip)
+	}
+}
+
+func newTestService(t *testing.T) (*Service, *pickups.Service) {
+	t.Helper()
+	db := store.NewMemory()
+	catalogue := items.NewService(db)
+	if err := catalogue.Seed(); err != nil {
+		t.Fatalf("Seed() error = %v", err)
+	}
+	svc := NewService(db, quotes.DefaultHubs)
+	svc.SetUnitWeight(catalogue.UnitWeightKg)
+	svc.now = func() time.Time { return time.Date(2026, 11, 1, 18, 0, 0, 0, time.UTC) }
+	return svc, pickups.NewService(db)
+}
+
+func schedule(t *testing.T, pickupService *pickups.Service, collector, slot string, location *geo.Point, items ...pickups.Item) *pickups.Pickup {
+	t.Helper()
+	p, err := pickupService.Create("resident", pickups.CreateRequest{
+		Address: "Somewhere in Nairobi", Location: location, Date: "2026-11-02", TimeSlot: slot, Items: items,
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if collector != "" {
+		if p, err = pickupService.Assign(p.ID, collector, "", "admin"); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	return p
+}
+
+func TestPlan(t *testing.T) {
+	svc, pickupService := newTestService(t)
+	if _, err := svc.SaveVehicle(Vehicle{ID: "kbx-123", Name: "Canter", CollectorID: "col1", CapacityKg: 100, HubID: "nairobi"}); err != nil {
+		t.Fatalf("SaveVehicle() error = %v", err)
+	}
+	fridge := pickups.Item{Category: "appliances", Quantity: 2}
+	phones := pickups.Item{Category: "phones", Quantity: 5}
+
+	afternoon := schedule(t, pickupService, "col1", "afternoon", &kilimani, phones)
+	morning1 := schedule(t, pickupService, "col1", "morning", &westlands, fridge)
+	morning2 := schedule(t, pickupService, "col1", "morning", &embakasi, fridge)
+	unrouted := schedule(t, pickupService, "col1", "morning", nil, phones)
+	schedule(t, pickupService, "col2", "morning", &parklands, phones)
+	schedule(t, pickupService, "", "morning", &donholm, phones)
+
+	m, err := svc.Plan("2026-11-02", "col1")
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if m.Depot.ID != "nairobi" || m.Vehicle.ID != "kbx-123" {
+		t.Errorf("unexpected depot or vehicle: %+v %+v", m.Depot, m.Vehicle)
+	}
+	// Two 60 kg morning pickups do not fit a 100 kg van together.
+	if len(m.Trips) != 3 {
+		t.Fatalf("expected 3 trips, got %+v", m.Trips)
+	}
+	if m.Trips[0].TimeSlot != "morning" || m.Trips[1].TimeSlot != "morning" || m.Trips[2].TimeSlot != "afternoon" {
+		t.Errorf("trips out of slot order: %+v", m.Trips)
+	}
+	if got := m.Trips[2].Stops[0]; got.PickupID != afternoon.ID || got.Sequence != 3 || got.Arrival < "12:00" {
+		t.Errorf("unexpected afternoon stop %+v", got)
+	}
+	ids := []string{m.Trips[0].Stops[0].PickupID, m.Trips[1].Stops[0].PickupID}
+	if !(ids[0] == morning1.ID || ids[0] == morning2.ID) || ids[0] == ids[1] {
+		t.Errorf("unexpected morning stops %v", ids)
+	}
+	if m.Trips[1].Depart < m.Trips[0].Return {
+		t.Errorf("second trip departs %s before first returns %s", m.Trips[1].Depart, m.Trips[0].Return)
+	}
+	if len(m.Unrouted) != 1 || m.Unrouted[0].PickupID != unrouted.ID || len(m.Warnings) != 1 {
+		t.Errorf("unrouted pickup not reported: %+v %v", m.Unrouted, m.Warnings)
+	}
+	if m.Stops != 4 || m.LoadKg != 122 {
+		t.Errorf("unexpected totals: %d stops, %.1f kg", m.Stops, m.LoadKg)
+	}
+}
+
+func TestPlanDay(t *testing.T) {
+	svc, pickupService := newTestService(t)
+	schedule(t, pickupService, "col2", "morning", &parklands, pickups.Item{Category: "phones", Quantity: 1})
+	schedule(t, pickupService, "col1", "evening", &westlands, pickups.Item{Category: "phones", Quantity: 1, WeightKg: 2})
+
+	manifests, err := svc.PlanDay("2026-11-02")
+	if err != nil {
+		t.Fatalf("PlanDay() error = %v", err)
+	}
+	if len(manifests) != 2 || manifests[0].CollectorID != "col1" || manifests[1].CollectorID != "col2" {
+		t.Fatalf("unexpected manifests %+v", manifests)
+	}
+	if manifests[0].Vehicle.CapacityKg != DefaultCapacityKg || manifests[0].LoadKg != 2 {
+		t.Errorf("unexpected default vehicle or load: %+v", manifests[0])
+	}
+	if _, err := svc.PlanDay("02/11/2026"); !errors.Is(err, ErrInvalidDate) {
+		t.Errorf("PlanDay(bad date) error = %v, want ErrInvalidDate", err)
+	}
+}
+
+func TestPlanUsesUnitWeights(t *testing.T) {
+	svc, pickupService := newTestService(t)
+	schedule(t, pickupService, "col1", "morning", &westlands,
+		pickups.Item{Category: "appliances", Subcategory: "refrigerators", Quantity: 2},
+		pickups.Item{Category: "phones", Quantity: 5})
+
+	m, err := svc.Plan("2026-11-02", "col1")
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	// Fridges weigh as their subcategory does, phones as their category.
+	if m.LoadKg != 101 {
+		t.Errorf("load = %.1f kg, want 101", m.LoadKg)
+	}
+}
+
+func TestSaveVehicleValidates(t *testing.T) {
+	svc, _ := newTestService(t)
+	tests := []struct {
+		name string
+		v    Vehicle
+	}{
+		{"Missing collector", Vehicle{ID: "v1", CapacityKg: 500}},
+		{"Zero capacity", Vehicle{ID: "v1", CollectorID: "col1"}},
+		{"Unknown hub", Vehicle{ID: "v1", CollectorID: "col1", CapacityKg: 500, HubID: "eldoret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.SaveVehicle(tt.v); !errors.Is(err, ErrInvalidVehicle) {
+				t.Errorf("SaveVehicle() error = %v, want ErrInvalidVehicle", err)
+			}
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	svc, pickupService := newTestService(t)
+	p := schedule(t, pickupService, "col1", "morning", &westlands, pickups.Item{Category: "crt_monitors", Quantity: 1})
+	m, err := svc.Plan("2026-11-02", "col1")
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	m.Trips[0].Stops[0].Notes = "<b>gate code</b>"
+
+	page, err := HTML(m)
+	if err != nil {
+		t.Fatalf("HTML() error = %v", err)
+	}
+	for _, want := range []string{p.ID, "1 x crt monitors", "&lt;b&gt;gate code&lt;/b&gt;", "Trip 1"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("manifest page missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package routing
+
+import (
+	"sort"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+)
+
+// solve splits points into trips from depot whose loads fit capacity, using
+// the Clarke-Wright savings heuristic followed by 2-opt on each trip. It
+// returns trips as indexes into points. A point heavier than capacity on its
+// own gets a trip to itself.
+func solve(depot geo.Point, capacity float64, points []geo.Point, loads []float64) [][]int {
+	n := len(points)
+	if n == 0 {
+		return nil
+	}
+	dist := distances(depot, points)
+
+	// Every point starts on its own trip.
+	routeOf := make([]int, n)
+	routes := make([][]int, n)
+	routeLoad := make([]float64, n)
+	for i := range points {
+		routeOf[i] = i
+		routes[i] = []int{i}
+		routeLoad[i] = loads[i]
+	}
+
+	type saving struct {
+		i, j  int
+		value float64
+	}
+	var savings []saving
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			savings = append(savings, saving{i, j, dist[0][i+1] + dist[0][j+1] - dist[i+1][j+1]})
+		}
+	}
+	sort.SliceStable(savings, func(a, b int) bool { return savings[a].value > savings[b].value })
+
+	for _, s := range savings {
+		ri, rj := routeOf[s.i], routeOf[s.j]
+		if ri == rj || routeLoad[ri]+routeLoad[rj] > capacity {
+			continue
+		}
+		a, b := routes[ri], routes[rj]
+		var merged []int
+		switch {
+		case a[len(a)-1] == s.i && b[0] == s.j:
+			merged = append(append([]int{}, a...), b...)
+		case b[len(b)-1] == s.j && a[0] == s.i:
+			merged = append(append([]int{}, b...), a...)
+		case a[0] == s.i && b[0] == s.j:
+			merged = append(reversed(a), b...)
+		case a[len(a)-1] == s.i && b[len(b)-1] == s.j:
+			merged = append(append([]int{}, a...), reversed(b)...)
+		default:
+			// One of the points is inside its trip and cannot be joined.
+			continue
+		}
+		routes[ri], routes[rj] = merged, nil
+		routeLoad[ri] += routeLoad[rj]
+		for _, p := range b {
+			routeOf[p] = ri
+		}
+	}
+
+	var trips [][]int
+	for _, route := range routes {
+		if route != nil {
+			trips = append(trips, twoOpt(route, dist))
+		}
+	}
+	return trips
+}
+
+// distances returns the matrix of haversine distances between the depot (index
+// 0) and points (index i+1).
+func distances(depot geo.Point, points []geo.Point) [][]float64 {
+	all := append([]geo.Point{depot}, points...)
+	dist := make([][]float64, len(all))
+	for i := range all {
+		dist[i] = make([]float64, len(all))
+		for j := range all {
+			if i != j {
+				dist[i][j] = geo.Haversine(all[i], all[j])
+			}
+		}
+	}
+	return dist
+}
+
+// twoOpt reverses segments of route while that shortens the closed trip from
+// and back to the depot.
+func twoOpt(route []int, dist [][]float64) []int {
+	node := func(k int) int {
+		if k < 0 || k >= len(route) {
+			return 0
+		}
+		return route[k] + 1
+	}
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(route)-1; i++ {
+			for j := i + 1; j < len(route); j++ {
+				before := dist[node(i-1)][node(i)] + dist[node(j)][node(j+1)]
+				after := dist[node(i-1)][node(j)] + dist[node(i)][node(j+1)]
+				if after < before-1e-9 {
+					for l, r := i, j; l < r; l, r = l+1, r-1 {
+						route[l], route[r] = route[r], route[l]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+	return route
+}
+
+func reversed(route []int) []int {
+	out := make([]int, len(route))
+	for i, p := range route {
+		out[len(route)-1-i] = p
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package serviceareas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// waitlistBucket holds waitlist entries keyed by user and county.
+const waitlistBucket = "service_area_waitlist"
+
+var (
+	// ErrLocationRequired is returned when a pickup has no coordinates to check.
+	ErrLocationRequired = errors.New("a pickup location is required")
+	// ErrInvalidLocation is returned for coordinates outside the WGS84 range.
+	ErrInvalidLocation = errors.New("invalid location")
+)
+
+// Area is a set of counties, or individual sub-counties, that collectors serve.
+type Area struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Counties    []string `json:"counties,omitempty"`
+	SubCounties []string `json:"sub_counties,omitempty"`
+}
+
+// DefaultAreas are the areas in service, each run from the hub of the same ID.
+var DefaultAreas = []Area{
+	{ID: "nairobi", Name: "Nairobi Metro", Counties: []string{"047", "022"}},
+	{ID: "mombasa", Name: "Mombasa", Counties: []string{"001"}},
+	{ID: "kisumu", Name: "Kisumu", SubCounties: []string{"042-01"}},
+}
+
+// covers reports whether the area serves the placement.
+func (a *Area) covers(p geo.Placement) bool {
+	for _, code := range a.Counties {
+		if code == p.CountyCode {
+			return true
+		}
+	}
+	for _, code := range a.SubCounties {
+		if p.SubCountyCode != "" && code == p.SubCountyCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Result describes where a point is and whether we collect there.
+type Result struct {
+	geo.Placement
+	AreaID   string `json:"area_id,omitempty"`
+	AreaName string `json:"area_name,omitempty"`
+	Covered  bool   `json:"covered"`
+}
+
+// WaitlistEntry records demand from outside the covered areas.
+type WaitlistEntry struct {
+	UserID    string    `json:"user_id"`
+	Address   string    `json:"address"`
+	Location  geo.Point `json:"location"`
+	County    string    `json:"county,omitempty"`
+	SubCounty string    `json:"sub_county,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Service decides which service area a location belongs to.
+type Service struct {
+	store      *store.Store
+	boundaries *geo.Boundaries
+	areas      []Area
+	strict     bool
+	now        func() time.Time
+}
+
+// NewService creates a service-area checker.
+func NewService(s *store.Store, boundaries *geo.Boundaries, areas []Area) *Service {
+	return &Service{store: s, boundaries: boundaries, areas: areas, now: time.Now}
+}
+
+// SetStrict makes ScreenPickup refuse pickups outside every service area.
+// Only set it when the boundaries are precise: with the simplified ones
+// bundled with the application a miss is recorded as a warning instead.
+func (s *Service) SetStrict(strict bool) {
+	s.strict = strict
+}
+
+// Areas returns the areas in service.
+func (s *Service) Areas() []Area {
+	return s.areas
+}
+
+// Locate places p within the county boundaries and service areas.
+func (s *Service) Locate(p geo.Point) (Result, error) {
+	if p.IsZero() || !p.Valid() {
+		return Result{}, ErrInvalidLocation
+	}
+	result := Result{Placement: s.boundaries.Locate(p)}
+	for i := range s.areas {
+		if s.areas[i].covers(result.Placement) {
+			result.AreaID, result.AreaName, result.Covered = s.areas[i].ID, s.areas[i].Name, true
+			break
+		}
+	}
+	return result, nil
+}
+
+// ScreenPickup is a pickups.Screen that records where a pickup is. A pickup
+// outside every service area is refused when the service is strict, and
+// otherwise accepted with an AreaWarning for dispatch to check.
+func (s *Service) ScreenPickup(tx *store.Tx, p *pickups.Pickup) error {
+	if p.Location == nil {
+		return fmt.Errorf("%w: %v", pickups.ErrInvalidPickup, ErrLocationRequired)
+	}
+	result, err := s.Locate(*p.Location)
+	if err != nil {
+		return fmt.Errorf("%w: %v", pickups.ErrInvalidPickup, err)
+	}
+	p.County, p.SubCounty, p.ServiceArea = result.County, result.SubCounty, result.AreaID
+	if !result.Covered {
+		where := result.County
+		if where == "" {
+			where = "this location"
+		}
+		if s.strict {
+			return fmt.Errorf("%w: we do not collect in %s yet", pickups.ErrOutsideServiceArea, where)
+		}
+		p.AreaWarning = fmt.Sprintf("%s may be outside our service areas", where)
+	}
+	return nil
+}
+
+// JoinWaitlist records that uid wants collections at location. Joining again
+// from the same county updates the earlier entry.
+func (s *Service) JoinWaitlist(uid, address string, location geo.Point) (*WaitlistEntry, error) {
+	result, err := s.Locate(location)
+	if err != nil {
+		return nil, err
+	}
+	entry := &WaitlistEntry{
+		UserID:    uid,
+		Address:   strings.TrimSpace(address),
+		Location:  location,
+		County:    result.County,
+		SubCounty: result.SubCounty,
+		CreatedAt: s.now().UTC(),
+	}
+	key := uid + ":" + result.CountyCode
+	err = s.store.Update(func(tx *store.Tx) error {
+		return tx.Put(waitlistBucket, key, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// CountyDemand counts waitlist entries in one county.
+type CountyDemand struct {
+	County string `json:"county"`
+	Count  int    `json:"count"`
+}
+
+// Waitlist returns every waitlist entry, oldest first, and the demand per
+// county, largest first. Entries outside every county are counted as "Unknown".
+func (s *Service) Waitlist() ([]WaitlistEntry, []CountyDemand, error) {
+	entries := []WaitlistEntry{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(waitlistBucket, func(key string, raw json.RawMessage) error {
+			var entry WaitlistEntry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return fmt.Errorf("error decoding waitlist entry %s: %w", key, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	counts := map[string]int{}
+	for _, entry := range entries {
+		county := entry.County
+		if county == "" {
+			county = "Unknown"
+		}
+		counts[county]++
+	}
+	demand := []CountyDemand{}
+	for county, count := range counts {
+		demand = append(demand, CountyDemand{County: county, Count: count})
+	}
+	sort.Slice(demand, func(i, j int) bool {
+		if demand[i].Count != demand[j].Count {
+			return demand[i].Count > demand[j].Count
+		}
+		return demand[i].County < demand[j].County
+	})
+	return entries, demand, nil
+}
@@ -0,0 +1,134 @@
+package serviceareas
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/geo"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/pickups"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+var (
+	westlands    = geo.Point{Lat: -1.2676, Lng: 36.8108}
+	kisumuCBD    = geo.Point{Lat: -0.0917, Lng: 34.7680}
+	kisumuRural  = geo.Point{Lat: -0.3000, Lng: 35.2000}
+	nakuruTown   = geo.Point{Lat: -0.3031, Lng: 36.0800}
+	lakeVictoria = geo.Point{Lat: -1.0000, Lng: 33.0000}
+)
+
+func newTestService(t *testing.T) (*Service, *pickups.Service) {
+	t.Helper()
+	boundaries, err := geo.DefaultBoundaries()
+	if err != nil {
+		t.Fatalf("DefaultBoundaries() error = %v", err)
+	}
+	db := store.NewMemory()
+	svc := NewService(db, boundaries, DefaultAreas)
+	pickupService := pickups.NewService(db)
+	pickupService.AddScreen(svc.ScreenPickup)
+	return svc, pickupService
+}
+
+func TestLocate(t *testing.T) {
+	svc, _ := newTestService(t)
+	tests := []struct {
+		name        string
+		p           geo.Point
+		wantArea    string
+		wantCounty  string
+		wantCovered bool
+	}{
+		{name: "Covered county", p: westlands, wantArea: "nairobi", wantCounty: "Nairobi", wantCovered: true},
+		{name: "Covered sub-county", p: kisumuCBD, wantArea: "kisumu", wantCounty: "Kisumu", wantCovered: true},
+		{name: "Uncovered sub-county of a served county", p: kisumuRural, wantCounty: "Kisumu"},
+		{name: "Uncovered county", p: nakuruTown, wantCounty: "Nakuru"},
+		{name: "Outside every county", p: lakeVictoria},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.Locate(tt.p)
+			if err != nil {
+				t.Fatalf("Locate() error = %v", err)
+			}
+			if got.AreaID != tt.wantArea || got.County != tt.wantCounty || got.Covered != tt.wantCovered {
+				t.Errorf("Locate() = %+v", got)
+			}
+		})
+	}
+	if _, err := svc.Locate(geo.Point{Lat: 120, Lng: 0}); !errors.Is(err, ErrInvalidLocation) {
+		t.Errorf("Locate(invalid) error = %v, want ErrInvalidLocation", err)
+	}
+}
+
+func TestScreenPickup(t *testing.T) {
+	areas, pickupService := newTestService(t)
+	req := func(location *geo.Point) pickups.CreateRequest {
+		return pickups.CreateRequest{
+			Address: "Somewhere", Location: location, Date: "2026-11-02", TimeSlot: "morning",
+			Items: []pickups.Item{{Category: "phones", Quantity: 1}},
+		}
+	}
+
+	p, err := pickupService.Create("alice", req(&westlands))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if p.County != "Nairobi" || p.SubCounty != "Westlands" || p.ServiceArea != "nairobi" {
+		t.Errorf("placement not recorded: %+v", p)
+	}
+
+	if p.AreaWarning != "" {
+		t.Errorf("covered pickup has a warning: %q", p.AreaWarning)
+	}
+
+	// The bundled boundaries are approximate, so a miss is only a warning.
+	outside, err := pickupService.Create("alice", req(&nakuruTown))
+	if err != nil {
+		t.Fatalf("Create(outside) error = %v", err)
+	}
+	if outside.ServiceArea != "" || outside.AreaWarning != "Nakuru may be outside our service areas" {
+		t.Errorf("outside pickup = %+v", outside)
+	}
+
+	areas.SetStrict(true)
+	if _, err := pickupService.Create("alice", req(&nakuruTown)); !errors.Is(err, pickups.ErrOutsideServiceArea) {
+		t.Errorf("strict Create(outside) error = %v, want ErrOutsideServiceArea", err)
+	}
+	if _, err := pickupService.Create("alice", req(nil)); !errors.Is(err, pickups.ErrInvalidPickup) {
+		t.Errorf("Create(no location) error = %v, want ErrInvalidPickup", err)
+	}
+	if list, _ := pickupService.List(nil); len(list) != 2 {
+		t.Errorf("refused pickups were stored: %d pickups", len(list))
+	}
+}
+
+func TestWaitlist(t *testing.T) {
+	svc, _ := newTestService(t)
+	joins := []struct {
+		uid string
+		p   geo.Point
+	}{
+		{"alice", nakuruTown},
+		{"alice", nakuruTown},
+		{"bob", nakuruTown},
+		{"carol", kisumuRural},
+		{"dave", lakeVictoria},
+	}
+	for _, j := range joins {
+		if _, err := svc.JoinWaitlist(j.uid, "home", j.p); err != nil {
+			t.Fatalf("JoinWaitlist() error = %v", err)
+		}
+	}
+
+	entries, demand, err := svc.Waitlist()
+	if err != nil {
+		t.Fatalf("Waitlist() error = %v", err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("expected 4 entries, got %d", len(entries))
+	}
+	if len(demand) != 3 || demand[0] != (CountyDemand{County: "Nakuru", Count: 2}) {
+		t.Errorf("unexpected demand %+v", demand)
+	}
+}
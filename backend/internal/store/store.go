@@ -0,0 +1,272 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned when a key does not exist in a bucket.
+	ErrNotFound = errors.New("store: not found")
+	// ErrAppendOnly is returned when a record in an append-only bucket would
+	// be overwritten or deleted.
+	ErrAppendOnly = errors.New("store: bucket is append-only")
+)
+
+// sequenceBucket holds the counters handed out by Tx.NextSequence.
+const sequenceBucket = "_sequences"
+
+// Store is a small transactional key/value store. Records are grouped into
+// named buckets and kept as JSON. When a path is configured every committed
+// write transaction is flushed to disk, so state survives restarts.
+type Store struct {
+	mu         sync.RWMutex
+	path       string
+	buckets    map[string]map[string]json.RawMessage
+	appendOnly map[string]bool
+}
+
+// NewMemory returns a store that only lives in memory. Used by tests.
+func NewMemory() *Store {
+	return &Store{buckets: make(map[string]map[string]json.RawMessage), appendOnly: make(map[string]bool)}
+}
+
+// AppendOnly marks bucket so that its records can be added but never
+// replaced or deleted.
+func (s *Store) AppendOnly(bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendOnly[bucket] = true
+}
+
+// Open loads the store from path, creating the file on first commit if it does not exist.
+func Open(path string) (*Store, error) {
+	s := NewMemory()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("error reading store file: %w", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.buckets); err != nil {
+			return nil, fmt.Errorf("error decoding store file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// View runs fn in a read-only transaction.
+func (s *Store) View(fn func(tx *Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(&Tx{store: s})
+}
+
+// Update runs fn in a read-write transaction. Writes only become visible,
+// and are only persisted, if fn returns nil.
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &Tx{store: s, writable: true, pending: make(map[string]map[string]json.RawMessage)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.pending) == 0 {
+		return nil
+	}
+
+	previous := s.apply(tx.pending)
+	if err := s.flush(); err != nil {
+		s.apply(previous)
+		return err
+	}
+	for _, hook := range tx.onCommit {
+		hook()
+	}
+	return nil
+}
+
+// apply writes the pending changes into the store and returns the values they replaced,
+// in the same shape, so that a failed flush can be rolled back.
+func (s *Store) apply(changes map[string]map[string]json.RawMessage) map[string]map[string]json.RawMessage {
+	previous := make(map[string]map[string]json.RawMessage)
+	for bucket, records := range changes {
+		if s.buckets[bucket] == nil {
+			s.buckets[bucket] = make(map[string]json.RawMessage)
+		}
+		previous[bucket] = make(map[string]json.RawMessage)
+		for key, value := range records {
+			previous[bucket][key] = s.buckets[bucket][key]
+			if value == nil {
+				delete(s.buckets[bucket], key)
+			} else {
+				s.buckets[bucket][key] = value
+			}
+		}
+	}
+	return previous
+}
+
+// flush writes the store to disk atomically. It is a no-op for in-memory stores.
+func (s *Store) flush() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.buckets)
+	if err != nil {
+		return fmt.Errorf("error encoding store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("error creating store directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing store file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("error replacing store file: %w", err)
+	}
+	return nil
+}
+
+// Tx is a view of the store inside View or Update.
+type Tx struct {
+	store    *Store
+	writable bool
+	pending  map[string]map[string]json.RawMessage
+	onCommit []func()
+}
+
+// Get decodes the record stored under key into v.
+func (tx *Tx) Get(bucket, key string, v interface{}) error {
+	raw, ok := tx.lookup(bucket, key)
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Exists reports whether key is present in bucket.
+func (tx *Tx) Exists(bucket, key string) bool {
+	_, ok := tx.lookup(bucket, key)
+	return ok
+}
+
+// Put stores v under key.
+func (tx *Tx) Put(bucket, key string, v interface{}) error {
+	if !tx.writable {
+		return errors.New("store: put in read-only transaction")
+	}
+	if tx.store.appendOnly[bucket] && tx.Exists(bucket, key) {
+		return fmt.Errorf("%w: %s/%s already exists", ErrAppendOnly, bucket, key)
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding %s/%s: %w", bucket, key, err)
+	}
+	tx.stage(bucket, key, raw)
+	return nil
+}
+
+// Insert stores v under key, failing if the key already exists. It is used
+// for append-only records that must never be overwritten.
+func (tx *Tx) Insert(bucket, key string, v interface{}) error {
+	if tx.Exists(bucket, key) {
+		return fmt.Errorf("store: %s/%s already exists", bucket, key)
+	}
+	return tx.Put(bucket, key, v)
+}
+
+// Delete removes key from bucket.
+func (tx *Tx) Delete(bucket, key string) error {
+	if !tx.writable {
+		return errors.New("store: delete in read-only transaction")
+	}
+	if tx.store.appendOnly[bucket] {
+		return fmt.Errorf("%w: cannot delete %s/%s", ErrAppendOnly, bucket, key)
+	}
+	tx.stage(bucket, key, nil)
+	return nil
+}
+
+// ForEach calls fn for every record in bucket, in key order. Returning an error stops the iteration.
+func (tx *Tx) ForEach(bucket string, fn func(key string, raw json.RawMessage) error) error {
+	merged := make(map[string]json.RawMessage)
+	for key, value := range tx.store.buckets[bucket] {
+		merged[key] = value
+	}
+	for key, value := range tx.pending[bucket] {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, merged[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextSequence returns the next value of the named counter, starting at 1.
+func (tx *Tx) NextSequence(name string) (uint64, error) {
+	var current uint64
+	if err := tx.Get(sequenceBucket, name, &current); err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	current++
+	if err := tx.Put(sequenceBucket, name, current); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+// OnCommit registers fn to run after the transaction has been committed successfully.
+func (tx *Tx) OnCommit(fn func()) {
+	tx.onCommit = append(tx.onCommit, fn)
+}
+
+func (tx *Tx) lookup(bucket, key string) (json.RawMessage, bool) {
+	if records, ok := tx.pending[bucket]; ok {
+		if value, ok := records[key]; ok {
+			return value, value != nil
+		}
+	}
+	value, ok := tx.store.buckets[bucket][key]
+	return value, ok
+}
+
+func (tx *Tx) stage(bucket, key string, raw json.RawMessage) {
+	if tx.pending[bucket] == nil {
+		tx.pending[bucket] = make(map[string]json.RawMessage)
+	}
+	tx.pending[bucket][key] = raw
+}
+
+// SequenceKey formats a sequence number so that keys sort in insertion order.
+func SequenceKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
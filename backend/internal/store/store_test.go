@@ -0,0 +1,122 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type record struct {
+	Name string `json:"name"`
+}
+
+func TestUpdateCommitsAndRollsBack(t *testing.T) {
+	s := NewMemory()
+
+	err := s.Update(func(tx *Tx) error {
+		return tx.Put("things", "a", record{Name: "first"})
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	wantErr := errors.New("boom")
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.Put("things", "b", record{Name: "second"}); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Update() error = %v, want %v", err, wantErr)
+	}
+
+	_ = s.View(func(tx *Tx) error {
+		var got record
+		if err := tx.Get("things", "a", &got); err != nil || got.Name != "first" {
+			t.Errorf("Get(a) = %+v, %v", got, err)
+		}
+		if tx.Exists("things", "b") {
+			t.Errorf("rolled back record b is visible")
+		}
+		return nil
+	})
+}
+
+func TestInsertRejectsDuplicates(t *testing.T) {
+	s := NewMemory()
+	err := s.Update(func(tx *Tx) error {
+		if err := tx.Insert("log", "1", record{Name: "x"}); err != nil {
+			return err
+		}
+		return tx.Insert("log", "1", record{Name: "y"})
+	})
+	if err == nil {
+		t.Fatal("expected duplicate insert to fail")
+	}
+}
+
+func TestAppendOnlyBuckets(t *testing.T) {
+	s := NewMemory()
+	s.AppendOnly("log")
+	if err := s.Update(func(tx *Tx) error { return tx.Put("log", "1", record{Name: "x"}) }); err != nil {
+		t.Fatalf("first Put() error = %v", err)
+	}
+	if err := s.Update(func(tx *Tx) error { return tx.Put("log", "1", record{Name: "y"}) }); !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("overwriting Put() error = %v, want ErrAppendOnly", err)
+	}
+	if err := s.Update(func(tx *Tx) error { return tx.Delete("log", "1") }); !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("Delete() error = %v, want ErrAppendOnly", err)
+	}
+	if err := s.Update(func(tx *Tx) error { return tx.Put("other", "1", record{Name: "y"}) }); err != nil {
+		t.Errorf("Put() in another bucket error = %v", err)
+	}
+}
+
+func TestForEachSeesPendingWrites(t *testing.T) {
+	s := NewMemory()
+	_ = s.Update(func(tx *Tx) error {
+		_ = tx.Put("things", "b", record{Name: "b"})
+		_ = tx.Put("things", "a", record{Name: "a"})
+		_ = tx.Delete("things", "b")
+
+		var keys []string
+		_ = tx.ForEach("things", func(key string, raw json.RawMessage) error {
+			keys = append(keys, key)
+			return nil
+		})
+		if len(keys) != 1 || keys[0] != "a" {
+			t.Errorf("ForEach keys = %v, want [a]", keys)
+		}
+		return nil
+	})
+}
+
+func TestOpenPersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	_ = s.Update(func(tx *Tx) error {
+		seq, err := tx.NextSequence("things")
+		if err != nil {
+			return err
+		}
+		return tx.Put("things", SequenceKey(seq), record{Name: "kept"})
+	})
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	_ = reopened.View(func(tx *Tx) error {
+		var got record
+		if err := tx.Get("things", SequenceKey(1), &got); err != nil || got.Name != "kept" {
+			t.Errorf("Get() after reopen = %+v, %v", got, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// maxJSONBody caps the size of JSON request bodies.
+const maxJSONBody = 1 << 20
+
+// WriteJSON encodes data as the JSON response body with the given status code.
+func WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("ERROR: encoding JSON response: %v", err)
+	}
+}
+
+// WriteJSONError writes an error message as a JSON response.
+func WriteJSONError(w http.ResponseWriter, statusCode int, errMsg string) {
+	WriteJSON(w, statusCode, map[string]string{"error": errMsg})
+}
+
+// DecodeJSON decodes the request body into v, rejecting unknown fields.
+func DecodeJSON(r *http.Request, v interface{}) error {
+	return DecodeJSONLimit(r, v, maxJSONBody)
+}
+
+// DecodeJSONLimit is DecodeJSON for endpoints that accept bodies larger than
+// the default cap, such as batches carrying photos.
+func DecodeJSONLimit(r *http.Request, v interface{}, limit int64) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
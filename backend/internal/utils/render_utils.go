@@ -2,11 +2,11 @@ package utils
 
 import (
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"path/filepath"
 	"sync"
-	"text/template"
 )
 
 // TemplateCache holds precompiled templates for efficient rendering.
@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/events"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// deliver runs a DeliverKind job: it sends the delivery, logs the attempt
+// and, on failure, leaves the job queue to retry it on DeliveryOptions'
+// schedule.
+func (s *Service) deliver(ctx context.Context, job *jobs.Job) error {
+	var id string
+	if err := job.Decode(&id); err != nil {
+		return err
+	}
+	var d *Delivery
+	var ep *Endpoint
+	var secret string
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		if d, err = getDeliveryTx(tx, "", id); err != nil {
+			return err
+		}
+		ep, err = getEndpointTx(tx, "", d.EndpointID)
+		if errors.Is(err, ErrNotFound) {
+			ep = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Get(secretsBucket, ep.ID, &secret)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %v", jobs.ErrPermanent, err)
+	}
+	if err != nil {
+		return err
+	}
+	if d.Status != DeliveryPending {
+		return nil
+	}
+	if ep == nil || ep.Status != StatusActive {
+		return s.finish(id, DeliveryCancelled)
+	}
+
+	attempt := s.send(ctx, ep.URL, secret, d)
+	ok := attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300
+	disabled := false
+	err = s.store.Update(func(tx *store.Tx) error {
+		current, err := getDeliveryTx(tx, "", id)
+		if err != nil {
+			return err
+		}
+		current.Attempts = append(current.Attempts, attempt)
+		current.UpdatedAt = attempt.At
+		switch {
+		case ok:
+			current.Status = DeliveryDelivered
+			current.DeliveredAt = attempt.At
+		case job.Attempts >= job.MaxAttempts:
+			current.Status = DeliveryFailed
+		}
+
+		endpoint, err := getEndpointTx(tx, "", ep.ID)
+		if errors.Is(err, ErrNotFound) {
+			return tx.Put(deliveriesBucket, id, current)
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			endpoint.ConsecutiveFailures = 0
+		} else {
+			endpoint.ConsecutiveFailures++
+			if endpoint.Status == StatusActive && endpoint.ConsecutiveFailures >= DisableAfter {
+				endpoint.Status = StatusDisabled
+				endpoint.DisabledReason = fmt.Sprintf("disabled after %d failed deliveries in a row", endpoint.ConsecutiveFailures)
+				endpoint.DisabledAt = attempt.At
+				disabled = true
+			}
+			if endpoint.Status != StatusActive && current.Status == DeliveryPending {
+				current.Status = DeliveryCancelled
+			}
+		}
+		endpoint.UpdatedAt = attempt.At
+		if err := tx.Put(endpointsBucket, endpoint.ID, endpoint); err != nil {
+			return err
+		}
+		return tx.Put(deliveriesBucket, id, current)
+	})
+	if err != nil {
+		return err
+	}
+	if disabled {
+		log.Printf("Webhooks: disabled endpoint %s of partner %s after repeated failures.", ep.ID, ep.PartnerID)
+	}
+	if ok || disabled {
+		return nil
+	}
+	if attempt.Error != "" {
+		return fmt.Errorf("delivery %s to %s failed: %s", id, ep.ID, attempt.Error)
+	}
+	return fmt.Errorf("delivery %s to %s failed with HTTP %d", id, ep.ID, attempt.StatusCode)
+}
+
+// finish gives a pending delivery its final status without sending it.
+func (s *Service) finish(id, status string) error {
+	return s.store.Update(func(tx *store.Tx) error {
+		d, err := getDeliveryTx(tx, "", id)
+		if err != nil {
+			return err
+		}
+		d.Status = status
+		d.UpdatedAt = s.now().UTC()
+		return tx.Put(deliveriesBucket, id, d)
+	})
+}
+
+// send POSTs a delivery to url and reports how it went.
+func (s *Service) send(ctx context.Context, url, secret string, d *Delivery) Attempt {
+	at := s.now().UTC()
+	attempt := Attempt{At: at}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ZingiraTech-Webhooks/1.0")
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(events.HeaderEventID, d.EventID)
+	req.Header.Set(events.HeaderEventType, d.Event)
+	req.Header.Set(HeaderSignature, signatureHeader(secret, at, d.Payload))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedResponse))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = strings.TrimSpace(string(body))
+	return attempt
+}
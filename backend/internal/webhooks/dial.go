@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errForbiddenAddress is returned when an endpoint resolves to an address
+// the server must not call.
+var errForbiddenAddress = errors.New("address is not reachable from the internet")
+
+// blockedNets are ranges, besides the private, loopback and link-local ones,
+// that are not on the public internet.
+var blockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved
+		"64:ff9b::/96",  // NAT64, which can reach any IPv4 address
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// checkIP returns errForbiddenAddress unless ip is on the public internet,
+// or is the local machine and allowLocal is set. Link-local covers the
+// 169.254.169.254 cloud metadata address.
+func checkIP(ip net.IP, allowLocal bool) error {
+	if ip.IsLoopback() && allowLocal {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errForbiddenAddress, ip)
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("%w: %s", errForbiddenAddress, ip)
+		}
+	}
+	return nil
+}
+
+// lookupIPAddr resolves host names; tests replace it.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// checkHost resolves host and returns an error if it cannot be resolved or
+// any of its addresses is forbidden.
+func checkHost(ctx context.Context, host string, allowLocal bool) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip, allowLocal)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if err := checkIP(addr.IP, allowLocal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. Every connection
+// is checked at dial time, after DNS resolution, so a host that resolved to
+// a public address when registered cannot later be pointed at an internal
+// one; redirects are not followed, so they cannot lead there either.
+func newClient(allowLocal bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", errForbiddenAddress, host)
+			}
+			return checkIP(ip, allowLocal)
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/compliance"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/events"
+)
+
+// Headers sent with every delivery, besides events.HeaderEventID and
+// events.HeaderEventType. Partners should ignore event IDs they have seen.
+const (
+	HeaderDelivery  = "X-Zingira-Delivery-Id"
+	HeaderSignature = "X-Zingira-Signature"
+)
+
+// Tolerance is how far a signature's timestamp may be from the receiver's
+// clock before Verify rejects it as a possible replay.
+const Tolerance = 5 * time.Minute
+
+// ErrInvalidSignature is returned by Verify when a signature does not match.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Item is a device in a pickup, as partners see it.
+type Item struct {
+	Category         string  `json:"category"`
+	Subcategory      string  `json:"subcategory,omitempty"`
+	Condition        string  `json:"condition,omitempty"`
+	Quantity         int     `json:"quantity"`
+	WeightKg         float64 `json:"weight_kg,omitempty"`
+	MeasuredWeightKg float64 `json:"measured_weight_kg,omitempty"`
+}
+
+// PickupData is the data of the pickup events. It leaves out who the
+// resident and collector are.
+type PickupData struct {
+	PickupID    string `json:"pickup_id"`
+	Status      string `json:"status"`
+	County      string `json:"county,omitempty"`
+	ServiceArea string `json:"service_area,omitempty"`
+	Date        string `json:"date"`
+	TimeSlot    string `json:"time_slot"`
+	Items       []Item `json:"items"`
+}
+
+// BatchData is the data of EventBatchDelivered.
+type BatchData struct {
+	PickupID     string    `json:"pickup_id"`
+	PartnerID    string    `json:"partner_id"`
+	Reference    string    `json:"reference"`
+	HandedOverAt time.Time `json:"handed_over_at"`
+}
+
+// partnerData returns the data partners are sent for e and the ID of the
+// partner that should receive it: the one a batch was handed over to, or
+// the one a pickup's items are going to. Pickups without a partner yet are
+// sent to nobody.
+func partnerData(e *events.Event) (interface{}, string, error) {
+	if e.Type == events.HandoverRecorded {
+		var h compliance.Handover
+		if err := e.Decode(&h); err != nil {
+			return nil, "", err
+		}
+		return BatchData{PickupID: h.PickupID, PartnerID: h.PartnerID, Reference: h.Reference, HandedOverAt: h.HandedOverAt}, h.PartnerID, nil
+	}
+	var change events.PickupChange
+	if err := e.Decode(&change); err != nil {
+		return nil, "", err
+	}
+	data := PickupData{
+		PickupID:    change.PickupID,
+		Status:      change.Status,
+		County:      change.County,
+		ServiceArea: change.ServiceArea,
+		Date:        change.Date,
+		TimeSlot:    change.TimeSlot,
+		Items:       []Item{},
+	}
+	for _, it := range change.Items {
+		data.Items = append(data.Items, Item{
+			Category: it.Category, Subcategory: it.Subcategory, Condition: it.Condition,
+			Quantity: it.Quantity, WeightKg: it.WeightKg, MeasuredWeightKg: it.MeasuredWeightKg,
+		})
+	}
+	return data, change.PartnerID, nil
+}
+
+// newSecret returns a random signing secret.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the HMAC-SHA256, in hex, of "<timestamp>.<body>" keyed with
+// secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureHeader returns the HeaderSignature value for body sent at t.
+func signatureHeader(secret string, t time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), Sign(secret, t.Unix(), body))
+}
+
+// Verify checks a HeaderSignature value against body as a receiver would:
+// the signature must match and its timestamp be within Tolerance of now.
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > Tolerance || age < -Tolerance {
+		return fmt.Errorf("%w: timestamp is too far from now", ErrInvalidSignature)
+	}
+	want := Sign(secret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,565 @@
+// Package webhooks lets recycling partners receive events in their own
+// inventory systems. Partners register endpoints for the events they want;
+// every delivery is signed with HMAC-SHA256 using the endpoint's secret,
+// retried on failure and logged, so partners can see what was sent and
+// replay it. Endpoints that keep failing are disabled until re-enabled.
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/events"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/jobs"
+	"github.com/Doreen-Onyango/zingiratech/backend/internal/store"
+)
+
+// Store buckets. Secrets are kept apart from endpoints so that listing
+// endpoints never exposes them; delivery keys map "<event ID>|<endpoint ID>"
+// to the delivery of that event, so a repeated event is not sent twice.
+const (
+	endpointsBucket    = "webhook_endpoints"
+	secretsBucket      = "webhook_secrets"
+	deliveriesBucket   = "webhook_deliveries"
+	deliveryKeysBucket = "webhook_delivery_keys"
+)
+
+// Events partners can subscribe to.
+const (
+	EventPickupAssigned  = "pickup.assigned"
+	EventPickupCollected = "pickup.collected"
+	// EventBatchDelivered is sent to the partner a pickup's items were
+	// handed over to.
+	EventBatchDelivered = "batch.delivered"
+)
+
+// Events lists the events partners can subscribe to.
+var Events = []string{EventPickupAssigned, EventPickupCollected, EventBatchDelivered}
+
+// partnerEvents maps the domain events partners hear about onto the names
+// they see.
+var partnerEvents = map[string]string{
+	events.PickupAssigned:   EventPickupAssigned,
+	events.PickupCollected:  EventPickupCollected,
+	events.HandoverRecorded: EventBatchDelivered,
+}
+
+// Endpoint states.
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+)
+
+// Delivery states. A delivery is cancelled when its endpoint is disabled or
+// removed before it succeeds.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryCancelled = "cancelled"
+)
+
+// DeliverKind is the job kind of a webhook delivery.
+const DeliverKind = "webhooks.deliver"
+
+// DeliveryOptions is the retry schedule: a failed delivery is tried again
+// after 1, 2, 4, ... minutes, at most 6 hours apart, 8 times in all.
+var DeliveryOptions = jobs.Options{
+	Concurrency: 4,
+	MaxAttempts: 8,
+	Backoff:     time.Minute,
+	MaxBackoff:  6 * time.Hour,
+	Timeout:     time.Minute,
+}
+
+// DisableAfter is how many failed attempts in a row, across deliveries,
+// disable an endpoint.
+var DisableAfter = 15
+
+// Limits on what is kept per endpoint and per attempt.
+const (
+	maxEndpointsPerPartner = 10
+	maxLoggedResponse      = 1024
+)
+
+var (
+	// ErrNotFound is returned when an endpoint or delivery does not exist
+	// or belongs to another partner.
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalidEndpoint is returned when an endpoint fails validation.
+	ErrInvalidEndpoint = errors.New("invalid webhook endpoint")
+	// ErrEndpointDisabled is returned when replaying to a disabled endpoint.
+	ErrEndpointDisabled = errors.New("webhook endpoint is disabled")
+)
+
+// Endpoint is a partner URL that receives events.
+type Endpoint struct {
+	ID                  string    `json:"id"`
+	PartnerID           string    `json:"partner_id"`
+	URL                 string    `json:"url"`
+	Events              []string  `json:"events"`
+	Status              string    `json:"status"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	DisabledAt          time.Time `json:"disabled_at,omitempty"`
+	CreatedBy           string    `json:"created_by"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+func (ep *Endpoint) wants(event string) bool {
+	for _, e := range ep.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointRequest holds the fields a partner sets on an endpoint.
+type EndpointRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// Attempt is one try at sending a delivery.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Response   string    `json:"response,omitempty"`
+}
+
+// Delivery is one event sent, or to be sent, to one endpoint. Payload is
+// the exact body sent, so replays send the same bytes.
+type Delivery struct {
+	ID          string          `json:"id"`
+	EndpointID  string          `json:"endpoint_id"`
+	PartnerID   string          `json:"partner_id"`
+	EventID     string          `json:"event_id"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    []Attempt       `json:"attempts"`
+	ReplayOf    string          `json:"replay_of,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeliveredAt time.Time       `json:"delivered_at,omitempty"`
+}
+
+// Service manages partner endpoints and delivers events to them.
+type Service struct {
+	store      *store.Store
+	queue      *jobs.Queue
+	client     *http.Client
+	ownClient  bool
+	allowLocal bool
+	now        func() time.Time
+}
+
+// NewService creates a webhook service backed by s that sends deliveries
+// through queue with client or, if nil, a client that only connects to
+// public addresses and does not follow redirects.
+func NewService(s *store.Store, queue *jobs.Queue, client *http.Client) *Service {
+	svc := &Service{store: s, queue: queue, client: client, now: time.Now}
+	if client == nil {
+		svc.client, svc.ownClient = newClient(false), true
+	}
+	queue.Register(DeliverKind, svc.deliver, DeliveryOptions)
+	return svc
+}
+
+// SetAllowLocal lets endpoints use plain HTTP on, and connect to, the local
+// machine. It is for development only: in production partners must not be
+// able to make the server call itself. Call it before the service is used.
+func (s *Service) SetAllowLocal(allow bool) {
+	s.allowLocal = allow
+	if s.ownClient {
+		s.client = newClient(allow)
+	}
+}
+
+// Subscribe has bus hand the service the events partners can receive.
+func (s *Service) Subscribe(bus *events.Bus) {
+	types := make([]string, 0, len(partnerEvents))
+	for t := range partnerEvents {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	bus.Subscribe("partner-webhooks", s.OnEvent, types...)
+}
+
+// validate checks req and returns it cleaned up. Endpoints must use HTTPS
+// and resolve to public addresses, unless allowLocal lets them use the local
+// machine for development.
+func validate(req EndpointRequest, allowLocal bool) (EndpointRequest, error) {
+	req.URL = strings.TrimSpace(req.URL)
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" {
+		return req, fmt.Errorf("%w: url must be an absolute URL", ErrInvalidEndpoint)
+	}
+	local := u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"
+	if u.Scheme != "https" && !(u.Scheme == "http" && local && allowLocal) {
+		return req, fmt.Errorf("%w: url must use https", ErrInvalidEndpoint)
+	}
+	if u.User != nil {
+		return req, fmt.Errorf("%w: url must not contain credentials", ErrInvalidEndpoint)
+	}
+	if err := checkHost(context.Background(), u.Hostname(), allowLocal); err != nil {
+		return req, fmt.Errorf("%w: %v", ErrInvalidEndpoint, err)
+	}
+	if len(req.Events) == 0 {
+		return req, fmt.Errorf("%w: choose at least one event", ErrInvalidEndpoint)
+	}
+	seen := map[string]bool{}
+	var list []string
+	for _, e := range req.Events {
+		known := false
+		for _, k := range Events {
+			known = known || k == e
+		}
+		if !known {
+			return req, fmt.Errorf("%w: unknown event %q", ErrInvalidEndpoint, e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			list = append(list, e)
+		}
+	}
+	req.Events = list
+	return req, nil
+}
+
+// getEndpointTx returns the endpoint id of partnerID, or ErrNotFound.
+// An empty partnerID matches any partner.
+func getEndpointTx(tx *store.Tx, partnerID, id string) (*Endpoint, error) {
+	var ep Endpoint
+	err := tx.Get(endpointsBucket, id, &ep)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && partnerID != "" && ep.PartnerID != partnerID) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ep, nil
+}
+
+func getDeliveryTx(tx *store.Tx, partnerID, id string) (*Delivery, error) {
+	var d Delivery
+	err := tx.Get(deliveriesBucket, id, &d)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && partnerID != "" && d.PartnerID != partnerID) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Create registers an endpoint for partnerID and returns it with its
+// signing secret, which is only shown here and when rotated.
+func (s *Service) Create(partnerID, actor string, req EndpointRequest) (*Endpoint, string, error) {
+	req, err := validate(req, s.allowLocal)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	var ep *Endpoint
+	err = s.store.Update(func(tx *store.Tx) error {
+		existing, err := listEndpointsTx(tx, partnerID)
+		if err != nil {
+			return err
+		}
+		if len(existing) >= maxEndpointsPerPartner {
+			return fmt.Errorf("%w: a partner can have at most %d endpoints", ErrInvalidEndpoint, maxEndpointsPerPartner)
+		}
+		seq, err := tx.NextSequence(endpointsBucket)
+		if err != nil {
+			return err
+		}
+		now := s.now().UTC()
+		ep = &Endpoint{
+			ID:        fmt.Sprintf("whk_%d", seq),
+			PartnerID: partnerID,
+			URL:       req.URL,
+			Events:    req.Events,
+			Status:    StatusActive,
+			CreatedBy: actor,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := tx.Insert(endpointsBucket, ep.ID, ep); err != nil {
+			return err
+		}
+		return tx.Put(secretsBucket, ep.ID, secret)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return ep, secret, nil
+}
+
+// Update changes the URL and events of an endpoint.
+func (s *Service) Update(partnerID, id string, req EndpointRequest) (*Endpoint, error) {
+	req, err := validate(req, s.allowLocal)
+	if err != nil {
+		return nil, err
+	}
+	return s.change(partnerID, id, func(ep *Endpoint) {
+		ep.URL, ep.Events = req.URL, req.Events
+	})
+}
+
+// SetActive enables or disables an endpoint. Enabling one clears its
+// failures, giving it a fresh start.
+func (s *Service) SetActive(partnerID, id string, active bool) (*Endpoint, error) {
+	return s.change(partnerID, id, func(ep *Endpoint) {
+		if active {
+			ep.Status = StatusActive
+			ep.ConsecutiveFailures = 0
+			ep.DisabledReason, ep.DisabledAt = "", time.Time{}
+		} else if ep.Status != StatusDisabled {
+			ep.Status = StatusDisabled
+			ep.DisabledReason, ep.DisabledAt = "disabled by the partner", s.now().UTC()
+		}
+	})
+}
+
+func (s *Service) change(partnerID, id string, fn func(ep *Endpoint)) (*Endpoint, error) {
+	var ep *Endpoint
+	err := s.store.Update(func(tx *store.Tx) error {
+		var err error
+		if ep, err = getEndpointTx(tx, partnerID, id); err != nil {
+			return err
+		}
+		fn(ep)
+		ep.UpdatedAt = s.now().UTC()
+		return tx.Put(endpointsBucket, ep.ID, ep)
+	})
+	return ep, err
+}
+
+// Delete removes an endpoint and cancels its pending deliveries; its
+// delivery log is kept.
+func (s *Service) Delete(partnerID, id string) error {
+	return s.store.Update(func(tx *store.Tx) error {
+		if _, err := getEndpointTx(tx, partnerID, id); err != nil {
+			return err
+		}
+		var pending []Delivery
+		err := tx.ForEach(deliveriesBucket, func(key string, raw json.RawMessage) error {
+			var d Delivery
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return fmt.Errorf("error decoding webhook delivery %s: %w", key, err)
+			}
+			if d.EndpointID == id && d.Status == DeliveryPending {
+				pending = append(pending, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		now := s.now().UTC()
+		for i := range pending {
+			pending[i].Status = DeliveryCancelled
+			pending[i].UpdatedAt = now
+			if err := tx.Put(deliveriesBucket, pending[i].ID, &pending[i]); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(endpointsBucket, id); err != nil {
+			return err
+		}
+		return tx.Delete(secretsBucket, id)
+	})
+}
+
+// RotateSecret replaces the signing secret of an endpoint and returns the
+// new one. Deliveries sent from then on are signed with it.
+func (s *Service) RotateSecret(partnerID, id string) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	err = s.store.Update(func(tx *store.Tx) error {
+		if _, err := getEndpointTx(tx, partnerID, id); err != nil {
+			return err
+		}
+		return tx.Put(secretsBucket, id, secret)
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func listEndpointsTx(tx *store.Tx, partnerID string) ([]Endpoint, error) {
+	list := []Endpoint{}
+	err := tx.ForEach(endpointsBucket, func(key string, raw json.RawMessage) error {
+		var ep Endpoint
+		if err := json.Unmarshal(raw, &ep); err != nil {
+			return fmt.Errorf("error decoding webhook endpoint %s: %w", key, err)
+		}
+		if partnerID == "" || ep.PartnerID == partnerID {
+			list = append(list, ep)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Endpoints returns the endpoints of partnerID, or of every partner when it
+// is empty, oldest first.
+func (s *Service) Endpoints(partnerID string) ([]Endpoint, error) {
+	var list []Endpoint
+	err := s.store.View(func(tx *store.Tx) error {
+		var err error
+		list, err = listEndpointsTx(tx, partnerID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Deliveries returns the delivery log of partnerID, newest first, limited to
+// one endpoint when endpointID is set and to limit entries when it is
+// positive.
+func (s *Service) Deliveries(partnerID, endpointID string, limit int) ([]Delivery, error) {
+	list := []Delivery{}
+	err := s.store.View(func(tx *store.Tx) error {
+		return tx.ForEach(deliveriesBucket, func(key string, raw json.RawMessage) error {
+			var d Delivery
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return fmt.Errorf("error decoding webhook delivery %s: %w", key, err)
+			}
+			if (partnerID == "" || d.PartnerID == partnerID) && (endpointID == "" || d.EndpointID == endpointID) {
+				list = append(list, d)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return len(list[i].ID) > len(list[j].ID) || (len(list[i].ID) == len(list[j].ID) && list[i].ID > list[j].ID)
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// Replay sends a delivery again, whatever became of it, as a new delivery
+// with the same payload.
+func (s *Service) Replay(partnerID, deliveryID string) (*Delivery, error) {
+	var replay *Delivery
+	err := s.store.Update(func(tx *store.Tx) error {
+		original, err := getDeliveryTx(tx, partnerID, deliveryID)
+		if err != nil {
+			return err
+		}
+		ep, err := getEndpointTx(tx, partnerID, original.EndpointID)
+		if err != nil {
+			return err
+		}
+		if ep.Status != StatusActive {
+			return fmt.Errorf("%w: enable %s before replaying to it", ErrEndpointDisabled, ep.ID)
+		}
+		replay, err = s.queueTx(tx, ep, original.EventID, original.Event, original.Payload)
+		if err != nil {
+			return err
+		}
+		replay.ReplayOf = original.ID
+		return tx.Put(deliveriesBucket, replay.ID, replay)
+	})
+	return replay, err
+}
+
+// queueTx records a pending delivery of payload to ep and queues the job
+// that sends it.
+func (s *Service) queueTx(tx *store.Tx, ep *Endpoint, eventID, event string, payload json.RawMessage) (*Delivery, error) {
+	seq, err := tx.NextSequence(deliveriesBucket)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	d := &Delivery{
+		ID:         fmt.Sprintf("dlv_%d", seq),
+		EndpointID: ep.ID,
+		PartnerID:  ep.PartnerID,
+		EventID:    eventID,
+		Event:      event,
+		Payload:    payload,
+		Status:     DeliveryPending,
+		Attempts:   []Attempt{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := tx.Insert(deliveriesBucket, d.ID, d); err != nil {
+		return nil, err
+	}
+	_, err = s.queue.EnqueueTx(tx, DeliverKind, d.ID, jobs.EnqueueOptions{UniqueKey: d.ID})
+	return d, err
+}
+
+// OnEvent is an events.Handler that queues a delivery of e to every active
+// endpoint of the partner it concerns that is subscribed to it. Events seen
+// before are not queued again.
+func (s *Service) OnEvent(ctx context.Context, e *events.Event) error {
+	name, ok := partnerEvents[e.Type]
+	if !ok {
+		return nil
+	}
+	data, partnerID, err := partnerData(e)
+	if err != nil {
+		return fmt.Errorf("%w: %v", jobs.ErrPermanent, err)
+	}
+	if partnerID == "" {
+		return nil
+	}
+	payload, err := json.Marshal(Payload{ID: e.ID, Event: name, CreatedAt: e.OccurredAt, Data: data})
+	if err != nil {
+		return fmt.Errorf("%w: error encoding %s payload: %v", jobs.ErrPermanent, name, err)
+	}
+
+	return s.store.Update(func(tx *store.Tx) error {
+		endpoints, err := listEndpointsTx(tx, partnerID)
+		if err != nil {
+			return err
+		}
+		for i := range endpoints {
+			ep := &endpoints[i]
+			key := e.ID + "|" + ep.ID
+			if ep.Status != StatusActive || !ep.wants(name) || tx.Exists(deliveryKeysBucket, key) {
+				continue
+			}
+			d, err := s.queueTx(tx, ep, e.ID, name, payload)
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(deliveryKeysBucket, key, d.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,3 +1,11 @@
+// storeSession keeps the ID token for API calls and, as a cookie, for the
+// server-rendered admin pages. ID tokens expire after an hour.
+function storeSession(idToken) {
+    localStorage.setItem('authToken', idToken);
+    const secure = window.location.protocol === 'https:' ? '; Secure' : '';
+    document.cookie = `authToken=${idToken}; Path=/admin; Max-Age=3600; SameSite=Strict${secure}`;
+}
+
 document.addEventListener('DOMContentLoaded', function() {
     const auth = firebase.auth();
     
@@ -27,8 +35,8 @@ document.addEventListener('DOMContentLoaded', function() {
                 });
                 
                 if (response.ok) {
-                    // Store the token in localStorage
-                    localStorage.setItem('authToken', idToken);
+                    // Store the token for later requests
+                    storeSession(idToken);
                     // Redirect to dashboard on success
                     window.location.href = '/dashboard';
                 } else {
@@ -88,7 +96,24 @@ document.addEventListener('DOMContentLoaded', function() {
                 const idToken = await user.getIdToken();
                 
                 // Store token
-                localStorage.setItem('authToken', idToken);
+                storeSession(idToken);
+
+                // Attribute the signup to the referrer, if a code was given
+                const referralCode = document.getElementById('referral-code').value.trim();
+                if (referralCode) {
+                    const response = await fetch('/api/referrals/attribute', {
+                        method: 'POST',
+                        headers: {
+                            'Content-Type': 'application/json',
+                            'Authorization': `Bearer ${idToken}`
+                        },
+                        body: JSON.stringify({ code: referralCode })
+                    });
+                    if (!response.ok) {
+                        const body = await response.json().catch(() => ({}));
+                        showNotification('error', body.error || 'Referral code could not be applied');
+                    }
+                }
                 
                 // Show success message
                 showNotification('success', 'Account created successfully!');
@@ -0,0 +1,78 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const rows = document.getElementById('reportRows');
+    const message = document.querySelector('.compliance-message');
+    const authHeaders = () => ({ 'Authorization': `Bearer ${localStorage.getItem('authToken')}` });
+
+    function showMessage(text, isError) {
+        message.textContent = text;
+        message.classList.toggle('error', isError);
+        message.hidden = false;
+    }
+
+    async function loadReports() {
+        try {
+            const response = await fetch('/api/admin/compliance/reports', { headers: authHeaders() });
+            if (!response.ok) {
+                rows.innerHTML = '<tr><td colspan="5">Only administrators can view compliance reports.</td></tr>';
+                return;
+            }
+            const data = await response.json();
+            if (data.reports.length === 0) {
+                rows.innerHTML = '<tr><td colspan="5">No reports have been generated yet.</td></tr>';
+                return;
+            }
+            rows.innerHTML = data.reports.map(report => `
+                <tr>
+                    <td>${report.label}</td>
+                    <td>${report.tonnes.toFixed(3)}</td>
+                    <td>${report.custody_percent.toFixed(1)}%</td>
+                    <td>${new Date(report.generated_at).toLocaleString()} by ${report.generated_by}</td>
+                    <td>
+                        ${['pdf', 'xlsx', 'csv'].map(format =>
+                            `<a href="/api/admin/compliance/reports/document?id=${report.id}&format=${format}" data-report-id="${report.id}" data-format="${format}">${format}</a>`
+                        ).join('')}
+                    </td>
+                </tr>
+            `).join('');
+        } catch (error) {
+            console.error('Compliance reports error:', error);
+        }
+    }
+    loadReports();
+
+    document.getElementById('generateForm').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const period = document.getElementById('period').value.trim();
+        const response = await fetch('/api/admin/compliance/reports', {
+            method: 'POST',
+            headers: { ...authHeaders(), 'Content-Type': 'application/json' },
+            body: JSON.stringify({ period })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            showMessage(data.error || 'Could not generate the report.', true);
+            return;
+        }
+        showMessage(`Generated the return for ${data.label}.`, false);
+        loadReports();
+    });
+
+    // Downloads need the auth header, so fetch them and save the blob
+    document.addEventListener('click', async (e) => {
+        const link = e.target.closest('a[data-report-id]');
+        if (!link) {
+            return;
+        }
+        e.preventDefault();
+        const response = await fetch(link.href, { headers: authHeaders() });
+        if (!response.ok) {
+            showMessage('Could not download the report.', true);
+            return;
+        }
+        const save = document.createElement('a');
+        save.href = URL.createObjectURL(await response.blob());
+        save.download = `ewaste-return-${link.dataset.reportId}.${link.dataset.format}`;
+        save.click();
+        setTimeout(() => URL.revokeObjectURL(save.href), 1000);
+    });
+});
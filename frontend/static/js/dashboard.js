@@ -287,6 +287,126 @@ document.addEventListener('DOMContentLoaded', function() {
         lastScrollTop = st <= 0 ? 0 : st;
     }, false);
 
+    // Show the materials and emissions the user's recycling has saved
+    async function loadImpact() {
+        const card = document.querySelector('.eco-impact-card');
+        if (!card) {
+            return;
+        }
+        try {
+            const response = await fetch('/api/impact', {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` }
+            });
+            if (!response.ok) {
+                return;
+            }
+            const { totals } = await response.json();
+            card.querySelector('[data-impact="co2e"]').textContent = formatKg(totals.co2e_kg);
+            card.querySelector('[data-impact="weight"]').textContent = formatKg(totals.weight_kg);
+
+            const rows = [
+                ['Copper recovered', totals.materials.copper],
+                ['Aluminium recovered', totals.materials.aluminium],
+                ['Plastics recovered', totals.materials.plastics],
+                ['Gold recovered', totals.materials.gold],
+                ['Lead kept out of landfill', totals.toxics.lead],
+                ['Mercury kept out of landfill', totals.toxics.mercury],
+                ['Cadmium kept out of landfill', totals.toxics.cadmium]
+            ].filter(([, kg]) => kg > 0);
+            const details = card.querySelector('.impact-details');
+            details.innerHTML = rows.map(([label, kg]) => `<li><span>${label}</span><span>${formatKg(kg)}</span></li>`).join('');
+            details.hidden = rows.length === 0;
+        } catch (error) {
+            console.error('Impact error:', error);
+        }
+    }
+
+    // Small quantities, such as the gold in a phone, read better in grams
+    function formatKg(kg) {
+        if (kg > 0 && kg < 1) {
+            return `${(kg * 1000).toLocaleString(undefined, { maximumFractionDigits: 2 })}g`;
+        }
+        return `${kg.toLocaleString(undefined, { maximumFractionDigits: 1 })}kg`;
+    }
+    loadImpact();
+
+    // List invoices and credit notes for paid services
+    async function loadInvoices() {
+        const section = document.querySelector('.invoices-section');
+        if (!section) {
+            return;
+        }
+        try {
+            const response = await fetch('/api/invoices', {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` }
+            });
+            if (!response.ok) {
+                return;
+            }
+            const data = await response.json();
+            if (data.invoices.length === 0) {
+                return;
+            }
+            section.querySelector('.invoice-list').innerHTML = data.invoices.map(invoice => `
+                <li class="invoice-item">
+                    <span>${invoice.number}</span>
+                    <span>${new Date(invoice.issued_at).toLocaleDateString()}</span>
+                    <span>${invoice.currency} ${(invoice.total / 100).toLocaleString(undefined, { minimumFractionDigits: 2 })}</span>
+                    <a href="/api/invoices/document?id=${invoice.id}&format=pdf" data-invoice-id="${invoice.id}">PDF</a>
+                </li>
+            `).join('');
+            section.hidden = false;
+        } catch (error) {
+            console.error('Invoices error:', error);
+        }
+    }
+    loadInvoices();
+
+    // PDF links need the auth header, so download them through fetch
+    document.addEventListener('click', async (e) => {
+        const link = e.target.closest('a[data-invoice-id]');
+        if (!link) {
+            return;
+        }
+        e.preventDefault();
+        const response = await fetch(link.href, {
+            headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` }
+        });
+        if (response.ok) {
+            window.open(URL.createObjectURL(await response.blob()));
+        }
+    });
+
+    // Rating links in follow-up messages open the dashboard with ?rate=<pickup id>
+    async function ratePickup() {
+        const pickupId = new URLSearchParams(window.location.search).get('rate');
+        if (!pickupId) {
+            return;
+        }
+        const answer = prompt(`How would you rate pickup ${pickupId}, from 1 (poor) to 5 (excellent)?`);
+        const score = parseInt(answer, 10);
+        if (!(score >= 1 && score <= 5)) {
+            return;
+        }
+        const comment = prompt('Anything you would like to tell us? (optional)') || '';
+        try {
+            const response = await fetch('/api/pickups/rating', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${localStorage.getItem('authToken')}`
+                },
+                body: JSON.stringify({ pickup_id: pickupId, score, comment })
+            });
+            const body = await response.json().catch(() => ({}));
+            alert(response.ok ? 'Thank you for your feedback!' : (body.error || 'Could not save your rating'));
+        } catch (error) {
+            console.error('Rating error:', error);
+        }
+        history.replaceState(null, '', window.location.pathname + window.location.hash);
+    }
+    ratePickup();
+
     document.querySelector('.schedule-btn').addEventListener('click', function() {
         window.location.href = 'schedule-pickup.html';
     });
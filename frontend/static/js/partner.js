@@ -0,0 +1,223 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const endpointRows = document.getElementById('endpointRows');
+    const deliveryRows = document.getElementById('deliveryRows');
+    const keyRows = document.getElementById('keyRows');
+    const message = document.querySelector('.partner-message');
+    const authHeaders = () => ({ 'Authorization': `Bearer ${localStorage.getItem('authToken')}` });
+    const escape = (text) => String(text ?? '').replace(/[&<>"']/g, c => `&#${c.charCodeAt(0)};`);
+
+    function showMessage(text, isError) {
+        message.textContent = text;
+        message.classList.toggle('error', isError);
+        message.hidden = false;
+    }
+
+    async function call(url, options = {}) {
+        const response = await fetch(url, {
+            ...options,
+            headers: { ...authHeaders(), 'Content-Type': 'application/json' }
+        });
+        const data = response.status === 204 ? {} : await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || 'The request failed.');
+        }
+        return data;
+    }
+
+    async function loadEndpoints() {
+        try {
+            const data = await call('/api/partner/webhooks');
+            document.getElementById('eventChoices').innerHTML = data.events.map(event =>
+                `<label><input type="checkbox" name="events" value="${escape(event)}" checked> ${escape(event)}</label>`
+            ).join('');
+            if (data.endpoints.length === 0) {
+                endpointRows.innerHTML = '<tr><td colspan="4">No endpoints yet.</td></tr>';
+                return;
+            }
+            endpointRows.innerHTML = data.endpoints.map(endpoint => `
+                <tr>
+                    <td>${escape(endpoint.url)}<br><small>${escape(endpoint.id)}</small></td>
+                    <td>${endpoint.events.map(escape).join('<br>')}</td>
+                    <td>${escape(endpoint.status)}${endpoint.disabled_reason ? `<br><small>${escape(endpoint.disabled_reason)}</small>` : ''}</td>
+                    <td>
+                        <button data-toggle="${escape(endpoint.id)}" data-active="${endpoint.status !== 'active'}">${endpoint.status === 'active' ? 'Disable' : 'Enable'}</button>
+                        <button data-rotate="${escape(endpoint.id)}" class="secondary">New secret</button>
+                        <button data-remove="${escape(endpoint.id)}" class="secondary">Remove</button>
+                    </td>
+                </tr>
+            `).join('');
+        } catch (error) {
+            endpointRows.innerHTML = `<tr><td colspan="4">${escape(error.message)}</td></tr>`;
+        }
+    }
+
+    async function loadDeliveries() {
+        try {
+            const data = await call('/api/partner/webhooks/deliveries?limit=50');
+            if (data.deliveries.length === 0) {
+                deliveryRows.innerHTML = '<tr><td colspan="6">Nothing has been sent yet.</td></tr>';
+                return;
+            }
+            deliveryRows.innerHTML = data.deliveries.map(delivery => {
+                const last = delivery.attempts[delivery.attempts.length - 1];
+                const response = last ? (last.error || `HTTP ${last.status_code}`) : 'Not sent yet';
+                return `
+                    <tr>
+                        <td>${new Date(delivery.created_at).toLocaleString()}</td>
+                        <td>${escape(delivery.event)}<br><small>${escape(delivery.event_id)}</small></td>
+                        <td>${escape(delivery.endpoint_id)}</td>
+                        <td>${escape(delivery.status)} (${delivery.attempts.length} attempts)</td>
+                        <td>${escape(response)}</td>
+                        <td><button data-replay="${escape(delivery.id)}">Replay</button></td>
+                    </tr>
+                `;
+            }).join('');
+        } catch (error) {
+            deliveryRows.innerHTML = `<tr><td colspan="6">${escape(error.message)}</td></tr>`;
+        }
+    }
+
+    async function loadKeys() {
+        try {
+            const data = await call('/api/partner/keys');
+            document.getElementById('scopeChoices').innerHTML = data.scopes.map(scope =>
+                `<label><input type="checkbox" name="scopes" value="${escape(scope)}" checked> ${escape(scope)}</label>`
+            ).join('');
+            if (data.keys.length === 0) {
+                keyRows.innerHTML = '<tr><td colspan="6">No keys yet.</td></tr>';
+                return;
+            }
+            keyRows.innerHTML = data.keys.map(key => {
+                const lastUsed = key.last_used_at && !key.last_used_at.startsWith('0001') ? new Date(key.last_used_at).toLocaleString() : 'Never';
+                const active = key.status === 'active';
+                return `
+                    <tr>
+                        <td>${escape(key.name)}<br><small>${escape(key.hint)} &middot; ${escape(key.id)}</small></td>
+                        <td>${key.scopes.map(escape).join('<br>')}</td>
+                        <td>${key.rate_limit}/min</td>
+                        <td>${escape(key.status)}${active ? `<br><small>until ${new Date(key.expires_at).toLocaleDateString()}</small>` : ''}</td>
+                        <td>${lastUsed}</td>
+                        <td>${active ? `${key.replaced_by ? '' : `
+                            <button data-rotate-key="${escape(key.id)}">Rotate</button>`}
+                            <button data-revoke-key="${escape(key.id)}" class="secondary">Revoke</button>` : ''}
+                        </td>
+                    </tr>
+                `;
+            }).join('');
+        } catch (error) {
+            keyRows.innerHTML = `<tr><td colspan="6">${escape(error.message)}</td></tr>`;
+        }
+    }
+
+    function showSecret(id, secret) {
+        document.getElementById('secretFor').textContent = id;
+        document.getElementById('secretValue').textContent = secret;
+        document.getElementById('webhookSecret').hidden = false;
+    }
+
+    function showKey(id, secret) {
+        document.getElementById('keyFor').textContent = id;
+        document.getElementById('keyValue').textContent = secret;
+        document.getElementById('keySecret').hidden = false;
+    }
+
+    document.getElementById('endpointForm').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const events = [...document.querySelectorAll('input[name="events"]:checked')].map(input => input.value);
+        try {
+            const data = await call('/api/partner/webhooks', {
+                method: 'POST',
+                body: JSON.stringify({ url: document.getElementById('endpointURL').value.trim(), events })
+            });
+            showSecret(data.endpoint.id, data.secret);
+            e.target.reset();
+            loadEndpoints();
+        } catch (error) {
+            showMessage(error.message, true);
+        }
+    });
+
+    document.getElementById('keyForm').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const scopes = [...document.querySelectorAll('input[name="scopes"]:checked')].map(input => input.value);
+        try {
+            const data = await call('/api/partner/keys', {
+                method: 'POST',
+                body: JSON.stringify({
+                    name: document.getElementById('keyName').value.trim(),
+                    scopes,
+                    rate_limit: Number(document.getElementById('keyRateLimit').value),
+                    expires_in_days: Number(document.getElementById('keyExpires').value)
+                })
+            });
+            showKey(data.key.id, data.secret);
+            e.target.reset();
+            loadKeys();
+        } catch (error) {
+            showMessage(error.message, true);
+        }
+    });
+
+    document.addEventListener('click', async (e) => {
+        const keyButton = e.target.closest('button[data-rotate-key], button[data-revoke-key]');
+        if (keyButton) {
+            try {
+                if (keyButton.dataset.rotateKey) {
+                    const data = await call('/api/partner/keys/rotate', {
+                        method: 'POST',
+                        body: JSON.stringify({ id: keyButton.dataset.rotateKey })
+                    });
+                    showKey(data.key.id, data.secret);
+                } else {
+                    if (!confirm('Revoke this key? Systems using it will stop working at once.')) {
+                        return;
+                    }
+                    await call(`/api/partner/keys?id=${encodeURIComponent(keyButton.dataset.revokeKey)}`, { method: 'DELETE' });
+                }
+                loadKeys();
+            } catch (error) {
+                showMessage(error.message, true);
+            }
+            return;
+        }
+
+        const button = e.target.closest('button[data-toggle], button[data-rotate], button[data-remove], button[data-replay]');
+        if (!button) {
+            return;
+        }
+        try {
+            if (button.dataset.toggle) {
+                await call('/api/partner/webhooks', {
+                    method: 'PUT',
+                    body: JSON.stringify({ id: button.dataset.toggle, active: button.dataset.active === 'true' })
+                });
+                loadEndpoints();
+            } else if (button.dataset.rotate) {
+                const data = await call('/api/partner/webhooks/secret', {
+                    method: 'POST',
+                    body: JSON.stringify({ id: button.dataset.rotate })
+                });
+                showSecret(data.id, data.secret);
+            } else if (button.dataset.remove) {
+                if (!confirm('Remove this endpoint? Pending deliveries to it will be cancelled.')) {
+                    return;
+                }
+                await call(`/api/partner/webhooks?id=${encodeURIComponent(button.dataset.remove)}`, { method: 'DELETE' });
+                loadEndpoints();
+            } else {
+                await call('/api/partner/webhooks/replay', {
+                    method: 'POST',
+                    body: JSON.stringify({ delivery_id: button.dataset.replay })
+                });
+                showMessage('Delivery queued to be sent again.', false);
+                loadDeliveries();
+            }
+        } catch (error) {
+            showMessage(error.message, true);
+        }
+    });
+
+    loadEndpoints();
+    loadKeys();
+    loadDeliveries();
+});
@@ -1,7 +1,7 @@
 document.addEventListener('DOMContentLoaded', function() {
     // Initialize filter buttons
     const filterButtons = document.querySelectorAll('.filter-btn');
-    const rewardCards = document.querySelectorAll('.reward-card');
+    const rewardsGrid = document.querySelector('.rewards-grid');
 
     // Filter functionality
     filterButtons.forEach(button => {
@@ -14,7 +14,7 @@ document.addEventListener('DOMContentLoaded', function() {
             const filter = button.dataset.filter;
             
             // Filter reward cards
-            rewardCards.forEach(card => {
+            document.querySelectorAll('.reward-card').forEach(card => {
                 if (filter === 'all' || card.dataset.category === filter) {
                     card.style.display = 'block';
                 } else {
@@ -24,111 +24,120 @@ document.addEventListener('DOMContentLoaded', function() {
         });
     });
 
+    // Render the reward catalogue served by the API
+    async function loadCatalogue() {
+        try {
+            const data = await apiFetch('/api/rewards/catalogue');
+            rewardsGrid.innerHTML = data.rewards.map(reward => `
+                <div class="reward-card" data-category="${reward.category}" data-reward-id="${reward.id}">
+                    <div class="reward-image">
+                        <img src="${reward.image}" alt="${reward.name}">
+                        <span class="points-required">${reward.points_cost} points</span>
+                    </div>
+                    <div class="reward-info">
+                        <h3>${reward.name}</h3>
+                        <p>${reward.description}</p>
+                        <button class="redeem-btn" ${reward.stock > 0 ? '' : 'disabled'}>
+                            ${reward.stock > 0 ? 'Redeem Reward' : 'Out of Stock'}
+                        </button>
+                    </div>
+                </div>
+            `).join('');
+        } catch (error) {
+            console.error('Catalogue error:', error);
+        }
+    }
+
     // Redeem button functionality
-    const redeemButtons = document.querySelectorAll('.redeem-btn');
-    redeemButtons.forEach(button => {
-        button.addEventListener('click', function(e) {
-            const card = this.closest('.reward-card');
-            const pointsRequired = parseInt(card.querySelector('.points-required').textContent);
-            const currentPoints = parseInt(document.querySelector('.points-value').textContent);
-
-            if (currentPoints >= pointsRequired) {
-                if (confirm('Are you sure you want to redeem this reward?')) {
-                    // Simulate redemption
-                    showNotification('success', 'Reward redeemed successfully!');
-                    // Update points
-                    document.querySelector('.points-value').textContent = 
-                        (currentPoints - pointsRequired).toLocaleString();
-                    // Add to redemption history
-                    addToHistory(card.querySelector('h3').textContent, pointsRequired);
-                }
-            } else {
-                showNotification('error', 'Not enough points to redeem this reward');
+    rewardsGrid.addEventListener('click', async function(e) {
+        const button = e.target.closest('.redeem-btn');
+        if (!button) {
+            return;
+        }
+        const card = button.closest('.reward-card');
+        if (!confirm('Are you sure you want to redeem this reward?')) {
+            return;
+        }
+
+        button.disabled = true;
+        try {
+            const redemption = await apiFetch('/api/rewards/redeem', {
+                method: 'POST',
+                body: JSON.stringify({
+                    reward_id: card.dataset.rewardId,
+                    idempotency_key: crypto.randomUUID()
+                })
+            });
+            showNotification('success', `Reward redeemed! Voucher code: ${redemption.voucher_code}`);
+            loadBalance();
+            loadCatalogue();
+            populateHistoryTable();
+        } catch (error) {
+            showNotification('error', error.message);
+        } finally {
+            button.disabled = false;
+        }
+    });
+
+    // Authenticated request to the rewards API
+    async function apiFetch(url, options = {}) {
+        const token = localStorage.getItem('authToken');
+        const response = await fetch(url, {
+            ...options,
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${token}`,
+                ...(options.headers || {})
             }
         });
-    });
+        const body = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            throw new Error(body.error || 'Request failed');
+        }
+        return body;
+    }
 
-    // Populate initial redemption history
-    const mockHistoryData = [
-        {
-            date: '2024-03-15',
-            reward: 'Shopping Voucher',
-            points: 500,
-            status: 'completed',
-            details: 'Eco-Store Gift Card'
-        },
-        {
-            date: '2024-03-10',
-            reward: 'Premium Pickup Service',
-            points: 1000,
-            status: 'active',
-            details: 'Valid until April 10, 2024'
-        },
-        {
-            date: '2024-02-28',
-            reward: 'Reusable Eco Bag Set',
-            points: 200,
-            status: 'shipped',
-            details: 'Tracking: KE123456789'
-        },
-        {
-            date: '2024-02-15',
-            reward: 'Tree Planting Initiative',
-            points: 300,
-            status: 'completed',
-            details: 'Tree planted in Karura Forest'
-        },
-        {
-            date: '2024-02-01',
-            reward: 'Solar Power Bank',
-            points: 800,
-            status: 'processing',
-            details: 'Preparing for shipment'
+    // Load the points balance from the server-side ledger
+    async function loadBalance() {
+        try {
+            const data = await apiFetch('/api/rewards/balance');
+            document.querySelector('.points-value').textContent = data.balance.toLocaleString();
+        } catch (error) {
+            console.error('Balance error:', error);
         }
-    ];
+    }
 
-    // Populate history table with mock data
-    function populateHistoryTable() {
+    // Populate history table from the ledger entries
+    async function populateHistoryTable() {
         const tbody = document.getElementById('redemptionHistory');
-        tbody.innerHTML = mockHistoryData.map(item => `
-            <tr>
-                <td>${formatDate(item.date)}</td>
-                <td>
-                    <div class="reward-info-cell">
-                        <span class="reward-name">${item.reward}</span>
-                        <span class="reward-details">${item.details}</span>
-                    </div>
-                </td>
-                <td>
-                    <span class="points-cell">
-                        <i class="fas fa-star"></i>
-                        ${item.points}
-                    </span>
-                </td>
-                <td>
-                    <span class="status-badge ${item.status}">
-                        ${capitalizeFirst(item.status)}
-                    </span>
-                </td>
-                <td>
-                    <div class="action-buttons">
-                        <button class="action-btn view" onclick="viewRewardDetails('${item.reward}')">
-                            <i class="fas fa-eye"></i> View
-                        </button>
-                        ${item.status === 'shipped' ? `
-                            <button class="action-btn track" onclick="trackShipment('${item.details.split(': ')[1]}')">
-                                <i class="fas fa-truck"></i> Track
-                            </button>
-                        ` : ''}
-                        ${item.status === 'completed' ? `
-                            <button class="action-btn review" onclick="addReview('${item.reward}')">
-                                <i class="fas fa-star"></i> Review
-                            </button>
-                        ` : ''}
-                    </div>
-                </td>
-            </tr>
-        `).join('');
+        try {
+            const data = await apiFetch('/api/rewards/history?page=1&page_size=20');
+            tbody.innerHTML = data.entries.map(entry => `
+                <tr>
+                    <td>${formatDate(entry.created_at)}</td>
+                    <td>
+                        <div class="reward-info-cell">
+                            <span class="reward-name">${capitalizeFirst(entry.reason)}</span>
+                            <span class="reward-details">${entry.reference || ''}</span>
+                        </div>
+                    </td>
+                    <td>
+                        <span class="points-cell">
+                            <i class="fas fa-star"></i>
+                            ${entry.direction === 'debit' ? '-' : '+'}${entry.points}
+                        </span>
+                    </td>
+                    <td>
+                        <span class="status-badge completed">
+                            Completed
+                        </span>
+                    </td>
+                    <td></td>
+                </tr>
+            `).join('');
+        } catch (error) {
+            console.error('History error:', error);
+        }
     }
 
     // Helper functions
@@ -141,46 +150,11 @@ document.addEventListener('DOMContentLoaded', function() {
         return string.charAt(0).toUpperCase() + string.slice(1);
     }
 
-    // Initialize history table
+    // Initialize catalogue, balance and history table
+    loadCatalogue();
+    loadBalance();
     populateHistoryTable();
 
-    // Add to existing addToHistory function
-    function addToHistory(rewardName, points) {
-        const tbody = document.getElementById('redemptionHistory');
-        const date = new Date().toLocaleDateString();
-        
-        const tr = document.createElement('tr');
-        tr.innerHTML = `
-            <td>${formatDate(date)}</td>
-            <td>
-                <div class="reward-info-cell">
-                    <span class="reward-name">${rewardName}</span>
-                    <span class="reward-details">Newly redeemed reward</span>
-                </div>
-            </td>
-            <td>
-                <span class="points-cell">
-                    <i class="fas fa-star"></i>
-                    ${points}
-                </span>
-            </td>
-            <td>
-                <span class="status-badge processing">
-                    Processing
-                </span>
-            </td>
-            <td>
-                <div class="action-buttons">
-                    <button class="action-btn view" onclick="viewRewardDetails('${rewardName}')">
-                        <i class="fas fa-eye"></i> View
-                    </button>
-                </div>
-            </td>
-        `;
-        
-        tbody.insertBefore(tr, tbody.firstChild);
-    }
-
     // Add these styles to your rewards.css
     const additionalStyles = `
         /* Redemption History Table Styles */
@@ -13,10 +13,127 @@ document.addEventListener('DOMContentLoaded', function() {
     maxDate.setDate(maxDate.getDate() + 30);
     pickupDateInput.max = maxDate.toISOString().split('T')[0];
 
-    // Update pricing based on waste type
+    // Update pricing and handling advice based on waste type
+    const wasteSubtypeSelect = document.getElementById('wasteSubtype');
+    const handlingNote = document.querySelector('.handling-note');
+    let categories = [];
+    let hazardNames = {};
+
     wasteTypeSelect.addEventListener('change', function() {
+        showSubtypes(this.value);
         updatePricing(this.value);
     });
+    wasteSubtypeSelect.addEventListener('change', showHandling);
+
+    // Replace the built-in list with the categories we currently collect
+    loadCategories();
+
+    async function loadCategories() {
+        try {
+            const response = await fetch('/api/items/categories', {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` }
+            });
+            if (!response.ok) {
+                return;
+            }
+            const data = await response.json();
+            categories = data.categories;
+            hazardNames = data.hazards;
+            wasteTypeSelect.length = 1;
+            categories.forEach(category => {
+                wasteTypeSelect.add(new Option(category.name, category.id));
+            });
+        } catch (error) {
+            // Keep the built-in list
+        }
+    }
+
+    function showSubtypes(categoryId) {
+        const category = categories.find(c => c.id === categoryId);
+        wasteSubtypeSelect.length = 1;
+        (category ? category.subcategories : []).forEach(sub => {
+            wasteSubtypeSelect.add(new Option(sub.name, sub.id));
+        });
+        wasteSubtypeSelect.hidden = wasteSubtypeSelect.length === 1;
+        showHandling();
+    }
+
+    function showHandling() {
+        const category = categories.find(c => c.id === wasteTypeSelect.value);
+        if (!category) {
+            handlingNote.hidden = true;
+            return;
+        }
+        const sub = category.subcategories.find(s => s.id === wasteSubtypeSelect.value) || {};
+        const hazards = (sub.hazards && sub.hazards.length ? sub.hazards : category.hazards) || [];
+        handlingNote.textContent = sub.handling || category.handling;
+        if (hazards.length) {
+            handlingNote.textContent += ` Contains: ${hazards.map(h => hazardNames[h] || h).join('; ')}.`;
+        }
+        handlingNote.classList.toggle('hazardous', hazards.length > 0);
+        handlingNote.hidden = false;
+    }
+
+    // Pin the pickup to the device's coordinates so we can check the service area
+    const locateBtn = document.querySelector('.locate-btn');
+    const locationStatus = document.querySelector('.location-status');
+    if (locateBtn && navigator.geolocation) {
+        locateBtn.addEventListener('click', () => {
+            locationStatus.textContent = 'Locating...';
+            navigator.geolocation.getCurrentPosition(position => {
+                document.getElementById('latitude').value = position.coords.latitude;
+                document.getElementById('longitude').value = position.coords.longitude;
+                locationStatus.textContent = 'Location captured';
+            }, () => {
+                locationStatus.textContent = 'Could not get your location';
+            });
+        });
+    }
+
+    // Suggest known places as the address is typed and pin the pickup to the one chosen
+    const addressInput = document.getElementById('address');
+    const suggestions = document.querySelector('.address-suggestions');
+    let suggestTimer;
+    addressInput.addEventListener('input', () => {
+        clearTimeout(suggestTimer);
+        const query = addressInput.value.trim();
+        if (query.length < 2) {
+            suggestions.hidden = true;
+            return;
+        }
+        suggestTimer = setTimeout(() => suggestAddresses(query), 250);
+    });
+
+    async function suggestAddresses(query) {
+        try {
+            const response = await fetch(`/api/geocode/autocomplete?q=${encodeURIComponent(query)}&limit=6`, {
+                headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` }
+            });
+            if (!response.ok) {
+                return;
+            }
+            const { candidates } = await response.json();
+            suggestions.innerHTML = '';
+            candidates.forEach(candidate => {
+                const item = document.createElement('li');
+                item.textContent = candidate.label;
+                const kind = document.createElement('small');
+                kind.textContent = candidate.kind;
+                item.appendChild(kind);
+                item.addEventListener('click', () => {
+                    addressInput.value = candidate.label;
+                    document.getElementById('latitude').value = candidate.location.lat;
+                    document.getElementById('longitude').value = candidate.location.lng;
+                    locationStatus.textContent = `Pinned to ${candidate.name}`;
+                    suggestions.hidden = true;
+                });
+                suggestions.appendChild(item);
+            });
+            suggestions.hidden = candidates.length === 0;
+        } catch (error) {
+            suggestions.hidden = true;
+        }
+    }
 
     // Form submission
     scheduleForm.addEventListener('submit', function(e) {
@@ -25,6 +142,7 @@ document.addEventListener('DOMContentLoaded', function() {
         // Collect form data
         const formData = {
             wasteType: wasteTypeSelect.value,
+            wasteSubtype: wasteSubtypeSelect.value,
             quantity: document.getElementById('quantity').value,
             pickupDate: pickupDateInput.value,
             pickupTime: document.getElementById('pickupTime').value,
@@ -51,6 +169,7 @@ document.addEventListener('DOMContentLoaded', function() {
         'appliances': 1.5,
         'computers': 2.5,
         'phones': 4,
+        'crt_monitors': 3,
         'other': 2
     };
 
@@ -162,26 +281,80 @@ document.addEventListener('DOMContentLoaded', function() {
         submitBtn.classList.add('loading');
         submitBtn.disabled = true;
 
-        // Simulate API call
-        setTimeout(() => {
-            console.log('Pickup scheduled:', data);
-            submitBtn.classList.remove('loading');
-            showSuccess('Pickup scheduled successfully!');
-            
-            // Store in localStorage for history
-            const pickups = JSON.parse(localStorage.getItem('pickups') || '[]');
-            pickups.push({
-                ...data,
-                id: Date.now(),
-                status: 'scheduled'
+        const payload = {
+            address: data.address,
+            date: data.pickupDate,
+            time_slot: data.pickupTime,
+            notes: data.notes,
+            items: [{
+                category: data.wasteType,
+                subcategory: data.wasteSubtype || undefined,
+                condition: data.manufacturer.condition,
+                quantity: parseInt(data.quantity, 10),
+                manufacturer: data.manufacturer.name,
+                model: data.manufacturer.model,
+                year: data.manufacturer.year
+            }]
+        };
+
+        const latitude = parseFloat(document.getElementById('latitude').value);
+        const longitude = parseFloat(document.getElementById('longitude').value);
+        if (!isNaN(latitude) && !isNaN(longitude)) {
+            payload.location = { lat: latitude, lng: longitude };
+        }
+
+        fetch('/api/pickups', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${localStorage.getItem('authToken')}`
+            },
+            body: JSON.stringify(payload)
+        })
+            .then(async response => {
+                const body = await response.json().catch(() => ({}));
+                if (response.status === 422 && payload.location &&
+                    confirm(`${body.error}. Join the waitlist to hear when we start collecting here?`)) {
+                    await joinWaitlist(payload.address, payload.location);
+                    return;
+                }
+                if (!response.ok) {
+                    throw new Error(body.error || 'Could not schedule pickup');
+                }
+                if (body.area_warning) {
+                    showSuccess(`Pickup scheduled, but ${body.area_warning}. We will confirm by email and SMS once our team has checked the location.`);
+                } else {
+                    showSuccess('Pickup scheduled! We will send your confirmation by email and SMS.');
+                }
+
+                // Redirect after success
+                setTimeout(() => {
+                    window.location.href = '/dashboard#pickups';
+                }, 2000);
+            })
+            .catch(error => {
+                console.error('Pickup error:', error);
+                showError(error.message);
+            })
+            .finally(() => {
+                submitBtn.classList.remove('loading');
+                submitBtn.disabled = false;
             });
-            localStorage.setItem('pickups', JSON.stringify(pickups));
+    }
 
-            // Redirect after success
-            setTimeout(() => {
-                window.location.href = 'dashboard-user.html#pickups';
-            }, 2000);
-        }, 1500);
+    async function joinWaitlist(address, location) {
+        const response = await fetch('/api/service-areas/waitlist', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${localStorage.getItem('authToken')}`
+            },
+            body: JSON.stringify({ address, location })
+        });
+        if (!response.ok) {
+            throw new Error('Could not join the waitlist');
+        }
+        showSuccess("You're on the waitlist. We'll let you know when pickups reach your area.");
     }
 
     // Add touch feedback for mobile